@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	_ "time/tzdata" // test availability windows are set in a timezone, and the image has no zoneinfo
 
 	"my-app/internal/database"
 	"my-app/internal/server"
@@ -31,6 +33,11 @@ func main() {
 	// Create and configure the server
 	srv := server.NewServer(db)
 
+	// Run background jobs until shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.RunBackgroundJobs(ctx)
+
 	// Set up graceful shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
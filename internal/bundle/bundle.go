@@ -0,0 +1,216 @@
+// Package bundle reads a zip archive of many tests for import at once: a
+// manifest listing the tests' JSON files, written in the upload schema, with
+// the images their questions refer to by relative path and their notes.
+//
+// The manifest, manifest.json at the top of the archive or of its only
+// folder, lists each test's file and, optionally, its notes:
+//
+//	{
+//	  "schema_version": 1,
+//	  "tests": [
+//	    {"file": "algebra/test.json", "notes": "algebra/notes.pdf"},
+//	    {"file": "geometry.json"}
+//	  ]
+//	}
+//
+// An image_url or explanation_image_url that is a relative path names an
+// image in the archive, relative to the test's file.
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"my-app/internal/models"
+)
+
+const (
+	// MaxBundleSize is the largest archive accepted for import
+	MaxBundleSize = 200 << 20
+	// MaxFileSize is the largest file read from an archive
+	MaxFileSize = 50 << 20
+	// MaxTests is the most tests one manifest may list
+	MaxTests = 500
+)
+
+// ManifestName is the name of the manifest file
+const ManifestName = "manifest.json"
+
+// Bundle is an archive whose manifest has been read. Its tests are read one
+// at a time with Test, so an archive of many tests is never held unpacked.
+type Bundle struct {
+	Entries []Entry // the tests the manifest lists, in order
+
+	files map[string]*zip.File
+	base  string // the folder the manifest is in, which its paths are relative to
+}
+
+// Entry is a test the manifest lists
+type Entry struct {
+	File  string `json:"file"`
+	Notes string `json:"notes,omitempty"`
+}
+
+// manifest is the content of manifest.json
+type manifest struct {
+	SchemaVersion int     `json:"schema_version"`
+	Tests         []Entry `json:"tests"`
+}
+
+// Test is a test read from the archive, as an upload to validate and persist.
+// Problem says why it could not be read, when it could not.
+type Test struct {
+	Entry   Entry
+	Upload  models.TestUpload
+	Images  map[string]File // the images the questions refer to, by the path written in the upload
+	Problem string
+}
+
+// File is a file read from the archive
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Read opens an archive and reads its manifest
+func Read(data []byte) (*Bundle, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("the file is not a zip archive")
+	}
+	b := &Bundle{files: make(map[string]*zip.File, len(archive.File))}
+	for _, f := range archive.File {
+		name := path.Clean(f.Name)
+		// Folders, and the resource forks macOS adds when zipping a folder
+		if f.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") {
+			continue
+		}
+		b.files[name] = f
+	}
+
+	// The manifest is at the top of the archive, or of its only folder
+	manifestPath := ManifestName
+	if _, ok := b.files[manifestPath]; !ok {
+		for name := range b.files {
+			if path.Base(name) == ManifestName && strings.Count(name, "/") == 1 {
+				manifestPath = name
+			}
+		}
+	}
+	raw, err := b.open(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading the manifest: %w", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("reading the manifest: %v", err)
+	}
+	if m.SchemaVersion > models.UploadSchemaVersion {
+		return nil, fmt.Errorf("the manifest's schema_version %d is newer than this server reads (%d)", m.SchemaVersion, models.UploadSchemaVersion)
+	}
+	if len(m.Tests) == 0 {
+		return nil, errors.New("the manifest lists no tests")
+	}
+	if len(m.Tests) > MaxTests {
+		return nil, fmt.Errorf("the manifest lists %d tests, more than the %d one archive may hold", len(m.Tests), MaxTests)
+	}
+	for i, e := range m.Tests {
+		if strings.TrimSpace(e.File) == "" {
+			return nil, fmt.Errorf("test %d in the manifest has no file", i+1)
+		}
+	}
+
+	b.Entries = m.Tests
+	b.base = path.Dir(manifestPath)
+	return b, nil
+}
+
+// Test reads the test of the manifest's entry i, with the images its
+// questions refer to and the notes the manifest gives it, which replace any
+// the test's file carries itself
+func (b *Bundle) Test(i int) Test {
+	t := Test{Entry: b.Entries[i], Images: make(map[string]File)}
+	file := path.Join(b.base, t.Entry.File)
+
+	raw, err := b.open(file)
+	if err != nil {
+		t.Problem = err.Error()
+		return t
+	}
+	if err := json.Unmarshal(raw, &t.Upload); err != nil {
+		t.Problem = fmt.Sprintf("%s is not a test in the upload schema: %v", t.Entry.File, err)
+		return t
+	}
+
+	var missing []string
+	for _, q := range t.Upload.Questions {
+		for _, ref := range []string{q.ImageURL, q.ExplanationImageURL} {
+			if _, done := t.Images[ref]; done || !IsArchivePath(ref) {
+				continue
+			}
+			name := path.Join(path.Dir(file), ref)
+			data, err := b.open(name)
+			if err != nil {
+				missing = append(missing, err.Error())
+				continue
+			}
+			t.Images[ref] = File{Name: path.Base(name), Data: data}
+		}
+	}
+	if len(missing) > 0 {
+		t.Problem = strings.Join(missing, "; ")
+		return t
+	}
+
+	if t.Entry.Notes != "" {
+		name := path.Join(b.base, t.Entry.Notes)
+		data, err := b.open(name)
+		if err != nil {
+			t.Problem = err.Error()
+			return t
+		}
+		t.Upload.Notes = &models.FileUpload{Filename: path.Base(name), Data: data}
+	}
+	return t
+}
+
+// IsArchivePath reports whether an image reference is a path within the
+// archive rather than a link, a data URL or a path on this server
+func IsArchivePath(ref string) bool {
+	return ref != "" && !strings.HasPrefix(ref, "/") && !strings.HasPrefix(ref, "data:") && !strings.Contains(ref, "://")
+}
+
+func (b *Bundle) open(name string) ([]byte, error) {
+	f, ok := b.files[path.Clean(name)]
+	if !ok {
+		return nil, fmt.Errorf("%s is not in the archive", b.relative(name))
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, MaxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", b.relative(name), err)
+	}
+	if len(data) > MaxFileSize {
+		return nil, fmt.Errorf("%s is larger than %d MB", b.relative(name), MaxFileSize>>20)
+	}
+	return data, nil
+}
+
+// relative names a file as the manifest would, relative to its folder
+func (b *Bundle) relative(name string) string {
+	name = path.Clean(name)
+	if b.base != "" && b.base != "." {
+		name = strings.TrimPrefix(name, b.base+"/")
+	}
+	return name
+}
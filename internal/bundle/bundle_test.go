@@ -0,0 +1,114 @@
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// archive zips the files given by name
+func archive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const algebra = `{
+  "title": "Algebra",
+  "questions": [
+    {"question_text": "x + 1 = 2", "options": ["1", "2"], "correct_index": 0, "points": 1, "image_url": "images/line.png"},
+    {"question_text": "2x = 4", "options": ["2", "4"], "correct_index": 0, "points": 1,
+     "image_url": "https://example.com/a.png", "explanation_image_url": "images/line.png"}
+  ]
+}`
+
+func TestRead(t *testing.T) {
+	data := archive(t, map[string]string{
+		"maths/manifest.json": `{"schema_version": 1, "tests": [
+			{"file": "algebra/test.json", "notes": "notes/algebra.pdf"},
+			{"file": "missing.json"},
+			{"file": "broken.json"},
+			{"file": "geometry.json"}
+		]}`,
+		"maths/algebra/test.json":        algebra,
+		"maths/algebra/images/line.png":  "png",
+		"maths/notes/algebra.pdf":        "%PDF",
+		"maths/broken.json":              `{"title": `,
+		"maths/geometry.json":            `{"title": "Geometry", "questions": [{"question_text": "Angles?", "image_url": "shapes/square.png"}]}`,
+		"__MACOSX/maths/._manifest.json": "fork",
+	})
+
+	b, err := Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Entries) != 4 {
+		t.Fatalf("expected the manifest's 4 tests, got %+v", b.Entries)
+	}
+
+	first := b.Test(0)
+	if first.Problem != "" {
+		t.Fatalf("expected the first test read, got %q", first.Problem)
+	}
+	if first.Upload.Title != "Algebra" || len(first.Upload.Questions) != 2 {
+		t.Errorf("unexpected upload %+v", first.Upload)
+	}
+	if len(first.Images) != 1 || string(first.Images["images/line.png"].Data) != "png" || first.Images["images/line.png"].Name != "line.png" {
+		t.Errorf("expected the image read once by its path, got %+v", first.Images)
+	}
+	if notes := first.Upload.Notes; notes == nil || notes.Filename != "algebra.pdf" || string(notes.Data) != "%PDF" {
+		t.Errorf("expected the notes the manifest names, got %+v", notes)
+	}
+
+	for i, want := range map[int]string{
+		1: "missing.json is not in the archive",
+		2: "broken.json is not a test in the upload schema",
+		3: "shapes/square.png is not in the archive",
+	} {
+		if problem := b.Test(i).Problem; !strings.Contains(problem, want) {
+			t.Errorf("test %d: expected a problem mentioning %q, got %q", i+1, want, problem)
+		}
+	}
+}
+
+func TestReadRejectsArchivesWithoutTests(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"not a zip":     []byte("title,question\n"),
+		"no manifest":   archive(t, map[string]string{"test.json": algebra}),
+		"no tests":      archive(t, map[string]string{"manifest.json": `{"tests": []}`}),
+		"newer schema":  archive(t, map[string]string{"manifest.json": `{"schema_version": 99, "tests": [{"file": "a.json"}]}`}),
+		"entry no file": archive(t, map[string]string{"manifest.json": `{"tests": [{"notes": "a.pdf"}]}`}),
+		"bad manifest":  archive(t, map[string]string{"manifest.json": `[`}),
+	} {
+		if _, err := Read(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestIsArchivePath(t *testing.T) {
+	for ref, want := range map[string]bool{
+		"images/a.png":               true,
+		"a.png":                      true,
+		"":                           false,
+		"/assets/uploads/1/a.png":    false,
+		"https://example.com/a.png":  false,
+		"data:image/png;base64,cG5n": false,
+	} {
+		if got := IsArchivePath(ref); got != want {
+			t.Errorf("%q: expected %v, got %v", ref, want, got)
+		}
+	}
+}
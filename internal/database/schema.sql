@@ -41,6 +41,20 @@ CREATE TABLE IF NOT EXISTS tests (
     difficulty VARCHAR(20) NOT NULL CHECK (difficulty IN ('Easy', 'Medium', 'Hard')),
     time_limit_minutes INTEGER NOT NULL DEFAULT 10,
     passing_score INTEGER NOT NULL DEFAULT 60,
+    wrong_penalty DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (wrong_penalty BETWEEN 0 AND 1),
+    skipped_credit DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (skipped_credit BETWEEN 0 AND 1),
+    hint_penalty DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (hint_penalty BETWEEN 0 AND 1),
+    floor_at_zero BOOLEAN NOT NULL DEFAULT TRUE,
+    shuffle_questions BOOLEAN NOT NULL DEFAULT FALSE,
+    shuffle_options BOOLEAN NOT NULL DEFAULT FALSE,
+    max_attempts INTEGER NOT NULL DEFAULT 0 CHECK (max_attempts >= 0),
+    attempt_cooldown_minutes INTEGER NOT NULL DEFAULT 0 CHECK (attempt_cooldown_minutes >= 0),
+    counted_attempt VARCHAR(20) NOT NULL DEFAULT 'best' CHECK (counted_attempt IN ('best', 'latest', 'average')),
+    allow_practice BOOLEAN NOT NULL DEFAULT FALSE,
+    available_from TIMESTAMP,
+    available_until TIMESTAMP,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    late_submission VARCHAR(20) NOT NULL DEFAULT 'finish' CHECK (late_submission IN ('finish', 'cut_off')),
     published BOOLEAN DEFAULT FALSE,
     notes_filename VARCHAR(500),
     created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
@@ -48,29 +62,132 @@ CREATE TABLE IF NOT EXISTS tests (
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Question pools: each attempt draws draw_count of the pool's questions at random
+CREATE TABLE IF NOT EXISTS question_pools (
+    id SERIAL PRIMARY KEY,
+    test_id INTEGER REFERENCES tests(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    draw_count INTEGER NOT NULL CHECK (draw_count >= 1),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(test_id, name)
+);
+
+-- Test sections, taken in section_order, each with its own instructions and
+-- optionally its own time limit; a no_return section cannot be revisited
+-- once the student moves on
+CREATE TABLE IF NOT EXISTS test_sections (
+    id SERIAL PRIMARY KEY,
+    test_id INTEGER NOT NULL REFERENCES tests(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    instructions TEXT NOT NULL DEFAULT '',
+    time_limit_minutes INTEGER NOT NULL DEFAULT 0 CHECK (time_limit_minutes >= 0),
+    no_return BOOLEAN NOT NULL DEFAULT FALSE,
+    section_order INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(test_id, title)
+);
+
+-- Prerequisites a student must meet before starting a test: pass another
+-- test at its passing score, score at least min_percent on it, or complete
+-- min_count tests in a topic
+CREATE TABLE IF NOT EXISTS test_prerequisites (
+    id SERIAL PRIMARY KEY,
+    test_id INTEGER NOT NULL REFERENCES tests(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('passed', 'min_score', 'topic_count')),
+    required_test_id INTEGER REFERENCES tests(id) ON DELETE CASCADE,
+    min_percent INTEGER NOT NULL DEFAULT 0 CHECK (min_percent BETWEEN 0 AND 100),
+    topic_id INTEGER REFERENCES topics(id) ON DELETE CASCADE,
+    min_count INTEGER NOT NULL DEFAULT 0 CHECK (min_count >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (required_test_id IS NOT NULL OR topic_id IS NOT NULL)
+);
+
+-- Grade boundaries: the lowest percentage that earns each grade. A set
+-- belongs to an exam standard, or to one test where it replaces the standard's.
+CREATE TABLE IF NOT EXISTS grade_boundaries (
+    id SERIAL PRIMARY KEY,
+    exam_standard VARCHAR(50),
+    test_id INTEGER REFERENCES tests(id) ON DELETE CASCADE,
+    grade VARCHAR(10) NOT NULL,
+    min_percent DOUBLE PRECISION NOT NULL CHECK (min_percent BETWEEN 0 AND 100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((exam_standard IS NULL) <> (test_id IS NULL))
+);
+
 -- Questions
 CREATE TABLE IF NOT EXISTS questions (
     id SERIAL PRIMARY KEY,
     test_id INTEGER REFERENCES tests(id) ON DELETE CASCADE,
     question_text TEXT NOT NULL,
     image_url VARCHAR(500),
+    question_type VARCHAR(30) NOT NULL DEFAULT 'single_choice' CHECK (question_type IN ('single_choice', 'multiple_select', 'true_false', 'numeric', 'short_answer', 'ordering', 'matching')),
+    scoring_rule VARCHAR(30) NOT NULL DEFAULT 'all_or_nothing' CHECK (scoring_rule IN ('all_or_nothing', 'partial')),
+    numeric_expected DOUBLE PRECISION,
+    numeric_tolerance DOUBLE PRECISION NOT NULL DEFAULT 0,
+    numeric_tolerance_type VARCHAR(20) NOT NULL DEFAULT 'absolute' CHECK (numeric_tolerance_type IN ('absolute', 'percent')),
+    numeric_sig_figs INTEGER,
+    numeric_units TEXT[],
+    case_sensitive BOOLEAN NOT NULL DEFAULT FALSE,
+    typo_tolerance INTEGER NOT NULL DEFAULT 0 CHECK (typo_tolerance BETWEEN 0 AND 3),
+    keep_option_order BOOLEAN NOT NULL DEFAULT FALSE,
+    pool_id INTEGER REFERENCES question_pools(id) ON DELETE SET NULL,
+    section_id INTEGER REFERENCES test_sections(id) ON DELETE SET NULL,
+    explanation TEXT NOT NULL DEFAULT '',
+    explanation_image_url VARCHAR(500),
     question_order INTEGER NOT NULL,
     points INTEGER NOT NULL DEFAULT 1,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     UNIQUE(test_id, question_order)
 );
 
--- Answer Options (4 per question)
+-- Answer Options (2 to 8 per question)
 CREATE TABLE IF NOT EXISTS answer_options (
     id SERIAL PRIMARY KEY,
     question_id INTEGER REFERENCES questions(id) ON DELETE CASCADE,
     option_text TEXT NOT NULL,
     is_correct BOOLEAN NOT NULL DEFAULT FALSE,
-    option_order INTEGER NOT NULL CHECK (option_order BETWEEN 1 AND 4),
+    match_text TEXT NOT NULL DEFAULT '',
+    rationale TEXT NOT NULL DEFAULT '',
+    option_order INTEGER NOT NULL CHECK (option_order BETWEEN 1 AND 8),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     UNIQUE(question_id, option_order)
 );
 
+-- Accepted Answers for short-answer questions (literal text or regex patterns)
+CREATE TABLE IF NOT EXISTS accepted_answers (
+    id SERIAL PRIMARY KEY,
+    question_id INTEGER REFERENCES questions(id) ON DELETE CASCADE,
+    answer_text TEXT NOT NULL,
+    is_regex BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(question_id, answer_text, is_regex)
+);
+
+-- Hints students can reveal during an attempt, in hint_order. A hint's penalty
+-- overrides the test's hint_penalty; both are shares of the question's points.
+CREATE TABLE IF NOT EXISTS question_hints (
+    id SERIAL PRIMARY KEY,
+    question_id INTEGER REFERENCES questions(id) ON DELETE CASCADE,
+    hint_text TEXT NOT NULL,
+    penalty DOUBLE PRECISION CHECK (penalty BETWEEN 0 AND 1),
+    hint_order INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(question_id, hint_order)
+);
+
+-- Immutable snapshots of a test's content. Attempts are taken against a
+-- revision, so later edits do not change what their review and results show.
+CREATE TABLE IF NOT EXISTS test_revisions (
+    id SERIAL PRIMARY KEY,
+    test_id INTEGER NOT NULL REFERENCES tests(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    content JSONB NOT NULL,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    restored_from INTEGER,
+    UNIQUE(test_id, revision)
+);
+
 -- Student Test Attempts
 CREATE TABLE IF NOT EXISTS test_attempts (
     id SERIAL PRIMARY KEY,
@@ -82,20 +199,48 @@ CREATE TABLE IF NOT EXISTS test_attempts (
     total_points INTEGER,
     time_taken_seconds INTEGER,
     status VARCHAR(20) DEFAULT 'in_progress' CHECK (status IN ('in_progress', 'completed', 'abandoned')),
+    shuffle_seed BIGINT NOT NULL DEFAULT 0,
+    question_order INTEGER[],
+    option_order JSONB,
+    deadline_at TIMESTAMP,
+    practice BOOLEAN NOT NULL DEFAULT FALSE,
+    grade VARCHAR(10),
+    section_id INTEGER REFERENCES test_sections(id) ON DELETE SET NULL,
+    section_starts JSONB,
+    sections_left INTEGER[],
+    revision_id INTEGER REFERENCES test_revisions(id) ON DELETE SET NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
--- Student Answers
+-- Student Answers. The question and options are those of the attempt's
+-- revision, so they are kept when the question is later edited or deleted.
 CREATE TABLE IF NOT EXISTS student_answers (
     id SERIAL PRIMARY KEY,
     attempt_id INTEGER REFERENCES test_attempts(id) ON DELETE CASCADE,
-    question_id INTEGER REFERENCES questions(id) ON DELETE CASCADE,
-    selected_option_id INTEGER REFERENCES answer_options(id) ON DELETE SET NULL,
+    question_id INTEGER NOT NULL,
+    selected_option_id INTEGER,
+    selected_option_ids INTEGER[],
+    text_answer TEXT,
+    matched_answer TEXT,
+    match_pairs JSONB,
     is_correct BOOLEAN,
+    credit DOUBLE PRECISION,
     answered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     UNIQUE(attempt_id, question_id)
 );
 
+-- Hints revealed during an attempt. The penalty is fixed when the hint is
+-- revealed, so editing or deleting the hint later does not change it.
+CREATE TABLE IF NOT EXISTS hint_reveals (
+    id SERIAL PRIMARY KEY,
+    attempt_id INTEGER REFERENCES test_attempts(id) ON DELETE CASCADE,
+    question_id INTEGER NOT NULL,
+    hint_id INTEGER REFERENCES question_hints(id) ON DELETE SET NULL,
+    penalty DOUBLE PRECISION NOT NULL DEFAULT 0,
+    revealed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(attempt_id, hint_id)
+);
+
 -- Achievements/Badges
 CREATE TABLE IF NOT EXISTS achievements (
     id SERIAL PRIMARY KEY,
@@ -128,6 +273,89 @@ CREATE TABLE IF NOT EXISTS user_stats (
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Upgrades for databases created before the columns above existed.
+-- Every statement is idempotent so the whole file can be re-applied.
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS wrong_penalty DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE tests DROP CONSTRAINT IF EXISTS tests_wrong_penalty_check;
+ALTER TABLE tests ADD CONSTRAINT tests_wrong_penalty_check CHECK (wrong_penalty BETWEEN 0 AND 1);
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS skipped_credit DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE tests DROP CONSTRAINT IF EXISTS tests_skipped_credit_check;
+ALTER TABLE tests ADD CONSTRAINT tests_skipped_credit_check CHECK (skipped_credit BETWEEN 0 AND 1);
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS hint_penalty DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE tests DROP CONSTRAINT IF EXISTS tests_hint_penalty_check;
+ALTER TABLE tests ADD CONSTRAINT tests_hint_penalty_check CHECK (hint_penalty BETWEEN 0 AND 1);
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS floor_at_zero BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS shuffle_questions BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS shuffle_options BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS max_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tests DROP CONSTRAINT IF EXISTS tests_max_attempts_check;
+ALTER TABLE tests ADD CONSTRAINT tests_max_attempts_check CHECK (max_attempts >= 0);
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS attempt_cooldown_minutes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tests DROP CONSTRAINT IF EXISTS tests_attempt_cooldown_minutes_check;
+ALTER TABLE tests ADD CONSTRAINT tests_attempt_cooldown_minutes_check CHECK (attempt_cooldown_minutes >= 0);
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS counted_attempt VARCHAR(20) NOT NULL DEFAULT 'best';
+ALTER TABLE tests DROP CONSTRAINT IF EXISTS tests_counted_attempt_check;
+ALTER TABLE tests ADD CONSTRAINT tests_counted_attempt_check CHECK (counted_attempt IN ('best', 'latest', 'average'));
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS allow_practice BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS available_from TIMESTAMP;
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS available_until TIMESTAMP;
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+ALTER TABLE tests ADD COLUMN IF NOT EXISTS late_submission VARCHAR(20) NOT NULL DEFAULT 'finish';
+ALTER TABLE tests DROP CONSTRAINT IF EXISTS tests_late_submission_check;
+ALTER TABLE tests ADD CONSTRAINT tests_late_submission_check CHECK (late_submission IN ('finish', 'cut_off'));
+ALTER TABLE test_attempts ADD COLUMN IF NOT EXISTS shuffle_seed BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE test_attempts ADD COLUMN IF NOT EXISTS question_order INTEGER[];
+ALTER TABLE test_attempts ADD COLUMN IF NOT EXISTS option_order JSONB;
+ALTER TABLE test_attempts ADD COLUMN IF NOT EXISTS deadline_at TIMESTAMP;
+UPDATE test_attempts a SET deadline_at = a.started_at + make_interval(mins => t.time_limit_minutes)
+    FROM tests t WHERE t.id = a.test_id AND a.status = 'in_progress' AND a.deadline_at IS NULL;
+ALTER TABLE test_attempts ADD COLUMN IF NOT EXISTS practice BOOLEAN NOT NULL DEFAULT FALSE;
+-- A student has at most one attempt in progress per test and mode; older duplicates are abandoned
+UPDATE test_attempts a SET status = 'abandoned'
+    WHERE a.status = 'in_progress' AND EXISTS (
+        SELECT 1 FROM test_attempts b
+        WHERE b.user_id = a.user_id AND b.test_id = a.test_id AND b.practice = a.practice
+          AND b.status = 'in_progress' AND b.id > a.id);
+ALTER TABLE test_attempts ADD COLUMN IF NOT EXISTS grade VARCHAR(10);
+ALTER TABLE test_attempts ADD COLUMN IF NOT EXISTS section_id INTEGER REFERENCES test_sections(id) ON DELETE SET NULL;
+ALTER TABLE test_attempts ADD COLUMN IF NOT EXISTS section_starts JSONB;
+ALTER TABLE test_attempts ADD COLUMN IF NOT EXISTS sections_left INTEGER[];
+ALTER TABLE test_attempts ADD COLUMN IF NOT EXISTS revision_id INTEGER REFERENCES test_revisions(id) ON DELETE SET NULL;
+ALTER TABLE test_revisions ADD COLUMN IF NOT EXISTS restored_from INTEGER;
+-- Answers and hint reveals outlive the questions and options they refer to
+ALTER TABLE student_answers DROP CONSTRAINT IF EXISTS student_answers_question_id_fkey;
+ALTER TABLE student_answers DROP CONSTRAINT IF EXISTS student_answers_selected_option_id_fkey;
+ALTER TABLE hint_reveals DROP CONSTRAINT IF EXISTS hint_reveals_question_id_fkey;
+-- Replaced by idx_test_attempts_one_in_progress_per_mode, which allows a practice attempt alongside
+DROP INDEX IF EXISTS idx_test_attempts_one_in_progress;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS question_type VARCHAR(30) NOT NULL DEFAULT 'single_choice';
+ALTER TABLE questions DROP CONSTRAINT IF EXISTS questions_question_type_check;
+ALTER TABLE questions ADD CONSTRAINT questions_question_type_check CHECK (question_type IN ('single_choice', 'multiple_select', 'true_false', 'numeric', 'short_answer', 'ordering', 'matching'));
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS scoring_rule VARCHAR(30) NOT NULL DEFAULT 'all_or_nothing';
+ALTER TABLE questions DROP CONSTRAINT IF EXISTS questions_scoring_rule_check;
+ALTER TABLE questions ADD CONSTRAINT questions_scoring_rule_check CHECK (scoring_rule IN ('all_or_nothing', 'partial'));
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS numeric_expected DOUBLE PRECISION;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS numeric_tolerance DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS numeric_tolerance_type VARCHAR(20) NOT NULL DEFAULT 'absolute';
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS numeric_sig_figs INTEGER;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS numeric_units TEXT[];
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS case_sensitive BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS typo_tolerance INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS keep_option_order BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS pool_id INTEGER REFERENCES question_pools(id) ON DELETE SET NULL;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS section_id INTEGER REFERENCES test_sections(id) ON DELETE SET NULL;
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS explanation TEXT NOT NULL DEFAULT '';
+ALTER TABLE questions ADD COLUMN IF NOT EXISTS explanation_image_url VARCHAR(500);
+ALTER TABLE answer_options ADD COLUMN IF NOT EXISTS match_text TEXT NOT NULL DEFAULT '';
+ALTER TABLE answer_options ADD COLUMN IF NOT EXISTS rationale TEXT NOT NULL DEFAULT '';
+ALTER TABLE answer_options DROP CONSTRAINT IF EXISTS answer_options_option_order_check;
+ALTER TABLE answer_options ADD CONSTRAINT answer_options_option_order_check CHECK (option_order BETWEEN 1 AND 8);
+ALTER TABLE student_answers ADD COLUMN IF NOT EXISTS selected_option_ids INTEGER[];
+ALTER TABLE student_answers ADD COLUMN IF NOT EXISTS credit DOUBLE PRECISION;
+ALTER TABLE student_answers ADD COLUMN IF NOT EXISTS text_answer TEXT;
+ALTER TABLE student_answers ADD COLUMN IF NOT EXISTS matched_answer TEXT;
+ALTER TABLE student_answers ADD COLUMN IF NOT EXISTS match_pairs JSONB;
+
 -- Indexes for performance
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 CREATE INDEX IF NOT EXISTS idx_users_role ON users(role);
@@ -135,10 +363,22 @@ CREATE INDEX IF NOT EXISTS idx_topics_subject ON topics(subject_id);
 CREATE INDEX IF NOT EXISTS idx_tests_subject ON tests(subject_id);
 CREATE INDEX IF NOT EXISTS idx_tests_topic ON tests(topic_id);
 CREATE INDEX IF NOT EXISTS idx_questions_test ON questions(test_id);
+CREATE INDEX IF NOT EXISTS idx_question_pools_test ON question_pools(test_id);
+CREATE INDEX IF NOT EXISTS idx_test_sections_test ON test_sections(test_id);
+CREATE INDEX IF NOT EXISTS idx_test_prerequisites_test ON test_prerequisites(test_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_grade_boundaries_standard ON grade_boundaries(exam_standard, grade) WHERE test_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_grade_boundaries_test ON grade_boundaries(test_id, grade) WHERE test_id IS NOT NULL;
 CREATE INDEX IF NOT EXISTS idx_answer_options_question ON answer_options(question_id);
+CREATE INDEX IF NOT EXISTS idx_accepted_answers_question ON accepted_answers(question_id);
+CREATE INDEX IF NOT EXISTS idx_question_hints_question ON question_hints(question_id);
+CREATE INDEX IF NOT EXISTS idx_test_attempts_revision ON test_attempts(revision_id);
 CREATE INDEX IF NOT EXISTS idx_test_attempts_user ON test_attempts(user_id);
 CREATE INDEX IF NOT EXISTS idx_test_attempts_test ON test_attempts(test_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_test_attempts_one_in_progress_per_mode ON test_attempts(user_id, test_id, practice) WHERE status = 'in_progress';
+CREATE INDEX IF NOT EXISTS idx_test_attempts_deadline ON test_attempts(deadline_at) WHERE status = 'in_progress';
 CREATE INDEX IF NOT EXISTS idx_student_answers_attempt ON student_answers(attempt_id);
+CREATE INDEX IF NOT EXISTS idx_student_answers_question ON student_answers(question_id);
+CREATE INDEX IF NOT EXISTS idx_hint_reveals_attempt ON hint_reveals(attempt_id);
 CREATE INDEX IF NOT EXISTS idx_user_achievements_user ON user_achievements(user_id);
 
 -- Insert default achievements
@@ -150,6 +390,19 @@ INSERT INTO achievements (name, description, badge_icon, criteria_type, criteria
     ('Streak Champion', 'Maintain a 5-day study streak', '🔥', 'streak', 5, 50)
 ON CONFLICT (name) DO NOTHING;
 
+-- Insert default grade boundaries, only while no standard has any so that
+-- admins can change or remove them
+INSERT INTO grade_boundaries (exam_standard, grade, min_percent)
+SELECT v.exam_standard, v.grade, v.min_percent FROM (VALUES
+    ('GCSE', '9', 80), ('GCSE', '8', 70), ('GCSE', '7', 60), ('GCSE', '6', 52), ('GCSE', '5', 45),
+    ('GCSE', '4', 37), ('GCSE', '3', 28), ('GCSE', '2', 19), ('GCSE', '1', 10), ('GCSE', 'U', 0),
+    ('IGCSE', 'A*', 80), ('IGCSE', 'A', 70), ('IGCSE', 'B', 60), ('IGCSE', 'C', 50), ('IGCSE', 'D', 40),
+    ('IGCSE', 'E', 30), ('IGCSE', 'F', 20), ('IGCSE', 'G', 10), ('IGCSE', 'U', 0),
+    ('A-Level', 'A*', 80), ('A-Level', 'A', 70), ('A-Level', 'B', 60), ('A-Level', 'C', 50),
+    ('A-Level', 'D', 40), ('A-Level', 'E', 30), ('A-Level', 'U', 0)
+) AS v(exam_standard, grade, min_percent)
+WHERE NOT EXISTS (SELECT 1 FROM grade_boundaries WHERE test_id IS NULL);
+
 -- Insert default subjects
 INSERT INTO subjects (name, description) VALUES
     ('Mathematics', 'Numbers, algebra, geometry, and more'),
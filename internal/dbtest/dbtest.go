@@ -0,0 +1,86 @@
+// Package dbtest connects tests to the database named by DATABASE_URL, as CI
+// provides, with the schema applied. Tests that need it are skipped without.
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// schemaLock is the advisory lock held while applying the schema, as the
+// packages' tests run at once and may each apply it
+const schemaLock = 20240601
+
+// Pool connects to the test database and applies the schema, skipping the
+// test when DATABASE_URL is not set. The pool is closed when the test ends.
+func Pool(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("connecting to the test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	if err := applySchema(ctx, pool); err != nil {
+		t.Fatalf("applying the schema: %v", err)
+	}
+	return pool
+}
+
+func applySchema(ctx context.Context, pool *pgxpool.Pool) error {
+	_, file, _, _ := runtime.Caller(0)
+	schema, err := os.ReadFile(filepath.Join(filepath.Dir(file), "..", "database", "schema.sql"))
+	if err != nil {
+		return err
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", schemaLock); err != nil {
+		return err
+	}
+	defer conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", schemaLock)
+
+	_, err = conn.Exec(ctx, string(schema))
+	return err
+}
+
+// users counts the users created, keeping their emails apart
+var users atomic.Int64
+
+// User creates a user with the given role, deleted when the test ends
+func User(t testing.TB, pool *pgxpool.Pool, role string) int {
+	t.Helper()
+	ctx := context.Background()
+	email := fmt.Sprintf("%s-%d-%d@dbtest.invalid", role, time.Now().UnixNano(), users.Add(1))
+
+	var id int
+	err := pool.QueryRow(ctx,
+		`INSERT INTO users (email, password_hash, username, role) VALUES ($1, 'x', $2, $3) RETURNING id`,
+		email, t.Name(), role,
+	).Scan(&id)
+	if err != nil {
+		t.Fatalf("creating a %s: %v", role, err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(ctx, "DELETE FROM users WHERE id = $1", id)
+	})
+	return id
+}
@@ -0,0 +1,50 @@
+package dbtest
+
+import (
+	"context"
+	"testing"
+)
+
+// TestReapplySchemaKeepsAttemptsOfBothModes re-applies the schema, as every
+// start does, while a student has a practice and a real attempt in progress
+func TestReapplySchemaKeepsAttemptsOfBothModes(t *testing.T) {
+	pool := Pool(t)
+	studentID := User(t, pool, "student")
+	ctx := context.Background()
+
+	var testID int
+	err := pool.QueryRow(ctx,
+		`INSERT INTO tests (title, exam_standard, difficulty, allow_practice) VALUES ('Reapply', 'GCSE', 'Easy', TRUE) RETURNING id`,
+	).Scan(&testID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pool.Exec(ctx, "DELETE FROM tests WHERE id = $1", testID) })
+
+	var attemptIDs []int
+	for _, practice := range []bool{false, true} {
+		var id int
+		err := pool.QueryRow(ctx,
+			`INSERT INTO test_attempts (user_id, test_id, status, practice) VALUES ($1, $2, 'in_progress', $3) RETURNING id`,
+			studentID, testID, practice,
+		).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		attemptIDs = append(attemptIDs, id)
+	}
+
+	if err := applySchema(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, id := range attemptIDs {
+		var status string
+		if err := pool.QueryRow(ctx, "SELECT status FROM test_attempts WHERE id = $1", id).Scan(&status); err != nil {
+			t.Fatal(err)
+		}
+		if status != "in_progress" {
+			t.Errorf("expected attempt %d left in progress, got %q", i+1, status)
+		}
+	}
+}
@@ -1,19 +1,25 @@
 package handlers
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"my-app/internal/auth"
 	"my-app/internal/models"
 	"my-app/internal/repository"
 	"my-app/internal/storage"
+	"my-app/internal/validation"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -206,11 +212,22 @@ func (h *AdminHandler) ShowManagement(w http.ResponseWriter, r *http.Request) {
 		subjects = []models.Subject{}
 	}
 
+	boundaries, err := h.testRepo.GetStandardGradeBoundaries(r.Context())
+	if err != nil {
+		log.Printf("Error fetching grade boundaries: %v", err)
+	}
+	gradeRows := make(map[string]models.GradeBoundaries, len(models.ValidExamStandards))
+	for _, standard := range models.ValidExamStandards {
+		gradeRows[standard] = gradeBoundaryRows(boundaries[standard])
+	}
+
 	data := map[string]interface{}{
 		"Session":       session,
 		"Subjects":      subjects,
 		"Difficulties":  models.ValidDifficulties,
 		"ExamStandards": models.ValidExamStandards,
+		"GradeRows":     gradeRows,
+		"GradesSaved":   r.URL.Query().Get("grades_saved"),
 	}
 
 	tmpl, err := template.ParseFiles("views/layout.html", "views/admin_manage.html")
@@ -267,6 +284,40 @@ func (h *AdminHandler) DeleteSubject(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// UpdateGradeBoundaries replaces an exam standard's grade boundaries. Attempts
+// already graded keep their grade until their test is regraded.
+func (h *AdminHandler) UpdateGradeBoundaries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	standard := r.FormValue("exam_standard")
+	if !slices.Contains(models.ValidExamStandards, standard) {
+		http.Error(w, "Invalid exam standard", http.StatusBadRequest)
+		return
+	}
+
+	boundaries := parseGradeBoundariesForm(r, nil)
+	validator := validation.NewTestValidator()
+	if !validator.ValidateGradeBoundaries(boundaries) {
+		http.Error(w, "Validation failed: "+validationSummary(validator), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.testRepo.ReplaceStandardGradeBoundaries(r.Context(), standard, boundaries); err != nil {
+		log.Printf("Error updating grade boundaries: %v", err)
+		http.Error(w, "Failed to update grade boundaries", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/manage?grades_saved="+url.QueryEscape(standard), http.StatusSeeOther)
+}
+
 // ShowUserManagement displays the user management page
 func (h *AdminHandler) ShowUserManagement(w http.ResponseWriter, r *http.Request) {
 	session := auth.GetSessionData(r)
@@ -446,7 +497,6 @@ func (h *AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 // EditTest displays the edit page for a test (admin-only)
 func (h *AdminHandler) EditTest(w http.ResponseWriter, r *http.Request) {
-	session := auth.GetSessionData(r)
 	testIDStr := r.PathValue("id")
 	testID, _ := strconv.Atoi(testIDStr)
 
@@ -457,30 +507,7 @@ func (h *AdminHandler) EditTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	subjects, err := h.testRepo.GetSubjects(r.Context())
-	if err != nil {
-		subjects = []models.Subject{}
-	}
-
-	data := map[string]interface{}{
-		"Session":  session,
-		"Test":     test,
-		"Subjects": subjects,
-	}
-
-	tmpl, err := template.New("").Funcs(template.FuncMap{
-		"add": func(a, b int) int { return a + b },
-	}).ParseFiles("views/layout.html", "views/edit_test.html")
-	if err != nil {
-		log.Printf("Error parsing templates: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
-	if err := tmpl.ExecuteTemplate(w, "layout.html", data); err != nil {
-		log.Printf("Error executing template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-	}
+	renderEditTest(w, r, h.testRepo, test, nil)
 }
 
 // DeleteTest removes a test and its questions (admin-only).
@@ -514,6 +541,8 @@ func (h *AdminHandler) UpdateTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	session := auth.GetSessionData(r)
+
 	testIDStr := r.PathValue("id")
 	testID, err := strconv.Atoi(testIDStr)
 	if err != nil {
@@ -542,21 +571,36 @@ func (h *AdminHandler) UpdateTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Log what the test held before the edit, which students may have been asked
+	if err := freezeBeforeEdit(r.Context(), h.testRepo, test); err != nil {
+		log.Printf("Error saving test revision: %v", err)
+		http.Error(w, "Failed to update test", http.StatusInternalServerError)
+		return
+	}
+
 	// Check if this is a full update or just notes update
 	titleParam := r.FormValue("title")
 	if titleParam != "" {
-		// Full test update - only update test fields
-		test.Title = titleParam
-		test.Description = r.FormValue("description")
-		test.ExamStandard = r.FormValue("exam_standard")
-		test.Difficulty = r.FormValue("difficulty")
-		test.PassingScore = parseIntOrDefault(r.FormValue("passing_score"), 60)
-		test.TimeLimitMinutes = parseIntOrDefault(r.FormValue("time_limit_minutes"), 10)
+		// Full test update
+		removed := parseTestEditForm(r, test)
 
 		log.Printf("Updating test %d: title=%s, description=%s", testID, test.Title, test.Description)
 
-		// Update test in database
-		if err := h.testRepo.Update(r.Context(), test); err != nil {
+		catalogue, err := h.testRepo.GetAll(r.Context())
+		if err != nil {
+			log.Printf("Error fetching tests: %v", err)
+			http.Error(w, "Failed to update test", http.StatusInternalServerError)
+			return
+		}
+		if problems := validateTestEdit(test, catalogue); problems.any() {
+			renderEditTest(w, r, h.testRepo, test, &problems)
+			return
+		}
+
+		err = h.testRepo.InTx(r.Context(), func(tx *repository.TestRepository) error {
+			return saveTestEdit(r.Context(), tx, test, removed, session.UserID)
+		})
+		if err != nil {
 			log.Printf("Error updating test: %v", err)
 			http.Error(w, fmt.Sprintf("Failed to update test: %v", err), http.StatusInternalServerError)
 			return
@@ -564,43 +608,6 @@ func (h *AdminHandler) UpdateTest(w http.ResponseWriter, r *http.Request) {
 
 		log.Printf("Test %d updated successfully", testID)
 
-		// Update questions
-		for idx, q := range test.Questions {
-			questionText := r.FormValue(fmt.Sprintf("question_%d_text", idx))
-			pointsStr := r.FormValue(fmt.Sprintf("question_%d_points", idx))
-
-			if questionText != "" {
-				q.QuestionText = questionText
-				q.Points = parseIntOrDefault(pointsStr, 1)
-
-				log.Printf("Updating question %d: text=%s, points=%d", q.ID, q.QuestionText, q.Points)
-
-				if err := h.testRepo.UpdateQuestion(r.Context(), &q); err != nil {
-					log.Printf("Error updating question: %v", err)
-					http.Error(w, fmt.Sprintf("Failed to update question: %v", err), http.StatusInternalServerError)
-					return
-				}
-			}
-
-			// Update answer options and set correct answer
-			correctOptionID := parseIntOrDefault(r.FormValue(fmt.Sprintf("question_%d_correct_option", idx)), 0)
-			for optIdx, opt := range q.Options {
-				optionText := r.FormValue(fmt.Sprintf("question_%d_option_%d_text", idx, optIdx))
-				if optionText != "" {
-					opt.OptionText = optionText
-					opt.IsCorrect = (opt.ID == correctOptionID)
-
-					log.Printf("Updating option %d: text=%s, isCorrect=%v", opt.ID, opt.OptionText, opt.IsCorrect)
-
-					if err := h.testRepo.UpdateAnswerOption(r.Context(), &opt); err != nil {
-						log.Printf("Error updating answer option: %v", err)
-						http.Error(w, fmt.Sprintf("Failed to update answer option: %v", err), http.StatusInternalServerError)
-						return
-					}
-				}
-			}
-		}
-
 		log.Printf("Redirecting to /admin/test/%d/edit", testID)
 		http.Redirect(w, r, fmt.Sprintf("/admin/test/%d/edit", testID), http.StatusSeeOther)
 		return
@@ -611,9 +618,11 @@ func (h *AdminHandler) UpdateTest(w http.ResponseWriter, r *http.Request) {
 	if err == nil {
 		defer file.Close()
 
-		// Delete old notes file if exists
+		// Delete old notes file if no revision still needs it
 		if test.NotesFilename != nil && *test.NotesFilename != "" {
-			storage.DeleteNotesFile(*test.NotesFilename)
+			if err := discardNotesFile(r.Context(), h.testRepo, *test.NotesFilename); err != nil {
+				log.Printf("Error deleting notes file: %v", err)
+			}
 		}
 
 		// Save new notes file
@@ -634,6 +643,12 @@ func (h *AdminHandler) UpdateTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := recordRevision(r.Context(), h.testRepo, testID, session.UserID); err != nil {
+		log.Printf("Error saving test revision: %v", err)
+		http.Error(w, "Failed to save test revision", http.StatusInternalServerError)
+		return
+	}
+
 	http.Redirect(w, r, fmt.Sprintf("/admin/test/%d/edit", testID), http.StatusSeeOther)
 }
 
@@ -666,11 +681,14 @@ func (h *AdminHandler) RemoveTestNotes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete notes file if exists
-	if test.NotesFilename != nil && *test.NotesFilename != "" {
-		if err := storage.DeleteNotesFile(*test.NotesFilename); err != nil {
-			log.Printf("Error deleting notes file: %v", err)
-		}
+	if err := freezeBeforeEdit(r.Context(), h.testRepo, test); err != nil {
+		log.Printf("Error saving test revision: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "Failed to remove notes",
+		})
+		return
 	}
 
 	// Update test in database (set notes to null)
@@ -684,6 +702,17 @@ func (h *AdminHandler) RemoveTestNotes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := recordRevision(r.Context(), h.testRepo, testID, auth.GetSessionData(r).UserID); err != nil {
+		log.Printf("Error saving test revision: %v", err)
+	}
+
+	// Delete notes file if no revision still needs it
+	if test.NotesFilename != nil && *test.NotesFilename != "" {
+		if err := discardNotesFile(r.Context(), h.testRepo, *test.NotesFilename); err != nil {
+			log.Printf("Error deleting notes file: %v", err)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -731,3 +760,384 @@ func parseIntOrDefault(s string, defaultVal int) int {
 	}
 	return defaultVal
 }
+
+// parseIntSet converts repeated form values into a set of ints, skipping invalid entries
+func parseIntSet(values []string) map[int]bool {
+	set := make(map[int]bool, len(values))
+	for _, v := range values {
+		if val, err := strconv.Atoi(v); err == nil {
+			set[val] = true
+		}
+	}
+	return set
+}
+
+// parseNumericAnswerForm reads the numeric answer key fields for question idx,
+// keeping the current expected value when the submitted one is not a number
+func parseNumericAnswerForm(r *http.Request, idx int, current *models.NumericAnswer) *models.NumericAnswer {
+	numeric := &models.NumericAnswer{ToleranceType: models.ToleranceAbsolute}
+	if current != nil {
+		numeric.Expected = current.Expected
+	}
+
+	field := func(name string) string {
+		return strings.TrimSpace(r.FormValue(fmt.Sprintf("question_%d_numeric_%s", idx, name)))
+	}
+
+	if val, err := strconv.ParseFloat(field("expected"), 64); err == nil {
+		numeric.Expected = val
+	}
+	if val, err := strconv.ParseFloat(field("tolerance"), 64); err == nil && val >= 0 {
+		numeric.Tolerance = val
+	}
+	if field("tolerance_type") == models.TolerancePercent {
+		numeric.ToleranceType = models.TolerancePercent
+	}
+	if val, err := strconv.Atoi(field("sig_figs")); err == nil && val > 0 && val <= models.MaxSigFigs {
+		numeric.SigFigs = &val
+	}
+	for _, unit := range strings.Split(field("units"), ",") {
+		if unit = strings.TrimSpace(unit); unit != "" {
+			numeric.Units = append(numeric.Units, unit)
+		}
+	}
+	return numeric
+}
+
+// parseShortAnswerForm reads the short-answer fields for question idx: accepted
+// answers and patterns one per line, case sensitivity and typo tolerance
+func parseShortAnswerForm(r *http.Request, idx int, q *models.Question) {
+	lines := func(name string) []string {
+		var values []string
+		for _, line := range strings.Split(r.FormValue(fmt.Sprintf("question_%d_%s", idx, name)), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				values = append(values, line)
+			}
+		}
+		return values
+	}
+
+	upload := models.QuestionUpload{
+		AcceptedAnswers:  lines("accepted_answers"),
+		AcceptedPatterns: lines("accepted_patterns"),
+	}
+	q.AcceptedAnswers = upload.ResolvedAcceptedAnswers()
+	q.CaseSensitive = r.FormValue(fmt.Sprintf("question_%d_case_sensitive", idx)) != ""
+
+	tolerance := parseIntOrDefault(r.FormValue(fmt.Sprintf("question_%d_typo_tolerance", idx)), q.TypoTolerance)
+	if tolerance >= 0 && tolerance <= models.MaxTypoTolerance {
+		q.TypoTolerance = tolerance
+	}
+}
+
+// parseExplanationForm reads question idx's worked solution and its image,
+// keeping the current value of a field that is too long to store
+func parseExplanationForm(r *http.Request, idx int, q *models.Question) {
+	if explanation := strings.TrimSpace(r.FormValue(fmt.Sprintf("question_%d_explanation", idx))); len(explanation) <= 5000 {
+		q.Explanation = explanation
+	}
+
+	switch url := strings.TrimSpace(r.FormValue(fmt.Sprintf("question_%d_explanation_image_url", idx))); {
+	case url == "":
+		q.ExplanationImageURL = nil
+	case len(url) <= 500:
+		q.ExplanationImageURL = &url
+	}
+}
+
+// parseRationaleForm reads the rationale of option optIdx of question idx.
+// Only choice questions have the field, so the rationale of an option the form
+// leaves out is kept.
+func parseRationaleForm(r *http.Request, idx, optIdx int, opt *models.AnswerOption) {
+	values, ok := r.Form[fmt.Sprintf("question_%d_option_%d_rationale", idx, optIdx)]
+	if !ok || len(values) == 0 {
+		return
+	}
+	if rationale := strings.TrimSpace(values[0]); len(rationale) <= 1000 {
+		opt.Rationale = rationale
+	}
+}
+
+// parseHintsForm reads question idx's hints from the edit form. Clearing a
+// hint's text deletes it, a blank penalty uses the test's, and the new hint row
+// adds one after the others. Values that are out of range keep the current
+// setting. It returns the IDs of the hints to delete.
+func parseHintsForm(r *http.Request, idx int, q *models.Question) []int {
+	penalty := func(name string, current *float64) *float64 {
+		text := strings.TrimSpace(r.FormValue(name))
+		if text == "" {
+			return nil
+		}
+		if val, err := strconv.ParseFloat(text, 64); err == nil && val >= 0 && val <= 1 {
+			return &val
+		}
+		return current
+	}
+
+	var removed []int
+	hints := make([]models.Hint, 0, len(q.Hints)+1)
+	nextOrder := 1
+	for i, hint := range q.Hints {
+		nextOrder = max(nextOrder, hint.HintOrder+1)
+		name := fmt.Sprintf("question_%d_hint_%d", idx, i)
+		if _, ok := r.Form[name+"_text"]; !ok {
+			hints = append(hints, hint)
+			continue
+		}
+		text := strings.TrimSpace(r.FormValue(name + "_text"))
+		if text == "" {
+			removed = append(removed, hint.ID)
+			continue
+		}
+		if len(text) <= 1000 {
+			hint.HintText = text
+		}
+		hint.Penalty = penalty(name+"_penalty", hint.Penalty)
+		hints = append(hints, hint)
+	}
+
+	name := fmt.Sprintf("question_%d_hint_new", idx)
+	if text := strings.TrimSpace(r.FormValue(name + "_text")); text != "" && len(text) <= 1000 {
+		hints = append(hints, models.Hint{
+			QuestionID: q.ID,
+			HintText:   text,
+			Penalty:    penalty(name+"_penalty", nil),
+			HintOrder:  nextOrder,
+		})
+	}
+	q.Hints = hints
+	return removed
+}
+
+// parseScoringPolicyForm reads a test's scoring policy from the edit form,
+// keeping the current setting for any field that is missing or out of range
+func parseScoringPolicyForm(r *http.Request, current models.ScoringPolicy) models.ScoringPolicy {
+	policy := current
+
+	share := func(name string, fallback float64) float64 {
+		if val, err := strconv.ParseFloat(strings.TrimSpace(r.FormValue(name)), 64); err == nil && val >= 0 && val <= 1 {
+			return val
+		}
+		return fallback
+	}
+
+	policy.WrongPenalty = share("wrong_penalty", policy.WrongPenalty)
+	policy.SkippedCredit = share("skipped_credit", policy.SkippedCredit)
+	policy.HintPenalty = share("hint_penalty", policy.HintPenalty)
+	switch r.FormValue("floor_at_zero") {
+	case "true":
+		policy.FloorAtZero = true
+	case "false":
+		policy.FloorAtZero = false
+	}
+	return policy
+}
+
+// parseAttemptPolicyForm reads how often a test may be attempted from the edit
+// form, keeping the current setting for any field that is missing or invalid
+func parseAttemptPolicyForm(r *http.Request, current models.AttemptPolicy) models.AttemptPolicy {
+	policy := current
+
+	if val := parseIntOrDefault(r.FormValue("max_attempts"), policy.MaxAttempts); val >= 0 {
+		policy.MaxAttempts = val
+	}
+	if val := parseIntOrDefault(r.FormValue("attempt_cooldown_minutes"), policy.CooldownMinutes); val >= 0 {
+		policy.CooldownMinutes = val
+	}
+	if counts := r.FormValue("counted_attempt"); slices.Contains(models.ValidCountedAttempts, counts) {
+		policy.Counts = counts
+	}
+	return policy
+}
+
+// parseAvailabilityForm reads when a test is open to students from the edit
+// form. Times are read in the form's timezone. A blank time clears that end of
+// the window; any field that is missing or invalid keeps its current setting.
+func parseAvailabilityForm(r *http.Request, test *models.Test) {
+	if tz := strings.TrimSpace(r.FormValue("timezone")); tz != "" && tz != "Local" {
+		if _, err := time.LoadLocation(tz); err == nil {
+			test.Timezone = tz
+		}
+	}
+
+	windowTime := func(name string, current *time.Time) *time.Time {
+		if _, sent := r.Form[name]; !sent {
+			return current
+		}
+		ts, err := models.ParseLocalTime(r.FormValue(name), test.Timezone)
+		if err != nil {
+			return current
+		}
+		return ts
+	}
+	test.AvailableFrom = windowTime("available_from", test.AvailableFrom)
+	test.AvailableUntil = windowTime("available_until", test.AvailableUntil)
+
+	if policy := r.FormValue("late_submission"); slices.Contains(models.ValidLateSubmissions, policy) {
+		test.LateSubmission = policy
+	}
+}
+
+// parsePoolsForm applies the edit form's pool changes to the test: renamed and
+// resized pools, removed pools and a new pool, which has ID 0 until savePools
+// creates it. parseQuestionsForm reads the pool each question is drawn from.
+// It returns the IDs of the removed pools.
+func parsePoolsForm(r *http.Request, test *models.Test) []int {
+	var removed []int
+	kept := test.Pools[:0]
+	for _, pool := range test.Pools {
+		prefix := fmt.Sprintf("pool_%d_", pool.ID)
+		if r.FormValue(prefix+"remove") != "" {
+			removed = append(removed, pool.ID)
+			continue
+		}
+		if name := strings.TrimSpace(r.FormValue(prefix + "name")); name != "" {
+			pool.Name = name
+		}
+		pool.DrawCount = parseIntOrDefault(r.FormValue(prefix+"draw"), pool.DrawCount)
+		kept = append(kept, pool)
+	}
+	test.Pools = kept
+
+	if name := strings.TrimSpace(r.FormValue("new_pool_name")); name != "" {
+		test.Pools = append(test.Pools, models.QuestionPool{
+			TestID:    test.ID,
+			Name:      name,
+			DrawCount: parseIntOrDefault(r.FormValue("new_pool_draw"), 1),
+		})
+	}
+
+	return removed
+}
+
+// parseSectionsForm applies the edit form's section changes to the test:
+// edited and reordered sections, removed sections and a new section, which
+// has ID 0 until saveSections creates it. Sections are renumbered in their new
+// order. parseQuestionsForm reads the section each question is asked in. It
+// returns the IDs of the removed sections.
+func parseSectionsForm(r *http.Request, test *models.Test) []int {
+	var removed []int
+	kept := test.Sections[:0]
+	for _, s := range test.Sections {
+		prefix := fmt.Sprintf("section_%d_", s.ID)
+		if r.FormValue(prefix+"remove") != "" {
+			removed = append(removed, s.ID)
+			continue
+		}
+		if title := strings.TrimSpace(r.FormValue(prefix + "title")); title != "" {
+			s.Title = title
+		}
+		if instructions, ok := r.Form[prefix+"instructions"]; ok && len(instructions) > 0 {
+			s.Instructions = strings.TrimSpace(instructions[0])
+		}
+		s.TimeLimitMinutes = parseIntOrDefault(r.FormValue(prefix+"time"), s.TimeLimitMinutes)
+		s.NoReturn = r.FormValue(prefix+"no_return") != ""
+		s.SectionOrder = parseIntOrDefault(r.FormValue(prefix+"order"), s.SectionOrder)
+		kept = append(kept, s)
+	}
+	test.Sections = kept
+
+	if title := strings.TrimSpace(r.FormValue("new_section_title")); title != "" {
+		test.Sections = append(test.Sections, models.Section{
+			TestID:           test.ID,
+			Title:            title,
+			Instructions:     strings.TrimSpace(r.FormValue("new_section_instructions")),
+			TimeLimitMinutes: parseIntOrDefault(r.FormValue("new_section_time"), 0),
+			NoReturn:         r.FormValue("new_section_no_return") != "",
+			SectionOrder:     parseIntOrDefault(r.FormValue("new_section_order"), len(test.Sections)+1),
+		})
+	}
+	slices.SortStableFunc(test.Sections, func(a, b models.Section) int {
+		return cmp.Compare(a.SectionOrder, b.SectionOrder)
+	})
+	for i := range test.Sections {
+		test.Sections[i].SectionOrder = i + 1
+	}
+
+	return removed
+}
+
+// parsePrerequisitesForm applies the edit form's prerequisite changes to the
+// test: removed prerequisites and a new one, which has ID 0 until
+// savePrerequisites creates it. It returns the IDs of the removed ones.
+func parsePrerequisitesForm(r *http.Request, test *models.Test) []int {
+	var removed []int
+	kept := make([]models.Prerequisite, 0, len(test.Prerequisites)+1)
+	for _, p := range test.Prerequisites {
+		if r.FormValue(fmt.Sprintf("prerequisite_%d_remove", p.ID)) != "" {
+			removed = append(removed, p.ID)
+			continue
+		}
+		kept = append(kept, p)
+	}
+
+	if kind := r.FormValue("new_prerequisite_kind"); slices.Contains(models.ValidPrerequisiteKinds, kind) {
+		p := models.Prerequisite{TestID: test.ID, Kind: kind}
+		if kind == models.PrerequisiteTopicCount {
+			if id, err := strconv.Atoi(r.FormValue("new_prerequisite_topic")); err == nil {
+				p.TopicID = &id
+			}
+			p.MinCount = parseIntOrDefault(r.FormValue("new_prerequisite_count"), 1)
+		} else {
+			if id, err := strconv.Atoi(r.FormValue("new_prerequisite_test")); err == nil {
+				p.RequiredTestID = &id
+			}
+			if kind == models.PrerequisiteMinScore {
+				p.MinPercent = parseIntOrDefault(r.FormValue("new_prerequisite_percent"), 0)
+			}
+		}
+		kept = append(kept, p)
+	}
+
+	test.Prerequisites = kept
+	return removed
+}
+
+// parseGradeBoundariesForm reads a set of grade boundaries from rows of
+// boundary_grade and boundary_percent fields. Rows left blank are dropped, and
+// a percentage that is not a number is kept as NaN for validation to report.
+// When the form has no boundary rows the current set is kept.
+func parseGradeBoundariesForm(r *http.Request, current models.GradeBoundaries) models.GradeBoundaries {
+	grades, sent := r.Form["boundary_grade"]
+	if !sent {
+		return current
+	}
+	percents := r.Form["boundary_percent"]
+
+	var boundaries models.GradeBoundaries
+	for i, grade := range grades {
+		grade = strings.TrimSpace(grade)
+		percent := ""
+		if i < len(percents) {
+			percent = strings.TrimSpace(percents[i])
+		}
+		if grade == "" && percent == "" {
+			continue
+		}
+		minPercent, err := strconv.ParseFloat(percent, 64)
+		if err != nil {
+			minPercent = math.NaN()
+		}
+		boundaries = append(boundaries, models.GradeBoundary{Grade: grade, MinPercent: minPercent})
+	}
+	return boundaries
+}
+
+// gradeBoundaryRows pads a set of grade boundaries with blank rows for a form
+// to fill in, leaving room for a full set of grades
+func gradeBoundaryRows(boundaries models.GradeBoundaries) models.GradeBoundaries {
+	rows := slices.Clone(boundaries)
+	for len(rows) < len(boundaries)+3 || len(rows) < 10 {
+		rows = append(rows, models.GradeBoundary{})
+	}
+	return rows
+}
+
+// validationSummary joins a validator's error messages into one line
+func validationSummary(v *validation.TestValidator) string {
+	messages := make([]string, 0, len(v.GetErrors()))
+	for _, err := range v.GetErrors() {
+		messages = append(messages, err.Message)
+	}
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"math/rand/v2"
+	"slices"
+
+	"my-app/internal/models"
+)
+
+// layoutAttempt draws the attempt's questions from the test's pools and fixes
+// the order it shows them and their options in. Everything comes from the
+// attempt's shuffle seed, so the same seed always gives the same layout.
+// Questions are shuffled when the test asks for it, and options when the test
+// asks for it and the question allows it. Ordering questions are always
+// scrambled, since their listed order is the answer.
+func layoutAttempt(test *models.Test, attempt *models.TestAttempt) {
+	rng := rand.New(rand.NewPCG(uint64(attempt.ShuffleSeed), uint64(test.ID)))
+	drawn := drawQuestions(rng, test)
+
+	attempt.QuestionOrder = make([]int, 0, len(drawn))
+	attempt.OptionOrder = make(map[int][]int, len(drawn))
+	for _, q := range drawn {
+		attempt.QuestionOrder = append(attempt.QuestionOrder, q.ID)
+
+		optionIDs := make([]int, 0, len(q.Options))
+		for _, opt := range q.CorrectOrder() {
+			optionIDs = append(optionIDs, opt.ID)
+		}
+		switch {
+		case q.IsOrdering():
+			scramble(rng, optionIDs)
+		case test.ShuffleOptions && !q.KeepOptionOrder && !q.IsTrueFalse():
+			shuffleIDs(rng, optionIDs)
+		}
+		attempt.OptionOrder[q.ID] = optionIDs
+	}
+
+	if test.ShuffleQuestions {
+		shuffleIDs(rng, attempt.QuestionOrder)
+	}
+}
+
+// drawQuestions returns the questions an attempt is asked, in test order:
+// every question outside a pool, and DrawCount questions picked at random from
+// each pool (all of them when the pool holds fewer)
+func drawQuestions(rng *rand.Rand, test *models.Test) []models.Question {
+	members := make(map[int][]int) // pool ID -> its questions' IDs, in test order
+	for _, q := range test.Questions {
+		if pool := test.Pool(q.PoolID); pool != nil {
+			members[pool.ID] = append(members[pool.ID], q.ID)
+		}
+	}
+
+	picked := make(map[int]bool)
+	for _, pool := range test.Pools {
+		ids := members[pool.ID]
+		for _, i := range rng.Perm(len(ids))[:min(pool.DrawCount, len(ids))] {
+			picked[ids[i]] = true
+		}
+	}
+
+	var drawn []models.Question
+	for _, q := range test.Questions {
+		if test.Pool(q.PoolID) == nil || picked[q.ID] {
+			drawn = append(drawn, q)
+		}
+	}
+	return drawn
+}
+
+func shuffleIDs(rng *rand.Rand, ids []int) {
+	rng.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+}
+
+// scramble shuffles ids, which start in their correct order, and never leaves
+// them in that order so a student is not started on the answer
+func scramble(rng *rand.Rand, ids []int) {
+	correct := slices.Clone(ids)
+	shuffleIDs(rng, ids)
+	if len(ids) > 1 && slices.Equal(ids, correct) {
+		first := ids[0]
+		copy(ids, ids[1:])
+		ids[len(ids)-1] = first
+	}
+}
+
+// arrangeForAttempt puts the test's questions and options in the order the
+// attempt shows them, section by section. Attempts started before layouts were stored get one
+// seeded from their ID, so ordering questions still start scrambled.
+func arrangeForAttempt(test *models.Test, attempt *models.TestAttempt) {
+	if attempt.QuestionOrder == nil && attempt.OptionOrder == nil {
+		unshuffled := *test
+		unshuffled.ShuffleQuestions, unshuffled.ShuffleOptions = false, false
+		legacy := models.TestAttempt{ShuffleSeed: int64(attempt.ID)}
+		layoutAttempt(&unshuffled, &legacy)
+		attempt.OptionOrder = legacy.OptionOrder
+	}
+	test.Questions = attempt.Arrange(test.Questions)
+	test.GroupBySection()
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"my-app/internal/models"
+)
+
+// layoutTest has eight four-option questions; question 8 keeps its option
+// order and question 9 is an ordering question
+func layoutTest(shuffleQuestions, shuffleOptions bool) *models.Test {
+	test := &models.Test{ID: 3, ShuffleQuestions: shuffleQuestions, ShuffleOptions: shuffleOptions}
+	for id := 1; id <= 9; id++ {
+		q := models.Question{ID: id, QuestionOrder: id}
+		for o := 1; o <= 4; o++ {
+			q.Options = append(q.Options, models.AnswerOption{ID: id*10 + o, OptionOrder: o})
+		}
+		switch id {
+		case 8:
+			q.KeepOptionOrder = true
+		case 9:
+			q.QuestionType = models.QuestionTypeOrdering
+		}
+		test.Questions = append(test.Questions, q)
+	}
+	return test
+}
+
+func questionIDs(questions []models.Question) []int {
+	var ids []int
+	for _, q := range questions {
+		ids = append(ids, q.ID)
+	}
+	return ids
+}
+
+func optionIDs(q models.Question) []int {
+	var ids []int
+	for _, opt := range q.Options {
+		ids = append(ids, opt.ID)
+	}
+	return ids
+}
+
+func TestLayoutAttempt_SameSeedSameLayout(t *testing.T) {
+	first := &models.TestAttempt{ShuffleSeed: 42}
+	second := &models.TestAttempt{ShuffleSeed: 42}
+	layoutAttempt(layoutTest(true, true), first)
+	layoutAttempt(layoutTest(true, true), second)
+
+	if !slices.Equal(first.QuestionOrder, second.QuestionOrder) {
+		t.Fatalf("expected the same question order, got %v and %v", first.QuestionOrder, second.QuestionOrder)
+	}
+	for id, order := range first.OptionOrder {
+		if !slices.Equal(order, second.OptionOrder[id]) {
+			t.Fatalf("question %d: expected the same option order, got %v and %v", id, order, second.OptionOrder[id])
+		}
+	}
+}
+
+func TestLayoutAttempt_ShufflesWhenAsked(t *testing.T) {
+	inOrder := []int{1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+	attempt := &models.TestAttempt{ShuffleSeed: 7}
+	layoutAttempt(layoutTest(false, false), attempt)
+	if !slices.Equal(attempt.QuestionOrder, inOrder) {
+		t.Fatalf("expected questions in test order, got %v", attempt.QuestionOrder)
+	}
+	if !slices.Equal(attempt.OptionOrder[1], []int{11, 12, 13, 14}) {
+		t.Fatalf("expected options in test order, got %v", attempt.OptionOrder[1])
+	}
+	if slices.Equal(attempt.OptionOrder[9], []int{91, 92, 93, 94}) {
+		t.Fatalf("expected an ordering question to start scrambled, got %v", attempt.OptionOrder[9])
+	}
+
+	// Some seed must move the questions and options; try a few
+	movedQuestions, movedOptions := false, false
+	for seed := int64(1); seed <= 5; seed++ {
+		attempt := &models.TestAttempt{ShuffleSeed: seed}
+		layoutAttempt(layoutTest(true, true), attempt)
+
+		movedQuestions = movedQuestions || !slices.Equal(attempt.QuestionOrder, inOrder)
+		movedOptions = movedOptions || !slices.Equal(attempt.OptionOrder[1], []int{11, 12, 13, 14})
+		if !slices.Equal(attempt.OptionOrder[8], []int{81, 82, 83, 84}) {
+			t.Fatalf("expected question 8 to keep its option order, got %v", attempt.OptionOrder[8])
+		}
+		if sorted := slices.Sorted(slices.Values(attempt.QuestionOrder)); !slices.Equal(sorted, inOrder) {
+			t.Fatalf("expected every question exactly once, got %v", attempt.QuestionOrder)
+		}
+	}
+	if !movedQuestions || !movedOptions {
+		t.Fatalf("expected shuffling to change the order (questions moved: %v, options moved: %v)", movedQuestions, movedOptions)
+	}
+}
+
+func TestTestAttemptArrange(t *testing.T) {
+	test := layoutTest(false, false)
+	attempt := &models.TestAttempt{
+		QuestionOrder: []int{3, 1, 2},
+		OptionOrder:   map[int][]int{3: {34, 33, 32, 31}},
+	}
+
+	arranged := attempt.Arrange(test.Questions)
+	if want := []int{3, 1, 2}; !slices.Equal(questionIDs(arranged), want) {
+		t.Fatalf("expected only the attempt's questions %v, got %v", want, questionIDs(arranged))
+	}
+	if want := []int{34, 33, 32, 31}; !slices.Equal(optionIDs(arranged[0]), want) {
+		t.Fatalf("expected options %v, got %v", want, optionIDs(arranged[0]))
+	}
+	if test.Questions[0].ID != 1 || test.Questions[2].Options[0].ID != 31 {
+		t.Fatalf("expected Arrange to leave the test's own questions untouched")
+	}
+
+	legacy := &models.TestAttempt{}
+	if got := questionIDs(legacy.Arrange(test.Questions)); len(got) != len(test.Questions) {
+		t.Fatalf("expected an attempt without a stored order to be asked every question, got %v", got)
+	}
+}
+
+func TestLayoutAttempt_DrawsFromPools(t *testing.T) {
+	// Questions 1-4 are the Easy pool, 5-7 the Hard pool, 8 and 9 are always asked
+	easy, hard := 10, 20
+	test := layoutTest(true, false)
+	test.Pools = []models.QuestionPool{{ID: easy, Name: "Easy", DrawCount: 2}, {ID: hard, Name: "Hard", DrawCount: 1}}
+	for i := range test.Questions {
+		switch id := test.Questions[i].ID; {
+		case id <= 4:
+			test.Questions[i].PoolID = &easy
+		case id <= 7:
+			test.Questions[i].PoolID = &hard
+		}
+	}
+	if got := test.QuestionsPerAttempt(); got != 5 {
+		t.Fatalf("expected 5 questions per attempt, got %d", got)
+	}
+
+	seen := make(map[int]bool)
+	for seed := int64(1); seed <= 20; seed++ {
+		attempt := &models.TestAttempt{ShuffleSeed: seed}
+		layoutAttempt(test, attempt)
+
+		if len(attempt.QuestionOrder) != 5 || len(attempt.OptionOrder) != 5 {
+			t.Fatalf("seed %d: expected 5 questions with option orders, got %v", seed, attempt.QuestionOrder)
+		}
+		counts := make(map[int]int)
+		for _, id := range attempt.QuestionOrder {
+			seen[id] = true
+			switch {
+			case id <= 4:
+				counts[easy]++
+			case id <= 7:
+				counts[hard]++
+			default:
+				counts[0]++
+			}
+		}
+		if counts[easy] != 2 || counts[hard] != 1 || counts[0] != 2 {
+			t.Fatalf("seed %d: expected 2 easy, 1 hard and both fixed questions, got %v", seed, attempt.QuestionOrder)
+		}
+
+		asked := attempt.Arrange(test.Questions)
+		if !slices.Equal(questionIDs(asked), attempt.QuestionOrder) {
+			t.Fatalf("seed %d: expected Arrange to return the drawn questions %v, got %v", seed, attempt.QuestionOrder, questionIDs(asked))
+		}
+	}
+	if len(seen) != len(test.Questions) {
+		t.Fatalf("expected every pooled question to be drawn by some attempt, saw %v", seen)
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"my-app/internal/models"
+)
+
+// attemptGate is what a test's attempt policy lets a user do next
+type attemptGate struct {
+	Resume  *models.TestAttempt // the attempt in progress, to continue instead of starting another
+	Blocked string              // why a new attempt may not start, empty when one may
+	Used    int                 // attempts started so far
+	OpensAt *time.Time          // when the cooldown after the last attempt ends
+}
+
+// checkAttemptPolicy decides whether a user may start a practice or a real
+// attempt at the test, given their earlier attempts at it with any expired
+// ones already closed. Only attempts in the same mode are considered, and one
+// in progress is always resumed. Students may only start published tests
+// while their availability window is open: real attempts within the test's
+// attempt limit and after its cooldown, and practice attempts, which are not
+// limited, when the test allows practice.
+// Teachers and admins may try any test as often as they like.
+func checkAttemptPolicy(test *models.Test, attempts []models.TestAttempt, role string, now time.Time, practice bool) attemptGate {
+	var gate attemptGate
+	var lastEnded time.Time
+	for i := range attempts {
+		a := &attempts[i]
+		if a.Practice != practice {
+			continue
+		}
+		gate.Used++
+		if a.Status == "in_progress" {
+			gate.Resume = a
+		}
+		if ended := attemptEndedAt(a); ended.After(lastEnded) {
+			lastEnded = ended
+		}
+	}
+	if gate.Resume != nil || role == "admin" || role == "teacher" {
+		return gate
+	}
+
+	policy := test.Attempts
+	if cooldown := time.Duration(policy.CooldownMinutes) * time.Minute; cooldown > 0 && gate.Used > 0 && !practice {
+		if opensAt := lastEnded.Add(cooldown); now.Before(opensAt) {
+			gate.OpensAt = &opensAt
+		}
+	}
+
+	switch {
+	case !test.Published:
+		gate.Blocked = "This test has not been published yet"
+	case test.NotYetOpen(now):
+		gate.Blocked = "This test opens " + test.LocalTime(test.AvailableFrom)
+	case test.Closed(now):
+		gate.Blocked = "This test closed " + test.LocalTime(test.AvailableUntil)
+	case practice && !test.AllowPractice:
+		gate.Blocked = "This test is not open for practice"
+	case practice:
+		// Practice attempts have no limit or cooldown
+	case policy.MaxAttempts > 0 && gate.Used >= policy.MaxAttempts:
+		gate.Blocked = fmt.Sprintf("You have used all %d attempts at this test", policy.MaxAttempts)
+	case gate.OpensAt != nil:
+		gate.Blocked = "You can start another attempt after " + gate.OpensAt.Format("Jan 2, 15:04")
+	}
+	return gate
+}
+
+// attemptEndedAt returns when an attempt finished: when it was completed, or
+// for an abandoned attempt when its time ran out
+func attemptEndedAt(a *models.TestAttempt) time.Time {
+	switch {
+	case a.CompletedAt != nil:
+		return *a.CompletedAt
+	case a.Deadline != nil:
+		return *a.Deadline
+	}
+	return a.StartedAt
+}
+
+// userAttemptsAt returns the user's attempts at a test, first closing any in
+// progress whose time has run out so the policy sees them as finished
+func (h *TestHandler) userAttemptsAt(ctx context.Context, userID, testID int, now time.Time) ([]models.TestAttempt, error) {
+	attempts, err := h.attemptRepo.GetByUserAndTest(ctx, userID, testID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range attempts {
+		if a := &attempts[i]; a.Status == "in_progress" && a.TimeUp(now) {
+			if err := h.closeExpiredAttempt(ctx, a, now); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return attempts, nil
+}
+
+// testProgress is a student's standing on one test in the tests list
+type testProgress struct {
+	attemptGate
+	Max    int     // attempts allowed, 0 for unlimited
+	Counts string  // which attempt counts towards the result
+	Score  float64 // the counted percentage, when Scored
+	Scored bool
+	Locked []string // prerequisites still to meet, when there is no attempt to resume
+
+	Practice *attemptGate // nil when the test does not allow practice
+}
+
+// studentProgress groups a student's attempts by test and works out, for each
+// listed test, what they may do next and the result that counts. Prerequisites
+// are judged against the whole catalogue of tests.
+func studentProgress(tests, catalogue []models.Test, attempts []models.TestAttempt, now time.Time) map[int]*testProgress {
+	byTest := make(map[int][]models.TestAttempt)
+	for _, a := range attempts {
+		byTest[a.TestID] = append(byTest[a.TestID], a)
+	}
+
+	progress := make(map[int]*testProgress, len(tests))
+	for i := range tests {
+		test := &tests[i]
+		own := byTest[test.ID]
+		p := &testProgress{
+			attemptGate: checkAttemptPolicy(test, own, "student", now, false),
+			Max:         test.Attempts.MaxAttempts,
+			Counts:      test.Attempts.Counts,
+		}
+		p.Score, p.Scored = test.Attempts.CountedPercentage(own)
+		if p.Resume == nil {
+			p.Locked = unmetPrerequisites(test, catalogue, attempts)
+		}
+		if test.AllowPractice {
+			practice := checkAttemptPolicy(test, own, "student", now, true)
+			p.Practice = &practice
+		}
+		progress[test.ID] = p
+	}
+	return progress
+}
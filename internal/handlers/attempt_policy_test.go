@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"my-app/internal/models"
+)
+
+func finishedAttempt(id int, completed time.Time) models.TestAttempt {
+	score, total := 5, 10
+	return models.TestAttempt{ID: id, Status: "completed", StartedAt: completed.Add(-10 * time.Minute), CompletedAt: &completed, Score: &score, TotalPoints: &total}
+}
+
+func TestCheckAttemptPolicy(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	test := &models.Test{ID: 1, Published: true, Attempts: models.AttemptPolicy{MaxAttempts: 2, CooldownMinutes: 60, Counts: models.CountBestAttempt}}
+
+	if gate := checkAttemptPolicy(test, nil, "student", now, false); gate.Blocked != "" || gate.Resume != nil {
+		t.Fatalf("expected a first attempt to be allowed, got %+v", gate)
+	}
+
+	inProgress := models.TestAttempt{ID: 7, Status: "in_progress", StartedAt: now.Add(-5 * time.Minute)}
+	attempts := []models.TestAttempt{finishedAttempt(6, now.Add(-3*time.Hour)), inProgress}
+	if gate := checkAttemptPolicy(test, attempts, "student", now, false); gate.Resume == nil || gate.Resume.ID != 7 {
+		t.Fatalf("expected the attempt in progress to be resumed, got %+v", gate)
+	}
+
+	recent := []models.TestAttempt{finishedAttempt(6, now.Add(-30*time.Minute))}
+	gate := checkAttemptPolicy(test, recent, "student", now, false)
+	if gate.OpensAt == nil || !gate.OpensAt.Equal(now.Add(30*time.Minute)) || !strings.Contains(gate.Blocked, "after") {
+		t.Fatalf("expected the cooldown to block until 30 minutes from now, got %+v", gate)
+	}
+	if gate := checkAttemptPolicy(test, recent, "teacher", now, false); gate.Blocked != "" {
+		t.Fatalf("expected teachers to ignore the cooldown, got %q", gate.Blocked)
+	}
+
+	used := []models.TestAttempt{finishedAttempt(5, now.Add(-5*time.Hour)), finishedAttempt(6, now.Add(-3*time.Hour))}
+	if gate := checkAttemptPolicy(test, used, "student", now, false); gate.Used != 2 || !strings.Contains(gate.Blocked, "all 2 attempts") {
+		t.Fatalf("expected the attempt limit to block, got %+v", gate)
+	}
+
+	// Practice attempts are counted apart and never limited, when the test allows them
+	practiced := append(used, models.TestAttempt{ID: 8, Status: "in_progress", StartedAt: now, Practice: true})
+	if gate := checkAttemptPolicy(test, used, "student", now, true); gate.Blocked == "" {
+		t.Fatalf("expected practice to be closed on a test that does not allow it")
+	}
+	test.AllowPractice = true
+	if gate := checkAttemptPolicy(test, practiced, "student", now, true); gate.Resume == nil || gate.Resume.ID != 8 || gate.Used != 1 {
+		t.Fatalf("expected the practice attempt to be resumed, got %+v", gate)
+	}
+	if gate := checkAttemptPolicy(test, used, "student", now, true); gate.Blocked != "" || gate.Used != 0 {
+		t.Fatalf("expected practice to stay open after the attempt limit is reached, got %+v", gate)
+	}
+	if gate := checkAttemptPolicy(test, practiced, "student", now, false); gate.Resume != nil || gate.Used != 2 {
+		t.Fatalf("expected a practice attempt not to count as a real one, got %+v", gate)
+	}
+
+	draft := &models.Test{ID: 2}
+	if gate := checkAttemptPolicy(draft, nil, "student", now, false); gate.Blocked == "" {
+		t.Fatalf("expected students to be kept out of an unpublished test")
+	}
+	if gate := checkAttemptPolicy(draft, nil, "admin", now, false); gate.Blocked != "" {
+		t.Fatalf("expected admins to try an unpublished test, got %q", gate.Blocked)
+	}
+
+	// Students may only start a test inside its availability window
+	opens, closes := now.Add(time.Hour), now.Add(3*time.Hour)
+	scheduled := &models.Test{ID: 3, Published: true, AllowPractice: true, AvailableFrom: &opens, AvailableUntil: &closes}
+	if gate := checkAttemptPolicy(scheduled, nil, "student", now, true); !strings.Contains(gate.Blocked, "opens") {
+		t.Fatalf("expected the test to be closed before its window opens, got %+v", gate)
+	}
+	if gate := checkAttemptPolicy(scheduled, nil, "student", opens, false); gate.Blocked != "" {
+		t.Fatalf("expected the test to be open inside its window, got %q", gate.Blocked)
+	}
+	if gate := checkAttemptPolicy(scheduled, nil, "student", closes, false); !strings.Contains(gate.Blocked, "closed") {
+		t.Fatalf("expected the test to be closed once its window closes, got %+v", gate)
+	}
+	if gate := checkAttemptPolicy(scheduled, nil, "teacher", closes, false); gate.Blocked != "" {
+		t.Fatalf("expected teachers to try a test outside its window, got %q", gate.Blocked)
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"my-app/internal/models"
+)
+
+// SweepAttempts closes in-progress attempts whose time ran out more than the
+// grace period ago, and abandons practice attempts left idle for longer than
+// models.PracticeIdleTimeout. An attempt that cannot be closed is logged and
+// left for the next sweep.
+func (h *TestHandler) SweepAttempts(ctx context.Context, now time.Time) (completed, abandoned int, err error) {
+	attempts, err := h.attemptRepo.GetExpired(ctx, now.Add(-models.SubmissionGrace))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for i := range attempts {
+		if err := h.closeExpiredAttempt(ctx, &attempts[i], now); err != nil {
+			log.Printf("Error closing expired attempt %d: %v", attempts[i].ID, err)
+			continue
+		}
+		switch attempts[i].Status {
+		case "completed":
+			completed++
+		case "abandoned":
+			abandoned++
+		}
+	}
+
+	// Practice attempts are never counted in results or stats, so one left
+	// idle is abandoned whatever it answered
+	idle, err := h.attemptRepo.GetIdlePractice(ctx, now.Add(-models.PracticeIdleTimeout))
+	if err != nil {
+		return completed, abandoned, err
+	}
+	for _, attempt := range idle {
+		ok, err := h.attemptRepo.Abandon(ctx, attempt.ID)
+		if err != nil {
+			log.Printf("Error abandoning idle practice attempt %d: %v", attempt.ID, err)
+			continue
+		}
+		if ok {
+			abandoned++
+		}
+	}
+
+	return completed, abandoned, nil
+}
+
+// closeExpiredAttempt ends an attempt whose time has run out. Attempts with
+// saved answers are completed and scored from them, as if the student had
+// submitted at the deadline; attempts the student left without answering
+// anything are marked abandoned so they do not count as a test taken. The
+// attempt's Status is updated to match.
+func (h *TestHandler) closeExpiredAttempt(ctx context.Context, attempt *models.TestAttempt, now time.Time) error {
+	answers, err := h.attemptRepo.GetAnswersByAttemptID(ctx, attempt.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(answers) == 0 {
+		if _, err := h.attemptRepo.Abandon(ctx, attempt.ID); err != nil {
+			return err
+		}
+		attempt.Status = "abandoned"
+		return nil
+	}
+
+	if err := h.finishAttempt(ctx, attempt, now); err != nil {
+		return err
+	}
+	attempt.Status = "completed"
+	return nil
+}
+
+// RunSweeper sweeps expired attempts every interval until ctx is cancelled
+func (h *TestHandler) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		completed, abandoned, err := h.SweepAttempts(ctx, time.Now())
+		if err != nil {
+			log.Printf("Error sweeping expired attempts: %v", err)
+		} else if completed > 0 || abandoned > 0 {
+			log.Printf("Swept expired attempts: %d completed, %d abandoned", completed, abandoned)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"my-app/internal/dbtest"
+	"my-app/internal/models"
+	"my-app/internal/repository"
+)
+
+func TestSweepAbandonsIdlePractice(t *testing.T) {
+	pool := dbtest.Pool(t)
+	teacherID := dbtest.User(t, pool, "teacher")
+	ctx := context.Background()
+	testRepo := repository.NewTestRepository(pool)
+	userRepo := repository.NewUserRepository(pool)
+	attemptRepo := repository.NewAttemptRepository(pool)
+	h := NewTestHandler(testRepo, attemptRepo, userRepo)
+
+	test, err := persistTestUpload(ctx, testRepo, uploadWithQuestion(models.QuestionUpload{
+		QuestionText: "Where was the battle of 1066?", Options: []string{"Hastings", "Agincourt"}, Points: 1,
+	}), teacherID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { testRepo.DeleteTest(ctx, test.ID) })
+	question := test.Questions[0]
+
+	// Two students started practising two days ago: one answered then and
+	// left, the other answered a moment ago
+	now := time.Now()
+	started := now.Add(-48 * time.Hour)
+	practise := func(answeredAt time.Time) (attemptID, studentID int) {
+		studentID = dbtest.User(t, pool, "student")
+		if err := userRepo.InitializeUserStats(ctx, studentID); err != nil {
+			t.Fatal(err)
+		}
+		attempt := &models.TestAttempt{UserID: studentID, TestID: test.ID, StartedAt: started, Status: "in_progress", Practice: true}
+		if err := attemptRepo.Create(ctx, attempt); err != nil {
+			t.Fatal(err)
+		}
+		correct := true
+		answer := &models.StudentAnswer{AttemptID: attempt.ID, QuestionID: question.ID, SelectedOptionID: &question.Options[0].ID, IsCorrect: &correct}
+		if err := attemptRepo.SaveAnswer(ctx, answer); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pool.Exec(ctx, `UPDATE student_answers SET answered_at = $1 WHERE id = $2`, answeredAt, answer.ID); err != nil {
+			t.Fatal(err)
+		}
+		return attempt.ID, studentID
+	}
+	idleID, idleStudentID := practise(started)
+	activeID, _ := practise(now)
+
+	if _, _, err := h.SweepAttempts(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+
+	idle, err := attemptRepo.GetByID(ctx, idleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idle.Status != "abandoned" {
+		t.Errorf("expected the idle practice attempt abandoned, got %q", idle.Status)
+	}
+	stats, err := userRepo.GetUserStats(ctx, idleStudentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TestsCompleted != 0 || stats.TotalPoints != 0 {
+		t.Errorf("expected the abandoned practice attempt left out of stats, got %+v", stats)
+	}
+
+	active, err := attemptRepo.GetByID(ctx, activeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active.Status != "in_progress" {
+		t.Errorf("expected the practice attempt answered a moment ago left in progress, got %q", active.Status)
+	}
+}
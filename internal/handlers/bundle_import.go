@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"my-app/internal/auth"
+	"my-app/internal/bundle"
+	"my-app/internal/models"
+	"my-app/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// importJobKeep is how long a finished bundle import's report can be read
+const importJobKeep = 24 * time.Hour
+
+// importJobs are the bundle imports started since the server was, each run in
+// the background and polled for its progress
+type importJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*importJob
+}
+
+func newImportJobs() *importJobs {
+	return &importJobs{jobs: make(map[string]*importJob)}
+}
+
+// importJob is one bundle import and its report so far
+type importJob struct {
+	ID        string
+	OwnerID   int
+	Total     int
+	StartedAt time.Time
+
+	mu         sync.Mutex
+	results    []bundleResult
+	finishedAt *time.Time
+}
+
+// bundleResult reports what became of one test of a bundle
+type bundleResult struct {
+	File   string            `json:"file"`
+	Title  string            `json:"title,omitempty"`
+	TestID int               `json:"test_id,omitempty"`
+	Error  string            `json:"error,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"` // validation errors, keyed like an upload's
+}
+
+// start registers a job for the owner's bundle, forgetting jobs finished
+// longer ago than importJobKeep
+func (j *importJobs) start(ownerID, total int, now time.Time) *importJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for id, job := range j.jobs {
+		if finished := job.finished(); finished != nil && now.Sub(*finished) > importJobKeep {
+			delete(j.jobs, id)
+		}
+	}
+	job := &importJob{ID: uuid.New().String(), OwnerID: ownerID, Total: total, StartedAt: now}
+	j.jobs[job.ID] = job
+	return job
+}
+
+// get returns the user's job with the given ID, or nil when they have none
+func (j *importJobs) get(id string, userID int) *importJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if job, ok := j.jobs[id]; ok && job.OwnerID == userID {
+		return job
+	}
+	return nil
+}
+
+func (job *importJob) add(result bundleResult) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.results = append(job.results, result)
+}
+
+func (job *importJob) finish(now time.Time) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.finishedAt = &now
+}
+
+func (job *importJob) finished() *time.Time {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.finishedAt
+}
+
+// report is the job's progress as ShowBundleImport returns it
+func (job *importJob) report() map[string]interface{} {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	succeeded := 0
+	for _, r := range job.results {
+		if r.TestID != 0 {
+			succeeded++
+		}
+	}
+	status := "running"
+	if job.finishedAt != nil {
+		status = "finished"
+	}
+	return map[string]interface{}{
+		"success":   true,
+		"job_id":    job.ID,
+		"status":    status,
+		"total":     job.Total,
+		"done":      len(job.results),
+		"succeeded": succeeded,
+		"failed":    len(job.results) - succeeded,
+		"results":   append([]bundleResult(nil), job.results...),
+	}
+}
+
+// ImportBundle starts importing the zip archive of tests in the form's "file"
+// field, described in package bundle, and returns the job to poll at once.
+// Each test is stored in a transaction of its own, so one that fails does not
+// stop the rest.
+func (h *TeacherHandler) ImportBundle(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSessionData(r)
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeUploadError(w, http.StatusBadRequest, fmt.Sprintf("Invalid upload: %v", err))
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeUploadError(w, http.StatusBadRequest, "Choose a .zip archive of tests to upload")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, bundle.MaxBundleSize+1))
+	if err != nil || len(data) > bundle.MaxBundleSize {
+		writeUploadError(w, http.StatusBadRequest, fmt.Sprintf("The archive is larger than %d MB", bundle.MaxBundleSize>>20))
+		return
+	}
+	b, err := bundle.Read(data)
+	if err != nil {
+		writeUploadError(w, http.StatusBadRequest, fmt.Sprintf("Could not read the archive: %v", err))
+		return
+	}
+
+	job := h.imports.start(session.UserID, len(b.Entries), time.Now())
+	// The import outlives the request, so it is not cancelled with it
+	go runBundleImport(context.Background(), h.testRepo, job, b)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"job_id":  job.ID,
+		"total":   job.Total,
+	})
+}
+
+// ShowBundleImport reports the progress of one of the user's bundle imports,
+// with what became of each test imported so far
+func (h *TeacherHandler) ShowBundleImport(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSessionData(r)
+
+	job := h.imports.get(r.PathValue("job"), session.UserID)
+	if job == nil {
+		writeUploadError(w, http.StatusNotFound, "Import not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.report())
+}
+
+// runBundleImport imports the bundle's tests in the manifest's order,
+// reporting each to the job as it is done
+func runBundleImport(ctx context.Context, repo *repository.TestRepository, job *importJob, b *bundle.Bundle) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("Bundle import %s stopped: %v", job.ID, p)
+		}
+		job.finish(time.Now())
+	}()
+
+	for i := range b.Entries {
+		job.add(importBundleTest(ctx, repo, b.Test(i), job.OwnerID))
+	}
+	log.Printf("Bundle import %s finished: %d tests", job.ID, job.Total)
+}
+
+// importBundleTest validates and stores one test of a bundle
+func importBundleTest(ctx context.Context, repo *repository.TestRepository, t bundle.Test, createdBy int) bundleResult {
+	result := bundleResult{File: t.Entry.File, Title: t.Upload.Title}
+	if t.Problem != "" {
+		result.Error = t.Problem
+		return result
+	}
+
+	upload, errors := bundleUpload(t)
+	if len(errors) > 0 {
+		result.Errors = errors
+		return result
+	}
+
+	test, err := persistTestUpload(ctx, repo, upload, createdBy)
+	if err != nil {
+		log.Printf("Error importing %s from a bundle: %v", t.Entry.File, err)
+		result.Error = fmt.Sprintf("Failed to create test: %v", err)
+		return result
+	}
+	result.TestID = test.ID
+	return result
+}
+
+// bundleUpload embeds the images a bundled test's questions refer to by path
+// as data URLs, so the test is stored like an uploaded one, and validates it
+func bundleUpload(t bundle.Test) (models.TestUpload, map[string]string) {
+	upload := t.Upload
+	upload.Questions = append([]models.QuestionUpload(nil), t.Upload.Questions...)
+
+	errors := make(map[string]string)
+	for i := range upload.Questions {
+		q := &upload.Questions[i]
+		for field, url := range map[string]*string{"image_url": &q.ImageURL, "explanation_image_url": &q.ExplanationImageURL} {
+			image, ok := t.Images[*url]
+			if !ok {
+				continue
+			}
+			embedded, ok := imageDataURL(image.Name, image.Data)
+			if !ok {
+				errors[fmt.Sprintf("question_%d_%s", i+1, field)] = fmt.Sprintf("%s is not a JPEG, PNG, GIF or WebP image", *url)
+				continue
+			}
+			*url = embedded
+		}
+	}
+	if len(errors) > 0 {
+		return upload, errors
+	}
+	return upload, validateTestUpload(upload)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"my-app/internal/bundle"
+	"my-app/internal/models"
+	"my-app/internal/repository"
+	"my-app/internal/storage"
+)
+
+func TestBundleUpload(t *testing.T) {
+	upload := uploadWithQuestion(models.QuestionUpload{
+		QuestionText: "1066?", Options: []string{"Hastings", "Agincourt"}, Points: 1,
+		ImageURL: "images/map.png", ExplanationImageURL: "https://example.com/tapestry.jpg",
+	})
+	test := bundle.Test{Upload: upload, Images: map[string]bundle.File{"images/map.png": {Name: "map.png", Data: []byte("png")}}}
+
+	got, errs := bundleUpload(test)
+	if len(errs) != 0 {
+		t.Fatalf("expected the test valid, got %v", errs)
+	}
+	if q := got.Questions[0]; q.ImageURL != "data:image/png;base64,cG5n" || q.ExplanationImageURL != "https://example.com/tapestry.jpg" {
+		t.Errorf("expected only the archive's image embedded, got %q and %q", q.ImageURL, q.ExplanationImageURL)
+	}
+	if upload.Questions[0].ImageURL != "images/map.png" {
+		t.Error("expected the bundle's test left unchanged")
+	}
+
+	test.Images["images/map.png"] = bundle.File{Name: "map.svg", Data: []byte("<svg/>")}
+	if _, errs := bundleUpload(test); !strings.Contains(errs["question_1_image_url"], "images/map.png is not a JPEG") {
+		t.Errorf("expected an image of the wrong type reported, got %v", errs)
+	}
+}
+
+func TestImportJobs(t *testing.T) {
+	jobs := newImportJobs()
+	now := time.Now()
+	old := jobs.start(1, 1, now.Add(-48*time.Hour))
+	old.finish(now.Add(-25 * time.Hour))
+
+	job := jobs.start(1, 2, now)
+	if jobs.get(old.ID, 1) != nil {
+		t.Error("expected a job finished over a day ago forgotten")
+	}
+	if jobs.get(job.ID, 2) != nil {
+		t.Error("expected another user's job hidden")
+	}
+	if jobs.get(job.ID, 1) != job {
+		t.Fatal("expected the owner's job found")
+	}
+
+	job.add(bundleResult{File: "a.json", TestID: 7})
+	job.add(bundleResult{File: "b.json", Error: "b.json is not in the archive"})
+	report := job.report()
+	if report["status"] != "running" || report["done"] != 2 || report["succeeded"] != 1 || report["failed"] != 1 {
+		t.Errorf("unexpected report %v", report)
+	}
+	job.finish(now)
+	if report := job.report(); report["status"] != "finished" {
+		t.Errorf("expected the job finished, got %v", report)
+	}
+}
+
+func TestImportBundleTestInTx(t *testing.T) {
+	upload := uploadWithQuestion(models.QuestionUpload{
+		QuestionText: "1066?", Options: []string{"Hastings", "Agincourt"}, Points: 1, ImageURL: "images/map.png",
+	})
+	testJSON, err := json.Marshal(upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range map[string][]byte{
+		bundle.ManifestName:      []byte(`{"tests": [{"file": "history/test.json", "notes": "notes.pdf"}, {"file": "missing.json"}]}`),
+		"history/test.json":      testJSON,
+		"history/images/map.png": []byte("png"),
+		"notes.pdf":              []byte("%PDF-1.4"),
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := bundle.Read(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inTestTx(t, func(ctx context.Context, tx *repository.TestRepository, teacherID int) error {
+		result := importBundleTest(ctx, tx, b.Test(0), teacherID)
+		if result.TestID == 0 {
+			t.Fatalf("expected the bundled test stored, got %+v", result)
+		}
+		removeUploads(t, result.TestID)
+
+		stored, err := tx.GetByID(ctx, result.TestID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.NotesFilename == nil {
+			t.Error("expected the manifest's notes stored")
+		} else {
+			t.Cleanup(func() { storage.DeleteNotesFile(*stored.NotesFilename) })
+		}
+		if len(stored.Questions) != 1 || stored.Questions[0].ImageURL == nil ||
+			*stored.Questions[0].ImageURL != "/assets/uploads/"+strconv.Itoa(stored.ID)+"/question_1.png" {
+			t.Errorf("expected the question stored with the archive's image, got %+v", stored.Questions)
+		}
+
+		if result := importBundleTest(ctx, tx, b.Test(1), teacherID); result.TestID != 0 || result.Error != "missing.json is not in the archive" {
+			t.Errorf("expected a test missing from the archive reported, got %+v", result)
+		}
+		return errRollback
+	})
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"my-app/internal/models"
+	"my-app/internal/repository"
+)
+
+// hintState is what an attempt has seen of a question's hints
+type hintState struct {
+	Revealed  []models.Hint // in the order they were revealed; a since-deleted hint has no text
+	Remaining int           // hints not yet revealed
+	NextCost  float64       // points the next hint takes off a fully correct answer
+	Cost      float64       // share of the question's points the revealed hints cost
+}
+
+// nextHint returns the first of the question's hints the attempt has not
+// revealed, or nil when every hint has been shown
+func nextHint(q *models.Question, reveals []models.HintReveal) *models.Hint {
+	for i := range q.Hints {
+		if !hintRevealed(q.Hints[i].ID, reveals) {
+			return &q.Hints[i]
+		}
+	}
+	return nil
+}
+
+func hintRevealed(hintID int, reveals []models.HintReveal) bool {
+	return slices.ContainsFunc(reveals, func(h models.HintReveal) bool {
+		return h.HintID != nil && *h.HintID == hintID
+	})
+}
+
+// hintStates works out, for every question with hints or revealed hints, what
+// the attempt has revealed and what revealing the next hint would cost
+func hintStates(test *models.Test, reveals []models.HintReveal) map[int]*hintState {
+	states := make(map[int]*hintState) // questionID -> hints
+	for i := range test.Questions {
+		q := &test.Questions[i]
+		state := &hintState{}
+		for _, h := range reveals {
+			if h.QuestionID != q.ID {
+				continue
+			}
+			hint := models.Hint{QuestionID: q.ID}
+			if h.HintID != nil {
+				if idx := slices.IndexFunc(q.Hints, func(qh models.Hint) bool { return qh.ID == *h.HintID }); idx >= 0 {
+					hint = q.Hints[idx]
+				}
+			}
+			state.Revealed = append(state.Revealed, hint)
+			state.Cost = min(state.Cost+h.Penalty, 1)
+		}
+		for _, hint := range q.Hints {
+			if !hintRevealed(hint.ID, reveals) {
+				state.Remaining++
+			}
+		}
+		if len(q.Hints) == 0 && len(state.Revealed) == 0 {
+			continue
+		}
+		if next := nextHint(q, reveals); next != nil {
+			state.NextCost = next.PenaltyUnder(test.Scoring) * float64(q.Points)
+		}
+		states[q.ID] = state
+	}
+	return states
+}
+
+// attemptHints is the hints one attempt at a test revealed, for the teacher's report
+type attemptHints struct {
+	AttemptID int
+	Username  string
+	StartedAt time.Time
+	Practice  bool
+	Questions []questionHints // in question order
+}
+
+// questionHints is the hints an attempt revealed for one question
+type questionHints struct {
+	QuestionOrder int
+	HintOrders    []int   // which hints, by position; 0 for a hint since deleted
+	Cost          float64 // share of the question's points they cost
+}
+
+// groupHintUsage groups the hints revealed at a test by attempt, keeping the
+// order GetHintUsage lists them in
+func groupHintUsage(test *models.Test, uses []repository.HintUse) []attemptHints {
+	questionOrder := make(map[int]int, len(test.Questions))
+	for _, q := range test.Questions {
+		questionOrder[q.ID] = q.QuestionOrder
+	}
+
+	var grouped []attemptHints
+	for _, use := range uses {
+		if len(grouped) == 0 || grouped[len(grouped)-1].AttemptID != use.AttemptID {
+			grouped = append(grouped, attemptHints{AttemptID: use.AttemptID, Username: use.Username, StartedAt: use.StartedAt, Practice: use.Practice})
+		}
+		attempt := &grouped[len(grouped)-1]
+
+		order := questionOrder[use.QuestionID]
+		idx := slices.IndexFunc(attempt.Questions, func(q questionHints) bool { return q.QuestionOrder == order })
+		if idx < 0 {
+			attempt.Questions = append(attempt.Questions, questionHints{QuestionOrder: order})
+			idx = len(attempt.Questions) - 1
+		}
+		q := &attempt.Questions[idx]
+		hintOrder := 0
+		if use.HintOrder != nil {
+			hintOrder = *use.HintOrder
+		}
+		q.HintOrders = append(q.HintOrders, hintOrder)
+		q.Cost = min(q.Cost+use.Penalty, 1)
+	}
+
+	for i := range grouped {
+		slices.SortFunc(grouped[i].Questions, func(a, b questionHints) int { return cmp.Compare(a.QuestionOrder, b.QuestionOrder) })
+	}
+	return grouped
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"my-app/internal/models"
+	"my-app/internal/repository"
+)
+
+func TestHintStates(t *testing.T) {
+	half := 0.5
+	test := &models.Test{Scoring: models.ScoringPolicy{HintPenalty: 0.25}, Questions: []models.Question{
+		{ID: 1, Points: 4, QuestionOrder: 1, Hints: []models.Hint{
+			{ID: 10, HintText: "first", HintOrder: 1},
+			{ID: 11, HintText: "second", HintOrder: 2, Penalty: &half},
+		}},
+		{ID: 2, Points: 2, QuestionOrder: 2},
+	}}
+
+	states := hintStates(test, nil)
+	if len(states) != 1 || states[1].Remaining != 2 || states[1].NextCost != 1 || states[1].Cost != 0 {
+		t.Fatalf("expected only question 1 with two hints left at 1 point next, got %+v", states[1])
+	}
+
+	hintID := 10
+	reveals := []models.HintReveal{{QuestionID: 1, HintID: &hintID, Penalty: 0.25}}
+	if next := nextHint(&test.Questions[0], reveals); next == nil || next.ID != 11 {
+		t.Fatalf("expected the second hint next, got %+v", next)
+	}
+	state := hintStates(test, reveals)[1]
+	if state.Remaining != 1 || state.NextCost != 2 || state.Cost != 0.25 || state.Revealed[0].HintText != "first" {
+		t.Fatalf("expected one hint revealed and the half-penalty hint next, got %+v", state)
+	}
+
+	// A revealed hint that has since been deleted still counts, and the
+	// cost never goes past the question's points
+	reveals = append(reveals, models.HintReveal{QuestionID: 1, Penalty: 0.9})
+	state = hintStates(test, reveals)[1]
+	if len(state.Revealed) != 2 || state.Revealed[1].HintText != "" || state.Cost != 1 {
+		t.Fatalf("expected the deleted hint kept and the cost capped at 1, got %+v", state)
+	}
+}
+
+func TestGroupHintUsage(t *testing.T) {
+	test := &models.Test{Questions: []models.Question{{ID: 1, QuestionOrder: 1}, {ID: 2, QuestionOrder: 2}}}
+	first, second := 1, 2
+	uses := []repository.HintUse{
+		{AttemptID: 7, Username: "amy", QuestionID: 2, HintOrder: &first, Penalty: 0.25},
+		{AttemptID: 7, Username: "amy", QuestionID: 1, HintOrder: &first, Penalty: 0.25},
+		{AttemptID: 7, Username: "amy", QuestionID: 1, HintOrder: &second, Penalty: 0.5},
+		{AttemptID: 9, Username: "ben", QuestionID: 1, Penalty: 0.25},
+	}
+
+	grouped := groupHintUsage(test, uses)
+	if len(grouped) != 2 || grouped[0].Username != "amy" || grouped[1].Username != "ben" {
+		t.Fatalf("expected one row per attempt, got %+v", grouped)
+	}
+	amy := grouped[0].Questions
+	if len(amy) != 2 || amy[0].QuestionOrder != 1 || !slices.Equal(amy[0].HintOrders, []int{1, 2}) || amy[0].Cost != 0.75 {
+		t.Fatalf("expected question 1 first with both hints, got %+v", amy)
+	}
+	if ben := grouped[1].Questions; !slices.Equal(ben[0].HintOrders, []int{0}) {
+		t.Fatalf("expected a deleted hint listed as 0, got %+v", ben)
+	}
+}
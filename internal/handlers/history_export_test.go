@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"math"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"my-app/internal/models"
+)
+
+func TestHistoryCSVRow(t *testing.T) {
+	started := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
+	completed := started.Add(20 * time.Minute)
+	score, total, secs := 13, 20, 1200
+	grade := "6"
+	attempt := &models.TestAttempt{
+		Status: "completed", StartedAt: started, CompletedAt: &completed,
+		Score: &score, TotalPoints: &total, TimeTakenSeconds: &secs, Grade: &grade,
+		User: &models.User{Username: "=amy"}, Test: &models.Test{Title: "Forces", ExamStandard: "GCSE", Difficulty: "Medium"},
+	}
+
+	row := historyCSVRow(attempt)
+	want := []string{"'=amy", "Forces", "GCSE", "Medium", "false", "completed", "13", "20", "65.0", "6",
+		"2025-06-02 09:00:00", "2025-06-02 09:20:00", "1200"}
+	if !slices.Equal(row, want) {
+		t.Fatalf("expected %q, got %q", want, row)
+	}
+	if len(row) != len(historyCSVHeader) {
+		t.Fatalf("expected a value for each of the %d columns, got %d", len(historyCSVHeader), len(row))
+	}
+
+	inProgress := historyCSVRow(&models.TestAttempt{Status: "in_progress", StartedAt: started})
+	if strings.Join(inProgress[6:10], "") != "" || inProgress[11] != "" {
+		t.Fatalf("expected no score or grade before completion, got %q", inProgress)
+	}
+}
+
+func TestParseGradeBoundariesForm(t *testing.T) {
+	current := models.GradeBoundaries{{Grade: "A", MinPercent: 70}}
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Form = url.Values{}
+	if got := parseGradeBoundariesForm(r, current); !slices.Equal(got, current) {
+		t.Fatalf("expected the current boundaries kept without boundary rows, got %v", got)
+	}
+
+	r.Form = url.Values{
+		"boundary_grade":   {" 9 ", "", "4", "x"},
+		"boundary_percent": {"80", "", "37.5", "lots"},
+	}
+	got := parseGradeBoundariesForm(r, current)
+	if len(got) != 3 || got[0] != (models.GradeBoundary{Grade: "9", MinPercent: 80}) || got[1].MinPercent != 37.5 || !math.IsNaN(got[2].MinPercent) {
+		t.Fatalf("expected blank rows dropped and a bad percentage kept as NaN, got %v", got)
+	}
+
+	r.Form = url.Values{"boundary_grade": {"", ""}, "boundary_percent": {"", ""}}
+	if got := parseGradeBoundariesForm(r, current); len(got) != 0 {
+		t.Fatalf("expected all-blank rows to clear the override, got %v", got)
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"my-app/internal/models"
+	"my-app/internal/repository"
+	"my-app/internal/storage"
+)
+
+// questionKey matches the validation error keys of one question
+var questionKey = regexp.MustCompile(`^question_(\d+)_`)
+
+// invalidQuestions validates a test read from another platform's file. It
+// returns the problems of each question that failed validation, by index,
+// apart from the errors of the test itself.
+func invalidQuestions(upload models.TestUpload) (map[int]string, map[string]string) {
+	found := make(map[int][]string)
+	errors := make(map[string]string)
+	for key, msg := range validateTestUpload(upload) {
+		if m := questionKey.FindStringSubmatch(key); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			found[n-1] = append(found[n-1], msg)
+			continue
+		}
+		errors[key] = msg
+	}
+
+	problems := make(map[int]string, len(found))
+	for i, msgs := range found {
+		sort.Strings(msgs)
+		problems[i] = strings.Join(msgs, "; ")
+	}
+	return problems, errors
+}
+
+// unstorableImage explains why an imported image was left out
+func unstorableImage(name string) string {
+	return fmt.Sprintf("imported without its image %s, which is not a JPEG, PNG, GIF or WebP", name)
+}
+
+// importedFile is an image or notes file carried in an import, stored once
+// the test or question it belongs to has been
+type importedFile struct {
+	name string
+	data []byte
+}
+
+// savedFiles are the files an import stored, to remove should it fail
+type savedFiles struct {
+	uploadDirs []string
+	notes      []string
+}
+
+func (s *savedFiles) remove() {
+	for _, dir := range s.uploadDirs {
+		os.RemoveAll(dir)
+	}
+	for _, filename := range s.notes {
+		if err := storage.DeleteNotesFile(filename); err != nil {
+			log.Printf("Error removing imported notes: %v", err)
+		}
+	}
+}
+
+// storeImportedImages stores the images a newly created test's questions were
+// imported with, which images gives by question order, and points the
+// questions at them. It returns the test as stored.
+func storeImportedImages(ctx context.Context, repo *repository.TestRepository, testID int, images func(order int) (image, explanation *importedFile), saved *savedFiles) (*models.Test, error) {
+	test, err := repo.GetByID(ctx, testID)
+	if err != nil {
+		return nil, err
+	}
+	saved.uploadDirs = append(saved.uploadDirs, filepath.Join("assets", "uploads", strconv.Itoa(test.ID)))
+
+	for i := range test.Questions {
+		q := &test.Questions[i]
+		image, explanation := images(q.QuestionOrder)
+		if image == nil && explanation == nil {
+			continue
+		}
+		if image != nil {
+			url, err := saveUploadedImage(test.ID, fmt.Sprintf("question_%d", q.QuestionOrder), bytes.NewReader(image.data), image.name)
+			if err != nil {
+				return nil, err
+			}
+			q.ImageURL = &url
+		}
+		if explanation != nil {
+			url, err := saveUploadedImage(test.ID, fmt.Sprintf("explanation_%d", q.QuestionOrder), bytes.NewReader(explanation.data), explanation.name)
+			if err != nil {
+				return nil, err
+			}
+			q.ExplanationImageURL = &url
+		}
+		if err := repo.UpdateQuestion(ctx, q); err != nil {
+			return nil, err
+		}
+	}
+	return test, nil
+}
+
+// storeImportedNotes stores the notes a newly created test was imported with
+// and attaches them to it
+func storeImportedNotes(ctx context.Context, repo *repository.TestRepository, testID int, notes *importedFile, saved *savedFiles) error {
+	filename, err := storage.SaveNotesFile(bytes.NewReader(notes.data), notes.name)
+	if err != nil {
+		return err
+	}
+	saved.notes = append(saved.notes, filename)
+	return repo.UpdateTestNotes(ctx, testID, &filename)
+}
+
+// embeddedImageTypes are the media types of the images an upload may carry
+// in a data URL, the first extension for a type being the one it is stored as
+var embeddedImageTypes = []struct{ ext, mediaType string }{
+	{".png", "image/png"},
+	{".jpg", "image/jpeg"},
+	{".jpeg", "image/jpeg"},
+	{".gif", "image/gif"},
+	{".webp", "image/webp"},
+}
+
+// imageDataURL embeds an image in a base64 data URL, reporting false for a
+// type an upload cannot carry
+func imageDataURL(name string, data []byte) (string, bool) {
+	ext := strings.ToLower(path.Ext(name))
+	for _, t := range embeddedImageTypes {
+		if t.ext == ext {
+			return "data:" + t.mediaType + ";base64," + base64.StdEncoding.EncodeToString(data), true
+		}
+	}
+	return "", false
+}
+
+// parseImageDataURL reads the image embedded in a base64 data URL, returning
+// nil for a URL that is not a data URL
+func parseImageDataURL(url string) (*importedFile, error) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return nil, nil
+	}
+	meta, encoded, ok := strings.Cut(rest, ",")
+	mediaType, isBase64 := strings.CutSuffix(meta, ";base64")
+	if !ok || !isBase64 {
+		return nil, fmt.Errorf("Embedded images must be base64 encoded data URLs")
+	}
+	for _, t := range embeddedImageTypes {
+		if t.mediaType == strings.ToLower(mediaType) {
+			data, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("Embedded image is not valid base64")
+			}
+			return &importedFile{name: "image" + t.ext, data: data}, nil
+		}
+	}
+	return nil, fmt.Errorf("Embedded images must be JPEG, PNG, GIF or WebP, not %q", mediaType)
+}
+
+// readStoredAsset reads an image stored under /assets/, reporting false for
+// images elsewhere or no longer stored
+func readStoredAsset(url string) ([]byte, bool) {
+	rel, ok := strings.CutPrefix(url, "/assets/")
+	if !ok {
+		return nil, false
+	}
+	rel = path.Clean("/" + rel)[1:]
+	if rel == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(filepath.Join("assets", filepath.FromSlash(rel)))
+	if err != nil {
+		log.Printf("Error reading %s for export: %v", url, err)
+		return nil, false
+	}
+	return data, true
+}
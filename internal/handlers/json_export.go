@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"my-app/internal/models"
+	"my-app/internal/storage"
+)
+
+// ExportJSON downloads the test in the JSON upload schema, so that uploading
+// the file through /teacher/upload creates the same test. Stored images are
+// embedded as data URLs and the notes as base64, so the file stands alone,
+// e.g. to move a test from one server to another.
+func (h *TeacherHandler) ExportJSON(w http.ResponseWriter, r *http.Request) {
+	test, ok := h.testForAuthor(w, r)
+	if !ok {
+		return
+	}
+
+	upload := exportUpload(test)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="test-%d.json"`, test.ID))
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(upload)
+}
+
+// exportUpload returns the test in the upload schema with its stored images
+// and notes embedded. Images hosted elsewhere keep their URL.
+func exportUpload(test *models.Test) models.TestUpload {
+	upload := test.Upload()
+	for i := range upload.Questions {
+		q := &upload.Questions[i]
+		for _, url := range []*string{&q.ImageURL, &q.ExplanationImageURL} {
+			data, ok := readStoredAsset(*url)
+			if !ok {
+				continue
+			}
+			if embedded, ok := imageDataURL(*url, data); ok {
+				*url = embedded
+			}
+		}
+	}
+
+	if test.NotesFilename != nil {
+		data, err := os.ReadFile(storage.GetNotesFilePath(*test.NotesFilename))
+		if err != nil {
+			log.Printf("Error reading notes for JSON export of test %d: %v", test.ID, err)
+		} else {
+			upload.Notes = &models.FileUpload{Filename: *test.NotesFilename, Data: data}
+		}
+	}
+	return upload
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"my-app/internal/models"
+	"my-app/internal/repository"
+)
+
+func TestImageDataURLRoundTrip(t *testing.T) {
+	url, ok := imageDataURL("/assets/uploads/3/question_1.JPEG", []byte("jpeg"))
+	if !ok || url != "data:image/jpeg;base64,anBlZw==" {
+		t.Fatalf("unexpected data URL %q", url)
+	}
+	image, err := parseImageDataURL(url)
+	if err != nil || image == nil || image.name != "image.jpg" || string(image.data) != "jpeg" {
+		t.Fatalf("expected the image read back, got %+v (%v)", image, err)
+	}
+
+	if _, ok := imageDataURL("diagram.svg", []byte("<svg/>")); ok {
+		t.Error("expected a type an upload cannot carry refused")
+	}
+	if image, err := parseImageDataURL("https://example.com/a.png"); image != nil || err != nil {
+		t.Errorf("expected a link left alone, got %+v (%v)", image, err)
+	}
+	for _, url := range []string{"data:image/svg+xml;base64,PHN2Zy8+", "data:image/png,raw", "data:image/png;base64,%%%"} {
+		if _, err := parseImageDataURL(url); err == nil {
+			t.Errorf("%q: expected an error", url)
+		}
+	}
+}
+
+func TestValidateTestUpload_EmbeddedMedia(t *testing.T) {
+	upload := uploadWithQuestion(models.QuestionUpload{
+		QuestionText: "1066?", Options: []string{"Hastings", "Agincourt"}, Points: 1,
+		ImageURL:            "data:image/png;base64,cG5n",
+		ExplanationImageURL: "data:image/png;base64," + string(make([]byte, 600)),
+	})
+	upload.SchemaVersion = models.UploadSchemaVersion
+	upload.Notes = &models.FileUpload{Filename: "notes.pdf", Data: []byte("%PDF")}
+	errs := validateTestUpload(upload)
+	if len(errs) != 1 || errs["question_1_explanation_image_url"] != "Embedded image is not valid base64" {
+		t.Fatalf("expected only the broken explanation image reported, got %v", errs)
+	}
+
+	upload.Questions[0].ExplanationImageURL = ""
+	upload.SchemaVersion = models.UploadSchemaVersion + 1
+	upload.Notes.Filename = "notes.docx"
+	errs = validateTestUpload(upload)
+	if errs["schema_version"] == "" || errs["notes"] == "" {
+		t.Errorf("expected a newer schema and a notes file of the wrong type reported, got %v", errs)
+	}
+}
+
+// TestExportUploadRoundTripInTx exports a stored test as it is loaded and
+// uploads the export again, which must store the same test
+func TestExportUploadRoundTripInTx(t *testing.T) {
+	upload := uploadWithQuestion(models.QuestionUpload{
+		QuestionText: "When was the Battle of Hastings?",
+		ImageURL:     "data:image/png;base64,cG5n",
+		Options:      []string{"1066", "1215"},
+		Points:       1,
+		Hints:        []models.HintUpload{{Text: "Norman conquest"}},
+	})
+	upload.Topic = "Medieval"
+	upload.Questions = append(upload.Questions, models.QuestionUpload{
+		QuestionText:    "Who won it?",
+		QuestionType:    models.QuestionTypeShortAnswer,
+		AcceptedAnswers: []string{"William"},
+		Points:          1,
+	})
+
+	inTestTx(t, func(ctx context.Context, tx *repository.TestRepository, teacherID int) error {
+		exported := exportStored(t, ctx, tx, upload, teacherID)
+		if exported.Subject != "History" || exported.Topic != "Medieval" {
+			t.Errorf("expected the subject and topic exported, got %q and %q", exported.Subject, exported.Topic)
+		}
+		if exported.Questions[0].ImageURL != upload.Questions[0].ImageURL {
+			t.Errorf("expected the stored image embedded, got %q", exported.Questions[0].ImageURL)
+		}
+		if errors := validateTestUpload(exported); len(errors) != 0 {
+			t.Fatalf("expected the export valid to upload, got %v", errors)
+		}
+
+		again := exportStored(t, ctx, tx, exported, teacherID)
+		first, _ := json.Marshal(exported)
+		second, _ := json.Marshal(again)
+		if !bytes.Equal(first, second) {
+			t.Errorf("expected uploading the export to store the same test\n got %s\nwant %s", second, first)
+		}
+		return errRollback
+	})
+}
+
+// exportStored stores an upload and exports the test as loaded back
+func exportStored(t *testing.T, ctx context.Context, tx *repository.TestRepository, upload models.TestUpload, teacherID int) models.TestUpload {
+	t.Helper()
+	test, err := persistTestUpload(ctx, tx, upload, teacherID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removeUploads(t, test.ID)
+	stored, err := tx.GetByID(ctx, test.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exportUpload(stored)
+}
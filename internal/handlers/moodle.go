@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+
+	"my-app/internal/auth"
+	"my-app/internal/models"
+	"my-app/internal/moodle"
+	"my-app/internal/repository"
+)
+
+// moodleImport is what a Moodle export creates: a test per category its
+// questions are filed in
+type moodleImport struct {
+	Tests    []moodleTest
+	Skipped  []moodle.Report
+	Warnings []moodle.Report
+	Errors   map[string]string // problems of the tests themselves, which stop the import
+}
+
+// moodleTest is a test made of the questions of one category
+type moodleTest struct {
+	Upload    models.TestUpload
+	Questions []moodle.Question // the question each of Upload.Questions was read from
+}
+
+// PreviewMoodle reads the Moodle GIFT or XML export in the form's "file"
+// field and reports the tests it would create, how many questions converted
+// and which were skipped and why, without storing anything
+func (h *TeacherHandler) PreviewMoodle(w http.ResponseWriter, r *http.Request) {
+	imp, ok := readMoodleUpload(w, r)
+	if !ok {
+		return
+	}
+
+	type testPreview struct {
+		Title     string `json:"title"`
+		Subject   string `json:"subject"`
+		Topic     string `json:"topic,omitempty"`
+		Questions int    `json:"questions"`
+	}
+	tests := make([]testPreview, 0, len(imp.Tests))
+	converted := 0
+	for _, t := range imp.Tests {
+		tests = append(tests, testPreview{Title: t.Upload.Title, Subject: t.Upload.Subject, Topic: t.Upload.Topic, Questions: len(t.Upload.Questions)})
+		converted += len(t.Upload.Questions)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   len(imp.Errors) == 0,
+		"tests":     tests,
+		"converted": converted,
+		"skipped":   imp.Skipped,
+		"warnings":  imp.Warnings,
+		"errors":    imp.Errors,
+	})
+}
+
+// ImportMoodle creates the tests PreviewMoodle reports for the same upload,
+// filing each under the subject and topic its category names
+func (h *TeacherHandler) ImportMoodle(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSessionData(r)
+
+	imp, ok := readMoodleUpload(w, r)
+	if !ok {
+		return
+	}
+	if len(imp.Errors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"errors":  imp.Errors,
+			"skipped": imp.Skipped,
+		})
+		return
+	}
+
+	var testIDs []int
+	var saved savedFiles
+	err := h.testRepo.InTx(r.Context(), func(tx *repository.TestRepository) error {
+		var err error
+		testIDs, err = persistMoodleImport(r.Context(), tx, imp, session.UserID, &saved)
+		return err
+	})
+	if err != nil {
+		saved.remove()
+		log.Printf("Error importing Moodle questions: %v", err)
+		writeUploadError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create tests: %v", err))
+		return
+	}
+
+	converted := 0
+	for _, t := range imp.Tests {
+		converted += len(t.Upload.Questions)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"test_ids": testIDs,
+		"message":  fmt.Sprintf("Imported %d questions into %d tests", converted, len(testIDs)),
+		"skipped":  imp.Skipped,
+		"warnings": imp.Warnings,
+	})
+}
+
+// persistMoodleImport stores each of an import's tests with the images its
+// questions carried, recording each one's first revision, and returns their IDs
+func persistMoodleImport(ctx context.Context, repo *repository.TestRepository, imp *moodleImport, createdBy int, saved *savedFiles) ([]int, error) {
+	testIDs := make([]int, 0, len(imp.Tests))
+	for _, t := range imp.Tests {
+		created, err := createTestFromUpload(ctx, repo, t.Upload, createdBy)
+		if err != nil {
+			return nil, err
+		}
+		_, err = storeImportedImages(ctx, repo, created.ID, func(order int) (image, explanation *importedFile) {
+			q := t.Questions[order-1]
+			return moodleFile(q.Image), moodleFile(q.ExplanationImage)
+		}, saved)
+		if err != nil {
+			return nil, err
+		}
+		if err := recordRevision(ctx, repo, created.ID, createdBy); err != nil {
+			return nil, err
+		}
+		testIDs = append(testIDs, created.ID)
+	}
+	return testIDs, nil
+}
+
+// ExportMoodle downloads the test's questions for Moodle, as GIFT unless the
+// "format" query asks for "xml"
+func (h *TeacherHandler) ExportMoodle(w http.ResponseWriter, r *http.Request) {
+	test, ok := h.testForAuthor(w, r)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	var err error
+	var contentType, filename string
+	switch r.URL.Query().Get("format") {
+	case "", "gift":
+		err = moodle.WriteGIFT(&buf, test)
+		contentType, filename = "text/plain; charset=utf-8", fmt.Sprintf("test-%d-moodle.txt", test.ID)
+	case "xml":
+		images := make(map[string][]byte)
+		for _, q := range test.Questions {
+			for _, url := range []*string{q.ImageURL, q.ExplanationImageURL} {
+				if url == nil {
+					continue
+				}
+				if data, ok := readStoredAsset(*url); ok {
+					images[*url] = data
+				}
+			}
+		}
+		err = moodle.WriteXML(&buf, test, images)
+		contentType, filename = "application/xml", fmt.Sprintf("test-%d-moodle.xml", test.ID)
+	default:
+		http.Error(w, "Unknown export format", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error exporting test %d for Moodle: %v", test.ID, err)
+		http.Error(w, "Failed to export test", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Write(buf.Bytes())
+}
+
+// readMoodleUpload reads the export in the form's "file" field into tests,
+// taking the test details Moodle does not carry from the form's fields. It
+// writes the error response itself when the file cannot be read.
+func readMoodleUpload(w http.ResponseWriter, r *http.Request) (*moodleImport, bool) {
+	if err := r.ParseMultipartForm(moodle.MaxFileSize); err != nil {
+		writeUploadError(w, http.StatusBadRequest, fmt.Sprintf("Invalid upload: %v", err))
+		return nil, false
+	}
+	file, handler, err := r.FormFile("file")
+	if err != nil {
+		writeUploadError(w, http.StatusBadRequest, "Choose a Moodle .gift, .txt or .xml file to upload")
+		return nil, false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, moodle.MaxFileSize+1))
+	if err != nil || len(data) > moodle.MaxFileSize {
+		writeUploadError(w, http.StatusBadRequest, "The file is too large")
+		return nil, false
+	}
+	bank, err := moodle.Read(handler.Filename, data)
+	if err != nil {
+		writeUploadError(w, http.StatusBadRequest, fmt.Sprintf("Could not read the file: %v", err))
+		return nil, false
+	}
+	if len(bank.Questions) == 0 && len(bank.Skipped) == 0 {
+		writeUploadError(w, http.StatusBadRequest, "The file has no questions")
+		return nil, false
+	}
+	return moodleTests(bank, sheetDefaults(r)), true
+}
+
+// moodleTests groups a bank's questions into a test per category, in the
+// order the categories first appear. A category's subject and topic are the
+// test's, and its last level names it when the bank has several; questions
+// filed in no category take the defaults'. Questions that fail validation
+// are skipped and reported.
+func moodleTests(bank *moodle.Bank, defaults models.TestUpload) *moodleImport {
+	imp := &moodleImport{Skipped: bank.Skipped, Warnings: bank.Warnings, Errors: make(map[string]string)}
+
+	var categories []string
+	grouped := make(map[string][]moodle.Question)
+	for _, q := range bank.Questions {
+		if _, ok := grouped[q.Category]; !ok {
+			categories = append(categories, q.Category)
+		}
+		grouped[q.Category] = append(grouped[q.Category], q)
+	}
+
+	for _, category := range categories {
+		t := moodleTest{Upload: defaults}
+		t.Upload.Questions = nil
+		subject, topic := moodle.SplitCategory(category)
+		if subject != "" {
+			t.Upload.Subject, t.Upload.Topic = subject, topic
+		}
+		if len(categories) > 1 || t.Upload.Title == "" {
+			switch {
+			case topic != "":
+				t.Upload.Title = topic
+			case subject != "":
+				t.Upload.Title = subject
+			}
+		}
+
+		for _, q := range grouped[category] {
+			for _, image := range []**moodle.File{&q.Image, &q.ExplanationImage} {
+				if *image != nil && !isAllowedImageType(path.Ext((*image).Name)) {
+					imp.Warnings = append(imp.Warnings, moodle.Report{Question: reportName(q), Problem: unstorableImage((*image).Name)})
+					*image = nil
+				}
+			}
+			t.Upload.Questions = append(t.Upload.Questions, q.Upload)
+			t.Questions = append(t.Questions, q)
+		}
+
+		problems, _ := invalidQuestions(t.Upload)
+		questions := t.Upload.Questions[:0]
+		kept := t.Questions[:0]
+		for i, q := range t.Questions {
+			if problem, ok := problems[i]; ok {
+				imp.Skipped = append(imp.Skipped, moodle.Report{Question: reportName(q), Problem: problem})
+				continue
+			}
+			questions = append(questions, t.Upload.Questions[i])
+			kept = append(kept, q)
+		}
+		t.Upload.Questions, t.Questions = questions, kept
+		if len(t.Questions) == 0 {
+			continue
+		}
+
+		for key, msg := range validateTestUpload(t.Upload) {
+			imp.Errors[fmt.Sprintf("test_%d_%s", len(imp.Tests)+1, key)] = fmt.Sprintf("%s: %s", testLabel(t.Upload), msg)
+		}
+		imp.Tests = append(imp.Tests, t)
+	}
+	return imp
+}
+
+// reportName names a question in a report, by its Moodle name or its text
+func reportName(q moodle.Question) string {
+	if q.Name != "" {
+		return q.Name
+	}
+	return q.Upload.QuestionText
+}
+
+// testLabel names a test in an error, by its title or else its subject
+func testLabel(upload models.TestUpload) string {
+	if upload.Title != "" {
+		return upload.Title
+	}
+	if upload.Subject != "" {
+		return upload.Subject
+	}
+	return "Untitled test"
+}
+
+func moodleFile(f *moodle.File) *importedFile {
+	if f == nil {
+		return nil
+	}
+	return &importedFile{name: f.Name, data: f.Data}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"my-app/internal/models"
+	"my-app/internal/moodle"
+	"my-app/internal/repository"
+)
+
+func TestMoodleTests(t *testing.T) {
+	bank := moodle.ReadGIFT(`$CATEGORY: $course$/top/Physics/Forces
+
+::Unit:: What is the unit of force? {=Newton ~Joule}
+
+::Long:: ` + strings.Repeat("x", 5001) + ` {=Yes ~No}
+
+$CATEGORY: $course$/top/Chemistry
+
+::Salt:: Is salt ionic? {T}
+`)
+	defaults := models.TestUpload{
+		Title: "Ignored", Description: "Imported from Moodle", Subject: "Science", ExamStandard: "GCSE", Difficulty: "Easy",
+		TimeLimitMinutes: 10, PassingScore: 60,
+	}
+
+	imp := moodleTests(bank, defaults)
+	if len(imp.Errors) != 0 {
+		t.Fatalf("expected no test errors, got %v", imp.Errors)
+	}
+	if len(imp.Tests) != 2 {
+		t.Fatalf("expected a test per category, got %+v", imp.Tests)
+	}
+	forces, chemistry := imp.Tests[0].Upload, imp.Tests[1].Upload
+	if forces.Title != "Forces" || forces.Subject != "Physics" || forces.Topic != "Forces" || len(forces.Questions) != 1 {
+		t.Errorf("unexpected first test %+v", forces)
+	}
+	if chemistry.Title != "Chemistry" || chemistry.Subject != "Chemistry" || chemistry.Topic != "" || len(chemistry.Questions) != 1 {
+		t.Errorf("unexpected second test %+v", chemistry)
+	}
+	if len(imp.Tests[0].Questions) != 1 || imp.Tests[0].Questions[0].Name != "Unit" {
+		t.Errorf("expected the questions kept in step with the upload, got %+v", imp.Tests[0].Questions)
+	}
+	if len(imp.Skipped) != 1 || imp.Skipped[0].Question != "Long" {
+		t.Errorf("expected the question with overlong text skipped, got %+v", imp.Skipped)
+	}
+
+	defaults.Description = ""
+	imp = moodleTests(bank, defaults)
+	if len(imp.Errors) != 2 {
+		t.Fatalf("expected each test's missing description reported, got %v", imp.Errors)
+	}
+	for _, msg := range imp.Errors {
+		if !strings.HasPrefix(msg, "Forces: ") && !strings.HasPrefix(msg, "Chemistry: ") {
+			t.Errorf("expected the error to name its test, got %q", msg)
+		}
+	}
+}
+
+func TestPersistMoodleImportInTx(t *testing.T) {
+	bank := moodle.ReadGIFT(`$CATEGORY: $course$/top/Physics/Forces
+
+::Unit:: What is the unit of force? {=Newton ~Joule}
+
+$CATEGORY: $course$/top/Chemistry
+
+::Salt:: Is salt ionic? {T}
+
+::Symbol:: What is the symbol for sodium? {=Na}
+`)
+	imp := moodleTests(bank, models.TestUpload{
+		Description: "Imported from Moodle", ExamStandard: "GCSE", Difficulty: "Easy", TimeLimitMinutes: 10, PassingScore: 60,
+	})
+	if len(imp.Errors) != 0 || len(imp.Tests) != 2 {
+		t.Fatalf("expected two valid tests, got %+v", imp)
+	}
+
+	inTestTx(t, func(ctx context.Context, tx *repository.TestRepository, teacherID int) error {
+		var saved savedFiles
+		t.Cleanup(saved.remove)
+		testIDs, err := persistMoodleImport(ctx, tx, imp, teacherID, &saved)
+		if err != nil {
+			t.Fatalf("importing Moodle questions in a transaction: %v", err)
+		}
+		if len(testIDs) != 2 {
+			t.Fatalf("expected a test per category, got %v", testIDs)
+		}
+
+		// Exporting the tests files their questions in the categories they came from
+		categories := []string{"$course$/top/Physics/Forces", "$course$/top/Chemistry"}
+		for i, id := range testIDs {
+			stored, err := tx.GetByID(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stored.Questions) != len(imp.Tests[i].Questions) {
+				t.Errorf("expected test %d's questions stored, got %+v", i+1, stored.Questions)
+			}
+			if category := moodle.CategoryFor(stored); category != categories[i] {
+				t.Errorf("expected test %d exported in %q, got %q", i+1, categories[i], category)
+			}
+			revisions, err := tx.GetRevisions(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(revisions) != 1 {
+				t.Errorf("expected test %d's first revision recorded, got %d", i+1, len(revisions))
+			}
+		}
+		return errRollback
+	})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"html/template"
+	"slices"
+	"strings"
+
+	"my-app/internal/models"
+	"my-app/internal/richtext"
+)
+
+// answerFeedback is what a practice attempt shows once a question is answered
+type answerFeedback struct {
+	IsCorrect           bool              `json:"is_correct"`
+	CreditPercent       int               `json:"credit_percent"`               // share of the points earned
+	CorrectOptionIDs    []int             `json:"correct_option_ids,omitempty"` // the right options; for ordering, in the right order
+	CorrectAnswer       string            `json:"correct_answer"`               // the right answer, written out
+	Explanation         template.HTML     `json:"explanation,omitempty"`        // the worked solution, rendered from richtext
+	ExplanationImageURL string            `json:"explanation_image_url,omitempty"`
+	Rationales          []optionRationale `json:"rationales,omitempty"` // for the options the student picked
+}
+
+// optionRationale explains the thinking behind picking an option
+type optionRationale struct {
+	OptionText string `json:"option_text"`
+	Rationale  string `json:"rationale"`
+}
+
+// IsCorrectOption reports whether the option is one of the right answers
+func (fb answerFeedback) IsCorrectOption(optionID int) bool {
+	return slices.Contains(fb.CorrectOptionIDs, optionID)
+}
+
+// practiceFeedback tells the student how they did on a graded answer and what
+// the right answer was
+func practiceFeedback(q *models.Question, answer *models.StudentAnswer) answerFeedback {
+	fb := answerFeedback{
+		IsCorrect:     answer.Correct(),
+		CreditPercent: answer.CreditPercent(),
+		Explanation:   richtext.Render(q.Explanation),
+	}
+	if q.ExplanationImageURL != nil {
+		fb.ExplanationImageURL = *q.ExplanationImageURL
+	}
+
+	switch {
+	case !q.UsesOptions():
+		fb.CorrectAnswer = q.ExpectedAnswer()
+	case q.IsOrdering():
+		var texts []string
+		for _, opt := range q.CorrectOrder() {
+			fb.CorrectOptionIDs = append(fb.CorrectOptionIDs, opt.ID)
+			texts = append(texts, opt.OptionText)
+		}
+		fb.CorrectAnswer = strings.Join(texts, " → ")
+	case q.IsMatching():
+		var pairs []string
+		for _, opt := range q.Options {
+			pairs = append(pairs, opt.OptionText+" → "+opt.MatchText)
+		}
+		fb.CorrectAnswer = strings.Join(pairs, "; ")
+	default:
+		var texts []string
+		for _, opt := range q.Options {
+			if opt.IsCorrect {
+				fb.CorrectOptionIDs = append(fb.CorrectOptionIDs, opt.ID)
+				texts = append(texts, opt.OptionText)
+			}
+			if opt.Rationale != "" && answer.HasSelected(opt.ID) {
+				fb.Rationales = append(fb.Rationales, optionRationale{OptionText: opt.OptionText, Rationale: opt.Rationale})
+			}
+		}
+		fb.CorrectAnswer = strings.Join(texts, ", ")
+	}
+	return fb
+}
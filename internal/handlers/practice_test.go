@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"my-app/internal/auth"
+	"my-app/internal/dbtest"
+	"my-app/internal/models"
+	"my-app/internal/repository"
+	"my-app/internal/scoring"
+)
+
+func TestPracticeFeedback(t *testing.T) {
+	choice := &models.Question{ID: 1, Points: 1, Explanation: "Hastings was fought in **1066**.", Options: []models.AnswerOption{
+		{ID: 11, OptionText: "Agincourt", Rationale: "Agincourt was in 1415"},
+		{ID: 12, OptionText: "Hastings", IsCorrect: true, Rationale: "Right"},
+	}}
+	wrong := 11
+	answer := &models.StudentAnswer{QuestionID: 1, SelectedOptionID: &wrong}
+	scoring.Grade(choice, answer)
+
+	fb := practiceFeedback(choice, answer)
+	if fb.IsCorrect || !slices.Equal(fb.CorrectOptionIDs, []int{12}) || fb.CorrectAnswer != "Hastings" {
+		t.Fatalf("expected a wrong answer pointing at Hastings, got %+v", fb)
+	}
+	if fb.Explanation != "<p>Hastings was fought in <strong>1066</strong>.</p>" || !fb.IsCorrectOption(12) || fb.IsCorrectOption(11) {
+		t.Fatalf("expected the rendered explanation and only option 12 marked correct, got %+v", fb)
+	}
+	if len(fb.Rationales) != 1 || fb.Rationales[0].OptionText != "Agincourt" {
+		t.Fatalf("expected only the rationale of the picked option, got %+v", fb.Rationales)
+	}
+
+	ordering := &models.Question{ID: 2, Points: 2, QuestionType: models.QuestionTypeOrdering, ScoringRule: "partial", Options: []models.AnswerOption{
+		{ID: 22, OptionText: "second", OptionOrder: 2}, {ID: 21, OptionText: "first", OptionOrder: 1},
+	}}
+	placed := &models.StudentAnswer{QuestionID: 2, SelectedOptionIDs: []int{21, 22}}
+	scoring.Grade(ordering, placed)
+	if fb := practiceFeedback(ordering, placed); !fb.IsCorrect || fb.CreditPercent != 100 || fb.CorrectAnswer != "first → second" {
+		t.Fatalf("expected a correct ordering with the order written out, got %+v", fb)
+	}
+
+	typed := &models.Question{ID: 3, Points: 1, QuestionType: models.QuestionTypeShortAnswer, AcceptedAnswers: []models.AcceptedAnswer{{AnswerText: "Paris"}}}
+	text := "Lyon"
+	guess := &models.StudentAnswer{QuestionID: 3, TextAnswer: &text}
+	scoring.Grade(typed, guess)
+	if fb := practiceFeedback(typed, guess); fb.IsCorrect || fb.CorrectAnswer != "Paris" || fb.CorrectOptionIDs != nil {
+		t.Fatalf("expected the accepted answer to be given, got %+v", fb)
+	}
+}
+
+func TestRegradeLeavesPracticeOutOfStats(t *testing.T) {
+	pool := dbtest.Pool(t)
+	teacherID := dbtest.User(t, pool, "teacher")
+	studentID := dbtest.User(t, pool, "student")
+	ctx := context.Background()
+	testRepo := repository.NewTestRepository(pool)
+	userRepo := repository.NewUserRepository(pool)
+	attemptRepo := repository.NewAttemptRepository(pool)
+	h := NewTeacherHandler(testRepo, userRepo, attemptRepo)
+
+	test, err := persistTestUpload(ctx, testRepo, uploadWithQuestion(models.QuestionUpload{
+		QuestionText: "Where was the battle of 1066?", Options: []string{"Hastings", "Agincourt"}, Points: 1,
+	}), teacherID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { testRepo.DeleteTest(ctx, test.ID) })
+	question := test.Questions[0]
+	hastings := question.Options[slices.IndexFunc(question.Options, func(o models.AnswerOption) bool { return o.OptionText == "Hastings" })].ID
+
+	// The student answered right in a counted attempt and a practice one,
+	// and finishing the counted attempt recorded its point and pass
+	for _, practice := range []bool{false, true} {
+		attempt := &models.TestAttempt{UserID: studentID, TestID: test.ID, StartedAt: time.Now(), Status: "in_progress", Practice: practice}
+		if err := attemptRepo.Create(ctx, attempt); err != nil {
+			t.Fatal(err)
+		}
+		correct := true
+		answer := &models.StudentAnswer{AttemptID: attempt.ID, QuestionID: question.ID, SelectedOptionID: &hastings, IsCorrect: &correct}
+		if err := attemptRepo.SaveAnswer(ctx, answer); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := attemptRepo.Complete(ctx, attempt.ID, 1, 1, nil, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := userRepo.InitializeUserStats(ctx, studentID); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := userRepo.GetUserStats(ctx, studentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats.TotalPoints, stats.TestsCompleted, stats.TestsPassed = 1, 1, 1
+	if err := userRepo.UpdateUserStats(ctx, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	// Agincourt becomes the answer, so both attempts now score nothing
+	for _, option := range question.Options {
+		option.IsCorrect = option.ID != hastings
+		if err := testRepo.UpdateAnswerOption(ctx, &option); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if test, err = testRepo.GetByID(ctx, test.ID); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := h.regradeTest(ctx, test)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 2 {
+		t.Errorf("expected both attempts regraded, got %d", changed)
+	}
+
+	stats, err = userRepo.GetUserStats(ctx, studentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalPoints != 0 || stats.TestsPassed != 0 {
+		t.Errorf("expected only the counted attempt's point and pass taken back, got %d points and %d passed", stats.TotalPoints, stats.TestsPassed)
+	}
+}
+
+// TestPracticeAnswerLocksAgainstRacingSubmits sends two answers to one
+// practice question at once: only one is stored, the other is turned away
+func TestPracticeAnswerLocksAgainstRacingSubmits(t *testing.T) {
+	pool := dbtest.Pool(t)
+	teacherID := dbtest.User(t, pool, "teacher")
+	studentID := dbtest.User(t, pool, "student")
+	ctx := context.Background()
+	testRepo := repository.NewTestRepository(pool)
+	attemptRepo := repository.NewAttemptRepository(pool)
+	h := NewTestHandler(testRepo, attemptRepo, repository.NewUserRepository(pool))
+
+	upload := uploadWithQuestion(models.QuestionUpload{
+		QuestionText: "Where was the battle of 1066?", Options: []string{"Hastings", "Agincourt"}, Points: 1,
+	})
+	upload.AllowPractice = true
+	test, err := persistTestUpload(ctx, testRepo, upload, teacherID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { testRepo.DeleteTest(ctx, test.ID) })
+	question := test.Questions[0]
+
+	attempt := &models.TestAttempt{UserID: studentID, TestID: test.ID, StartedAt: time.Now(), Status: "in_progress", Practice: true}
+	if err := attemptRepo.Create(ctx, attempt); err != nil {
+		t.Fatal(err)
+	}
+
+	store := auth.NewSessionStore()
+	token, _ := store.Create(studentID, "student", "student")
+	submit := auth.NewMiddleware(store).RequireAuth(http.HandlerFunc(h.SubmitAnswer))
+
+	codes := make([]int, len(question.Options))
+	var wg sync.WaitGroup
+	for i, option := range question.Options {
+		body, _ := json.Marshal(map[string]int{"attempt_id": attempt.ID, "question_id": question.ID, "option_id": option.ID})
+		req := httptest.NewRequest(http.MethodPost, "/test/answer", bytes.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			submit.ServeHTTP(rr, req)
+			codes[i] = rr.Code
+		}()
+	}
+	wg.Wait()
+
+	slices.Sort(codes)
+	if !slices.Equal(codes, []int{http.StatusOK, http.StatusConflict}) {
+		t.Fatalf("expected one answer saved and the other turned away, got %v", codes)
+	}
+	answers, err := attemptRepo.GetAnswersByAttemptID(ctx, attempt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(answers) != 1 {
+		t.Fatalf("expected one stored answer, got %+v", answers)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"my-app/internal/models"
+)
+
+// unmetPrerequisites returns what the student still has to do before starting
+// the test, one line per prerequisite their attempts do not meet. Only
+// completed attempts that are not practice count, and a test is passed by any
+// attempt at or above its PassingScore. The catalogue of tests supplies each
+// required test's passing score and which tests are in a topic.
+func unmetPrerequisites(test *models.Test, catalogue []models.Test, attempts []models.TestAttempt) []string {
+	if len(test.Prerequisites) == 0 {
+		return nil
+	}
+
+	best := make(map[int]float64) // testID -> best percentage
+	for i := range attempts {
+		a := &attempts[i]
+		if a.Practice {
+			continue
+		}
+		if pct, ok := a.Percentage(); ok {
+			if prev, seen := best[a.TestID]; !seen || pct > prev {
+				best[a.TestID] = pct
+			}
+		}
+	}
+	byID := make(map[int]*models.Test, len(catalogue))
+	for i := range catalogue {
+		byID[catalogue[i].ID] = &catalogue[i]
+	}
+
+	var unmet []string
+	for _, p := range test.Prerequisites {
+		switch p.Kind {
+		case models.PrerequisitePassed, models.PrerequisiteMinScore:
+			if p.RequiredTestID == nil {
+				continue
+			}
+			threshold := float64(p.MinPercent)
+			if p.Kind == models.PrerequisitePassed {
+				required, ok := byID[*p.RequiredTestID]
+				if !ok {
+					continue
+				}
+				threshold = float64(required.PassingScore)
+			}
+			pct, attempted := best[*p.RequiredTestID]
+			if attempted && pct >= threshold {
+				continue
+			}
+			reason := p.Describe()
+			if attempted {
+				reason += fmt.Sprintf(" (best so far %.0f%%)", pct)
+			}
+			unmet = append(unmet, reason)
+
+		case models.PrerequisiteTopicCount:
+			if p.TopicID == nil {
+				continue
+			}
+			done := 0
+			for _, t := range catalogue {
+				if _, completed := best[t.ID]; completed && t.ID != test.ID && t.TopicID != nil && *t.TopicID == *p.TopicID {
+					done++
+				}
+			}
+			if done < p.MinCount {
+				unmet = append(unmet, fmt.Sprintf("%s (%d done)", p.Describe(), done))
+			}
+		}
+	}
+	return unmet
+}
+
+// unmetPrerequisites loads the student's attempts at every test and returns
+// the prerequisites of the test they do not meet
+func (h *TestHandler) unmetPrerequisites(ctx context.Context, test *models.Test, userID int) ([]string, error) {
+	catalogue, err := h.testRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	attempts, err := h.attemptRepo.GetByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return unmetPrerequisites(test, catalogue, attempts), nil
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"my-app/internal/models"
+)
+
+func scoredAttempt(testID, score int, practice bool) models.TestAttempt {
+	completed := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	total := 100
+	return models.TestAttempt{TestID: testID, Status: "completed", CompletedAt: &completed, Score: &score, TotalPoints: &total, Practice: practice}
+}
+
+func TestUnmetPrerequisites(t *testing.T) {
+	basics, fractions, topic := 1, 2, 7
+	catalogue := []models.Test{
+		{ID: basics, PassingScore: 60, TopicID: &topic},
+		{ID: fractions, PassingScore: 50, TopicID: &topic},
+		{ID: 3, PassingScore: 50, TopicID: &topic},
+	}
+	quadratics := &models.Test{ID: 4, Prerequisites: []models.Prerequisite{
+		{Kind: models.PrerequisitePassed, RequiredTestID: &basics, RequiredTitle: "Algebra Basics"},
+		{Kind: models.PrerequisiteMinScore, RequiredTestID: &fractions, MinPercent: 80, RequiredTitle: "Fractions"},
+		{Kind: models.PrerequisiteTopicCount, TopicID: &topic, MinCount: 2, TopicName: "Algebra"},
+	}}
+
+	unmet := unmetPrerequisites(quadratics, catalogue, nil)
+	if len(unmet) != 3 || unmet[0] != `Pass "Algebra Basics"` || unmet[2] != "Complete 2 tests in Algebra (0 done)" {
+		t.Fatalf("expected every prerequisite unmet with no attempts, got %q", unmet)
+	}
+
+	// Practice attempts and scores under the threshold do not count
+	attempts := []models.TestAttempt{scoredAttempt(basics, 90, true), scoredAttempt(basics, 55, false), scoredAttempt(fractions, 70, false)}
+	unmet = unmetPrerequisites(quadratics, catalogue, attempts)
+	if len(unmet) != 2 || !strings.Contains(unmet[0], "best so far 55%") || !strings.Contains(unmet[1], "best so far 70%") {
+		t.Fatalf("expected both tests still short of their scores, got %q", unmet)
+	}
+
+	attempts = append(attempts, scoredAttempt(basics, 60, false), scoredAttempt(fractions, 85, false))
+	if unmet := unmetPrerequisites(quadratics, catalogue, attempts); len(unmet) != 0 {
+		t.Fatalf("expected every prerequisite met, got %q", unmet)
+	}
+
+	// The topic count never includes the test itself
+	inTopic := &models.Test{ID: 3, TopicID: &topic, Prerequisites: []models.Prerequisite{{Kind: models.PrerequisiteTopicCount, TopicID: &topic, MinCount: 3, TopicName: "Algebra"}}}
+	attempts = append(attempts, scoredAttempt(3, 10, false))
+	if unmet := unmetPrerequisites(inTopic, catalogue, attempts); !slices.Equal(unmet, []string{"Complete 3 tests in Algebra (2 done)"}) {
+		t.Fatalf("expected two of the topic's other tests done, got %q", unmet)
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+
+	"my-app/internal/auth"
+	"my-app/internal/models"
+	"my-app/internal/qti"
+	"my-app/internal/repository"
+	"my-app/internal/storage"
+)
+
+// ImportQTI creates a test from the IMS QTI content package in the form's
+// "file" field. Test details the package does not carry are taken from the
+// form's fields, as for a spreadsheet. Items that cannot be imported are
+// reported back under "skipped" and the rest of the package is imported.
+func (h *TeacherHandler) ImportQTI(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSessionData(r)
+
+	if err := r.ParseMultipartForm(qti.MaxPackageSize); err != nil {
+		writeUploadError(w, http.StatusBadRequest, fmt.Sprintf("Invalid upload: %v", err))
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeUploadError(w, http.StatusBadRequest, "Choose a QTI .zip package to upload")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, qti.MaxPackageSize+1))
+	if err != nil || len(data) > qti.MaxPackageSize {
+		writeUploadError(w, http.StatusBadRequest, "The package is too large")
+		return
+	}
+	imp, err := qti.Read(data, sheetDefaults(r))
+	if err != nil {
+		writeUploadError(w, http.StatusBadRequest, fmt.Sprintf("Could not read the package: %v", err))
+		return
+	}
+
+	if validationErrors := checkQTIImport(imp); len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"errors":  validationErrors,
+			"skipped": imp.Skipped,
+		})
+		return
+	}
+
+	var test *models.Test
+	var saved savedFiles
+	err = h.testRepo.InTx(r.Context(), func(tx *repository.TestRepository) error {
+		test, err = persistQTIImport(r.Context(), tx, imp, session.UserID, &saved)
+		return err
+	})
+	if err != nil {
+		saved.remove()
+		log.Printf("Error importing QTI package: %v", err)
+		writeUploadError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create test: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"test_id":  test.ID,
+		"message":  fmt.Sprintf("Test imported with %d questions", len(imp.Upload.Questions)),
+		"skipped":  imp.Skipped,
+		"warnings": imp.Warnings,
+	})
+}
+
+// ExportQTI downloads the test as an IMS QTI content package, of version 2.1
+// unless the "version" query asks for 3.0, with its stored images and notes
+func (h *TeacherHandler) ExportQTI(w http.ResponseWriter, r *http.Request) {
+	test, ok := h.testForAuthor(w, r)
+	if !ok {
+		return
+	}
+
+	version := r.URL.Query().Get("version")
+	if version == "" {
+		version = qti.Version21
+	}
+	if version != qti.Version21 && version != qti.Version30 {
+		http.Error(w, "Unknown QTI version", http.StatusBadRequest)
+		return
+	}
+
+	pkg := qti.Package{Test: test, Images: make(map[string][]byte)}
+	for _, q := range test.Questions {
+		for _, url := range []*string{q.ImageURL, q.ExplanationImageURL} {
+			if url == nil {
+				continue
+			}
+			if data, ok := readStoredAsset(*url); ok {
+				pkg.Images[*url] = data
+			}
+		}
+	}
+	if test.NotesFilename != nil {
+		data, err := os.ReadFile(storage.GetNotesFilePath(*test.NotesFilename))
+		if err != nil {
+			log.Printf("Error reading notes for QTI export of test %d: %v", test.ID, err)
+		} else {
+			pkg.Notes = &qti.Media{Name: *test.NotesFilename, Data: data}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := qti.Export(&buf, pkg, version); err != nil {
+		log.Printf("Error exporting test %d as QTI: %v", test.ID, err)
+		http.Error(w, "Failed to export test", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="test-%d-qti-%s.zip"`, test.ID, version))
+	w.Write(buf.Bytes())
+}
+
+// checkQTIImport validates an imported package's test. Questions that fail
+// validation are skipped and reported as their item, and images of a type
+// that cannot be stored are left out with a warning; the errors returned are
+// those of the test itself, which stop the import.
+func checkQTIImport(imp *qti.Import) map[string]string {
+	for i, item := range imp.Items {
+		for _, image := range []**qti.Media{&item.Image, &item.ExplanationImage} {
+			if *image != nil && !isAllowedImageType(path.Ext((*image).Name)) {
+				imp.Warnings = append(imp.Warnings, qti.Report{
+					Item: item.Identifier, Title: item.Title, Problem: unstorableImage((*image).Name),
+				})
+				*image = nil
+			}
+		}
+		imp.Items[i] = item
+	}
+
+	problems, errors := invalidQuestions(imp.Upload)
+	if len(problems) == 0 {
+		return errors
+	}
+
+	questions := imp.Upload.Questions[:0]
+	items := imp.Items[:0]
+	for i, q := range imp.Upload.Questions {
+		if problem, ok := problems[i]; ok {
+			imp.Skipped = append(imp.Skipped, qti.Report{
+				Item: imp.Items[i].Identifier, Title: imp.Items[i].Title, Problem: problem,
+			})
+			continue
+		}
+		questions = append(questions, q)
+		items = append(items, imp.Items[i])
+	}
+	imp.Upload.Questions, imp.Items = questions, items
+	return validateTestUpload(imp.Upload)
+}
+
+// persistQTIImport stores an imported test with the images and notes its
+// package carried, then records its first revision
+func persistQTIImport(ctx context.Context, repo *repository.TestRepository, imp *qti.Import, createdBy int, saved *savedFiles) (*models.Test, error) {
+	created, err := createTestFromUpload(ctx, repo, imp.Upload, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	test, err := storeImportedImages(ctx, repo, created.ID, func(order int) (image, explanation *importedFile) {
+		item := imp.Items[order-1]
+		return mediaFile(item.Image), mediaFile(item.ExplanationImage)
+	}, saved)
+	if err != nil {
+		return nil, err
+	}
+
+	if imp.Notes != nil {
+		if err := storeImportedNotes(ctx, repo, test.ID, mediaFile(imp.Notes), saved); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := recordRevision(ctx, repo, test.ID, createdBy); err != nil {
+		return nil, err
+	}
+	return test, nil
+}
+
+func mediaFile(m *qti.Media) *importedFile {
+	if m == nil {
+		return nil
+	}
+	return &importedFile{name: m.Name, data: m.Data}
+}
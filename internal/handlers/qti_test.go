@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"my-app/internal/models"
+	"my-app/internal/qti"
+	"my-app/internal/repository"
+)
+
+func TestCheckQTIImport(t *testing.T) {
+	imp := &qti.Import{
+		Upload: models.TestUpload{
+			Title: "Capitals", Description: "European capitals", Subject: "Geography", ExamStandard: "GCSE", Difficulty: "Easy",
+			TimeLimitMinutes: 10, PassingScore: 60,
+			Questions: []models.QuestionUpload{
+				{QuestionText: "Capital of France?", Points: 1, Options: []string{"Lyon", "Paris"}, CorrectIndex: 1},
+				{QuestionText: "Capital of Spain?", Points: 1, Options: []string{"Madrid"}},
+				{QuestionText: "Capital of Italy?", Points: 1, Options: []string{"Rome", "Milan"}},
+			},
+		},
+		Items: []qti.Item{
+			{Identifier: "france", Image: &qti.Media{Name: "map.svg", Data: []byte("<svg/>")}},
+			{Identifier: "spain", Title: "Spain"},
+			{Identifier: "italy", Image: &qti.Media{Name: "map.png", Data: []byte("png")}},
+		},
+	}
+
+	if errors := checkQTIImport(imp); len(errors) != 0 {
+		t.Fatalf("expected the test accepted without its invalid question, got %v", errors)
+	}
+	if len(imp.Upload.Questions) != 2 || len(imp.Items) != 2 || imp.Items[1].Identifier != "italy" {
+		t.Fatalf("expected the Spain item dropped, got %+v", imp.Items)
+	}
+	if len(imp.Skipped) != 1 || imp.Skipped[0].Item != "spain" || imp.Skipped[0].Title != "Spain" {
+		t.Errorf("expected the Spain item reported, got %+v", imp.Skipped)
+	}
+	if imp.Items[0].Image != nil || imp.Items[1].Image == nil {
+		t.Errorf("expected only the SVG image left out, got %+v", imp.Items)
+	}
+	if len(imp.Warnings) != 1 || imp.Warnings[0].Item != "france" {
+		t.Errorf("expected a warning for the SVG image, got %+v", imp.Warnings)
+	}
+
+	imp.Upload.Title = ""
+	if errors := checkQTIImport(imp); errors["title"] == "" {
+		t.Errorf("expected a missing title to stop the import, got %v", errors)
+	}
+}
+
+func TestPersistQTIImportInTx(t *testing.T) {
+	imp := &qti.Import{
+		Upload: models.TestUpload{
+			Title: "Capitals", Description: "European capitals", Subject: "Geography", Topic: "Europe", ExamStandard: "GCSE", Difficulty: "Easy",
+			TimeLimitMinutes: 10, PassingScore: 60,
+			Questions: []models.QuestionUpload{
+				{QuestionText: "Capital of France?", Points: 1, Options: []string{"Lyon", "Paris"}, CorrectIndex: 1},
+				{QuestionText: "Capital of Italy?", Points: 1, QuestionType: models.QuestionTypeShortAnswer, AcceptedAnswers: []string{"Rome"}},
+			},
+		},
+		Items: []qti.Item{
+			{Identifier: "france", Image: &qti.Media{Name: "map.png", Data: []byte("png")}},
+			{Identifier: "italy"},
+		},
+		Notes: &qti.Media{Name: "capitals.pdf", Data: []byte("%PDF-1.4")},
+	}
+	if errors := checkQTIImport(imp); len(errors) != 0 {
+		t.Fatal(errors)
+	}
+
+	inTestTx(t, func(ctx context.Context, tx *repository.TestRepository, teacherID int) error {
+		var saved savedFiles
+		t.Cleanup(saved.remove)
+		test, err := persistQTIImport(ctx, tx, imp, teacherID, &saved)
+		if err != nil {
+			t.Fatalf("importing a package in a transaction: %v", err)
+		}
+
+		stored, err := tx.GetByID(ctx, test.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stored.Questions) != 2 || len(stored.Questions[0].Options) != 2 || len(stored.Questions[1].AcceptedAnswers) != 1 {
+			t.Fatalf("expected the items stored as questions, got %+v", stored.Questions)
+		}
+		if url := stored.Questions[0].ImageURL; url == nil || *url != "/assets/uploads/"+strconv.Itoa(test.ID)+"/question_1.png" {
+			t.Errorf("expected the item's image stored, got %v", url)
+		}
+		if stored.NotesFilename == nil {
+			t.Error("expected the package's notes stored")
+		}
+		revisions, err := tx.GetRevisions(ctx, test.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revisions) != 1 {
+			t.Errorf("expected the first revision recorded, got %d", len(revisions))
+		}
+		return errRollback
+	})
+}
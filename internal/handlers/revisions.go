@@ -0,0 +1,350 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+
+	"my-app/internal/models"
+	"my-app/internal/repository"
+	"my-app/internal/storage"
+)
+
+// freezeBeforeEdit saves the test's content as a revision before an edit, so
+// the log holds what the edit started from even when it was changed outside
+// the editor, and ties attempts from before revisions existed to it, so the
+// edit cannot rewrite what those attempts were asked
+func freezeBeforeEdit(ctx context.Context, repo *repository.TestRepository, test *models.Test) error {
+	revisionID, err := repo.SaveRevision(ctx, test, nil)
+	if err != nil {
+		return err
+	}
+	return repo.PinUnrevisedAttempts(ctx, test.ID, revisionID)
+}
+
+// recordRevision saves the test as it now stands as a new revision made by
+// the author of the change
+func recordRevision(ctx context.Context, repo *repository.TestRepository, testID, authorID int) error {
+	test, err := repo.GetByID(ctx, testID)
+	if err != nil {
+		return err
+	}
+	_, err = repo.SaveRevision(ctx, test, &authorID)
+	return err
+}
+
+// restoreRevision writes a revision's content back onto the test, the way an
+// edit is saved, and records the result as a new revision by the user
+// restoring it, noting the revision it restored. The test keeps its attempts,
+// links, publishing state and prerequisites, and what the revision shares with
+// the test keeps its ID. Images are shared with the revision, as is its notes
+// file while it is still stored. Run it in a transaction so the content and
+// its revision are saved whole or not at all.
+func restoreRevision(ctx context.Context, repo *repository.TestRepository, testID int, revision *models.Test, number, restoredBy int) error {
+	live, err := repo.GetByID(ctx, testID)
+	if err != nil {
+		return err
+	}
+	if err := freezeBeforeEdit(ctx, repo, live); err != nil {
+		return fmt.Errorf("saving test revision: %w", err)
+	}
+
+	test := revision.Content()
+	test.ID, test.CreatedBy, test.CreatedAt = live.ID, live.CreatedBy, live.CreatedAt
+	test.Published, test.Prerequisites = live.Published, live.Prerequisites
+	test.Pools, test.Sections = slices.Clone(revision.Pools), slices.Clone(revision.Sections)
+
+	// The subject and topic may have been deleted since: the subject is found
+	// again by name, and a topic no longer stored under it is dropped
+	test.SubjectID, test.TopicID = nil, nil
+	if revision.Subject != nil {
+		subjectID, err := repo.GetOrCreateSubject(ctx, revision.Subject.Name, revision.Subject.Description)
+		if err != nil {
+			return err
+		}
+		test.SubjectID = &subjectID
+	}
+	if revision.TopicID != nil && test.SubjectID != nil {
+		topics, err := repo.GetTopics(ctx)
+		if err != nil {
+			return err
+		}
+		for _, t := range topics {
+			if t.ID == *revision.TopicID && t.SubjectID == *test.SubjectID {
+				test.TopicID = revision.TopicID
+			}
+		}
+	}
+
+	poolIDs, err := restorePools(ctx, repo, &test, live.Pools)
+	if err != nil {
+		return fmt.Errorf("restoring question pools: %w", err)
+	}
+	sectionIDs, err := restoreSections(ctx, repo, &test, live.Sections)
+	if err != nil {
+		return fmt.Errorf("restoring sections: %w", err)
+	}
+	removed := restoreQuestions(&test, live.Questions, poolIDs, sectionIDs)
+	if err := applyTestEdit(ctx, repo, &test, removed); err != nil {
+		return err
+	}
+
+	notes := live.NotesFilename
+	if revision.NotesFilename == nil {
+		notes = nil
+	} else if _, err := os.Stat(storage.GetNotesFilePath(*revision.NotesFilename)); err == nil {
+		notes = revision.NotesFilename
+	}
+	if err := repo.UpdateTestNotes(ctx, test.ID, notes); err != nil {
+		return fmt.Errorf("restoring notes: %w", err)
+	}
+
+	restored, err := repo.GetByID(ctx, test.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := repo.SaveRestoredRevision(ctx, restored, &restoredBy, number); err != nil {
+		return fmt.Errorf("saving test revision: %w", err)
+	}
+	return nil
+}
+
+// restorePools deletes the test's pools the restored revision does not have
+// and creates those it had that were deleted since, returning the ID each of
+// the revision's pools is now stored under. The rest are updated with the test.
+func restorePools(ctx context.Context, repo *repository.TestRepository, test *models.Test, live []models.QuestionPool) (map[int]int, error) {
+	restored := make(map[int]bool, len(test.Pools))
+	for _, p := range test.Pools {
+		restored[p.ID] = true
+	}
+	stored := make(map[int]bool, len(live))
+	for _, p := range live {
+		stored[p.ID] = true
+		if !restored[p.ID] {
+			if err := repo.DeletePool(ctx, p.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ids := make(map[int]int, len(test.Pools))
+	for i := range test.Pools {
+		pool := &test.Pools[i]
+		was := pool.ID
+		if !stored[pool.ID] {
+			pool.TestID = test.ID
+			if err := repo.CreatePool(ctx, pool); err != nil {
+				return nil, err
+			}
+		}
+		ids[was] = pool.ID
+	}
+	return ids, nil
+}
+
+// restoreSections deletes the test's sections the restored revision does not
+// have and creates those it had that were deleted since, returning the ID each
+// of the revision's sections is now stored under. The rest are updated with
+// the test.
+func restoreSections(ctx context.Context, repo *repository.TestRepository, test *models.Test, live []models.Section) (map[int]int, error) {
+	restored := make(map[int]bool, len(test.Sections))
+	for _, s := range test.Sections {
+		restored[s.ID] = true
+	}
+	stored := make(map[int]bool, len(live))
+	for _, s := range live {
+		stored[s.ID] = true
+		if !restored[s.ID] {
+			if err := repo.DeleteSection(ctx, s.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ids := make(map[int]int, len(test.Sections))
+	for i := range test.Sections {
+		section := &test.Sections[i]
+		was := section.ID
+		if !stored[section.ID] {
+			section.TestID = test.ID
+			if err := repo.CreateSection(ctx, section); err != nil {
+				return nil, err
+			}
+		}
+		ids[was] = section.ID
+	}
+	return ids, nil
+}
+
+// restoreQuestions prepares the restored revision's questions to be saved
+// over the test's live ones: questions, options and hints the test still has
+// keep their IDs, those deleted since are created again, and the removals
+// returned delete what the revision did not have
+func restoreQuestions(test *models.Test, live []models.Question, poolIDs, sectionIDs map[int]int) testEditRemovals {
+	var removed testEditRemovals
+	stored := make(map[int]*models.Question, len(live))
+	for i := range live {
+		stored[live[i].ID] = &live[i]
+	}
+
+	restored := make(map[int]bool, len(test.Questions))
+	questions := make([]models.Question, len(test.Questions))
+	for i, q := range test.Questions {
+		q.TestID = test.ID
+		q.Options, q.Hints = slices.Clone(q.Options), slices.Clone(q.Hints)
+		if q.PoolID != nil {
+			q.PoolID = restoredID(poolIDs, *q.PoolID)
+		}
+		if q.SectionID != nil {
+			q.SectionID = restoredID(sectionIDs, *q.SectionID)
+		}
+
+		if was, ok := stored[q.ID]; ok {
+			restored[q.ID] = true
+			removed.options = append(removed.options, restoreOptions(q.Options, was.Options)...)
+			removed.hints = append(removed.hints, restoreHints(q.Hints, was.Hints)...)
+		} else {
+			q.ID = 0
+			restoreOptions(q.Options, nil)
+			restoreHints(q.Hints, nil)
+		}
+		questions[i] = q
+	}
+	test.Questions = questions
+
+	for _, q := range live {
+		if !restored[q.ID] {
+			removed.questions = append(removed.questions, q.ID)
+		}
+	}
+	return removed
+}
+
+// restoreOptions prepares a restored question's options to be saved over its
+// live ones and returns the live options to delete. saveQuestions moves kept
+// options one at a time, so they keep their IDs only when none moves back;
+// otherwise every option is deleted and created again.
+func restoreOptions(options, live []models.AnswerOption) []int {
+	order := make(map[int]int, len(live))
+	for _, o := range live {
+		order[o.ID] = o.OptionOrder
+	}
+	kept := make(map[int]bool, len(options))
+	inPlace := true
+	for _, o := range options {
+		if was, ok := order[o.ID]; ok {
+			kept[o.ID] = true
+			inPlace = inPlace && o.OptionOrder <= was
+		}
+	}
+
+	var removed []int
+	for _, o := range live {
+		if !inPlace || !kept[o.ID] {
+			removed = append(removed, o.ID)
+		}
+	}
+	for i := range options {
+		if !inPlace || !kept[options[i].ID] {
+			options[i].ID = 0
+		}
+	}
+	return removed
+}
+
+// restoreHints prepares a restored question's hints to be saved over its live
+// ones and returns the live hints to delete. A kept hint's position cannot be
+// updated, so hints keep their IDs only when every kept one stays where it is;
+// otherwise every hint is deleted and created again.
+func restoreHints(hints, live []models.Hint) []int {
+	order := make(map[int]int, len(live))
+	for _, h := range live {
+		order[h.ID] = h.HintOrder
+	}
+	kept := make(map[int]bool, len(hints))
+	inPlace := true
+	for _, h := range hints {
+		if was, ok := order[h.ID]; ok {
+			kept[h.ID] = true
+			inPlace = inPlace && h.HintOrder == was
+		}
+	}
+
+	var removed []int
+	for _, h := range live {
+		if !inPlace || !kept[h.ID] {
+			removed = append(removed, h.ID)
+		}
+	}
+	for i := range hints {
+		if !inPlace || !kept[hints[i].ID] {
+			hints[i].ID = 0
+		}
+	}
+	return removed
+}
+
+// restoredID returns the ID a restored pool or section is stored under, nil
+// when the revision did not have it
+func restoredID(ids map[int]int, was int) *int {
+	id, ok := ids[was]
+	if !ok {
+		return nil
+	}
+	return &id
+}
+
+// discardNotesFile deletes a notes file a test no longer uses, unless a
+// revision still refers to it and restoring that revision would need it
+func discardNotesFile(ctx context.Context, repo *repository.TestRepository, filename string) error {
+	referenced, err := repo.NotesInRevisions(ctx, filename)
+	if err != nil || referenced {
+		return err
+	}
+	return storage.DeleteNotesFile(filename)
+}
+
+// withLiveAcceptedAnswers returns the attempt's revision of the test with each
+// short-answer question accepting what the live question now accepts, so
+// answers a teacher accepts after the attempt count when it is regraded. The
+// rest of the revision, wording and answer key included, is left as it was.
+func withLiveAcceptedAnswers(revision, live *models.Test) *models.Test {
+	accepted := make(map[int][]models.AcceptedAnswer, len(live.Questions))
+	for _, q := range live.Questions {
+		if q.IsShortAnswer() {
+			accepted[q.ID] = q.AcceptedAnswers
+		}
+	}
+
+	merged := *revision
+	merged.Questions = make([]models.Question, len(revision.Questions))
+	for i, q := range revision.Questions {
+		if current, ok := accepted[q.ID]; ok && q.IsShortAnswer() {
+			q.AcceptedAnswers = current
+		}
+		merged.Questions[i] = q
+	}
+	return &merged
+}
+
+// questionsAcrossRevisions lists the live test's questions followed by those
+// that only revisions attempts were taken against still have, each as the
+// newest such revision had it
+func questionsAcrossRevisions(live *models.Test, revisions []models.TestRevision) []models.Question {
+	questions := slices.Clone(live.Questions)
+	seen := make(map[int]bool, len(questions))
+	for _, q := range questions {
+		seen[q.ID] = true
+	}
+
+	for _, v := range revisions { // newest first
+		for _, q := range v.Content.Questions {
+			if !seen[q.ID] {
+				seen[q.ID] = true
+				questions = append(questions, q)
+			}
+		}
+	}
+	return questions
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"my-app/internal/models"
+	"my-app/internal/repository"
+)
+
+func TestWithLiveAcceptedAnswers(t *testing.T) {
+	revision := &models.Test{Questions: []models.Question{
+		{ID: 1, QuestionType: models.QuestionTypeShortAnswer, QuestionText: "Capital of France?", AcceptedAnswers: []models.AcceptedAnswer{{AnswerText: "Paris"}}},
+		{ID: 2, QuestionText: "2 + 2", Options: []models.AnswerOption{{ID: 5, IsCorrect: true}}},
+	}}
+	live := &models.Test{Questions: []models.Question{
+		{ID: 1, QuestionType: models.QuestionTypeShortAnswer, QuestionText: "Which city is France's capital?", AcceptedAnswers: []models.AcceptedAnswer{{AnswerText: "Paris"}, {AnswerText: "paris, france"}}},
+		{ID: 2, QuestionText: "2 + 2", Options: []models.AnswerOption{{ID: 5}, {ID: 6, IsCorrect: true}}},
+	}}
+
+	merged := withLiveAcceptedAnswers(revision, live)
+	if len(merged.Questions[0].AcceptedAnswers) != 2 || merged.Questions[0].QuestionText != "Capital of France?" {
+		t.Fatalf("expected the revision's wording with the live accepted answers, got %+v", merged.Questions[0])
+	}
+	if len(merged.Questions[1].Options) != 1 || !merged.Questions[1].Options[0].IsCorrect {
+		t.Fatalf("expected the revision's answer key kept, got %+v", merged.Questions[1].Options)
+	}
+	if len(revision.Questions[0].AcceptedAnswers) != 1 {
+		t.Fatal("expected the revision itself left unchanged")
+	}
+}
+
+func TestQuestionsAcrossRevisions(t *testing.T) {
+	live := &models.Test{Questions: []models.Question{{ID: 1, QuestionText: "now"}, {ID: 3}}}
+	revisions := []models.TestRevision{
+		{Revision: 2, Content: &models.Test{Questions: []models.Question{{ID: 1, QuestionText: "then"}, {ID: 2, QuestionText: "newer"}}}},
+		{Revision: 1, Content: &models.Test{Questions: []models.Question{{ID: 2, QuestionText: "older"}, {ID: 4}}}},
+	}
+
+	questions := questionsAcrossRevisions(live, revisions)
+	var ids []int
+	for _, q := range questions {
+		ids = append(ids, q.ID)
+	}
+	if !slices.Equal(ids, []int{1, 3, 2, 4}) {
+		t.Fatalf("expected the live questions then deleted ones, got %v", ids)
+	}
+	if questions[0].QuestionText != "now" || questions[2].QuestionText != "newer" {
+		t.Fatalf("expected live questions as they are and deleted ones from the newest revision, got %+v", questions)
+	}
+}
+
+func TestRestoreOptions(t *testing.T) {
+	live := []models.AnswerOption{{ID: 1, OptionOrder: 1}, {ID: 2, OptionOrder: 2}, {ID: 3, OptionOrder: 3}}
+
+	// The first option was deleted and another added since: the rest move
+	// forward and keep their IDs
+	options := []models.AnswerOption{{ID: 2, OptionOrder: 1}, {ID: 3, OptionOrder: 2}, {ID: 9, OptionOrder: 3}}
+	if removed := restoreOptions(options, live); !slices.Equal(removed, []int{1}) {
+		t.Errorf("expected only the option the revision lacks deleted, got %v", removed)
+	}
+	if options[0].ID != 2 || options[1].ID != 3 || options[2].ID != 0 {
+		t.Errorf("expected kept options to keep their IDs and the deleted one created again, got %+v", options)
+	}
+
+	// An option moving back would need a position another still holds
+	options = []models.AnswerOption{{ID: 3, OptionOrder: 1}, {ID: 1, OptionOrder: 2}}
+	if removed := restoreOptions(options, live); !slices.Equal(removed, []int{1, 2, 3}) {
+		t.Errorf("expected every live option deleted, got %v", removed)
+	}
+	if options[0].ID != 0 || options[1].ID != 0 {
+		t.Errorf("expected every option created again, got %+v", options)
+	}
+}
+
+func TestRestoreRevisionInPlace(t *testing.T) {
+	upload := uploadWithQuestion(models.QuestionUpload{
+		QuestionText: "When was the Battle of Hastings?", Options: []string{"1066", "1215"}, Points: 1,
+	})
+
+	inTestTx(t, func(ctx context.Context, tx *repository.TestRepository, teacherID int) error {
+		required, err := persistTestUpload(ctx, tx, upload, teacherID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		created, err := persistTestUpload(ctx, tx, upload, teacherID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prerequisite := &models.Prerequisite{TestID: created.ID, Kind: models.PrerequisitePassed, RequiredTestID: &required.ID}
+		if err := tx.CreatePrerequisite(ctx, prerequisite); err != nil {
+			t.Fatal(err)
+		}
+
+		// Revision 2 renames the test and drops the second option
+		test, err := tx.GetByID(ctx, created.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		question := test.Questions[0]
+		test.Title = "Norman conquest"
+		test.Questions[0].Options = question.Options[:1]
+		removed := testEditRemovals{options: []int{question.Options[1].ID}}
+		if err := saveTestEdit(ctx, tx, test, removed, teacherID); err != nil {
+			t.Fatal(err)
+		}
+
+		revisions, err := tx.GetRevisions(ctx, test.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := revisions[len(revisions)-1]
+		if err := restoreRevision(ctx, tx, test.ID, first.Content, first.Revision, teacherID); err != nil {
+			t.Fatalf("restoring revision %d: %v", first.Revision, err)
+		}
+
+		restored, err := tx.GetByID(ctx, test.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored.Title != "History" || len(restored.Questions) != 1 || len(restored.Questions[0].Options) != 2 {
+			t.Fatalf("expected the first revision's content on the test, got %+v", restored)
+		}
+		if restored.Questions[0].ID != question.ID || restored.Questions[0].Options[0].ID != question.Options[0].ID {
+			t.Errorf("expected the question and its kept option to keep their IDs, got %+v", restored.Questions[0])
+		}
+		if len(restored.Prerequisites) != 1 || restored.Prerequisites[0].ID != prerequisite.ID {
+			t.Errorf("expected the test's prerequisite kept, got %+v", restored.Prerequisites)
+		}
+
+		revisions, err = tx.GetRevisions(ctx, test.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		latest := revisions[0]
+		if latest.Revision != 3 || latest.RestoredFrom == nil || *latest.RestoredFrom != first.Revision ||
+			latest.CreatedBy == nil || *latest.CreatedBy != teacherID {
+			t.Fatalf("expected revision 3 restored from revision %d by the restorer, got %+v", first.Revision, latest)
+		}
+		return errRollback
+	})
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"my-app/internal/auth"
+	"my-app/internal/models"
+)
+
+// currentSection returns the section the attempt is working on, or nil when
+// the test has no sections or every section has closed. An attempt whose
+// section has closed moves on to the next open section, or back to an
+// earlier one still open. Entering a section starts its clock; changed
+// reports whether the attempt's section state needs saving.
+func currentSection(test *models.Test, attempt *models.TestAttempt, now time.Time) (section *models.Section, changed bool) {
+	if len(test.Sections) == 0 {
+		return nil, false
+	}
+
+	start := slices.IndexFunc(test.Sections, func(s models.Section) bool {
+		return attempt.SectionID != nil && s.ID == *attempt.SectionID
+	})
+	if start < 0 {
+		start = 0
+	}
+	for i := range test.Sections {
+		s := &test.Sections[(start+i)%len(test.Sections)]
+		if attempt.SectionOpen(s, now) {
+			return s, enterSection(attempt, s, now)
+		}
+	}
+	return nil, false
+}
+
+// enterSection makes the section the attempt's current one, starting its
+// clock the first time, and reports whether anything changed
+func enterSection(attempt *models.TestAttempt, s *models.Section, now time.Time) bool {
+	changed := attempt.SectionID == nil || *attempt.SectionID != s.ID
+	attempt.SectionID = &s.ID
+	if _, entered := attempt.SectionStarts[s.ID]; !entered {
+		if attempt.SectionStarts == nil {
+			attempt.SectionStarts = make(map[int]time.Time)
+		}
+		attempt.SectionStarts[s.ID] = now
+		changed = true
+	}
+	return changed
+}
+
+// sectionAccepts reports whether the attempt may still answer the question:
+// it must be in the section the student is working on, which they have not
+// left and whose time and grace period have not run out. Questions of tests
+// without sections are always accepted.
+func sectionAccepts(test *models.Test, attempt *models.TestAttempt, q *models.Question, now time.Time) bool {
+	s := test.SectionOf(q)
+	if s == nil {
+		return true
+	}
+	current := test.Section(attempt.SectionID)
+	if current == nil {
+		current = &test.Sections[0]
+	}
+	return s.ID == current.ID && !slices.Contains(attempt.SectionsLeft, s.ID) && !attempt.SectionTimeUp(s, now)
+}
+
+// writeSectionEnded tells the page its section has closed, so it reloads onto
+// the next one rather than submitting the whole test
+func writeSectionEnded(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       false,
+		"error":         "This section has ended",
+		"section_ended": true,
+	})
+}
+
+// questionNumbers numbers the questions from 1 in the order given, so a test
+// shown a section at a time keeps numbering across its sections
+func questionNumbers(questions []models.Question) map[int]int {
+	numbers := make(map[int]int, len(questions)) // questionID -> number
+	for i, q := range questions {
+		numbers[q.ID] = i + 1
+	}
+	return numbers
+}
+
+// MoveSection moves an attempt to another of its test's sections. The
+// section must still be open, and moving on from a no-return section closes
+// it for the rest of the attempt.
+func (h *TestHandler) MoveSection(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSessionData(r)
+	attemptIDStr := r.FormValue("attempt_id")
+	attemptID, err := strconv.Atoi(attemptIDStr)
+	if err != nil {
+		http.Error(w, "Invalid attempt ID", http.StatusBadRequest)
+		return
+	}
+	sectionID, err := strconv.Atoi(r.FormValue("section_id"))
+	if err != nil {
+		http.Error(w, "Invalid section ID", http.StatusBadRequest)
+		return
+	}
+
+	// Verify attempt belongs to user
+	attempt, err := h.attemptRepo.GetByID(r.Context(), attemptID)
+	if err != nil || attempt.UserID != session.UserID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	// An attempt that is over, or out of time, shows its results
+	now := time.Now()
+	if attempt.Status != "in_progress" || attempt.TimeUp(now) {
+		http.Redirect(w, r, "/test/take?attempt_id="+attemptIDStr, http.StatusSeeOther)
+		return
+	}
+
+	test, err := h.testRepo.GetForAttempt(r.Context(), attempt)
+	if err != nil {
+		log.Printf("Error fetching test: %v", err)
+		http.Error(w, "Test not found", http.StatusNotFound)
+		return
+	}
+	target := test.Section(&sectionID)
+	if target == nil {
+		http.Error(w, "Section not found", http.StatusBadRequest)
+		return
+	}
+	if !attempt.SectionOpen(target, now) {
+		http.Error(w, "That section has closed", http.StatusConflict)
+		return
+	}
+
+	if current, _ := currentSection(test, attempt, now); current != nil && current.ID != target.ID && current.NoReturn {
+		attempt.SectionsLeft = append(attempt.SectionsLeft, current.ID)
+	}
+	enterSection(attempt, target, now)
+	if err := h.attemptRepo.UpdateSectionState(r.Context(), attempt); err != nil {
+		log.Printf("Error moving attempt %d to section %d: %v", attemptID, sectionID, err)
+		http.Error(w, "Failed to change section", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/test/take?attempt_id="+attemptIDStr, http.StatusSeeOther)
+}
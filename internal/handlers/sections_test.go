@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"my-app/internal/models"
+)
+
+func sectionedTest() *models.Test {
+	a, b := 1, 2
+	return &models.Test{
+		Sections: []models.Section{
+			{ID: a, Title: "A", TimeLimitMinutes: 10, NoReturn: true, SectionOrder: 1},
+			{ID: b, Title: "B", SectionOrder: 2},
+			{ID: 3, Title: "C", TimeLimitMinutes: 5, SectionOrder: 3},
+		},
+		Questions: []models.Question{{ID: 10}, {ID: 20, SectionID: &b}, {ID: 30, SectionID: &a}},
+	}
+}
+
+func TestCurrentSection(t *testing.T) {
+	test := sectionedTest()
+	start := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	attempt := &models.TestAttempt{}
+
+	// A new attempt enters the first section and starts its clock
+	section, changed := currentSection(test, attempt, start)
+	if section == nil || section.ID != 1 || !changed || !attempt.SectionStarts[1].Equal(start) {
+		t.Fatalf("expected to enter section A at the start, got %+v (changed %v)", section, changed)
+	}
+	if _, changed := currentSection(test, attempt, start.Add(time.Minute)); changed {
+		t.Fatal("expected nothing to change while the section stays open")
+	}
+
+	// Once its time runs out the attempt moves on
+	section, _ = currentSection(test, attempt, start.Add(10*time.Minute))
+	if section == nil || section.ID != 2 || !attempt.SectionStarts[2].Equal(start.Add(10*time.Minute)) {
+		t.Fatalf("expected to move on to section B, got %+v", section)
+	}
+
+	// From the last section, with its time up, it goes back to one still open
+	attempt.SectionID = &test.Sections[2].ID
+	attempt.SectionStarts[3] = start.Add(11 * time.Minute)
+	section, _ = currentSection(test, attempt, start.Add(20*time.Minute))
+	if section == nil || section.ID != 2 {
+		t.Fatalf("expected to go back to section B, got %+v", section)
+	}
+
+	attempt.SectionsLeft = []int{2}
+	if section, _ := currentSection(test, attempt, start.Add(20*time.Minute)); section != nil {
+		t.Fatalf("expected no section once every one has closed, got %+v", section)
+	}
+
+	if section, changed := currentSection(&models.Test{}, attempt, start); section != nil || changed {
+		t.Fatal("expected no section for a test without sections")
+	}
+}
+
+func TestSectionAccepts(t *testing.T) {
+	test := sectionedTest()
+	start := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	attempt := &models.TestAttempt{SectionStarts: map[int]time.Time{1: start}}
+	unassigned, inB, inA := &test.Questions[0], &test.Questions[1], &test.Questions[2]
+
+	// Before any move the attempt is on the first section, which holds the
+	// questions not assigned to one
+	if !sectionAccepts(test, attempt, unassigned, start) || !sectionAccepts(test, attempt, inA, start) {
+		t.Fatal("expected the first section's questions to be accepted")
+	}
+	if sectionAccepts(test, attempt, inB, start) {
+		t.Fatal("expected a question in another section to be refused")
+	}
+
+	// A last answer is taken during the grace period
+	deadline := start.Add(10 * time.Minute)
+	if !sectionAccepts(test, attempt, inA, deadline.Add(models.SubmissionGrace)) {
+		t.Fatal("expected answers to be accepted until the grace period ends")
+	}
+	if sectionAccepts(test, attempt, inA, deadline.Add(models.SubmissionGrace+time.Second)) {
+		t.Fatal("expected answers to be refused once the section's time is up")
+	}
+
+	attempt.SectionsLeft = []int{1}
+	if sectionAccepts(test, attempt, inA, start) {
+		t.Fatal("expected a section the student has left to refuse answers")
+	}
+
+	if !sectionAccepts(&models.Test{}, &models.TestAttempt{}, &models.Question{ID: 1}, start) {
+		t.Fatal("expected tests without sections to accept every question")
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"my-app/internal/auth"
+	"my-app/internal/models"
+	"my-app/internal/repository"
+	"my-app/internal/spreadsheet"
+)
+
+// UploadSheet handles a CSV or XLSX test upload for teachers
+func (h *TeacherHandler) UploadSheet(w http.ResponseWriter, r *http.Request) {
+	uploadSheet(w, r, h.testRepo)
+}
+
+// UploadSheet handles a CSV or XLSX test upload
+func (h *AdminHandler) UploadSheet(w http.ResponseWriter, r *http.Request) {
+	uploadSheet(w, r, h.testRepo)
+}
+
+// DownloadSheetTemplate downloads a CSV file to write a test in, laid out as
+// UploadSheet expects
+func (h *TeacherHandler) DownloadSheetTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="test-template.csv"`)
+
+	out := csv.NewWriter(w)
+	out.WriteAll(spreadsheet.Template())
+	if err := out.Error(); err != nil {
+		log.Printf("Error writing sheet template: %v", err)
+	}
+}
+
+// uploadSheet creates a test from the spreadsheet in the form's "file"
+// field, one row per question. Test details the sheet's header block leaves
+// out are taken from the form's fields of the same names. Problems are
+// reported against the sheet row and column they concern.
+func uploadSheet(w http.ResponseWriter, r *http.Request, repo *repository.TestRepository) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session := auth.GetSessionData(r)
+
+	if err := r.ParseMultipartForm(spreadsheet.MaxFileSize); err != nil {
+		writeUploadError(w, http.StatusBadRequest, fmt.Sprintf("Invalid upload: %v", err))
+		return
+	}
+	file, handler, err := r.FormFile("file")
+	if err != nil {
+		writeUploadError(w, http.StatusBadRequest, "Choose a .csv or .xlsx file to upload")
+		return
+	}
+	defer file.Close()
+
+	rows, err := spreadsheet.Read(handler.Filename, file)
+	if err != nil {
+		writeUploadError(w, http.StatusBadRequest, fmt.Sprintf("Could not read the spreadsheet: %v", err))
+		return
+	}
+
+	testUpload, validationErrors := testUploadFromSheet(rows, sheetDefaults(r))
+	if len(validationErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"errors":  validationErrors,
+		})
+		return
+	}
+
+	test, err := persistTestUpload(r.Context(), repo, testUpload, session.UserID)
+	if err != nil {
+		log.Printf("Error creating test: %v", err)
+		writeUploadError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create test: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"test_id": test.ID,
+		"message": fmt.Sprintf("Test uploaded successfully with %d questions", len(testUpload.Questions)),
+	})
+}
+
+// testUploadFromSheet maps a sheet's rows into a test upload and validates
+// it, keying each problem by the sheet cell it concerns where there is one
+func testUploadFromSheet(rows [][]string, defaults models.TestUpload) (models.TestUpload, map[string]string) {
+	testUpload, layout, problems := spreadsheet.ParseTest(rows, defaults)
+	if layout == nil {
+		return testUpload, problems
+	}
+
+	errors := make(map[string]string, len(problems))
+	for key, msg := range validateTestUpload(testUpload) {
+		if where, ok := layout.Locate(key); ok {
+			key = where
+		}
+		errors[key] = msg
+	}
+	// What the sheet itself got wrong explains the validation errors it causes
+	for where, msg := range problems {
+		errors[where] = msg
+	}
+	return testUpload, errors
+}
+
+// sheetDefaults reads the test details given alongside an uploaded sheet
+func sheetDefaults(r *http.Request) models.TestUpload {
+	return models.TestUpload{
+		Title:            r.FormValue("title"),
+		Description:      r.FormValue("description"),
+		Subject:          r.FormValue("subject"),
+		Topic:            r.FormValue("topic"),
+		ExamStandard:     r.FormValue("exam_standard"),
+		Difficulty:       r.FormValue("difficulty"),
+		TimeLimitMinutes: parseIntOrDefault(r.FormValue("time_limit_minutes"), 10),
+		PassingScore:     parseIntOrDefault(r.FormValue("passing_score"), 60),
+	}
+}
+
+func writeUploadError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   message,
+	})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"testing"
+
+	"my-app/internal/models"
+)
+
+func TestTestUploadFromSheet(t *testing.T) {
+	rows := [][]string{
+		{"title", "Fractions"},
+		{"description", "Halves and quarters"},
+		{"passing_score", "150"},
+		{"Question", "Option A", "Option B", "Correct", "Points"},
+		{"Half of 10?", "2", "5", "B", "1"},
+		{"", "4", "8", "A", "x"},
+	}
+	defaults := models.TestUpload{Subject: "Maths", ExamStandard: "GCSE", Difficulty: "Easy", TimeLimitMinutes: 10}
+
+	upload, errors := testUploadFromSheet(rows, defaults)
+	if len(upload.Questions) != 2 {
+		t.Fatalf("expected both rows read as questions, got %+v", upload.Questions)
+	}
+	for where, want := range map[string]string{
+		"Row 3, column B (passing_score)": "Passing score must be between 0 and 100",
+		"Row 6, column A (Question)":      "Question text is required",
+		"Row 6, column E (Points)":        `Points must be a whole number, not "x"`,
+	} {
+		if got := errors[where]; got != want {
+			t.Errorf("%s: expected %q, got %q (all errors: %v)", where, want, got, errors)
+		}
+	}
+	if len(errors) != 3 {
+		t.Errorf("expected three errors, got %v", errors)
+	}
+
+	rows[2][1] = "60"
+	rows[5][0] = "A quarter of 16?"
+	rows[5][4] = "2"
+	if _, errors := testUploadFromSheet(rows, defaults); len(errors) != 0 {
+		t.Fatalf("expected the corrected sheet accepted, got %v", errors)
+	}
+}
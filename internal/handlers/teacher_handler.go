@@ -15,6 +15,7 @@ import (
 	"my-app/internal/auth"
 	"my-app/internal/models"
 	"my-app/internal/repository"
+	"my-app/internal/richtext"
 	"my-app/internal/validation"
 )
 
@@ -23,6 +24,7 @@ type TeacherHandler struct {
 	testRepo    *repository.TestRepository
 	userRepo    *repository.UserRepository
 	attemptRepo *repository.AttemptRepository
+	imports     *importJobs
 }
 
 // NewTeacherHandler creates a new teacher handler
@@ -31,6 +33,7 @@ func NewTeacherHandler(testRepo *repository.TestRepository, userRepo *repository
 		testRepo:    testRepo,
 		userRepo:    userRepo,
 		attemptRepo: attemptRepo,
+		imports:     newImportJobs(),
 	}
 }
 
@@ -50,25 +53,41 @@ func (h *TeacherHandler) ShowDashboard(w http.ResponseWriter, r *http.Request) {
 	for _, test := range tests {
 		attempts, _ := h.attemptRepo.GetByTestID(r.Context(), test.ID)
 
-		totalAttempts := len(attempts)
-		var totalScore float64
-		completedAttempts := 0
-
+		// Practice attempts are reported on their own
+		totalAttempts, completedAttempts, practiceAttempts := 0, 0, 0
+		byStudent := make(map[int][]models.TestAttempt)
 		for _, attempt := range attempts {
+			if attempt.Practice {
+				practiceAttempts++
+				continue
+			}
+			totalAttempts++
 			if attempt.CompletedAt != nil && attempt.Score != nil {
 				completedAttempts++
-				totalScore += float64(*attempt.Score)
+			}
+			byStudent[attempt.UserID] = append(byStudent[attempt.UserID], attempt)
+		}
+
+		// Average the result that counts for each student under the test's
+		// attempt policy, so a student with many attempts isn't weighted more
+		var totalPercentage float64
+		scoredStudents := 0
+		for _, own := range byStudent {
+			if pct, ok := test.Attempts.CountedPercentage(own); ok {
+				totalPercentage += pct
+				scoredStudents++
 			}
 		}
 
 		avgScore := 0.0
-		if completedAttempts > 0 {
-			avgScore = totalScore / float64(completedAttempts)
+		if scoredStudents > 0 {
+			avgScore = totalPercentage / float64(scoredStudents)
 		}
 
 		testStats[test.ID] = map[string]interface{}{
 			"total_attempts":     totalAttempts,
 			"completed_attempts": completedAttempts,
+			"practice_attempts":  practiceAttempts,
 			"average_score":      fmt.Sprintf("%.1f", avgScore),
 		}
 	}
@@ -79,7 +98,9 @@ func (h *TeacherHandler) ShowDashboard(w http.ResponseWriter, r *http.Request) {
 		"TestStats": testStats,
 	}
 
-	tmpl, err := template.ParseFiles("views/layout.html", "views/teacher_dashboard.html")
+	tmpl, err := template.New("").Funcs(template.FuncMap{
+		"add": func(a, b int) int { return a + b },
+	}).ParseFiles("views/layout.html", "views/teacher_dashboard.html")
 	if err != nil {
 		log.Printf("Error parsing templates: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -229,6 +250,9 @@ func (h *TeacherHandler) CreateTest(w http.ResponseWriter, r *http.Request) {
 		TimeLimitMinutes: parseIntOrDefault(r.FormValue("time_limit_minutes"), 10),
 		CreatedBy:        &session.UserID,
 	}
+	test.Scoring = parseScoringPolicyForm(r, models.DefaultScoringPolicy())
+	test.Attempts = parseAttemptPolicyForm(r, models.DefaultAttemptPolicy())
+	parseAvailabilityForm(r, test)
 
 	// Parse subject and topic
 	if subjectIDStr := r.FormValue("subject_id"); subjectIDStr != "" {
@@ -266,6 +290,7 @@ func (h *TeacherHandler) CreateTest(w http.ResponseWriter, r *http.Request) {
 		question := &models.Question{
 			TestID:        test.ID,
 			QuestionText:  questionText,
+			QuestionType:  r.FormValue(fmt.Sprintf("question_%d_type", i)),
 			QuestionOrder: i,
 			Points:        parseIntOrDefault(r.FormValue(fmt.Sprintf("question_%d_points", i)), 1),
 		}
@@ -273,7 +298,7 @@ func (h *TeacherHandler) CreateTest(w http.ResponseWriter, r *http.Request) {
 		// Handle image upload
 		if file, handler, err := r.FormFile(fmt.Sprintf("question_%d_image", i)); err == nil {
 			defer file.Close()
-			imagePath, err := h.saveUploadedImage(test.ID, i, file, handler.Filename)
+			imagePath, err := saveUploadedImage(test.ID, fmt.Sprintf("question_%d", i), file, handler.Filename)
 			if err == nil && imagePath != "" {
 				question.ImageURL = &imagePath
 			}
@@ -284,9 +309,12 @@ func (h *TeacherHandler) CreateTest(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		// Create answer options
-		for j := 1; j <= 4; j++ {
+		// Create answer options; true/false questions use fixed option text
+		for j := 1; j <= models.MaxOptions; j++ {
 			optionText := r.FormValue(fmt.Sprintf("question_%d_option_%d", i, j))
+			if question.IsTrueFalse() && j <= len(models.TrueFalseOptions) {
+				optionText = models.TrueFalseOptions[j-1]
+			}
 			if optionText == "" {
 				continue
 			}
@@ -306,6 +334,10 @@ func (h *TeacherHandler) CreateTest(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if err := recordRevision(r.Context(), h.testRepo, test.ID, session.UserID); err != nil {
+		log.Printf("Error saving test revision: %v", err)
+	}
+
 	// Redirect to test edit page
 	http.Redirect(w, r, fmt.Sprintf("/teacher/test/%d/edit", test.ID), http.StatusSeeOther)
 }
@@ -329,30 +361,7 @@ func (h *TeacherHandler) EditTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	subjects, err := h.testRepo.GetSubjects(r.Context())
-	if err != nil {
-		subjects = []models.Subject{}
-	}
-
-	data := map[string]interface{}{
-		"Session":  session,
-		"Test":     test,
-		"Subjects": subjects,
-	}
-
-	tmpl, err := template.New("").Funcs(template.FuncMap{
-		"add": func(a, b int) int { return a + b },
-	}).ParseFiles("views/layout.html", "views/edit_test.html")
-	if err != nil {
-		log.Printf("Error parsing templates: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
-	if err := tmpl.ExecuteTemplate(w, "layout.html", data); err != nil {
-		log.Printf("Error executing template: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-	}
+	renderEditTest(w, r, h.testRepo, test, nil)
 }
 
 // UpdateTest handles test updates
@@ -393,24 +402,32 @@ func (h *TeacherHandler) UpdateTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update test fields
-	test.Title = r.FormValue("title")
-	test.Description = r.FormValue("description")
-	test.ExamStandard = r.FormValue("exam_standard")
-	test.Difficulty = r.FormValue("difficulty")
-	test.PassingScore = parseIntOrDefault(r.FormValue("passing_score"), 60)
-	test.TimeLimitMinutes = parseIntOrDefault(r.FormValue("time_limit_minutes"), 10)
+	// Log what the test held before the edit, which students may have been asked
+	if err := freezeBeforeEdit(r.Context(), h.testRepo, test); err != nil {
+		log.Printf("Error saving test revision: %v", err)
+		http.Error(w, "Failed to update test", http.StatusInternalServerError)
+		return
+	}
+
+	removed := parseTestEditForm(r, test)
 
 	log.Printf("Updating test %d: title=%s, description=%s", testID, test.Title, test.Description)
 
-	// Validate
-	validator := validation.NewTestValidator()
-	if !validator.ValidateTest(test) {
-		http.Error(w, "Validation failed", http.StatusBadRequest)
+	catalogue, err := h.testRepo.GetAll(r.Context())
+	if err != nil {
+		log.Printf("Error fetching tests: %v", err)
+		http.Error(w, "Failed to update test", http.StatusInternalServerError)
+		return
+	}
+	if problems := validateTestEdit(test, catalogue); problems.any() {
+		renderEditTest(w, r, h.testRepo, test, &problems)
 		return
 	}
 
-	if err := h.testRepo.Update(r.Context(), test); err != nil {
+	err = h.testRepo.InTx(r.Context(), func(tx *repository.TestRepository) error {
+		return saveTestEdit(r.Context(), tx, test, removed, session.UserID)
+	})
+	if err != nil {
 		log.Printf("Error updating test: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to update test: %v", err), http.StatusInternalServerError)
 		return
@@ -418,43 +435,6 @@ func (h *TeacherHandler) UpdateTest(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Test %d updated successfully", testID)
 
-	// Update questions
-	for idx, q := range test.Questions {
-		questionText := r.FormValue(fmt.Sprintf("question_%d_text", idx))
-		pointsStr := r.FormValue(fmt.Sprintf("question_%d_points", idx))
-
-		if questionText != "" {
-			q.QuestionText = questionText
-			q.Points = parseIntOrDefault(pointsStr, 1)
-
-			log.Printf("Updating question %d: text=%s, points=%d", q.ID, q.QuestionText, q.Points)
-
-			if err := h.testRepo.UpdateQuestion(r.Context(), &q); err != nil {
-				log.Printf("Error updating question: %v", err)
-				http.Error(w, fmt.Sprintf("Failed to update question: %v", err), http.StatusInternalServerError)
-				return
-			}
-		}
-
-		// Update answer options and set correct answer
-		correctOptionID := parseIntOrDefault(r.FormValue(fmt.Sprintf("question_%d_correct_option", idx)), 0)
-		for optIdx, opt := range q.Options {
-			optionText := r.FormValue(fmt.Sprintf("question_%d_option_%d_text", idx, optIdx))
-			if optionText != "" {
-				opt.OptionText = optionText
-				opt.IsCorrect = (opt.ID == correctOptionID)
-
-				log.Printf("Updating option %d: text=%s, isCorrect=%v", opt.ID, opt.OptionText, opt.IsCorrect)
-
-				if err := h.testRepo.UpdateAnswerOption(r.Context(), &opt); err != nil {
-					log.Printf("Error updating answer option: %v", err)
-					http.Error(w, fmt.Sprintf("Failed to update answer option: %v", err), http.StatusInternalServerError)
-					return
-				}
-			}
-		}
-	}
-
 	log.Printf("Redirecting to /teacher/test/%d/edit", testID)
 	http.Redirect(w, r, fmt.Sprintf("/teacher/test/%d/edit", test.ID), http.StatusSeeOther)
 }
@@ -482,7 +462,9 @@ func (h *TeacherHandler) PreviewTest(w http.ResponseWriter, r *http.Request) {
 		"Test":    test,
 	}
 
-	tmpl, err := template.ParseFiles("views/layout.html", "views/test_preview.html")
+	tmpl, err := template.New("").Funcs(template.FuncMap{
+		"richText": richtext.Render,
+	}).ParseFiles("views/layout.html", "views/test_preview.html")
 	if err != nil {
 		log.Printf("Error parsing templates: %v", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -607,8 +589,9 @@ func (h *TeacherHandler) DeleteTest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// saveUploadedImage saves an uploaded image file
-func (h *TeacherHandler) saveUploadedImage(testID int, questionNumber int, file io.ReadCloser, filename string) (string, error) {
+// saveUploadedImage saves an uploaded image file among the test's uploads
+// under the name given, e.g. "question_3", keeping its extension
+func saveUploadedImage(testID int, name string, file io.Reader, filename string) (string, error) {
 	// Create uploads directory if it doesn't exist
 	uploadDir := filepath.Join("assets", "uploads", strconv.Itoa(testID))
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
@@ -621,7 +604,7 @@ func (h *TeacherHandler) saveUploadedImage(testID int, questionNumber int, file
 		return "", fmt.Errorf("unsupported image type")
 	}
 
-	fname := fmt.Sprintf("question_%d%s", questionNumber, ext)
+	fname := name + ext
 	fpath := filepath.Join(uploadDir, fname)
 	webPath := fmt.Sprintf("/assets/uploads/%d/%s", testID, fname)
 
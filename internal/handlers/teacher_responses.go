@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"my-app/internal/auth"
+	"my-app/internal/models"
+	"my-app/internal/repository"
+	"my-app/internal/scoring"
+)
+
+// shortAnswerResponses pairs a short-answer question with what students typed for it
+type shortAnswerResponses struct {
+	Question  models.Question
+	Responses []repository.TypedAnswerCount
+}
+
+// ShowResponses lists the distinct answers students typed for each short-answer
+// question so the author can accept new ones, and the hints each student used
+func (h *TeacherHandler) ShowResponses(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSessionData(r)
+	test, ok := h.testForAuthor(w, r)
+	if !ok {
+		return
+	}
+
+	// Students answered the questions as their attempt's revision had them,
+	// including questions deleted from the test since
+	revisions, err := h.testRepo.GetAttemptedRevisions(r.Context(), test.ID)
+	if err != nil {
+		log.Printf("Error fetching test revisions: %v", err)
+		http.Error(w, "Failed to load responses", http.StatusInternalServerError)
+		return
+	}
+	asked := *test
+	asked.Questions = questionsAcrossRevisions(test, revisions)
+
+	var questions []shortAnswerResponses
+	for _, q := range asked.Questions {
+		if !q.IsShortAnswer() {
+			continue
+		}
+		counts, err := h.attemptRepo.GetTypedAnswerCounts(r.Context(), q.ID)
+		if err != nil {
+			log.Printf("Error fetching typed answers: %v", err)
+			http.Error(w, "Failed to load responses", http.StatusInternalServerError)
+			return
+		}
+		questions = append(questions, shortAnswerResponses{Question: q, Responses: counts})
+	}
+
+	uses, err := h.attemptRepo.GetHintUsage(r.Context(), test.ID)
+	if err != nil {
+		log.Printf("Error fetching hint usage: %v", err)
+		http.Error(w, "Failed to load responses", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Session":   session,
+		"Test":      test,
+		"Questions": questions,
+		"HintUsage": groupHintUsage(&asked, uses),
+		"Regraded":  r.URL.Query().Get("regraded"),
+	}
+
+	tmpl, err := template.ParseFiles("views/layout.html", "views/teacher_responses.html")
+	if err != nil {
+		log.Printf("Error parsing templates: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "layout.html", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// AcceptAnswer adds a student's answer to a short-answer question's accepted
+// list and regrades every attempt at the test
+func (h *TeacherHandler) AcceptAnswer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	test, ok := h.testForAuthor(w, r)
+	if !ok {
+		return
+	}
+
+	questionID, _ := strconv.Atoi(r.FormValue("question_id"))
+	answerText := strings.Join(strings.Fields(r.FormValue("answer_text")), " ")
+	if answerText == "" {
+		http.Error(w, "Answer text is required", http.StatusBadRequest)
+		return
+	}
+
+	var question *models.Question
+	for i := range test.Questions {
+		if test.Questions[i].ID == questionID && test.Questions[i].IsShortAnswer() {
+			question = &test.Questions[i]
+			break
+		}
+	}
+	if question == nil {
+		http.Error(w, "Question not found", http.StatusBadRequest)
+		return
+	}
+
+	accepted := &models.AcceptedAnswer{QuestionID: question.ID, AnswerText: answerText}
+	if err := h.testRepo.CreateAcceptedAnswer(r.Context(), accepted); err != nil {
+		log.Printf("Error adding accepted answer: %v", err)
+		http.Error(w, "Failed to add accepted answer", http.StatusInternalServerError)
+		return
+	}
+	question.AcceptedAnswers = append(question.AcceptedAnswers, *accepted)
+
+	h.regradeAndRedirect(w, r, test)
+}
+
+// RegradeTest regrades every attempt at a test against the answer key of the
+// revision it was taken against, the answers now accepted and the current
+// grade boundaries
+func (h *TeacherHandler) RegradeTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	test, ok := h.testForAuthor(w, r)
+	if !ok {
+		return
+	}
+
+	h.regradeAndRedirect(w, r, test)
+}
+
+func (h *TeacherHandler) regradeAndRedirect(w http.ResponseWriter, r *http.Request, test *models.Test) {
+	changed, err := h.regradeTest(r.Context(), test)
+	if err != nil {
+		log.Printf("Error regrading test %d: %v", test.ID, err)
+		http.Error(w, "Failed to regrade attempts", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/teacher/test/%d/responses?regraded=%d", test.ID, changed), http.StatusSeeOther)
+}
+
+// testForAuthor loads the test named in the path and checks the user wrote it
+// (or is an admin), writing the error response when not
+func (h *TeacherHandler) testForAuthor(w http.ResponseWriter, r *http.Request) (*models.Test, bool) {
+	session := auth.GetSessionData(r)
+	testID, _ := strconv.Atoi(r.PathValue("id"))
+
+	test, err := h.testRepo.GetByID(r.Context(), testID)
+	if err != nil {
+		http.Error(w, "Test not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if test.CreatedBy != nil && *test.CreatedBy != session.UserID && session.Role != "admin" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+
+	return test, true
+}
+
+// regradeTest regrades the answers of every attempt at the test and updates
+// the scores and grades of completed attempts, keeping each student's stats in
+// step. Each attempt is scored over the questions it was asked, as its
+// revision of the test had them but with the answers now accepted, less the
+// hints it revealed, and graded against the current grade boundaries. It
+// returns how many completed attempts changed score or grade.
+func (h *TeacherHandler) regradeTest(ctx context.Context, test *models.Test) (int, error) {
+	attempts, err := h.attemptRepo.GetByTestID(ctx, test.ID)
+	if err != nil {
+		return 0, err
+	}
+	boundaries, err := h.testRepo.GradeBoundariesFor(ctx, test)
+	if err != nil {
+		return 0, err
+	}
+
+	revisions := make(map[int]*models.Test) // revision ID -> its content
+	changed := 0
+	for _, attempt := range attempts {
+		answers, err := h.attemptRepo.GetAnswersByAttemptID(ctx, attempt.ID)
+		if err != nil {
+			return changed, err
+		}
+
+		hints, err := h.attemptRepo.GetHintReveals(ctx, attempt.ID)
+		if err != nil {
+			return changed, err
+		}
+
+		// Each attempt is regraded against the revision it was taken against
+		asked := *test
+		if attempt.RevisionID != nil {
+			revision, ok := revisions[*attempt.RevisionID]
+			if !ok {
+				if revision, err = h.testRepo.GetRevision(ctx, *attempt.RevisionID); err != nil {
+					return changed, err
+				}
+				revisions[*attempt.RevisionID] = revision
+			}
+			asked = *withLiveAcceptedAnswers(revision, test)
+		}
+		arrangeForAttempt(&asked, &attempt)
+		result := scoring.Score(&asked, answers, hints)
+		score, totalPoints := result.Score, result.TotalPoints
+		for i := range answers {
+			if err := h.attemptRepo.UpdateAnswerGrade(ctx, &answers[i]); err != nil {
+				return changed, err
+			}
+		}
+
+		if attempt.Status != "completed" || attempt.Score == nil {
+			continue
+		}
+		grade := boundaries.GradeFor(score, totalPoints)
+		sameScore := *attempt.Score == score && attempt.TotalPoints != nil && *attempt.TotalPoints == totalPoints
+		if sameScore && sameGrade(attempt.Grade, grade) {
+			continue
+		}
+		if err := h.attemptRepo.UpdateScore(ctx, attempt.ID, score, totalPoints, grade); err != nil {
+			return changed, err
+		}
+		changed++
+		// Practice attempts were never counted in the student's stats
+		if sameScore || attempt.Practice {
+			continue
+		}
+
+		oldTotal := score
+		if attempt.TotalPoints != nil {
+			oldTotal = *attempt.TotalPoints
+		}
+		h.adjustStatsForRegrade(ctx, test, attempt.UserID, *attempt.Score, oldTotal, score, totalPoints)
+	}
+
+	return changed, nil
+}
+
+// sameGrade reports whether two awarded grades are the same, either being nil
+// when no grade was awarded
+func sameGrade(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// adjustStatsForRegrade moves a student's points and pass count from an
+// attempt's old score to its new one
+func (h *TeacherHandler) adjustStatsForRegrade(ctx context.Context, test *models.Test, userID, oldScore, oldTotal, newScore, newTotal int) {
+	stats, err := h.userRepo.GetUserStats(ctx, userID)
+	if err != nil {
+		log.Printf("Error fetching stats for user %d: %v", userID, err)
+		return
+	}
+
+	passed := func(score, total int) bool {
+		return total > 0 && float64(score)/float64(total)*100 >= float64(test.PassingScore)
+	}
+
+	stats.TotalPoints += newScore - oldScore
+	switch {
+	case passed(newScore, newTotal) && !passed(oldScore, oldTotal):
+		stats.TestsPassed++
+	case !passed(newScore, newTotal) && passed(oldScore, oldTotal):
+		stats.TestsPassed--
+	}
+
+	if err := h.userRepo.UpdateUserStats(ctx, stats); err != nil {
+		log.Printf("Error updating stats for user %d: %v", userID, err)
+	}
+}
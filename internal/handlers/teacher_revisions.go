@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"my-app/internal/auth"
+	"my-app/internal/models"
+	"my-app/internal/repository"
+	"my-app/internal/revision"
+)
+
+// ShowRevisions lists a test's revisions, newest first, and the changes from
+// one to another: by default from the previous revision to the latest
+func (h *TeacherHandler) ShowRevisions(w http.ResponseWriter, r *http.Request) {
+	session := auth.GetSessionData(r)
+	test, ok := h.testForAuthor(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.testRepo.GetRevisions(r.Context(), test.ID)
+	if err != nil {
+		log.Printf("Error fetching test revisions: %v", err)
+		http.Error(w, "Failed to load revisions", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Session":   session,
+		"Test":      test,
+		"Revisions": revisions,
+	}
+
+	if len(revisions) > 0 {
+		to := revisionNumbered(revisions, r.URL.Query().Get("to"), &revisions[0])
+		from := to
+		if i := indexOfRevision(revisions, to.Revision); i+1 < len(revisions) {
+			from = &revisions[i+1]
+		}
+		from = revisionNumbered(revisions, r.URL.Query().Get("from"), from)
+
+		data["From"] = from
+		data["To"] = to
+		data["Changes"] = revision.Diff(from.Content, to.Content)
+	}
+
+	tmpl, err := template.ParseFiles("views/layout.html", "views/test_revisions.html")
+	if err != nil {
+		log.Printf("Error parsing templates: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "layout.html", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// RestoreRevision writes a revision of a test back onto the test and records
+// it as a new revision restored from the one chosen
+func (h *TeacherHandler) RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session := auth.GetSessionData(r)
+	test, ok := h.testForAuthor(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.testRepo.GetRevisions(r.Context(), test.ID)
+	if err != nil {
+		log.Printf("Error fetching test revisions: %v", err)
+		http.Error(w, "Failed to restore revision", http.StatusInternalServerError)
+		return
+	}
+	chosen := revisionNumbered(revisions, r.PathValue("revision"), nil)
+	if chosen == nil {
+		http.Error(w, "Revision not found", http.StatusNotFound)
+		return
+	}
+
+	err = h.testRepo.InTx(r.Context(), func(tx *repository.TestRepository) error {
+		return restoreRevision(r.Context(), tx, test.ID, chosen.Content, chosen.Revision, session.UserID)
+	})
+	if err != nil {
+		log.Printf("Error restoring revision %d of test %d: %v", chosen.Revision, test.ID, err)
+		http.Error(w, "Failed to restore revision", http.StatusInternalServerError)
+		return
+	}
+
+	editPath := "/teacher/test/%d/edit"
+	if session.Role == "admin" {
+		editPath = "/admin/test/%d/edit"
+	}
+	http.Redirect(w, r, fmt.Sprintf(editPath, test.ID), http.StatusSeeOther)
+}
+
+// revisionNumbered finds the revision with the number given, falling back
+// when the number is missing or no revision has it
+func revisionNumbered(revisions []models.TestRevision, number string, fallback *models.TestRevision) *models.TestRevision {
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return fallback
+	}
+	if i := indexOfRevision(revisions, n); i >= 0 {
+		return &revisions[i]
+	}
+	return fallback
+}
+
+func indexOfRevision(revisions []models.TestRevision, number int) int {
+	for i, v := range revisions {
+		if v.Revision == number {
+			return i
+		}
+	}
+	return -1
+}
@@ -3,9 +3,12 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"my-app/internal/models"
 	"my-app/internal/repository"
+	"my-app/internal/storage"
 	"my-app/internal/validation"
 )
 
@@ -21,37 +24,78 @@ func validateTestUpload(upload models.TestUpload) map[string]string {
 		Difficulty:       upload.Difficulty,
 		TimeLimitMinutes: upload.TimeLimitMinutes,
 		PassingScore:     upload.PassingScore,
+		Scoring:          upload.ResolvedScoring(),
+		Attempts:         upload.ResolvedAttempts(),
+		Timezone:         upload.Timezone,
+		LateSubmission:   upload.LateSubmission,
 	}
+	var windowErrors map[string]string
+	tempTest.AvailableFrom, tempTest.AvailableUntil, windowErrors = uploadWindow(upload)
 
 	if !validator.ValidateTest(tempTest) {
 		for field, msg := range validator.GetErrorMessages() {
 			errors[field] = msg
 		}
 	}
+	for field, msg := range windowErrors {
+		errors[field] = msg
+	}
 
 	if upload.Subject == "" {
 		errors["subject"] = "Subject is required"
 	}
 
+	if upload.SchemaVersion > models.UploadSchemaVersion {
+		errors["schema_version"] = fmt.Sprintf("schema_version %d is newer than this server reads (%d)", upload.SchemaVersion, models.UploadSchemaVersion)
+	}
+	if notes := upload.Notes; notes != nil {
+		switch {
+		case !storage.IsNotesFilename(notes.Filename):
+			errors["notes"] = "Notes must be a PDF or PowerPoint file"
+		case len(notes.Data) == 0:
+			errors["notes"] = "Notes file is empty"
+		}
+	}
+
 	if len(upload.Questions) == 0 {
 		errors["questions"] = "At least one question is required"
 		return errors
 	}
 
 	for idx, q := range upload.Questions {
-		opts := make([]models.AnswerOption, 0, len(q.Options))
-		for i, opt := range q.Options {
+		optionTexts := q.ResolvedOptions()
+		opts := make([]models.AnswerOption, 0, len(optionTexts))
+		for i, opt := range optionTexts {
 			opts = append(opts, models.AnswerOption{
 				OptionText:  opt,
-				IsCorrect:   i == q.CorrectIndex,
+				IsCorrect:   q.IsCorrectOption(i),
+				MatchText:   q.MatchTextFor(i),
+				Rationale:   q.RationaleFor(i),
 				OptionOrder: i + 1,
 			})
 		}
 
 		question := &models.Question{
-			QuestionText: q.QuestionText,
-			Points:       q.Points,
-			Options:      opts,
+			QuestionText:    q.QuestionText,
+			QuestionType:    q.ResolvedType(),
+			ScoringRule:     q.ResolvedScoringRule(),
+			Numeric:         q.Numeric,
+			CaseSensitive:   q.CaseSensitive,
+			TypoTolerance:   q.TypoTolerance,
+			Points:          q.Points,
+			Explanation:     q.Explanation,
+			Options:         opts,
+			AcceptedAnswers: q.ResolvedAcceptedAnswers(),
+			Hints:           q.ResolvedHints(),
+		}
+		// An embedded image is checked here, as it is stored under a URL of its own
+		for field, url := range map[string]string{"image_url": q.ImageURL, "explanation_image_url": q.ExplanationImageURL} {
+			if _, err := parseImageDataURL(url); err != nil {
+				errors[fmt.Sprintf("question_%d_%s", idx+1, field)] = err.Error()
+			}
+		}
+		if q.ExplanationImageURL != "" && !strings.HasPrefix(q.ExplanationImageURL, "data:") {
+			question.ExplanationImageURL = &q.ExplanationImageURL
 		}
 
 		qValidator := validation.NewTestValidator()
@@ -61,13 +105,165 @@ func validateTestUpload(upload models.TestUpload) map[string]string {
 				errors[fmt.Sprintf("question_%d_%s", idx+1, field)] = msg
 			}
 		}
+
+		for _, correctIdx := range q.CorrectIndices {
+			if correctIdx < 0 || correctIdx >= len(optionTexts) {
+				errors[fmt.Sprintf("question_%d_correct_indices", idx+1)] =
+					fmt.Sprintf("correct_indices must be between 0 and %d", len(optionTexts)-1)
+				break
+			}
+		}
+
+		if len(q.Rationales) > len(optionTexts) {
+			errors[fmt.Sprintf("question_%d_rationales", idx+1)] =
+				fmt.Sprintf("rationales has %d entries but the question only has %d options", len(q.Rationales), len(optionTexts))
+		}
+	}
+
+	// Every question's pool must be declared, and each pool must hold at
+	// least as many questions as an attempt draws from it
+	poolIDs := make(map[string]int, len(upload.Pools))
+	pooled := &models.Test{}
+	for i, pool := range upload.Pools {
+		name := strings.TrimSpace(pool.Name)
+		if _, dup := poolIDs[name]; !dup {
+			poolIDs[name] = i + 1
+		}
+		pooled.Pools = append(pooled.Pools, models.QuestionPool{ID: i + 1, Name: name, DrawCount: pool.Draw})
+	}
+	for idx, q := range upload.Questions {
+		var question models.Question
+		if name := strings.TrimSpace(q.Pool); name != "" {
+			id, ok := poolIDs[name]
+			if !ok {
+				errors[fmt.Sprintf("question_%d_pool", idx+1)] = fmt.Sprintf("Pool %q is not listed in pools", name)
+			}
+			question.PoolID = &id
+		}
+		pooled.Questions = append(pooled.Questions, question)
+	}
+	poolValidator := validation.NewTestValidator()
+	if !poolValidator.ValidatePools(pooled) {
+		for field, msg := range poolValidator.GetErrorMessages() {
+			errors[field] = msg
+		}
+	}
+
+	// Every question's section must be declared too
+	sectioned := &models.Test{TimeLimitMinutes: upload.TimeLimitMinutes}
+	titles := make(map[string]bool, len(upload.Sections))
+	for _, s := range upload.Sections {
+		titles[strings.TrimSpace(s.Title)] = true
+		sectioned.Sections = append(sectioned.Sections, models.Section{
+			Title: s.Title, Instructions: s.Instructions, TimeLimitMinutes: s.TimeLimitMinutes, NoReturn: s.NoReturn,
+		})
+	}
+	for idx, q := range upload.Questions {
+		if title := strings.TrimSpace(q.Section); title != "" && !titles[title] {
+			errors[fmt.Sprintf("question_%d_section", idx+1)] = fmt.Sprintf("Section %q is not listed in sections", title)
+		}
+	}
+	if !poolValidator.ValidateSections(sectioned) {
+		for field, msg := range poolValidator.GetErrorMessages() {
+			errors[field] = msg
+		}
+	}
+
+	if !poolValidator.ValidateGradeBoundaries(upload.GradeBoundaries) {
+		for field, msg := range poolValidator.GetErrorMessages() {
+			errors[field] = msg
+		}
 	}
 
 	return errors
 }
 
-// persistTestUpload stores the validated test definition and returns the created test.
+// uploadWindow parses the upload's availability window in its timezone,
+// returning errors keyed by the field that did not parse. An unknown timezone
+// is left for ValidateTest to report.
+func uploadWindow(upload models.TestUpload) (from, until *time.Time, errors map[string]string) {
+	errors = make(map[string]string)
+	if _, err := time.LoadLocation(upload.Timezone); err != nil {
+		return nil, nil, errors
+	}
+	from, err := models.ParseLocalTime(upload.AvailableFrom, upload.Timezone)
+	if err != nil {
+		errors["available_from"] = "available_from: " + err.Error()
+	}
+	until, err = models.ParseLocalTime(upload.AvailableUntil, upload.Timezone)
+	if err != nil {
+		errors["available_until"] = "available_until: " + err.Error()
+	}
+	return from, until, errors
+}
+
+// persistTestUpload stores the validated test definition, with the images
+// and notes it carries, and returns the created test.
 func persistTestUpload(ctx context.Context, repo *repository.TestRepository, upload models.TestUpload, createdBy int) (*models.Test, error) {
+	var test *models.Test
+	var saved savedFiles
+	err := repo.InTx(ctx, func(tx *repository.TestRepository) error {
+		var err error
+		if test, err = createTestWithMedia(ctx, tx, upload, createdBy, &saved); err != nil {
+			return err
+		}
+		// The test's history starts with the content it was created with
+		return recordRevision(ctx, tx, test.ID, createdBy)
+	})
+	if err != nil {
+		saved.remove()
+		return nil, err
+	}
+	return test, nil
+}
+
+// createTestWithMedia stores the validated test definition like
+// createTestFromUpload, then stores the images embedded in its questions as
+// data URLs and its notes
+func createTestWithMedia(ctx context.Context, repo *repository.TestRepository, upload models.TestUpload, createdBy int, saved *savedFiles) (*models.Test, error) {
+	type questionImages struct{ image, explanation *importedFile }
+	embedded := make([]questionImages, len(upload.Questions))
+	questions := make([]models.QuestionUpload, len(upload.Questions))
+	for i, q := range upload.Questions {
+		var err error
+		if embedded[i].image, err = parseImageDataURL(q.ImageURL); err != nil {
+			return nil, err
+		}
+		if embedded[i].explanation, err = parseImageDataURL(q.ExplanationImageURL); err != nil {
+			return nil, err
+		}
+		if embedded[i].image != nil {
+			q.ImageURL = ""
+		}
+		if embedded[i].explanation != nil {
+			q.ExplanationImageURL = ""
+		}
+		questions[i] = q
+	}
+	upload.Questions = questions
+
+	test, err := createTestFromUpload(ctx, repo, upload, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	test, err = storeImportedImages(ctx, repo, test.ID, func(order int) (image, explanation *importedFile) {
+		return embedded[order-1].image, embedded[order-1].explanation
+	}, saved)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Notes != nil {
+		notes := &importedFile{name: upload.Notes.Filename, data: upload.Notes.Data}
+		if err := storeImportedNotes(ctx, repo, test.ID, notes, saved); err != nil {
+			return nil, err
+		}
+	}
+	return test, nil
+}
+
+// createTestFromUpload stores the validated test definition without
+// recording its first revision, for callers with more to add to it first
+func createTestFromUpload(ctx context.Context, repo *repository.TestRepository, upload models.TestUpload, createdBy int) (*models.Test, error) {
 	subjectID, err := repo.GetOrCreateSubject(ctx, upload.Subject, "")
 	if err != nil {
 		return nil, err
@@ -91,34 +287,104 @@ func persistTestUpload(ctx context.Context, repo *repository.TestRepository, upl
 		Difficulty:       upload.Difficulty,
 		TimeLimitMinutes: upload.TimeLimitMinutes,
 		PassingScore:     upload.PassingScore,
+		Scoring:          upload.ResolvedScoring(),
+		Attempts:         upload.ResolvedAttempts(),
+		ShuffleQuestions: upload.ShuffleQuestions,
+		ShuffleOptions:   upload.ShuffleOptions,
+		AllowPractice:    upload.AllowPractice,
+		Timezone:         upload.Timezone,
+		LateSubmission:   upload.LateSubmission,
 		CreatedBy:        &createdBy,
 	}
+	test.AvailableFrom, test.AvailableUntil, _ = uploadWindow(upload)
 
 	if err := repo.Create(ctx, test); err != nil {
 		return nil, err
 	}
 
+	poolIDs := make(map[string]*int, len(upload.Pools))
+	for _, p := range upload.Pools {
+		pool := &models.QuestionPool{TestID: test.ID, Name: strings.TrimSpace(p.Name), DrawCount: p.Draw}
+		if err := repo.CreatePool(ctx, pool); err != nil {
+			return nil, err
+		}
+		poolIDs[pool.Name] = &pool.ID
+		test.Pools = append(test.Pools, *pool)
+	}
+
+	sectionIDs := make(map[string]*int, len(upload.Sections))
+	for i, s := range upload.Sections {
+		section := &models.Section{
+			TestID:           test.ID,
+			Title:            strings.TrimSpace(s.Title),
+			Instructions:     strings.TrimSpace(s.Instructions),
+			TimeLimitMinutes: s.TimeLimitMinutes,
+			NoReturn:         s.NoReturn,
+			SectionOrder:     i + 1,
+		}
+		if err := repo.CreateSection(ctx, section); err != nil {
+			return nil, err
+		}
+		sectionIDs[section.Title] = &section.ID
+		test.Sections = append(test.Sections, *section)
+	}
+
+	if len(upload.GradeBoundaries) > 0 {
+		if err := repo.ReplaceTestGradeBoundaries(ctx, test.ID, upload.GradeBoundaries); err != nil {
+			return nil, err
+		}
+		test.GradeBoundaries = upload.GradeBoundaries.Sorted()
+	}
+
 	for i, q := range upload.Questions {
 		question := &models.Question{
-			TestID:        test.ID,
-			QuestionText:  q.QuestionText,
-			QuestionOrder: i + 1,
-			Points:        normalizePoints(q.Points),
+			TestID:          test.ID,
+			QuestionText:    q.QuestionText,
+			QuestionType:    q.ResolvedType(),
+			ScoringRule:     q.ResolvedScoringRule(),
+			Numeric:         q.Numeric,
+			CaseSensitive:   q.CaseSensitive,
+			TypoTolerance:   q.TypoTolerance,
+			KeepOptionOrder: q.KeepOptionOrder,
+			Explanation:     q.Explanation,
+			PoolID:          poolIDs[strings.TrimSpace(q.Pool)],
+			SectionID:       sectionIDs[strings.TrimSpace(q.Section)],
+			QuestionOrder:   i + 1,
+			Points:          normalizePoints(q.Points),
 		}
 
 		if q.ImageURL != "" {
 			question.ImageURL = &q.ImageURL
 		}
+		if q.ExplanationImageURL != "" {
+			question.ExplanationImageURL = &q.ExplanationImageURL
+		}
 
 		if err := repo.CreateQuestion(ctx, question); err != nil {
 			return nil, err
 		}
 
-		for j, optText := range q.Options {
+		for _, accepted := range q.ResolvedAcceptedAnswers() {
+			accepted.QuestionID = question.ID
+			if err := repo.CreateAcceptedAnswer(ctx, &accepted); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, hint := range q.ResolvedHints() {
+			hint.QuestionID = question.ID
+			if err := repo.CreateHint(ctx, &hint); err != nil {
+				return nil, err
+			}
+		}
+
+		for j, optText := range q.ResolvedOptions() {
 			option := &models.AnswerOption{
 				QuestionID:  question.ID,
 				OptionText:  optText,
-				IsCorrect:   j == q.CorrectIndex,
+				IsCorrect:   q.IsCorrectOption(j),
+				MatchText:   q.MatchTextFor(j),
+				Rationale:   q.RationaleFor(j),
 				OptionOrder: j + 1,
 			}
 
@@ -131,6 +397,107 @@ func persistTestUpload(ctx context.Context, repo *repository.TestRepository, upl
 	return test, nil
 }
 
+// savePools stores the pool changes parsePoolsForm made to an edited test,
+// creating its new pool and pointing the questions chosen for it at it
+func savePools(ctx context.Context, repo *repository.TestRepository, test *models.Test, removed []int) error {
+	for _, id := range removed {
+		if err := repo.DeletePool(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	for i := range test.Pools {
+		pool := &test.Pools[i]
+		if pool.ID != 0 {
+			if err := repo.UpdatePool(ctx, pool); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := repo.CreatePool(ctx, pool); err != nil {
+			return err
+		}
+		for j := range test.Questions {
+			if q := &test.Questions[j]; q.PoolID != nil && *q.PoolID == 0 {
+				q.PoolID = &pool.ID
+			}
+		}
+	}
+	return nil
+}
+
+// saveSections stores the section changes parseSectionsForm made to an edited
+// test, creating its new section and pointing the questions chosen for it at it
+func saveSections(ctx context.Context, repo *repository.TestRepository, test *models.Test, removed []int) error {
+	for _, id := range removed {
+		if err := repo.DeleteSection(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	for i := range test.Sections {
+		section := &test.Sections[i]
+		if section.ID != 0 {
+			if err := repo.UpdateSection(ctx, section); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := repo.CreateSection(ctx, section); err != nil {
+			return err
+		}
+		for j := range test.Questions {
+			if q := &test.Questions[j]; q.SectionID != nil && *q.SectionID == 0 {
+				q.SectionID = &section.ID
+			}
+		}
+	}
+	return nil
+}
+
+// savePrerequisites stores the prerequisite changes parsePrerequisitesForm
+// made to an edited test
+func savePrerequisites(ctx context.Context, repo *repository.TestRepository, test *models.Test, removed []int) error {
+	for _, id := range removed {
+		if err := repo.DeletePrerequisite(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	for i := range test.Prerequisites {
+		if p := &test.Prerequisites[i]; p.ID == 0 {
+			if err := repo.CreatePrerequisite(ctx, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// saveHints stores the hint changes parseHintsForm made to an edited question
+func saveHints(ctx context.Context, repo *repository.TestRepository, q *models.Question, removed []int) error {
+	for _, id := range removed {
+		if err := repo.DeleteHint(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	for i := range q.Hints {
+		hint := &q.Hints[i]
+		if hint.ID != 0 {
+			if err := repo.UpdateHint(ctx, hint); err != nil {
+				return err
+			}
+			continue
+		}
+		hint.QuestionID = q.ID // unset until a question added in the edit is saved
+		if err := repo.CreateHint(ctx, hint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func normalizePoints(points int) int {
 	if points <= 0 {
 		return 1
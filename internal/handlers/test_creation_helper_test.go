@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"my-app/internal/dbtest"
+	"my-app/internal/models"
+	"my-app/internal/repository"
+)
+
+// errRollback ends a test's transaction so nothing it stored is kept
+var errRollback = errors.New("rolled back")
+
+// inTestTx runs fn in a transaction of the test database, as the handlers
+// that import tests run theirs, and rolls it back afterwards. fn is given a
+// teacher to store tests as.
+func inTestTx(t *testing.T, fn func(ctx context.Context, tx *repository.TestRepository, teacherID int) error) {
+	t.Helper()
+	pool := dbtest.Pool(t)
+	teacherID := dbtest.User(t, pool, "teacher")
+	ctx := context.Background()
+	err := repository.NewTestRepository(pool).InTx(ctx, func(tx *repository.TestRepository) error {
+		return fn(ctx, tx, teacherID)
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatal(err)
+	}
+}
+
+// removeUploads removes the images stored for a test when the test ends
+func removeUploads(t *testing.T, testID int) {
+	t.Cleanup(func() { os.RemoveAll(filepath.Join("assets", "uploads", strconv.Itoa(testID))) })
+}
+
+func uploadWithQuestion(q models.QuestionUpload) models.TestUpload {
+	return models.TestUpload{
+		Title:            "History",
+		Description:      "Dates and events",
+		Subject:          "History",
+		ExamStandard:     "GCSE",
+		Difficulty:       "Easy",
+		TimeLimitMinutes: 10,
+		PassingScore:     50,
+		Questions:        []models.QuestionUpload{q},
+	}
+}
+
+func TestValidateTestUpload_OrderingAndMatching(t *testing.T) {
+	ordering := models.QuestionUpload{
+		QuestionText: "Put these in chronological order",
+		QuestionType: models.QuestionTypeOrdering,
+		Options:      []string{"Battle of Hastings", "Magna Carta", "Black Death"},
+		Points:       3,
+	}
+	if errs := validateTestUpload(uploadWithQuestion(ordering)); len(errs) != 0 {
+		t.Fatalf("expected ordering upload to be valid, got %v", errs)
+	}
+	if ordering.ResolvedScoringRule() != models.ScoringPartial {
+		t.Fatalf("expected ordering questions to default to partial credit")
+	}
+
+	matching := models.QuestionUpload{
+		QuestionText: "Match each organ to its function",
+		Pairs: []models.MatchPair{
+			{Prompt: "Heart", Match: "Pumps blood"},
+			{Prompt: "Lungs", Match: "Exchange gases"},
+		},
+		Points: 2,
+	}
+	if matching.ResolvedType() != models.QuestionTypeMatching {
+		t.Fatalf("expected pairs to imply a matching question, got %s", matching.ResolvedType())
+	}
+	if errs := validateTestUpload(uploadWithQuestion(matching)); len(errs) != 0 {
+		t.Fatalf("expected matching upload to be valid, got %v", errs)
+	}
+
+	matching.Pairs[1].Match = ""
+	if errs := validateTestUpload(uploadWithQuestion(matching)); errs["question_1_options"] == "" {
+		t.Fatalf("expected a missing match to be reported, got %v", errs)
+	}
+}
+
+func TestValidateTestUpload_ScoringPolicy(t *testing.T) {
+	question := models.QuestionUpload{QuestionText: "1066?", Options: []string{"Hastings", "Agincourt"}, Points: 1}
+
+	var upload models.TestUpload
+	if err := json.Unmarshal([]byte(`{"scoring": {"wrong_penalty": 0.25}}`), &upload); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	policy := upload.ResolvedScoring()
+	if policy.WrongPenalty != 0.25 || !policy.FloorAtZero {
+		t.Fatalf("expected a quarter mark penalty with the zero floor kept, got %+v", policy)
+	}
+	if (models.TestUpload{}).ResolvedScoring() != models.DefaultScoringPolicy() {
+		t.Fatalf("expected a missing policy to resolve to the default")
+	}
+
+	valid := uploadWithQuestion(question)
+	valid.Scoring = &policy
+	if errs := validateTestUpload(valid); len(errs) != 0 {
+		t.Fatalf("expected upload with a scoring policy to be valid, got %v", errs)
+	}
+
+	invalid := uploadWithQuestion(question)
+	invalid.Scoring = &models.ScoringPolicy{WrongPenalty: 2, SkippedCredit: -1}
+	errs := validateTestUpload(invalid)
+	if errs["wrong_penalty"] == "" || errs["skipped_credit"] == "" {
+		t.Fatalf("expected out of range penalty and skipped credit to be reported, got %v", errs)
+	}
+}
+
+func TestValidateTestUpload_Pools(t *testing.T) {
+	question := func(pool string) models.QuestionUpload {
+		return models.QuestionUpload{QuestionText: "1066?", Options: []string{"Hastings", "Agincourt"}, Points: 1, Pool: pool}
+	}
+
+	upload := uploadWithQuestion(question("Easy"))
+	upload.Questions = append(upload.Questions, question("Easy"), question(""))
+	upload.Pools = []models.PoolUpload{{Name: "Easy", Draw: 1}}
+	if errs := validateTestUpload(upload); len(errs) != 0 {
+		t.Fatalf("expected upload with a pool to be valid, got %v", errs)
+	}
+
+	upload.Pools[0].Draw = 3
+	if errs := validateTestUpload(upload); errs["pool_1_draw"] == "" {
+		t.Fatalf("expected drawing more questions than the pool holds to be reported, got %v", errs)
+	}
+
+	upload.Pools = []models.PoolUpload{{Name: "Easy", Draw: 1}, {Name: "Easy", Draw: 1}}
+	upload.Questions[2].Pool = "Hard"
+	errs := validateTestUpload(upload)
+	if errs["pool_2_name"] == "" || errs["question_3_pool"] == "" {
+		t.Fatalf("expected a duplicate pool and an undeclared pool to be reported, got %v", errs)
+	}
+}
+
+func TestValidateTestUpload_AttemptPolicy(t *testing.T) {
+	question := models.QuestionUpload{QuestionText: "1066?", Options: []string{"Hastings", "Agincourt"}, Points: 1}
+
+	var upload models.TestUpload
+	if err := json.Unmarshal([]byte(`{"attempts": {"max_attempts": 3}}`), &upload); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	policy := upload.ResolvedAttempts()
+	if policy.MaxAttempts != 3 || policy.Counts != models.CountBestAttempt {
+		t.Fatalf("expected three attempts with the best counting, got %+v", policy)
+	}
+	if (models.TestUpload{}).ResolvedAttempts() != models.DefaultAttemptPolicy() {
+		t.Fatalf("expected a missing policy to resolve to the default")
+	}
+
+	invalid := uploadWithQuestion(question)
+	invalid.Attempts = &models.AttemptPolicy{MaxAttempts: -1, CooldownMinutes: -5, Counts: "worst"}
+	errs := validateTestUpload(invalid)
+	if errs["max_attempts"] == "" || errs["cooldown_minutes"] == "" || errs["counted_attempt"] == "" {
+		t.Fatalf("expected negative limits and an unknown counted attempt to be reported, got %v", errs)
+	}
+}
+
+func TestValidateTestUpload_AvailabilityWindow(t *testing.T) {
+	question := models.QuestionUpload{QuestionText: "1066?", Options: []string{"Hastings", "Agincourt"}, Points: 1}
+
+	upload := uploadWithQuestion(question)
+	upload.AvailableFrom, upload.AvailableUntil, upload.Timezone = "2025-06-02T09:00", "2025-06-02 11:00", "Europe/London"
+	upload.LateSubmission = models.LateSubmissionCutOff
+	if errs := validateTestUpload(upload); len(errs) != 0 {
+		t.Fatalf("expected a valid window, got %v", errs)
+	}
+	from, until, _ := uploadWindow(upload)
+	if from.Hour() != 9 || until.Sub(*from) != 2*time.Hour || from.Location().String() != "Europe/London" {
+		t.Fatalf("expected the window read in London time, got %v to %v", from, until)
+	}
+
+	backwards := uploadWithQuestion(question)
+	backwards.AvailableFrom, backwards.AvailableUntil = "2025-06-02T11:00", "2025-06-02T09:00"
+	if errs := validateTestUpload(backwards); errs["available_until"] == "" {
+		t.Fatalf("expected a window that closes before it opens to be reported, got %v", errs)
+	}
+
+	invalid := uploadWithQuestion(question)
+	invalid.AvailableFrom, invalid.Timezone, invalid.LateSubmission = "next Tuesday", "Mars/Olympus", "never"
+	if errs := validateTestUpload(invalid); errs["timezone"] == "" || errs["late_submission"] == "" {
+		t.Fatalf("expected an unknown timezone and late submission policy to be reported, got %v", errs)
+	}
+	invalid.Timezone = ""
+	if errs := validateTestUpload(invalid); errs["available_from"] == "" {
+		t.Fatalf("expected an unparseable time to be reported, got %v", errs)
+	}
+}
+
+func TestValidateTestUpload_ExplanationAndRationales(t *testing.T) {
+	var question models.QuestionUpload
+	err := json.Unmarshal([]byte(`{
+		"question_text": "When was the Battle of Hastings?",
+		"options": ["1066", "1166"],
+		"correct_index": 0,
+		"points": 1,
+		"explanation": "William of Normandy won in **1066**.",
+		"explanation_image_url": "/static/uploads/hastings.png",
+		"rationales": ["", "Confused with the century after"]
+	}`), &question)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if question.RationaleFor(1) != "Confused with the century after" || question.RationaleFor(2) != "" {
+		t.Fatalf("expected rationales to line up with options, got %q", question.Rationales)
+	}
+	if errs := validateTestUpload(uploadWithQuestion(question)); len(errs) != 0 {
+		t.Fatalf("expected upload with an explanation and rationales to be valid, got %v", errs)
+	}
+
+	question.Rationales = append(question.Rationales, "no such option")
+	if errs := validateTestUpload(uploadWithQuestion(question)); errs["question_1_rationales"] == "" {
+		t.Fatalf("expected more rationales than options to be reported, got %v", errs)
+	}
+}
+
+func TestValidateTestUpload_Hints(t *testing.T) {
+	var upload models.TestUpload
+	err := json.Unmarshal([]byte(`{
+		"scoring": {"hint_penalty": 0.25},
+		"questions": [{
+			"question_text": "When was the Battle of Hastings?",
+			"options": ["1066", "1166"],
+			"points": 2,
+			"hints": ["It was in the 11th century", {"text": "William the Conqueror won it", "penalty": 0.5}]
+		}]
+	}`), &upload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if upload.ResolvedScoring().HintPenalty != 0.25 {
+		t.Fatalf("expected the test's hint penalty to be read, got %+v", upload.ResolvedScoring())
+	}
+
+	hints := upload.Questions[0].ResolvedHints()
+	if len(hints) != 2 || hints[0].HintOrder != 1 || hints[0].Penalty != nil || *hints[1].Penalty != 0.5 {
+		t.Fatalf("expected a plain hint then one with its own penalty, got %+v", hints)
+	}
+
+	valid := uploadWithQuestion(upload.Questions[0])
+	if errs := validateTestUpload(valid); len(errs) != 0 {
+		t.Fatalf("expected upload with hints to be valid, got %v", errs)
+	}
+
+	tooDear := 1.5
+	invalid := uploadWithQuestion(models.QuestionUpload{
+		QuestionText: "1066?", Options: []string{"Hastings", "Agincourt"}, Points: 1,
+		Hints: []models.HintUpload{{Text: " "}, {Text: "Norman", Penalty: &tooDear}},
+	})
+	invalid.Scoring = &models.ScoringPolicy{HintPenalty: -1}
+	errs := validateTestUpload(invalid)
+	if errs["question_1_hints"] == "" || errs["hint_penalty"] == "" {
+		t.Fatalf("expected a blank hint, a penalty over 1 and a negative test penalty to be reported, got %v", errs)
+	}
+}
+
+func TestValidateTestUpload_Sections(t *testing.T) {
+	question := func(section string) models.QuestionUpload {
+		return models.QuestionUpload{QuestionText: "1066?", Options: []string{"Hastings", "Agincourt"}, Points: 1, Section: section}
+	}
+
+	upload := uploadWithQuestion(question(""))
+	upload.Questions = append(upload.Questions, question("Part B"))
+	upload.Sections = []models.SectionUpload{{Title: "Part A", TimeLimitMinutes: 5, NoReturn: true}, {Title: "Part B"}}
+	if errs := validateTestUpload(upload); len(errs) != 0 {
+		t.Fatalf("expected upload with sections to be valid, got %v", errs)
+	}
+
+	upload.Sections = []models.SectionUpload{{Title: "Part A", TimeLimitMinutes: 15}, {Title: "Part A"}, {Title: " "}}
+	errs := validateTestUpload(upload)
+	for _, field := range []string{"section_1_time", "section_2_title", "section_3_title", "question_2_section"} {
+		if errs[field] == "" {
+			t.Fatalf("expected %s to be reported, got %v", field, errs)
+		}
+	}
+}
+
+func TestPersistTestUploadInTx(t *testing.T) {
+	upload := uploadWithQuestion(models.QuestionUpload{
+		QuestionText: "When was the Battle of Hastings?",
+		ImageURL:     "data:image/png;base64,cG5n",
+		Options:      []string{"1066", "1215"},
+		Points:       1,
+		Hints:        []models.HintUpload{{Text: "Norman conquest"}},
+	})
+	upload.Topic = "Medieval"
+	upload.Questions = append(upload.Questions, models.QuestionUpload{
+		QuestionText:    "Who won it?",
+		QuestionType:    models.QuestionTypeShortAnswer,
+		AcceptedAnswers: []string{"William"},
+		Points:          1,
+	})
+
+	inTestTx(t, func(ctx context.Context, tx *repository.TestRepository, teacherID int) error {
+		test, err := persistTestUpload(ctx, tx, upload, teacherID)
+		if err != nil {
+			t.Fatalf("persisting an upload in a transaction: %v", err)
+		}
+		removeUploads(t, test.ID)
+
+		stored, err := tx.GetByID(ctx, test.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stored.Questions) != 2 || len(stored.Questions[0].Options) != 2 || len(stored.Questions[0].Hints) != 1 {
+			t.Fatalf("expected the questions stored with their options and hints, got %+v", stored.Questions)
+		}
+		if url := stored.Questions[0].ImageURL; url == nil || *url != "/assets/uploads/"+strconv.Itoa(test.ID)+"/question_1.png" {
+			t.Errorf("expected the embedded image stored, got %v", url)
+		}
+		if accepted := stored.Questions[1].AcceptedAnswers; len(accepted) != 1 || accepted[0].AnswerText != "William" {
+			t.Errorf("expected the accepted answer stored, got %+v", accepted)
+		}
+		revisions, err := tx.GetRevisions(ctx, test.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revisions) != 1 {
+			t.Errorf("expected the first revision recorded, got %d", len(revisions))
+		}
+		return errRollback
+	})
+}
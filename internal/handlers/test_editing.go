@@ -0,0 +1,466 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"my-app/internal/auth"
+	"my-app/internal/models"
+	"my-app/internal/repository"
+	"my-app/internal/validation"
+)
+
+// testEditRemovals holds the IDs of what an edit removed from a test. What it
+// kept, changed and added is applied to the test itself.
+type testEditRemovals struct {
+	pools         []int
+	sections      []int
+	prerequisites []int
+	questions     []int
+	options       []int
+	hints         []int
+}
+
+// editProblems are the validation errors found in an edit, shown on the edit
+// form beside what they concern
+type editProblems struct {
+	Test      []string         // about the test's own settings, shown above the form
+	Questions map[int][]string // by the question's position in the edit, from 0
+}
+
+func (p editProblems) any() bool {
+	return len(p.Test) > 0 || len(p.Questions) > 0
+}
+
+// parseTestEditForm applies the edit form to the test: its settings, pools,
+// sections, prerequisites and grade boundaries, then its questions. It
+// returns what the edit removed.
+func parseTestEditForm(r *http.Request, test *models.Test) testEditRemovals {
+	test.Title = strings.TrimSpace(r.FormValue("title"))
+	test.Description = r.FormValue("description")
+	test.ExamStandard = r.FormValue("exam_standard")
+	test.Difficulty = r.FormValue("difficulty")
+	test.PassingScore = parseIntOrDefault(r.FormValue("passing_score"), 60)
+	test.TimeLimitMinutes = parseIntOrDefault(r.FormValue("time_limit_minutes"), 10)
+	test.Scoring = parseScoringPolicyForm(r, test.Scoring)
+	test.Attempts = parseAttemptPolicyForm(r, test.Attempts)
+	parseAvailabilityForm(r, test)
+	test.ShuffleQuestions = r.FormValue("shuffle_questions") != ""
+	test.ShuffleOptions = r.FormValue("shuffle_options") != ""
+	test.AllowPractice = r.FormValue("allow_practice") != ""
+
+	var removed testEditRemovals
+	removed.pools = parsePoolsForm(r, test)
+	removed.sections = parseSectionsForm(r, test)
+	removed.prerequisites = parsePrerequisitesForm(r, test)
+	test.GradeBoundaries = parseGradeBoundariesForm(r, test.GradeBoundaries)
+	parseQuestionsForm(r, test, &removed)
+	return removed
+}
+
+// parseQuestionsForm applies the edit form's question changes to the test.
+// Each question's fields are named by a key: its position when the form was
+// drawn, or a higher number for a question added on the page. question_order
+// lists the keys in the questions' new order, and a question left out of it
+// is removed. A form without question_order edits the questions in place.
+// New questions and options have ID 0 until saveQuestions creates them.
+func parseQuestionsForm(r *http.Request, test *models.Test, removed *testEditRemovals) {
+	keys, reordered := r.Form["question_order"]
+	if !reordered {
+		keys = make([]string, len(test.Questions))
+		for i := range test.Questions {
+			keys[i] = strconv.Itoa(i)
+		}
+	}
+
+	current := make(map[int]models.Question, len(test.Questions))
+	for _, q := range test.Questions {
+		current[q.ID] = q
+	}
+
+	kept := make(map[int]bool, len(test.Questions))
+	seenKeys := make(map[int]bool, len(keys))
+	questions := make([]models.Question, 0, len(keys))
+	for _, value := range keys {
+		key, err := strconv.Atoi(value)
+		if err != nil || key < 0 || seenKeys[key] {
+			continue
+		}
+		seenKeys[key] = true
+
+		id := parseIntOrDefault(r.FormValue(fmt.Sprintf("question_%d_id", key)), 0)
+		if !reordered {
+			id = test.Questions[key].ID
+		}
+
+		var q models.Question
+		if id == 0 {
+			q = models.Question{TestID: test.ID, QuestionType: r.FormValue(fmt.Sprintf("question_%d_type", key))}
+			if q.IsTrueFalse() {
+				q.Options = []models.AnswerOption{{OptionText: models.TrueFalseOptions[0]}, {OptionText: models.TrueFalseOptions[1]}}
+			}
+		} else if existing, ok := current[id]; ok && !kept[id] {
+			q = existing
+			kept[id] = true
+		} else {
+			continue // a question deleted since the form was drawn, or listed twice
+		}
+
+		removed.options = append(removed.options, parseQuestionForm(r, key, test, &q)...)
+		removed.hints = append(removed.hints, parseHintsForm(r, key, &q)...)
+		questions = append(questions, q)
+	}
+
+	for _, q := range test.Questions {
+		if !kept[q.ID] {
+			removed.questions = append(removed.questions, q.ID)
+		}
+	}
+	test.Questions = questions
+}
+
+// parseQuestionForm reads the fields of the question with the given key, and
+// the pool and section it is in. It returns the IDs of the options removed.
+func parseQuestionForm(r *http.Request, key int, test *models.Test, q *models.Question) []int {
+	field := func(name string) string {
+		return r.FormValue(fmt.Sprintf("question_%d_%s", key, name))
+	}
+
+	if values, ok := r.Form[fmt.Sprintf("question_%d_text", key)]; ok && len(values) > 0 {
+		q.QuestionText = strings.TrimSpace(values[0])
+	}
+	q.Points = parseIntOrDefault(field("points"), normalizePoints(q.Points))
+	if rule := field("scoring_rule"); rule != "" {
+		q.ScoringRule = rule
+	}
+	q.KeepOptionOrder = field("keep_option_order") != ""
+	if q.IsNumeric() {
+		q.Numeric = parseNumericAnswerForm(r, key, q.Numeric)
+	}
+	if q.IsShortAnswer() {
+		parseShortAnswerForm(r, key, q)
+	}
+	parseExplanationForm(r, key, q)
+
+	if values, ok := r.Form[fmt.Sprintf("question_%d_pool", key)]; ok && len(values) > 0 {
+		q.PoolID = chosenID(values[0])
+		if test.Pool(q.PoolID) == nil {
+			q.PoolID = nil // "new" without a new pool, or a pool just removed
+		}
+	}
+	if values, ok := r.Form[fmt.Sprintf("question_%d_section", key)]; ok && len(values) > 0 {
+		q.SectionID = chosenID(values[0])
+		if test.Section(q.SectionID) == nil {
+			q.SectionID = nil // "new" without a new section, or a section just removed
+		}
+	}
+
+	if q.IsNumeric() || q.IsShortAnswer() {
+		return nil
+	}
+	return parseOptionsForm(r, key, q)
+}
+
+// chosenID reads the pool or section picked in a question's select: blank
+// for none, "new" for the one added in the same edit, which has ID 0 until it
+// is saved, or an ID
+func chosenID(value string) *int {
+	switch value {
+	case "":
+		return nil
+	case "new":
+		newID := 0
+		return &newID
+	}
+	if id, err := strconv.Atoi(value); err == nil {
+		return &id
+	}
+	return nil
+}
+
+// parseOptionsForm reads the options of the question with the given key. Each
+// option's fields are named by a key too, listed in question_N_option; an
+// option left out is removed. Options keep their order, with new ones after
+// them. A form without the list edits the options in place. It returns the IDs
+// of the options removed.
+func parseOptionsForm(r *http.Request, key int, q *models.Question) []int {
+	correct := parseIntSet(r.Form[fmt.Sprintf("question_%d_correct_option", key)])
+
+	// True/false questions keep their two options, keyed by position; only
+	// which is correct and why changes
+	if q.IsTrueFalse() {
+		for i := range q.Options {
+			q.Options[i].IsCorrect = correct[i]
+			q.Options[i].OptionOrder = i + 1
+			parseRationaleForm(r, key, i, &q.Options[i])
+		}
+		return nil
+	}
+
+	prefix := fmt.Sprintf("question_%d_option", key)
+	rows, listed := r.Form[prefix]
+	if !listed {
+		rows = make([]string, len(q.Options))
+		for i := range q.Options {
+			rows[i] = strconv.Itoa(i)
+		}
+	}
+
+	kept := make(map[int]models.AnswerOption, len(q.Options))
+	var added []models.AnswerOption
+	seenRows := make(map[int]bool, len(rows))
+	for _, value := range rows {
+		row, err := strconv.Atoi(value)
+		if err != nil || row < 0 || seenRows[row] {
+			continue
+		}
+		seenRows[row] = true
+
+		name := fmt.Sprintf("%s_%d_", prefix, row)
+		id := parseIntOrDefault(r.FormValue(name+"id"), 0)
+		if !listed {
+			id = q.Options[row].ID
+		}
+
+		var opt models.AnswerOption
+		if id == 0 {
+			opt.QuestionID = q.ID
+		} else if i := slices.IndexFunc(q.Options, func(o models.AnswerOption) bool { return o.ID == id }); i >= 0 {
+			opt = q.Options[i]
+		} else {
+			continue // an option deleted since the form was drawn
+		}
+
+		if text, ok := r.Form[name+"text"]; ok && len(text) > 0 {
+			opt.OptionText = strings.TrimSpace(text[0])
+		}
+		opt.IsCorrect = correct[row]
+		if match, ok := r.Form[name+"match"]; ok && len(match) > 0 && q.IsMatching() {
+			opt.MatchText = strings.TrimSpace(match[0])
+		}
+		parseRationaleForm(r, key, row, &opt)
+
+		if id == 0 {
+			added = append(added, opt)
+		} else {
+			kept[id] = opt
+		}
+	}
+
+	var removed []int
+	options := make([]models.AnswerOption, 0, len(kept)+len(added))
+	for _, opt := range q.Options {
+		if updated, ok := kept[opt.ID]; ok && opt.ID != 0 {
+			options = append(options, updated)
+		} else if opt.ID != 0 {
+			removed = append(removed, opt.ID)
+		}
+	}
+	options = append(options, added...)
+	for i := range options {
+		options[i].OptionOrder = i + 1
+	}
+	q.Options = options
+	return removed
+}
+
+// validateTestEdit checks an edited test before it is saved, returning the
+// problems found with its settings and with each of its questions
+func validateTestEdit(test *models.Test, catalogue []models.Test) editProblems {
+	problems := editProblems{Questions: make(map[int][]string)}
+
+	validator := validation.NewTestValidator()
+	for _, valid := range []func() bool{
+		func() bool { return validator.ValidateTest(test) },
+		func() bool { return validator.ValidatePools(test) },
+		func() bool { return validator.ValidateSections(test) },
+		func() bool { return validator.ValidatePrerequisites(test, catalogue) },
+		func() bool { return validator.ValidateGradeBoundaries(test.GradeBoundaries) },
+	} {
+		if !valid() {
+			for _, err := range validator.GetErrors() {
+				problems.Test = append(problems.Test, err.Message)
+			}
+		}
+	}
+
+	if len(test.Questions) == 0 {
+		problems.Test = append(problems.Test, "A test needs at least one question")
+	}
+	for i := range test.Questions {
+		qValidator := validation.NewTestValidator()
+		if !qValidator.ValidateQuestion(&test.Questions[i]) {
+			for _, err := range qValidator.GetErrors() {
+				problems.Questions[i] = append(problems.Questions[i], err.Message)
+			}
+		}
+	}
+	return problems
+}
+
+// saveTestEdit stores an edit parseTestEditForm applied to the test and
+// records it as a revision by the editor. Run it in a transaction so the edit
+// and its revision are saved whole or not at all.
+func saveTestEdit(ctx context.Context, repo *repository.TestRepository, test *models.Test, removed testEditRemovals, editorID int) error {
+	if err := applyTestEdit(ctx, repo, test, removed); err != nil {
+		return err
+	}
+	if err := recordRevision(ctx, repo, test.ID, editorID); err != nil {
+		return fmt.Errorf("saving test revision: %w", err)
+	}
+	return nil
+}
+
+// applyTestEdit stores the test's settings, pools, sections, prerequisites,
+// grade boundaries and questions as edited, deleting what the edit removed
+func applyTestEdit(ctx context.Context, repo *repository.TestRepository, test *models.Test, removed testEditRemovals) error {
+	if err := repo.Update(ctx, test); err != nil {
+		return fmt.Errorf("updating test: %w", err)
+	}
+	if err := savePools(ctx, repo, test, removed.pools); err != nil {
+		return fmt.Errorf("updating question pools: %w", err)
+	}
+	if err := saveSections(ctx, repo, test, removed.sections); err != nil {
+		return fmt.Errorf("updating sections: %w", err)
+	}
+	if err := savePrerequisites(ctx, repo, test, removed.prerequisites); err != nil {
+		return fmt.Errorf("updating prerequisites: %w", err)
+	}
+	if err := repo.ReplaceTestGradeBoundaries(ctx, test.ID, test.GradeBoundaries); err != nil {
+		return fmt.Errorf("updating grade boundaries: %w", err)
+	}
+	if err := saveQuestions(ctx, repo, test, removed); err != nil {
+		return fmt.Errorf("updating questions: %w", err)
+	}
+	return nil
+}
+
+// saveQuestions stores the question changes parseQuestionsForm made to an
+// edited test: it deletes the removed questions, options and hints, numbers
+// the questions in their new order and creates or updates each one with its
+// options, accepted answers and hints
+func saveQuestions(ctx context.Context, repo *repository.TestRepository, test *models.Test, removed testEditRemovals) error {
+	for _, id := range removed.questions {
+		if err := repo.DeleteQuestion(ctx, id); err != nil {
+			return err
+		}
+	}
+	for _, id := range removed.options {
+		if err := repo.DeleteAnswerOption(ctx, id); err != nil {
+			return err
+		}
+	}
+	for _, id := range removed.hints {
+		if err := repo.DeleteHint(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	// Positions are unique within a test, so move every question out of the
+	// way before numbering them afresh
+	if err := repo.MoveQuestionsAside(ctx, test.ID); err != nil {
+		return err
+	}
+
+	for i := range test.Questions {
+		q := &test.Questions[i]
+		q.QuestionOrder = i + 1
+		if q.ID == 0 {
+			q.TestID = test.ID
+			if err := repo.CreateQuestion(ctx, q); err != nil {
+				return err
+			}
+		} else if err := repo.UpdateQuestion(ctx, q); err != nil {
+			return err
+		}
+
+		// Kept options only ever move towards the front, so each moves into a
+		// position no other option still holds
+		for j := range q.Options {
+			opt := &q.Options[j]
+			opt.QuestionID = q.ID
+			if opt.ID == 0 {
+				if err := repo.CreateAnswerOption(ctx, opt); err != nil {
+					return err
+				}
+			} else if err := repo.UpdateAnswerOption(ctx, opt); err != nil {
+				return err
+			}
+		}
+
+		if q.IsShortAnswer() && len(q.AcceptedAnswers) > 0 {
+			if err := repo.ReplaceAcceptedAnswers(ctx, q.ID, q.AcceptedAnswers); err != nil {
+				return err
+			}
+		}
+
+		if err := saveHints(ctx, repo, q, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderEditTest draws the edit form for the test. With problems, the form
+// shows the edit that was rejected, with each problem beside what it concerns.
+func renderEditTest(w http.ResponseWriter, r *http.Request, repo *repository.TestRepository, test *models.Test, problems *editProblems) {
+	session := auth.GetSessionData(r)
+
+	subjects, err := repo.GetSubjects(r.Context())
+	if err != nil {
+		subjects = []models.Subject{}
+	}
+
+	// Other tests and topics a prerequisite can name
+	catalogue, err := repo.GetAll(r.Context())
+	if err != nil {
+		log.Printf("Error fetching tests: %v", err)
+		catalogue = []models.Test{}
+	}
+	topics, err := repo.GetTopics(r.Context())
+	if err != nil {
+		log.Printf("Error fetching topics: %v", err)
+		topics = []models.Topic{}
+	}
+
+	// The standard's boundaries, which apply unless the test overrides them
+	standardBoundaries, err := repo.GetStandardGradeBoundaries(r.Context())
+	if err != nil {
+		log.Printf("Error fetching grade boundaries: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"Session":            session,
+		"Test":               test,
+		"Subjects":           subjects,
+		"Catalogue":          catalogue,
+		"Topics":             topics,
+		"StandardBoundaries": standardBoundaries[test.ExamStandard],
+		"GradeRows":          gradeBoundaryRows(test.GradeBoundaries),
+		"MaxOptions":         models.MaxOptions,
+		"Problems":           problems,
+	}
+
+	tmpl, err := template.New("").Funcs(template.FuncMap{
+		"add": func(a, b int) int { return a + b },
+	}).ParseFiles("views/layout.html", "views/edit_test.html")
+	if err != nil {
+		log.Printf("Error parsing templates: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if problems != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	if err := tmpl.ExecuteTemplate(w, "layout.html", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"my-app/internal/models"
+	"my-app/internal/repository"
+)
+
+func editedTest() *models.Test {
+	return &models.Test{ID: 1, Questions: []models.Question{
+		{ID: 10, TestID: 1, QuestionType: models.QuestionTypeSingleChoice, QuestionText: "First", Points: 1, QuestionOrder: 1,
+			Options: []models.AnswerOption{{ID: 100, OptionText: "a", IsCorrect: true, OptionOrder: 1}, {ID: 101, OptionText: "b", OptionOrder: 2}}},
+		{ID: 20, TestID: 1, QuestionType: models.QuestionTypeSingleChoice, QuestionText: "Second", Points: 1, QuestionOrder: 2,
+			Options: []models.AnswerOption{{ID: 200, OptionText: "c", OptionOrder: 1}, {ID: 201, OptionText: "d", IsCorrect: true, OptionOrder: 2}}},
+		{ID: 30, TestID: 1, QuestionType: models.QuestionTypeSingleChoice, QuestionText: "Third", Points: 1, QuestionOrder: 3,
+			Options: []models.AnswerOption{{ID: 300, OptionText: "e", IsCorrect: true, OptionOrder: 1}, {ID: 301, OptionText: "f", OptionOrder: 2}}},
+	}}
+}
+
+func TestParseQuestionsFormReorders(t *testing.T) {
+	test := editedTest()
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Form = url.Values{
+		// The third question moved to the top, the first deleted, and a new
+		// true/false question inserted between the other two
+		"question_order":            {"2", "3", "1"},
+		"question_0_id":             {"10"},
+		"question_1_id":             {"20"},
+		"question_2_id":             {"30"},
+		"question_2_text":           {"  Third, now first "},
+		"question_3_id":             {"0"},
+		"question_3_type":           {models.QuestionTypeTrueFalse},
+		"question_3_text":           {"Is the sky blue?"},
+		"question_3_points":         {"2"},
+		"question_3_correct_option": {"0"},
+	}
+
+	var removed testEditRemovals
+	parseQuestionsForm(r, test, &removed)
+
+	if got := questionIDs(test.Questions); !slices.Equal(got, []int{30, 0, 20}) {
+		t.Fatalf("expected questions 30, new, 20, got %v", got)
+	}
+	if test.Questions[0].QuestionText != "Third, now first" {
+		t.Errorf("expected the moved question's text trimmed, got %q", test.Questions[0].QuestionText)
+	}
+	added := test.Questions[1]
+	if added.TestID != 1 || added.Points != 2 || len(added.Options) != 2 || !added.Options[0].IsCorrect || added.Options[1].IsCorrect {
+		t.Errorf("expected a new true/false question with True correct, got %+v", added)
+	}
+	if added.Options[0].OptionText != models.TrueFalseOptions[0] || added.Options[1].OptionOrder != 2 {
+		t.Errorf("expected the true/false options seeded in order, got %+v", added.Options)
+	}
+	if !slices.Equal(removed.questions, []int{10}) {
+		t.Errorf("expected question 10 removed, got %v", removed.questions)
+	}
+}
+
+func TestParseQuestionsFormInPlace(t *testing.T) {
+	test := editedTest()
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Form = url.Values{
+		"question_1_text":           {"Second, reworded"},
+		"question_1_correct_option": {"0"},
+	}
+
+	var removed testEditRemovals
+	parseQuestionsForm(r, test, &removed)
+
+	if got := questionIDs(test.Questions); !slices.Equal(got, []int{10, 20, 30}) {
+		t.Fatalf("expected the questions kept in place without question_order, got %v", got)
+	}
+	q := test.Questions[1]
+	if q.QuestionText != "Second, reworded" || !q.Options[0].IsCorrect || q.Options[1].IsCorrect {
+		t.Errorf("expected the second question edited in place, got %+v", q)
+	}
+	if len(removed.questions) != 0 || len(removed.options) != 0 {
+		t.Errorf("expected nothing removed, got %+v", removed)
+	}
+}
+
+func TestParseOptionsForm(t *testing.T) {
+	q := editedTest().Questions[0]
+	q.Options = append(q.Options, models.AnswerOption{ID: 102, OptionText: "c", OptionOrder: 3})
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Form = url.Values{
+		// Option 101 removed, a new option added, and the rows listed out of
+		// their original order
+		"question_0_option":         {"4", "2", "0"},
+		"question_0_option_0_id":    {"100"},
+		"question_0_option_0_text":  {"a"},
+		"question_0_option_2_id":    {"102"},
+		"question_0_option_2_text":  {"c"},
+		"question_0_option_4_id":    {"0"},
+		"question_0_option_4_text":  {" d "},
+		"question_0_correct_option": {"4"},
+	}
+
+	removed := parseOptionsForm(r, 0, &q)
+
+	if !slices.Equal(removed, []int{101}) {
+		t.Fatalf("expected option 101 removed, got %v", removed)
+	}
+	if len(q.Options) != 3 {
+		t.Fatalf("expected three options, got %+v", q.Options)
+	}
+	for i, want := range []struct {
+		id      int
+		text    string
+		correct bool
+	}{{100, "a", false}, {102, "c", false}, {0, "d", true}} {
+		opt := q.Options[i]
+		if opt.ID != want.id || opt.OptionText != want.text || opt.IsCorrect != want.correct || opt.OptionOrder != i+1 {
+			t.Errorf("option %d: expected %+v at position %d, got %+v", i, want, i+1, opt)
+		}
+	}
+}
+
+func TestValidateTestEdit(t *testing.T) {
+	test := editedTest()
+	test.Questions[1].QuestionText = ""
+
+	problems := validateTestEdit(test, nil)
+	if !problems.any() || len(problems.Questions[1]) == 0 {
+		t.Fatalf("expected a problem with the second question, got %+v", problems)
+	}
+	if len(problems.Questions[0]) != 0 || len(problems.Questions[2]) != 0 {
+		t.Errorf("expected only the second question to have problems, got %+v", problems.Questions)
+	}
+
+	test.Questions = nil
+	if problems := validateTestEdit(test, nil); !slices.Contains(problems.Test, "A test needs at least one question") {
+		t.Errorf("expected a test without questions rejected, got %+v", problems)
+	}
+}
+
+func TestSaveTestEditRecordsRevisionInTx(t *testing.T) {
+	upload := uploadWithQuestion(models.QuestionUpload{
+		QuestionText: "When was the Battle of Hastings?", Options: []string{"1066", "1215"}, Points: 1,
+	})
+
+	inTestTx(t, func(ctx context.Context, tx *repository.TestRepository, teacherID int) error {
+		created, err := persistTestUpload(ctx, tx, upload, teacherID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test, err := tx.GetByID(ctx, created.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.Title = "Norman conquest"
+		if err := saveTestEdit(ctx, tx, test, testEditRemovals{}, teacherID); err != nil {
+			t.Fatalf("saving an edit in a transaction: %v", err)
+		}
+
+		revisions, err := tx.GetRevisions(ctx, test.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revisions) != 2 || revisions[0].CreatedBy == nil || *revisions[0].CreatedBy != teacherID {
+			t.Fatalf("expected the edit recorded as a revision by its editor, got %+v", revisions)
+		}
+		revision, err := tx.GetRevision(ctx, revisions[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revision.Title != "Norman conquest" {
+			t.Errorf("expected the revision to hold the edit, got title %q", revision.Title)
+		}
+		return errRollback
+	})
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"log"
+	"math/rand/v2"
 	"net/http"
 	"strconv"
 	"strings"
@@ -12,6 +15,8 @@ import (
 	"my-app/internal/auth"
 	"my-app/internal/models"
 	"my-app/internal/repository"
+	"my-app/internal/richtext"
+	"my-app/internal/scoring"
 )
 
 // TestHandler handles test-related requests
@@ -27,6 +32,7 @@ type testFilters struct {
 	Difficulty string
 	Standard   string
 	Published  *bool
+	OpenAt     *time.Time // only tests whose availability window has opened by then
 }
 
 // historyFilters captures query filters for attempt history.
@@ -54,6 +60,12 @@ func NewTestHandler(testRepo *repository.TestRepository, attemptRepo *repository
 func (h *TestHandler) ListTests(w http.ResponseWriter, r *http.Request) {
 	session := auth.GetSessionData(r)
 	filters := parseTestFilters(r)
+	if session.Role == "student" {
+		published := true
+		filters.Published = &published
+		now := time.Now()
+		filters.OpenAt = &now
+	}
 
 	tests, err := h.testRepo.GetAll(r.Context())
 	if err != nil {
@@ -70,11 +82,23 @@ func (h *TestHandler) ListTests(w http.ResponseWriter, r *http.Request) {
 		subjects = []models.Subject{}
 	}
 
+	// Students see where they stand on each test
+	progress := map[int]*testProgress{}
+	if session.Role == "student" {
+		attempts, err := h.attemptRepo.GetByUser(r.Context(), session.UserID)
+		if err != nil {
+			log.Printf("Error fetching attempts: %v", err)
+			attempts = []models.TestAttempt{}
+		}
+		progress = studentProgress(filteredTests, tests, attempts, time.Now())
+	}
+
 	data := map[string]interface{}{
 		"Session":  session,
 		"Tests":    filteredTests,
 		"Filters":  filters,
 		"Subjects": subjects,
+		"Progress": progress,
 	}
 
 	tmpl, err := template.New("").Funcs(template.FuncMap{
@@ -107,12 +131,7 @@ func (h *TestHandler) ListTests(w http.ResponseWriter, r *http.Request) {
 func (h *TestHandler) History(w http.ResponseWriter, r *http.Request) {
 	session := auth.GetSessionData(r)
 
-	filters := parseHistoryFilters(r)
-	if session.Role == "student" {
-		filters.UserID = &session.UserID
-	}
-	filters.AttemptSearchFilter.UserID = filters.UserID
-
+	filters := historyFiltersFor(r, session)
 	attempts, err := h.attemptRepo.SearchAttempts(r.Context(), filters.AttemptSearchFilter)
 	if err != nil {
 		log.Printf("Error fetching attempt history: %v", err)
@@ -164,9 +183,14 @@ func parseTestFilters(r *http.Request) testFilters {
 		filters.Standard = std
 	}
 
+	// Only published tests are listed unless another choice is made
+	published := true
+	filters.Published = &published
 	if pub := query.Get("published"); pub != "" {
 		val := strings.ToLower(pub)
 		switch val {
+		case "all":
+			filters.Published = nil
 		case "true", "1", "published":
 			v := true
 			filters.Published = &v
@@ -179,6 +203,16 @@ func parseTestFilters(r *http.Request) testFilters {
 	return filters
 }
 
+// historyFiltersFor parses the history filters, limiting students to their own attempts
+func historyFiltersFor(r *http.Request, session *auth.SessionData) historyFilters {
+	filters := parseHistoryFilters(r)
+	if session.Role == "student" {
+		filters.UserID = &session.UserID
+	}
+	filters.AttemptSearchFilter.UserID = filters.UserID
+	return filters
+}
+
 // parseHistoryFilters converts query params into a repository filter and carries display values.
 func parseHistoryFilters(r *http.Request) historyFilters {
 	query := r.URL.Query()
@@ -246,13 +280,19 @@ func filterTests(tests []models.Test, filters testFilters) []models.Test {
 			continue
 		}
 
+		if filters.OpenAt != nil && t.NotYetOpen(*filters.OpenAt) {
+			continue
+		}
+
 		filtered = append(filtered, t)
 	}
 
 	return filtered
 }
 
-// StartTest creates a new test attempt and displays the first question
+// StartTest resumes the student's attempt in progress, or creates a new one
+// when the test's attempt policy allows it. With mode=practice it does the same
+// for an untimed practice attempt.
 func (h *TestHandler) StartTest(w http.ResponseWriter, r *http.Request) {
 	session := auth.GetSessionData(r)
 	testIDStr := r.URL.Query().Get("id")
@@ -261,24 +301,86 @@ func (h *TestHandler) StartTest(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid test ID", http.StatusBadRequest)
 		return
 	}
+	practice := r.URL.Query().Get("mode") == "practice"
 
-	// Get test details (just to validate it exists)
-	_, err = h.testRepo.GetByID(r.Context(), testID)
+	// Get test details
+	test, err := h.testRepo.GetByID(r.Context(), testID)
 	if err != nil {
 		log.Printf("Error fetching test: %v", err)
 		http.Error(w, "Test not found", http.StatusNotFound)
 		return
 	}
 
-	// Create new attempt
+	// Resume an unfinished attempt rather than opening a second one
+	now := time.Now()
+	attempts, err := h.userAttemptsAt(r.Context(), session.UserID, testID, now)
+	if err != nil {
+		log.Printf("Error fetching attempts: %v", err)
+		http.Error(w, "Failed to start test", http.StatusInternalServerError)
+		return
+	}
+	gate := checkAttemptPolicy(test, attempts, session.Role, now, practice)
+	if gate.Resume != nil {
+		http.Redirect(w, r, "/test/take?attempt_id="+strconv.Itoa(gate.Resume.ID), http.StatusSeeOther)
+		return
+	}
+	if gate.Blocked != "" {
+		http.Error(w, gate.Blocked, http.StatusForbidden)
+		return
+	}
+	if session.Role == "student" && len(test.Prerequisites) > 0 {
+		locked, err := h.unmetPrerequisites(r.Context(), test, session.UserID)
+		if err != nil {
+			log.Printf("Error checking prerequisites: %v", err)
+			http.Error(w, "Failed to start test", http.StatusInternalServerError)
+			return
+		}
+		if len(locked) > 0 {
+			http.Error(w, "This test is locked until you: "+strings.Join(locked, "; "), http.StatusForbidden)
+			return
+		}
+	}
+
+	// Take the attempt against a revision of the test's current content, so
+	// that editing the test later leaves what this attempt was asked alone
+	revisionID, err := h.testRepo.SaveRevision(r.Context(), test, nil)
+	if err != nil {
+		log.Printf("Error saving test revision: %v", err)
+		http.Error(w, "Failed to start test", http.StatusInternalServerError)
+		return
+	}
+
+	// Create new attempt, fixing its deadline and the order its questions and
+	// options are shown in. The deadline is the end of the time limit, or the
+	// window closing when the test cuts late attempts off. Practice attempts
+	// are untimed.
+	startedAt := now
 	attempt := &models.TestAttempt{
-		UserID:    session.UserID,
-		TestID:    testID,
-		StartedAt: time.Now(),
-		Status:    "in_progress",
+		UserID:      session.UserID,
+		TestID:      testID,
+		StartedAt:   startedAt,
+		Status:      "in_progress",
+		ShuffleSeed: rand.Int64(),
+		Practice:    practice,
+		RevisionID:  &revisionID,
+	}
+	if !practice {
+		deadline := test.AttemptDeadline(startedAt)
+		attempt.Deadline = &deadline
 	}
+	layoutAttempt(test, attempt)
 
 	if err := h.attemptRepo.Create(r.Context(), attempt); err != nil {
+		// Only one attempt per test and mode may be in progress, so a second
+		// click that raced this one has already created it
+		if existing, _ := h.attemptRepo.GetByUserAndTest(r.Context(), session.UserID, testID); len(existing) > 0 {
+			for _, a := range existing {
+				if a.Status == "in_progress" && a.Practice == practice {
+					http.Redirect(w, r, "/test/take?attempt_id="+strconv.Itoa(a.ID), http.StatusSeeOther)
+					return
+				}
+			}
+		}
 		log.Printf("Error creating attempt: %v", err)
 		http.Error(w, "Failed to start test", http.StatusInternalServerError)
 		return
@@ -312,19 +414,64 @@ func (h *TestHandler) TakeTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if already completed
-	if attempt.Status == "completed" {
+	// Attempts that are over, including ones whose time ran out while the
+	// student was away, go straight to the results
+	if attempt.Status == "in_progress" && attempt.TimeUp(time.Now()) {
+		if err := h.closeExpiredAttempt(r.Context(), attempt, time.Now()); err != nil {
+			log.Printf("Error closing expired attempt %d: %v", attemptID, err)
+			http.Error(w, "Failed to submit test", http.StatusInternalServerError)
+			return
+		}
+	}
+	if attempt.Status != "in_progress" {
 		http.Redirect(w, r, "/test/results?attempt_id="+attemptIDStr, http.StatusSeeOther)
 		return
 	}
 
 	// Get test with questions
-	test, err := h.testRepo.GetByID(r.Context(), attempt.TestID)
+	test, err := h.testRepo.GetForAttempt(r.Context(), attempt)
 	if err != nil {
 		log.Printf("Error fetching test: %v", err)
 		http.Error(w, "Test not found", http.StatusNotFound)
 		return
 	}
+	arrangeForAttempt(test, attempt)
+	numbers := questionNumbers(test.Questions)
+
+	// Tests in sections are shown a section at a time, moving on once the
+	// section's time runs out; the attempt is over when every section has closed
+	now := time.Now()
+	section, changed := currentSection(test, attempt, now)
+	if changed {
+		if err := h.attemptRepo.UpdateSectionState(r.Context(), attempt); err != nil {
+			log.Printf("Error saving section of attempt %d: %v", attemptID, err)
+			http.Error(w, "Failed to load test", http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(test.Sections) > 0 && section == nil {
+		if err := h.closeExpiredAttempt(r.Context(), attempt, now); err != nil {
+			log.Printf("Error closing attempt %d: %v", attemptID, err)
+			http.Error(w, "Failed to submit test", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/test/results?attempt_id="+attemptIDStr, http.StatusSeeOther)
+		return
+	}
+	sectionClosed := make(map[int]bool) // section ID -> no longer open
+	var nextSection *models.Section
+	if section != nil {
+		test.Questions = test.SectionQuestions(section.ID)
+		passed := false
+		for i := range test.Sections {
+			s := &test.Sections[i]
+			sectionClosed[s.ID] = !attempt.SectionOpen(s, now)
+			if nextSection == nil && passed && !sectionClosed[s.ID] {
+				nextSection = s
+			}
+			passed = passed || s.ID == section.ID
+		}
+	}
 
 	// Get existing answers
 	answers, err := h.attemptRepo.GetAnswersByAttemptID(r.Context(), attemptID)
@@ -333,26 +480,88 @@ func (h *TestHandler) TakeTest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create map of answered questions
-	answeredMap := make(map[int]int) // questionID -> selectedOptionID
-	for _, answer := range answers {
-		if answer.SelectedOptionID != nil {
-			answeredMap[answer.QuestionID] = *answer.SelectedOptionID
+	answeredMap := make(map[int]*models.StudentAnswer) // questionID -> answer
+	for i := range answers {
+		answeredMap[answers[i].QuestionID] = &answers[i]
+	}
+
+	reveals, err := h.attemptRepo.GetHintReveals(r.Context(), attemptID)
+	if err != nil {
+		log.Printf("Error fetching hints: %v", err)
+	}
+	hints := hintStates(test, reveals)
+
+	// Practice attempts show the feedback on questions already answered, which
+	// stay locked
+	feedback := make(map[int]*answerFeedback) // questionID -> feedback
+	if attempt.Practice {
+		for i := range test.Questions {
+			if answer := answeredMap[test.Questions[i].ID]; answer != nil {
+				fb := practiceFeedback(&test.Questions[i], answer)
+				feedback[test.Questions[i].ID] = &fb
+			}
 		}
 	}
 
 	// Hide correct answers from students (they shouldn't see this during the test)
+	matchChoices := make(map[int][]string) // questionID -> choices for matching questions
 	for i := range test.Questions {
-		for j := range test.Questions[i].Options {
-			test.Questions[i].Options[j].IsCorrect = false
+		q := &test.Questions[i]
+		if q.IsMatching() {
+			matchChoices[q.ID] = q.MatchChoices()
+		}
+		if q.IsOrdering() {
+			// Show the student's own order once they have moved anything, and number
+			// options by position so the numbers do not give the answer away
+			if ordered := answeredMap[q.ID].OrderedOptions(q); len(ordered) == len(q.Options) {
+				q.Options = ordered
+			}
+			for j := range q.Options {
+				q.Options[j].OptionOrder = j + 1
+			}
+		}
+		for j := range q.Options {
+			q.Options[j].IsCorrect = false
+			q.Options[j].MatchText = ""
+		}
+		// Typed-answer questions keep only the answer format hints
+		if n := q.Numeric; n != nil {
+			q.Numeric = &models.NumericAnswer{SigFigs: n.SigFigs, Units: n.Units}
+		}
+		q.AcceptedAnswers = nil
+		q.Hints = nil // only the revealed ones are shown, from hints
+	}
+
+	// The JS timer counts down what is left of the attempt, so reloading the
+	// page does not restart the clock. A section running out first moves the
+	// student on rather than ending the attempt.
+	timeLeft := test.TimeLimitMinutes * 60
+	if attempt.Deadline != nil {
+		timeLeft = attempt.SecondsLeft(now)
+	}
+	sectionTimed := false
+	if section != nil {
+		if deadline := attempt.SectionDeadline(section); deadline != nil {
+			if left := max(int(deadline.Sub(now).Seconds()), 0); attempt.Deadline == nil || left < timeLeft {
+				timeLeft, sectionTimed = left, true
+			}
 		}
 	}
 
 	data := map[string]interface{}{
-		"Session":   session,
-		"Test":      test,
-		"Attempt":   attempt,
-		"Answered":  answeredMap,
-		"TimeLimit": test.TimeLimitMinutes * 60, // Convert to seconds for JS timer
+		"Session":       session,
+		"Test":          test,
+		"Attempt":       attempt,
+		"Answered":      answeredMap,
+		"MatchChoices":  matchChoices,
+		"Feedback":      feedback,
+		"Hints":         hints,
+		"Numbers":       numbers,
+		"Section":       section,
+		"SectionClosed": sectionClosed,
+		"NextSection":   nextSection,
+		"SectionTimed":  sectionTimed,
+		"TimeLimit":     timeLeft, // seconds, for the JS timer
 	}
 
 	tmpl, err := template.New("").Funcs(template.FuncMap{
@@ -392,9 +601,12 @@ func (h *TestHandler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
 	session := auth.GetSessionData(r)
 
 	var req struct {
-		AttemptID  int `json:"attempt_id"`
-		QuestionID int `json:"question_id"`
-		OptionID   int `json:"option_id"`
+		AttemptID  int            `json:"attempt_id"`
+		QuestionID int            `json:"question_id"`
+		OptionID   int            `json:"option_id"`
+		OptionIDs  []int          `json:"option_ids"`  // multiple_select picks, or ordering in placed order
+		TextAnswer string         `json:"text_answer"` // numeric and short_answer questions
+		MatchPairs map[int]string `json:"match_pairs"` // matching: option ID -> chosen match
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -409,45 +621,217 @@ func (h *TestHandler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Answers are only taken while the attempt is open and its time has not run out
+	if attempt.Status != "in_progress" || attempt.TimeUp(time.Now()) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "This attempt has ended",
+		})
+		return
+	}
+
 	// Get the question to find correct answer
-	test, err := h.testRepo.GetByID(r.Context(), attempt.TestID)
+	test, err := h.testRepo.GetForAttempt(r.Context(), attempt)
 	if err != nil {
 		http.Error(w, "Test not found", http.StatusNotFound)
 		return
 	}
+	arrangeForAttempt(test, attempt)
 
-	// Find the question and check if answer is correct
-	var isCorrect bool
-	for _, q := range test.Questions {
-		if q.ID == req.QuestionID {
-			for _, opt := range q.Options {
-				if opt.ID == req.OptionID {
-					isCorrect = opt.IsCorrect
-					break
-				}
-			}
+	// Find the question being answered, which must be one the attempt was asked
+	var question *models.Question
+	for i := range test.Questions {
+		if test.Questions[i].ID == req.QuestionID {
+			question = &test.Questions[i]
 			break
 		}
 	}
+	if question == nil {
+		http.Error(w, "Question not found", http.StatusBadRequest)
+		return
+	}
+	if !sectionAccepts(test, attempt, question, time.Now()) {
+		writeSectionEnded(w)
+		return
+	}
 
-	// Save the answer
+	// Grade and save the answer
 	answer := &models.StudentAnswer{
-		AttemptID:        req.AttemptID,
-		QuestionID:       req.QuestionID,
-		SelectedOptionID: &req.OptionID,
-		IsCorrect:        &isCorrect,
+		AttemptID:  req.AttemptID,
+		QuestionID: req.QuestionID,
+	}
+	switch {
+	case question.IsMultipleSelect(), question.IsOrdering():
+		answer.SelectedOptionIDs = req.OptionIDs
+	case question.IsMatching():
+		answer.MatchPairs = req.MatchPairs
+	case !question.UsesOptions():
+		text := strings.TrimSpace(req.TextAnswer)
+		answer.TextAnswer = &text
+	default:
+		answer.SelectedOptionID = &req.OptionID
+	}
+	scoring.Grade(question, answer)
+
+	// A practice question is locked once its feedback has been shown, so only
+	// its first answer is stored
+	saved := true
+	if attempt.Practice {
+		saved, err = h.attemptRepo.SaveFirstAnswer(r.Context(), answer)
+	} else {
+		err = h.attemptRepo.SaveAnswer(r.Context(), answer)
 	}
-
-	if err := h.attemptRepo.SaveAnswer(r.Context(), answer); err != nil {
+	if err != nil {
 		log.Printf("Error saving answer: %v", err)
 		http.Error(w, "Failed to save answer", http.StatusInternalServerError)
 		return
 	}
+	if !saved {
+		answers, err := h.attemptRepo.GetAnswersByAttemptID(r.Context(), attempt.ID)
+		if err != nil {
+			log.Printf("Error fetching answers: %v", err)
+			http.Error(w, "Failed to save answer", http.StatusInternalServerError)
+			return
+		}
+		for i := range answers {
+			if answers[i].QuestionID == question.ID {
+				answer = &answers[i]
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":  false,
+			"error":    "This question has already been answered",
+			"locked":   true,
+			"feedback": practiceFeedback(question, answer),
+		})
+		return
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	response := map[string]interface{}{
 		"success": true,
 		"message": "Answer saved",
+	}
+	if attempt.Practice {
+		response["feedback"] = practiceFeedback(question, answer)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevealHint handles AJAX requests to reveal a question's next hint. The
+// reveal is recorded with the penalty it costs, which SubmitTest takes off the
+// question's points.
+func (h *TestHandler) RevealHint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session := auth.GetSessionData(r)
+
+	var req struct {
+		AttemptID  int `json:"attempt_id"`
+		QuestionID int `json:"question_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// Verify attempt belongs to user
+	attempt, err := h.attemptRepo.GetByID(r.Context(), req.AttemptID)
+	if err != nil || attempt.UserID != session.UserID {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	if attempt.Status != "in_progress" || attempt.TimeUp(time.Now()) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "This attempt has ended",
+		})
+		return
+	}
+
+	test, err := h.testRepo.GetForAttempt(r.Context(), attempt)
+	if err != nil {
+		http.Error(w, "Test not found", http.StatusNotFound)
+		return
+	}
+	arrangeForAttempt(test, attempt)
+
+	// The question must be one the attempt was asked
+	var question *models.Question
+	for i := range test.Questions {
+		if test.Questions[i].ID == req.QuestionID {
+			question = &test.Questions[i]
+			break
+		}
+	}
+	if question == nil {
+		http.Error(w, "Question not found", http.StatusBadRequest)
+		return
+	}
+	if !sectionAccepts(test, attempt, question, time.Now()) {
+		writeSectionEnded(w)
+		return
+	}
+
+	reveals, err := h.attemptRepo.GetHintReveals(r.Context(), attempt.ID)
+	if err != nil {
+		log.Printf("Error fetching hints: %v", err)
+		http.Error(w, "Failed to reveal hint", http.StatusInternalServerError)
+		return
+	}
+
+	hint := nextHint(question, reveals)
+	if hint == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":   false,
+			"error":     "There are no more hints for this question",
+			"remaining": 0,
+		})
+		return
+	}
+
+	reveal := &models.HintReveal{
+		AttemptID:  attempt.ID,
+		QuestionID: question.ID,
+		HintID:     &hint.ID,
+		Penalty:    hint.PenaltyUnder(test.Scoring),
+	}
+	if _, err := h.attemptRepo.RevealHint(r.Context(), reveal); err != nil {
+		log.Printf("Error revealing hint: %v", err)
+		http.Error(w, "Failed to reveal hint", http.StatusInternalServerError)
+		return
+	}
+
+	// A second click that raced this one reveals the same hint without a
+	// second penalty, so work out what is left from what is stored
+	reveals, err = h.attemptRepo.GetHintReveals(r.Context(), attempt.ID)
+	if err != nil {
+		log.Printf("Error fetching hints: %v", err)
+		http.Error(w, "Failed to reveal hint", http.StatusInternalServerError)
+		return
+	}
+	state := hintStates(test, reveals)[question.ID]
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"hint":      hint.HintText,
+		"remaining": state.Remaining,
+		"next_cost": state.NextCost,
 	})
 }
 
@@ -473,41 +857,67 @@ func (h *TestHandler) SubmitTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// An attempt the sweeper already finished, or a second submit, just shows the results
+	if attempt.Status == "in_progress" {
+		if err := h.finishAttempt(r.Context(), attempt, time.Now()); err != nil {
+			log.Printf("Error completing attempt %d: %v", attemptID, err)
+			http.Error(w, "Failed to submit test", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Redirect to results
+	http.Redirect(w, r, "/test/results?attempt_id="+attemptIDStr, http.StatusSeeOther)
+}
+
+// finishAttempt scores and grades an in-progress attempt from the answers
+// saved so far, completes it and updates the student's stats, which practice attempts leave
+// alone. An attempt finished after its deadline is recorded as completed at
+// the deadline.
+func (h *TestHandler) finishAttempt(ctx context.Context, attempt *models.TestAttempt, now time.Time) error {
 	// Get all answers
-	answers, err := h.attemptRepo.GetAnswersByAttemptID(r.Context(), attemptID)
+	answers, err := h.attemptRepo.GetAnswersByAttemptID(ctx, attempt.ID)
 	if err != nil {
-		log.Printf("Error fetching answers: %v", err)
-		http.Error(w, "Failed to calculate score", http.StatusInternalServerError)
-		return
+		return fmt.Errorf("fetching answers: %w", err)
 	}
 
-	// Calculate score
-	score := 0
-	totalPoints := 0
-	test, _ := h.testRepo.GetByID(r.Context(), attempt.TestID)
+	// Calculate score over the questions the attempt was asked, regrading each
+	// answer so the question's scoring rule applies, less the hints revealed
+	test, err := h.testRepo.GetForAttempt(ctx, attempt)
+	if err != nil {
+		return fmt.Errorf("fetching test: %w", err)
+	}
+	arrangeForAttempt(test, attempt)
+	hints, err := h.attemptRepo.GetHintReveals(ctx, attempt.ID)
+	if err != nil {
+		return fmt.Errorf("fetching hints: %w", err)
+	}
+	result := scoring.Score(test, answers, hints)
+	score, totalPoints := result.Score, result.TotalPoints
 
-	for _, q := range test.Questions {
-		totalPoints += q.Points
-		for _, answer := range answers {
-			if answer.QuestionID == q.ID && answer.IsCorrect != nil && *answer.IsCorrect {
-				score += q.Points
-			}
-		}
+	// Grade against the boundaries in force now; the grade stays fixed until
+	// the test is regraded
+	boundaries, err := h.testRepo.GradeBoundariesFor(ctx, test)
+	if err != nil {
+		return fmt.Errorf("fetching grade boundaries: %w", err)
 	}
 
-	// Complete the attempt
-	if err := h.attemptRepo.Complete(r.Context(), attemptID, score, totalPoints); err != nil {
-		log.Printf("Error completing attempt: %v", err)
-		http.Error(w, "Failed to submit test", http.StatusInternalServerError)
-		return
+	// Complete the attempt, unless something else finished it first
+	completedAt := now
+	if attempt.Deadline != nil && completedAt.After(*attempt.Deadline) {
+		completedAt = *attempt.Deadline
+	}
+	completed, err := h.attemptRepo.Complete(ctx, attempt.ID, score, totalPoints, boundaries.GradeFor(score, totalPoints), completedAt)
+	if err != nil || !completed || attempt.Practice {
+		return err
 	}
 
 	// Update user stats
-	stats, err := h.userRepo.GetUserStats(r.Context(), session.UserID)
+	stats, err := h.userRepo.GetUserStats(ctx, attempt.UserID)
 	if err != nil {
 		// Initialize if doesn't exist
-		h.userRepo.InitializeUserStats(r.Context(), session.UserID)
-		stats, _ = h.userRepo.GetUserStats(r.Context(), session.UserID)
+		h.userRepo.InitializeUserStats(ctx, attempt.UserID)
+		stats, _ = h.userRepo.GetUserStats(ctx, attempt.UserID)
 	}
 
 	stats.TestsCompleted++
@@ -518,17 +928,30 @@ func (h *TestHandler) SubmitTest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Recalculate streaks based on completed attempts
-	if streaks, err := h.attemptRepo.GetUserStreakStats(r.Context(), session.UserID); err == nil {
+	if streaks, err := h.attemptRepo.GetUserStreakStats(ctx, attempt.UserID); err == nil {
 		stats.CurrentStreak = streaks.Current
 		stats.BestStreak = streaks.Best
 	} else {
 		log.Printf("Error calculating streaks: %v", err)
 	}
 
-	h.userRepo.UpdateUserStats(r.Context(), stats)
+	h.userRepo.UpdateUserStats(ctx, stats)
+	return nil
+}
 
-	// Redirect to results
-	http.Redirect(w, r, "/test/results?attempt_id="+attemptIDStr, http.StatusSeeOther)
+// attemptOver reports whether the attempt is completed or abandoned, so its
+// answer key and explanations may be shown. Otherwise its student is sent
+// back to the attempt and anyone else is refused.
+func attemptOver(w http.ResponseWriter, r *http.Request, attempt *models.TestAttempt, userID int) bool {
+	if attempt.Status == "completed" || attempt.Status == "abandoned" {
+		return true
+	}
+	if attempt.UserID == userID {
+		http.Redirect(w, r, "/test/take?attempt_id="+strconv.Itoa(attempt.ID), http.StatusSeeOther)
+	} else {
+		http.Error(w, "The attempt is still in progress", http.StatusConflict)
+	}
+	return false
 }
 
 // ViewResults displays test results
@@ -554,14 +977,18 @@ func (h *TestHandler) ViewResults(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
+	if !attemptOver(w, r, attempt, session.UserID) {
+		return
+	}
 
 	// Get test
-	test, err := h.testRepo.GetByID(r.Context(), attempt.TestID)
+	test, err := h.testRepo.GetForAttempt(r.Context(), attempt)
 	if err != nil {
 		log.Printf("Error fetching test: %v", err)
 		http.Error(w, "Test not found", http.StatusNotFound)
 		return
 	}
+	arrangeForAttempt(test, attempt)
 
 	// Get answers
 	answers, err := h.attemptRepo.GetAnswersByAttemptID(r.Context(), attemptID)
@@ -569,6 +996,11 @@ func (h *TestHandler) ViewResults(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Error fetching answers: %v", err)
 	}
 
+	hints, err := h.attemptRepo.GetHintReveals(r.Context(), attemptID)
+	if err != nil {
+		log.Printf("Error fetching hints: %v", err)
+	}
+
 	// Create map of answers
 	answerMap := make(map[int]*models.StudentAnswer)
 	for i := range answers {
@@ -590,6 +1022,8 @@ func (h *TestHandler) ViewResults(w http.ResponseWriter, r *http.Request) {
 		"Answers":    answerMap,
 		"Percentage": percentage,
 		"Passed":     passed,
+		"Breakdown":  scoring.Tally(test, answers, hints),
+		"Sections":   scoring.Sections(test, answers, hints),
 	}
 
 	tmpl, err := template.New("").Funcs(template.FuncMap{
@@ -606,12 +1040,6 @@ func (h *TestHandler) ViewResults(w http.ResponseWriter, r *http.Request) {
 			}
 			return a % b
 		},
-		"eqPtr": func(ptr *int, val int) bool {
-			if ptr == nil {
-				return false
-			}
-			return *ptr == val
-		},
 	}).ParseFiles("views/layout.html", "views/test_results.html")
 	if err != nil {
 		log.Printf("Error parsing templates: %v", err)
@@ -648,14 +1076,18 @@ func (h *TestHandler) ReviewTest(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
+	if !attemptOver(w, r, attempt, session.UserID) {
+		return
+	}
 
 	// Get test with full details
-	test, err := h.testRepo.GetByID(r.Context(), attempt.TestID)
+	test, err := h.testRepo.GetForAttempt(r.Context(), attempt)
 	if err != nil {
 		log.Printf("Error fetching test: %v", err)
 		http.Error(w, "Test not found", http.StatusNotFound)
 		return
 	}
+	arrangeForAttempt(test, attempt)
 
 	// Get answers
 	answers, err := h.attemptRepo.GetAnswersByAttemptID(r.Context(), attemptID)
@@ -663,16 +1095,24 @@ func (h *TestHandler) ReviewTest(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Error fetching answers: %v", err)
 	}
 
-	// Create map of answers and count correct/incorrect
+	hints, err := h.attemptRepo.GetHintReveals(r.Context(), attemptID)
+	if err != nil {
+		log.Printf("Error fetching hints: %v", err)
+	}
+
+	// Create map of answers and work out how the score was reached
 	answerMap := make(map[int]*models.StudentAnswer)
-	correctCount := 0
-	incorrectCount := 0
 	for i := range answers {
 		answerMap[answers[i].QuestionID] = &answers[i]
-		if answers[i].IsCorrect != nil && *answers[i].IsCorrect {
-			correctCount++
-		} else if answers[i].IsCorrect != nil {
-			incorrectCount++
+	}
+	breakdown := scoring.Tally(test, answers, hints)
+
+	// Each section's subtotal heads its first question
+	sectionHeadings := make(map[int]*scoring.SectionResult) // questionID -> section starting there
+	sections := scoring.Sections(test, answers, hints)
+	for i := range sections {
+		if questions := test.SectionQuestions(sections[i].Section.ID); len(questions) > 0 {
+			sectionHeadings[questions[0].ID] = &sections[i]
 		}
 	}
 
@@ -685,24 +1125,23 @@ func (h *TestHandler) ReviewTest(w http.ResponseWriter, r *http.Request) {
 	passed := percentage >= float64(test.PassingScore)
 
 	data := map[string]interface{}{
-		"Session":        session,
-		"Test":           test,
-		"Attempt":        attempt,
-		"Answers":        answerMap,
-		"Percentage":     percentage,
-		"Passed":         passed,
-		"CorrectCount":   correctCount,
-		"IncorrectCount": incorrectCount,
+		"Session":         session,
+		"Test":            test,
+		"Attempt":         attempt,
+		"Answers":         answerMap,
+		"Percentage":      percentage,
+		"Passed":          passed,
+		"CorrectCount":    breakdown.Correct,
+		"IncorrectCount":  breakdown.Partial + breakdown.Wrong,
+		"Breakdown":       breakdown,
+		"Hints":           hintStates(test, hints),
+		"SectionHeadings": sectionHeadings,
 	}
 
 	tmpl, err := template.New("").Funcs(template.FuncMap{
-		"add": func(a, b int) int { return a + b },
-		"eqPtr": func(ptr *int, val int) bool {
-			if ptr == nil {
-				return false
-			}
-			return *ptr == val
-		},
+		"add":          func(a, b int) int { return a + b },
+		"optionLetter": optionLetter,
+		"richText":     richtext.Render,
 	}).ParseFiles("views/layout.html", "views/test_review.html")
 	if err != nil {
 		log.Printf("Error parsing templates: %v", err)
@@ -715,3 +1154,8 @@ func (h *TestHandler) ReviewTest(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
+
+// optionLetter labels an option by its zero-based position (0 -> A, 1 -> B, ...)
+func optionLetter(index int) string {
+	return string(rune('A' + index))
+}
@@ -4,6 +4,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"my-app/internal/models"
 )
@@ -29,6 +30,24 @@ func TestFilterTests_AppliesAllFilters(t *testing.T) {
 	}
 }
 
+func TestFilterTests_HidesTestsNotYetOpen(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+	tests := []models.Test{
+		{ID: 1, Title: "Always open", Published: true},
+		{ID: 2, Title: "Opens later", Published: true, AvailableFrom: &later},
+		{ID: 3, Title: "Closed", Published: true, AvailableUntil: &earlier},
+	}
+
+	filtered := filterTests(tests, testFilters{OpenAt: &now})
+	if len(filtered) != 2 || filtered[0].ID != 1 || filtered[1].ID != 3 {
+		t.Fatalf("expected only the test not yet open to be hidden, got %+v", filtered)
+	}
+	if all := filterTests(tests, testFilters{}); len(all) != 3 {
+		t.Fatalf("expected every test without the filter, got %d", len(all))
+	}
+}
+
 func TestFilterTests_PublishedDefaultsToTrue(t *testing.T) {
 	tests := []models.Test{
 		{ID: 1, Title: "Published", Published: true},
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"my-app/internal/auth"
+	"my-app/internal/dbtest"
+	"my-app/internal/models"
+	"my-app/internal/repository"
+)
+
+// TestReviewWithholdsAnswersInProgress requests the review and results pages
+// of an attempt still in progress, which would show its answer key
+func TestReviewWithholdsAnswersInProgress(t *testing.T) {
+	pool := dbtest.Pool(t)
+	teacherID := dbtest.User(t, pool, "teacher")
+	studentID := dbtest.User(t, pool, "student")
+	ctx := context.Background()
+	testRepo := repository.NewTestRepository(pool)
+	attemptRepo := repository.NewAttemptRepository(pool)
+	h := NewTestHandler(testRepo, attemptRepo, repository.NewUserRepository(pool))
+
+	test, err := persistTestUpload(ctx, testRepo, uploadWithQuestion(models.QuestionUpload{
+		QuestionText: "Where was the battle of 1066?", Options: []string{"Hastings", "Agincourt"}, Points: 1,
+	}), teacherID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { testRepo.DeleteTest(ctx, test.ID) })
+
+	attempt := &models.TestAttempt{UserID: studentID, TestID: test.ID, StartedAt: time.Now(), Status: "in_progress"}
+	if err := attemptRepo.Create(ctx, attempt); err != nil {
+		t.Fatal(err)
+	}
+	attemptID := strconv.Itoa(attempt.ID)
+
+	store := auth.NewSessionStore()
+	mw := auth.NewMiddleware(store)
+	request := func(handler http.HandlerFunc, path string, userID int, role string) *httptest.ResponseRecorder {
+		token, _ := store.Create(userID, role, role)
+		req := httptest.NewRequest(http.MethodGet, path+"?attempt_id="+attemptID, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: token})
+		rr := httptest.NewRecorder()
+		mw.RequireAuth(handler).ServeHTTP(rr, req)
+		return rr
+	}
+
+	for path, handler := range map[string]http.HandlerFunc{"/test/review": h.ReviewTest, "/test/results": h.ViewResults} {
+		rr := request(handler, path, studentID, "student")
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/test/take?attempt_id="+attemptID {
+			t.Errorf("%s: expected the student sent back to the attempt, got %d to %q", path, rr.Code, rr.Header().Get("Location"))
+		}
+
+		rr = request(handler, path, teacherID, "teacher")
+		if rr.Code != http.StatusConflict {
+			t.Errorf("%s: expected a teacher refused while the attempt is in progress, got %d", path, rr.Code)
+		}
+	}
+}
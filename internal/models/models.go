@@ -1,6 +1,15 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Valid difficulty levels
 var ValidDifficulties = []string{"Easy", "Medium", "Hard"}
@@ -8,6 +17,82 @@ var ValidDifficulties = []string{"Easy", "Medium", "Hard"}
 // Valid exam standards
 var ValidExamStandards = []string{"Primary", "Secondary", "GCSE", "IGCSE", "A-Level"}
 
+// Question types
+const (
+	QuestionTypeSingleChoice   = "single_choice"
+	QuestionTypeMultipleSelect = "multiple_select"
+	QuestionTypeTrueFalse      = "true_false"
+	QuestionTypeNumeric        = "numeric"
+	QuestionTypeShortAnswer    = "short_answer"
+	QuestionTypeOrdering       = "ordering" // put the options in order; option_order is the correct order
+	QuestionTypeMatching       = "matching" // pair each option with its match_text
+)
+
+// Valid question types
+var ValidQuestionTypes = []string{
+	QuestionTypeSingleChoice, QuestionTypeMultipleSelect, QuestionTypeTrueFalse,
+	QuestionTypeNumeric, QuestionTypeShortAnswer, QuestionTypeOrdering, QuestionTypeMatching,
+}
+
+// MaxSigFigs is the most significant figures a numeric answer can require
+const MaxSigFigs = 15
+
+// MaxTypoTolerance is the largest edit distance a short answer may be allowed to be off by
+const MaxTypoTolerance = 3
+
+// Tolerance types for numeric answers
+const (
+	ToleranceAbsolute = "absolute"
+	TolerancePercent  = "percent"
+)
+
+// Limits on the number of answer options per question
+const (
+	MinOptions = 2
+	MaxOptions = 8
+)
+
+// TrueFalseOptions are the fixed option texts used by true_false questions
+var TrueFalseOptions = []string{"True", "False"}
+
+// Scoring rules for questions that can be partially correct
+const (
+	ScoringAllOrNothing = "all_or_nothing"
+	ScoringPartial      = "partial" // proportional credit, wrong picks cancel right ones
+)
+
+// Valid scoring rules
+var ValidScoringRules = []string{ScoringAllOrNothing, ScoringPartial}
+
+// Which of a student's attempts at a test counts as their result
+const (
+	CountBestAttempt    = "best"
+	CountLatestAttempt  = "latest"
+	CountAverageAttempt = "average" // the mean of every completed attempt
+)
+
+// Valid choices of counted attempt
+var ValidCountedAttempts = []string{CountBestAttempt, CountLatestAttempt, CountAverageAttempt}
+
+// What happens to an attempt still running when its test's availability window closes
+const (
+	LateSubmissionFinish = "finish"  // the attempt runs to its time limit
+	LateSubmissionCutOff = "cut_off" // the attempt ends when the window closes
+)
+
+// Valid late-submission policies
+var ValidLateSubmissions = []string{LateSubmissionFinish, LateSubmissionCutOff}
+
+// Kinds of prerequisite a student must meet before starting a test
+const (
+	PrerequisitePassed     = "passed"      // pass the required test at its passing score
+	PrerequisiteMinScore   = "min_score"   // score at least MinPercent on the required test
+	PrerequisiteTopicCount = "topic_count" // complete MinCount tests in the topic
+)
+
+// Valid kinds of prerequisite
+var ValidPrerequisiteKinds = []string{PrerequisitePassed, PrerequisiteMinScore, PrerequisiteTopicCount}
+
 // User represents a user in the system (student, teacher, or admin)
 type User struct {
 	ID           int       `json:"id"`
@@ -38,63 +123,657 @@ type Topic struct {
 
 // Test represents a complete test/exam
 type Test struct {
+	ID               int           `json:"id"`
+	Title            string        `json:"title"`
+	Description      string        `json:"description"`
+	SubjectID        *int          `json:"subject_id"`
+	TopicID          *int          `json:"topic_id"`
+	ExamStandard     string        `json:"exam_standard"` // GCSE, A-Level, Primary, Secondary
+	Difficulty       string        `json:"difficulty"`    // Easy, Medium, Hard
+	TimeLimitMinutes int           `json:"time_limit_minutes"`
+	PassingScore     int           `json:"passing_score"`
+	Scoring          ScoringPolicy `json:"scoring"`
+	ShuffleQuestions bool          `json:"shuffle_questions"` // each attempt sees the questions in its own order
+	ShuffleOptions   bool          `json:"shuffle_options"`   // each attempt sees the options in its own order
+	Attempts         AttemptPolicy `json:"attempts"`
+	AllowPractice    bool          `json:"allow_practice"`  // students may also take practice attempts with instant feedback
+	AvailableFrom    *time.Time    `json:"available_from"`  // students may not start it before, nil when open from publishing
+	AvailableUntil   *time.Time    `json:"available_until"` // students may not start it after, nil when it never closes
+	Timezone         string        `json:"timezone"`        // IANA zone the window is set and shown in
+	LateSubmission   string        `json:"late_submission"` // see ValidLateSubmissions
+	Published        bool          `json:"published"`
+	NotesFilename    *string       `json:"notes_filename"`
+	CreatedBy        *int          `json:"created_by"`
+	CreatedAt        time.Time     `json:"created_at"`
+	UpdatedAt        time.Time     `json:"updated_at"`
+
+	// Related data (not in DB, populated via joins)
+	Subject       *Subject       `json:"subject,omitempty"`
+	Topic         *Topic         `json:"topic,omitempty"`
+	Pools         []QuestionPool `json:"pools,omitempty"`
+	Sections      []Section      `json:"sections,omitempty"` // in SectionOrder
+	Prerequisites []Prerequisite `json:"prerequisites,omitempty"`
+	Questions     []Question     `json:"questions,omitempty"`
+
+	// GradeBoundaries replace the exam standard's boundaries for this test when set
+	GradeBoundaries GradeBoundaries `json:"grade_boundaries,omitempty"`
+}
+
+// Location returns the test's timezone, or UTC when it has none or it is unknown
+func (t *Test) Location() *time.Location {
+	if loc, err := time.LoadLocation(t.Timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// NotYetOpen reports whether the test's availability window has yet to open
+func (t *Test) NotYetOpen(now time.Time) bool {
+	return t.AvailableFrom != nil && now.Before(*t.AvailableFrom)
+}
+
+// Closed reports whether the test's availability window has closed
+func (t *Test) Closed(now time.Time) bool {
+	return t.AvailableUntil != nil && !now.Before(*t.AvailableUntil)
+}
+
+// AttemptDeadline returns when a timed attempt started at startedAt runs out:
+// at the end of the time limit, or when the window closes first and the test
+// cuts late attempts off
+func (t *Test) AttemptDeadline(startedAt time.Time) time.Time {
+	deadline := startedAt.Add(time.Duration(t.TimeLimitMinutes) * time.Minute)
+	if t.LateSubmission == LateSubmissionCutOff && t.AvailableUntil != nil && t.AvailableUntil.Before(deadline) {
+		return *t.AvailableUntil
+	}
+	return deadline
+}
+
+// LocalTime formats a time in the test's timezone for display, or returns ""
+// for nil
+func (t *Test) LocalTime(ts *time.Time) string {
+	if ts == nil {
+		return ""
+	}
+	return ts.In(t.Location()).Format("Mon 2 Jan 2006, 15:04 MST")
+}
+
+// LocalInput formats a time in the test's timezone for a datetime-local
+// input, or returns "" for nil
+func (t *Test) LocalInput(ts *time.Time) string {
+	if ts == nil {
+		return ""
+	}
+	return ts.In(t.Location()).Format(localTimeLayouts[0])
+}
+
+// localTimeLayouts are the forms ParseLocalTime accepts, the first being what
+// a datetime-local input sends
+var localTimeLayouts = []string{"2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02 15:04:05", time.RFC3339}
+
+// ParseLocalTime reads a date and time given in the named timezone, e.g.
+// "2025-06-01T09:00"; a value with its own offset keeps it. A blank value
+// parses as nil.
+func ParseLocalTime(value, timezone string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", timezone)
+	}
+	for _, layout := range localTimeLayouts {
+		if ts, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return &ts, nil
+		}
+	}
+	return nil, fmt.Errorf("%q is not a date and time like 2025-06-01T09:00", value)
+}
+
+// TestRevision is an immutable snapshot of a test's content. Attempts are
+// taken against a revision, so editing the test later does not change what
+// their review, results and analytics show.
+type TestRevision struct {
+	ID           int       `json:"id"`
+	TestID       int       `json:"test_id"`
+	Revision     int       `json:"revision"` // 1 for the test's first revision, counting up
+	Content      *Test     `json:"content"`
+	CreatedBy    *int      `json:"created_by"` // who made the edit, nil when the content was captured as an attempt started or before an edit
+	CreatedAt    time.Time `json:"created_at"`
+	RestoredFrom *int      `json:"restored_from"` // the revision whose content this one restored, nil unless it was a restore
+
+	// Related data (not in DB, populated via joins)
+	CreatedByName string `json:"created_by_name,omitempty"`
+}
+
+// Content returns the part of the test a revision keeps: everything students
+// are asked and graded against, without publishing state, the time of the
+// last edit or the prerequisites, which gate starting an attempt rather than
+// what it asks
+func (t *Test) Content() Test {
+	content := *t
+	content.Published = false
+	content.UpdatedAt = time.Time{}
+	content.Prerequisites = nil
+	return content
+}
+
+// MaxGradeLength is the longest grade label a boundary may award
+const MaxGradeLength = 10
+
+// GradeBoundary is the lowest percentage that earns a grade
+type GradeBoundary struct {
+	Grade      string  `json:"grade"`
+	MinPercent float64 `json:"min_percent"`
+}
+
+// GradeBoundaries are the boundaries of one exam standard or one test
+type GradeBoundaries []GradeBoundary
+
+// Sorted returns the boundaries highest first
+func (b GradeBoundaries) Sorted() GradeBoundaries {
+	sorted := slices.Clone(b)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].MinPercent > sorted[j].MinPercent })
+	return sorted
+}
+
+// Grade returns the grade a percentage earns, or "" when it is below every boundary
+func (b GradeBoundaries) Grade(percent float64) string {
+	for _, boundary := range b.Sorted() {
+		if percent >= boundary.MinPercent {
+			return boundary.Grade
+		}
+	}
+	return ""
+}
+
+// GradeFor returns the grade a score earns, or nil when there is nothing to
+// score it against or it is below every boundary
+func (b GradeBoundaries) GradeFor(score, totalPoints int) *string {
+	if totalPoints <= 0 {
+		return nil
+	}
+	grade := b.Grade(float64(score) / float64(totalPoints) * 100)
+	if grade == "" {
+		return nil
+	}
+	return &grade
+}
+
+// Summary lists the boundaries highest first, like "A 70%, B 60%"
+func (b GradeBoundaries) Summary() string {
+	parts := make([]string, 0, len(b))
+	for _, boundary := range b.Sorted() {
+		parts = append(parts, fmt.Sprintf("%s %s%%", boundary.Grade, strconv.FormatFloat(boundary.MinPercent, 'f', -1, 64)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Prerequisite is a rule a student's earlier attempts must meet before they
+// may start the test. Passed and MinScore rules name a RequiredTestID;
+// TopicCount rules a TopicID.
+type Prerequisite struct {
+	ID             int       `json:"id"`
+	TestID         int       `json:"test_id"`
+	Kind           string    `json:"kind"` // see ValidPrerequisiteKinds
+	RequiredTestID *int      `json:"required_test_id"`
+	MinPercent     int       `json:"min_percent"` // min_score: the percentage to reach
+	TopicID        *int      `json:"topic_id"`
+	MinCount       int       `json:"min_count"` // topic_count: how many of the topic's tests to complete
+	CreatedAt      time.Time `json:"created_at"`
+
+	// Related data (not in DB, populated via joins)
+	RequiredTitle string `json:"required_title,omitempty"`
+	TopicName     string `json:"topic_name,omitempty"`
+}
+
+// Describe states the rule as something for the student to do
+func (p Prerequisite) Describe() string {
+	switch p.Kind {
+	case PrerequisiteMinScore:
+		return fmt.Sprintf("Score at least %d%% on %q", p.MinPercent, p.RequiredTitle)
+	case PrerequisiteTopicCount:
+		if p.MinCount == 1 {
+			return fmt.Sprintf("Complete a test in %s", p.TopicName)
+		}
+		return fmt.Sprintf("Complete %d tests in %s", p.MinCount, p.TopicName)
+	default:
+		return fmt.Sprintf("Pass %q", p.RequiredTitle)
+	}
+}
+
+// QuestionPool is a bank of a test's questions from which each attempt draws
+// DrawCount at random. Questions outside any pool are asked in every attempt.
+type QuestionPool struct {
+	ID        int       `json:"id"`
+	TestID    int       `json:"test_id"`
+	Name      string    `json:"name"`
+	DrawCount int       `json:"draw_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Pool returns the test's pool with the given ID, or nil when there is none
+func (t *Test) Pool(id *int) *QuestionPool {
+	if id == nil {
+		return nil
+	}
+	for i := range t.Pools {
+		if t.Pools[i].ID == *id {
+			return &t.Pools[i]
+		}
+	}
+	return nil
+}
+
+// PoolSize returns how many of the test's questions are in the pool
+func (t *Test) PoolSize(poolID int) int {
+	size := 0
+	for _, q := range t.Questions {
+		if q.InPool(poolID) {
+			size++
+		}
+	}
+	return size
+}
+
+// QuestionsPerAttempt returns how many questions each attempt is asked: every
+// question outside a pool plus the number drawn from each pool
+func (t *Test) QuestionsPerAttempt() int {
+	count := 0
+	for _, q := range t.Questions {
+		if t.Pool(q.PoolID) == nil {
+			count++
+		}
+	}
+	for _, pool := range t.Pools {
+		count += min(pool.DrawCount, t.PoolSize(pool.ID))
+	}
+	return count
+}
+
+// Section is one part of a test, taken in SectionOrder, with its own
+// instructions and optionally its own time limit. Once a student leaves a
+// NoReturn section they cannot go back to it.
+type Section struct {
 	ID               int       `json:"id"`
+	TestID           int       `json:"test_id"`
 	Title            string    `json:"title"`
-	Description      string    `json:"description"`
-	SubjectID        *int      `json:"subject_id"`
-	TopicID          *int      `json:"topic_id"`
-	ExamStandard     string    `json:"exam_standard"` // GCSE, A-Level, Primary, Secondary
-	Difficulty       string    `json:"difficulty"`    // Easy, Medium, Hard
-	TimeLimitMinutes int       `json:"time_limit_minutes"`
-	PassingScore     int       `json:"passing_score"`
-	Published        bool      `json:"published"`
-	NotesFilename    *string   `json:"notes_filename"`
-	CreatedBy        *int      `json:"created_by"`
+	Instructions     string    `json:"instructions"`
+	TimeLimitMinutes int       `json:"time_limit_minutes"` // 0 when only the test's limit applies
+	NoReturn         bool      `json:"no_return"`
+	SectionOrder     int       `json:"section_order"`
 	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
+}
 
-	// Related data (not in DB, populated via joins)
-	Subject   *Subject   `json:"subject,omitempty"`
-	Topic     *Topic     `json:"topic,omitempty"`
-	Questions []Question `json:"questions,omitempty"`
+// Section returns the test's section with the given ID, or nil when there is none
+func (t *Test) Section(id *int) *Section {
+	if id == nil {
+		return nil
+	}
+	for i := range t.Sections {
+		if t.Sections[i].ID == *id {
+			return &t.Sections[i]
+		}
+	}
+	return nil
+}
+
+// SectionOf returns the section a question is asked in, or nil when the test
+// has no sections. Questions not assigned to one are asked in the first.
+func (t *Test) SectionOf(q *Question) *Section {
+	if s := t.Section(q.SectionID); s != nil {
+		return s
+	}
+	if len(t.Sections) == 0 {
+		return nil
+	}
+	return &t.Sections[0]
+}
+
+// SectionQuestions returns the test's questions asked in the section
+func (t *Test) SectionQuestions(sectionID int) []Question {
+	var questions []Question
+	for i := range t.Questions {
+		if s := t.SectionOf(&t.Questions[i]); s != nil && s.ID == sectionID {
+			questions = append(questions, t.Questions[i])
+		}
+	}
+	return questions
+}
+
+// GroupBySection reorders the test's questions section by section, keeping
+// their order within each section
+func (t *Test) GroupBySection() {
+	position := make(map[int]int, len(t.Sections))
+	for i, s := range t.Sections {
+		position[s.ID] = i
+	}
+	sort.SliceStable(t.Questions, func(i, j int) bool {
+		si, sj := t.SectionOf(&t.Questions[i]), t.SectionOf(&t.Questions[j])
+		return si != nil && sj != nil && position[si.ID] < position[sj.ID]
+	})
+}
+
+// ScoringPolicy controls how a test's answers add up to its score. The penalty
+// and skipped credit are shares of each question's points.
+type ScoringPolicy struct {
+	WrongPenalty  float64 `json:"wrong_penalty"`  // deducted for a wrong answer, e.g. 0.25 takes off a quarter of the question's points
+	SkippedCredit float64 `json:"skipped_credit"` // awarded for a question left unanswered
+	HintPenalty   float64 `json:"hint_penalty"`   // taken off a question's points for each hint revealed, unless the hint sets its own
+	FloorAtZero   bool    `json:"floor_at_zero"`  // the test score never drops below zero
+}
+
+// DefaultScoringPolicy awards points for correct answers only, with no
+// negative marking
+func DefaultScoringPolicy() ScoringPolicy {
+	return ScoringPolicy{FloorAtZero: true}
+}
+
+// UnmarshalJSON fills in defaults for fields missing from the JSON, so an
+// uploaded policy that only sets a penalty keeps the zero floor
+func (p *ScoringPolicy) UnmarshalJSON(data []byte) error {
+	type plain ScoringPolicy
+	policy := plain(DefaultScoringPolicy())
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return err
+	}
+	*p = ScoringPolicy(policy)
+	return nil
+}
+
+// AttemptPolicy limits how often a student may take a test and decides which
+// of their attempts counts as their result
+type AttemptPolicy struct {
+	MaxAttempts     int    `json:"max_attempts"`     // attempts each student may start, 0 for no limit
+	CooldownMinutes int    `json:"cooldown_minutes"` // wait after one attempt ends before the next may start
+	Counts          string `json:"counts"`           // best, latest or average
+}
+
+// DefaultAttemptPolicy allows unlimited attempts back to back and counts the best
+func DefaultAttemptPolicy() AttemptPolicy {
+	return AttemptPolicy{Counts: CountBestAttempt}
+}
+
+// UnmarshalJSON fills in defaults for fields missing from the JSON
+func (p *AttemptPolicy) UnmarshalJSON(data []byte) error {
+	type plain AttemptPolicy
+	policy := plain(DefaultAttemptPolicy())
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return err
+	}
+	*p = AttemptPolicy(policy)
+	return nil
+}
+
+// CountedPercentage returns a student's result from their attempts at the
+// test under the policy, as a percentage. Practice attempts never count. It
+// reports false when none of the other attempts has been completed.
+func (p AttemptPolicy) CountedPercentage(attempts []TestAttempt) (float64, bool) {
+	var counted []*TestAttempt
+	for i := range attempts {
+		if _, ok := attempts[i].Percentage(); ok && !attempts[i].Practice {
+			counted = append(counted, &attempts[i])
+		}
+	}
+	if len(counted) == 0 {
+		return 0, false
+	}
+
+	switch p.Counts {
+	case CountLatestAttempt:
+		latest := counted[0]
+		for _, a := range counted[1:] {
+			if a.CompletedAt.After(*latest.CompletedAt) {
+				latest = a
+			}
+		}
+		return latest.Percentage()
+	case CountAverageAttempt:
+		var total float64
+		for _, a := range counted {
+			pct, _ := a.Percentage()
+			total += pct
+		}
+		return total / float64(len(counted)), true
+	default:
+		var best float64
+		for _, a := range counted {
+			if pct, _ := a.Percentage(); pct > best {
+				best = pct
+			}
+		}
+		return best, true
+	}
 }
 
 // Question represents a single question in a test
 type Question struct {
-	ID            int       `json:"id"`
-	TestID        int       `json:"test_id"`
-	QuestionText  string    `json:"question_text"`
-	ImageURL      *string   `json:"image_url"`
-	QuestionOrder int       `json:"question_order"`
-	Points        int       `json:"points"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID                  int            `json:"id"`
+	TestID              int            `json:"test_id"`
+	QuestionText        string         `json:"question_text"`
+	ImageURL            *string        `json:"image_url"`
+	QuestionType        string         `json:"question_type"` // see ValidQuestionTypes
+	ScoringRule         string         `json:"scoring_rule"`  // all_or_nothing, partial
+	Numeric             *NumericAnswer `json:"numeric,omitempty"`
+	CaseSensitive       bool           `json:"case_sensitive"`        // short_answer: match case exactly
+	TypoTolerance       int            `json:"typo_tolerance"`        // short_answer: edits allowed against an accepted answer
+	KeepOptionOrder     bool           `json:"keep_option_order"`     // never shuffle the options, e.g. for "All of the above"
+	PoolID              *int           `json:"pool_id"`               // the pool the question is drawn from, nil when always asked
+	SectionID           *int           `json:"section_id"`            // the section the question is asked in, nil for the first
+	Explanation         string         `json:"explanation"`           // worked solution in richtext markup, shown once the question is answered
+	ExplanationImageURL *string        `json:"explanation_image_url"` // optional diagram for the worked solution
+	QuestionOrder       int            `json:"question_order"`
+	Points              int            `json:"points"`
+	CreatedAt           time.Time      `json:"created_at"`
 
 	// Related data
-	Options []AnswerOption `json:"options,omitempty"`
+	Options         []AnswerOption   `json:"options,omitempty"`
+	AcceptedAnswers []AcceptedAnswer `json:"accepted_answers,omitempty"`
+	Hints           []Hint           `json:"hints,omitempty"`
+}
+
+// Hint is a clue a student can reveal during an attempt, at the cost of some of
+// the question's points. Hints are revealed in HintOrder.
+type Hint struct {
+	ID         int       `json:"id"`
+	QuestionID int       `json:"question_id"`
+	HintText   string    `json:"hint_text"`
+	Penalty    *float64  `json:"penalty"` // share of the question's points, nil to use the test's hint penalty
+	HintOrder  int       `json:"hint_order"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PenaltyUnder returns the share of the question's points revealing the hint
+// costs under the test's scoring policy
+func (h Hint) PenaltyUnder(policy ScoringPolicy) float64 {
+	if h.Penalty != nil {
+		return *h.Penalty
+	}
+	return policy.HintPenalty
+}
+
+// HintReveal records a hint a student revealed during an attempt, with the
+// penalty it cost at the time
+type HintReveal struct {
+	ID         int       `json:"id"`
+	AttemptID  int       `json:"attempt_id"`
+	QuestionID int       `json:"question_id"`
+	HintID     *int      `json:"hint_id"` // nil once the hint has been deleted
+	Penalty    float64   `json:"penalty"`
+	RevealedAt time.Time `json:"revealed_at"`
+}
+
+// AcceptedAnswer is one answer a short_answer question accepts, either literal text or a regex
+type AcceptedAnswer struct {
+	ID         int       `json:"id"`
+	QuestionID int       `json:"question_id"`
+	AnswerText string    `json:"answer_text"`
+	IsRegex    bool      `json:"is_regex"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Display shows the accepted answer, with regex patterns wrapped in slashes
+func (a AcceptedAnswer) Display() string {
+	if a.IsRegex {
+		return "/" + a.AnswerText + "/"
+	}
+	return a.AnswerText
+}
+
+// NumericAnswer is the answer key for a numeric question
+type NumericAnswer struct {
+	Expected      float64  `json:"expected"`
+	Tolerance     float64  `json:"tolerance"`
+	ToleranceType string   `json:"tolerance_type"`     // absolute (default) or percent
+	SigFigs       *int     `json:"sig_figs,omitempty"` // answer must be given to this many significant figures
+	Units         []string `json:"units,omitempty"`    // accepted units; when empty the answer must be a bare number
 }
 
-// AnswerOption represents one of four possible answers
+// Summary describes the expected answer, e.g. "9.81 ± 1% m/s^2 (3 s.f.)"
+func (n *NumericAnswer) Summary() string {
+	if n == nil {
+		return ""
+	}
+	summary := strconv.FormatFloat(n.Expected, 'g', -1, 64)
+	if n.Tolerance > 0 {
+		tolerance := strconv.FormatFloat(n.Tolerance, 'g', -1, 64)
+		if n.ToleranceType == TolerancePercent {
+			tolerance += "%"
+		}
+		summary += " ± " + tolerance
+	}
+	if len(n.Units) > 0 {
+		summary += " " + strings.Join(n.Units, " or ")
+	}
+	if n.SigFigs != nil {
+		summary += fmt.Sprintf(" (%d s.f.)", *n.SigFigs)
+	}
+	return summary
+}
+
+// IsMultipleSelect reports whether students may pick more than one option
+func (q *Question) IsMultipleSelect() bool {
+	return q.QuestionType == QuestionTypeMultipleSelect
+}
+
+// IsTrueFalse reports whether the question is a fixed True/False pair
+func (q *Question) IsTrueFalse() bool {
+	return q.QuestionType == QuestionTypeTrueFalse
+}
+
+// IsNumeric reports whether the student types a number instead of picking an option
+func (q *Question) IsNumeric() bool {
+	return q.QuestionType == QuestionTypeNumeric
+}
+
+// IsShortAnswer reports whether the student types a short text answer
+func (q *Question) IsShortAnswer() bool {
+	return q.QuestionType == QuestionTypeShortAnswer
+}
+
+// IsOrdering reports whether the student puts the options in order
+func (q *Question) IsOrdering() bool {
+	return q.QuestionType == QuestionTypeOrdering
+}
+
+// IsMatching reports whether the student pairs each option with a match
+func (q *Question) IsMatching() bool {
+	return q.QuestionType == QuestionTypeMatching
+}
+
+// SupportsPartialCredit reports whether the question's scoring rule can award partial credit
+func (q *Question) SupportsPartialCredit() bool {
+	return q.IsMultipleSelect() || q.IsOrdering() || q.IsMatching()
+}
+
+// MatchChoices returns the distinct match texts of a matching question in
+// alphabetical order, so their order gives nothing away
+func (q *Question) MatchChoices() []string {
+	seen := make(map[string]bool)
+	var choices []string
+	for _, opt := range q.Options {
+		if opt.MatchText != "" && !seen[opt.MatchText] {
+			seen[opt.MatchText] = true
+			choices = append(choices, opt.MatchText)
+		}
+	}
+	sort.Strings(choices)
+	return choices
+}
+
+// CorrectOrder returns an ordering question's options in their correct order,
+// whatever order they are currently listed in
+func (q *Question) CorrectOrder() []AnswerOption {
+	ordered := make([]AnswerOption, len(q.Options))
+	copy(ordered, q.Options)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].OptionOrder < ordered[j].OptionOrder })
+	return ordered
+}
+
+// InPool reports whether the question is drawn from the given pool
+func (q *Question) InPool(poolID int) bool {
+	return q.PoolID != nil && *q.PoolID == poolID
+}
+
+// InSection reports whether the question is assigned to the section
+func (q *Question) InSection(sectionID int) bool {
+	return q.SectionID != nil && *q.SectionID == sectionID
+}
+
+// UsesOptions reports whether the question is answered by picking answer options
+func (q *Question) UsesOptions() bool {
+	return !q.IsNumeric() && !q.IsShortAnswer()
+}
+
+// ExpectedAnswer describes the answer key of a typed-answer question
+func (q *Question) ExpectedAnswer() string {
+	switch {
+	case q.IsNumeric():
+		return q.Numeric.Summary()
+	case q.IsShortAnswer():
+		accepted := make([]string, 0, len(q.AcceptedAnswers))
+		for _, a := range q.AcceptedAnswers {
+			accepted = append(accepted, a.Display())
+		}
+		return strings.Join(accepted, " / ")
+	}
+	return ""
+}
+
+// AnswerOption represents one of a question's possible answers (2 to 8)
 type AnswerOption struct {
 	ID          int       `json:"id"`
 	QuestionID  int       `json:"question_id"`
 	OptionText  string    `json:"option_text"`
 	IsCorrect   bool      `json:"is_correct,omitempty"` // Only shown to teachers/admins or after test
-	OptionOrder int       `json:"option_order"`
+	MatchText   string    `json:"match_text,omitempty"` // matching: the text this option pairs with
+	Rationale   string    `json:"rationale,omitempty"`  // the misconception behind choosing this option, shown once answered
+	OptionOrder int       `json:"option_order"`         // ordering: the option's correct position
 	CreatedAt   time.Time `json:"created_at"`
 }
 
 // TestAttempt represents a student's attempt at a test
 type TestAttempt struct {
-	ID               int        `json:"id"`
-	UserID           int        `json:"user_id"`
-	TestID           int        `json:"test_id"`
-	StartedAt        time.Time  `json:"started_at"`
-	CompletedAt      *time.Time `json:"completed_at"`
-	Score            *int       `json:"score"`
-	TotalPoints      *int       `json:"total_points"`
-	TimeTakenSeconds *int       `json:"time_taken_seconds"`
-	Status           string     `json:"status"` // in_progress, completed, abandoned
-	CreatedAt        time.Time  `json:"created_at"`
+	ID               int               `json:"id"`
+	UserID           int               `json:"user_id"`
+	TestID           int               `json:"test_id"`
+	StartedAt        time.Time         `json:"started_at"`
+	CompletedAt      *time.Time        `json:"completed_at"`
+	Score            *int              `json:"score"`
+	TotalPoints      *int              `json:"total_points"`
+	TimeTakenSeconds *int              `json:"time_taken_seconds"`
+	Status           string            `json:"status"`                   // in_progress, completed, abandoned
+	ShuffleSeed      int64             `json:"shuffle_seed"`             // seeds the attempt's question and option order
+	QuestionOrder    []int             `json:"question_order,omitempty"` // question IDs in the order the attempt shows them
+	OptionOrder      map[int][]int     `json:"option_order,omitempty"`   // question ID -> option IDs in the order the attempt shows them
+	Deadline         *time.Time        `json:"deadline"`                 // when the test's time limit runs out for this attempt
+	Practice         bool              `json:"practice"`                 // untimed, with feedback after each answer; not counted in results or stats
+	Grade            *string           `json:"grade"`                    // awarded on completion; boundary changes reach it only by regrading
+	SectionID        *int              `json:"section_id"`               // the section the student is working on, nil for tests without sections
+	SectionStarts    map[int]time.Time `json:"section_starts,omitempty"` // section ID -> when the student first entered it
+	SectionsLeft     []int             `json:"sections_left,omitempty"`  // no-return sections the student has moved on from
+	RevisionID       *int              `json:"revision_id"`              // the test revision the attempt was taken against, nil for attempts from before revisions
+	CreatedAt        time.Time         `json:"created_at"`
 
 	// Related data
 	Test    *Test           `json:"test,omitempty"`
@@ -102,20 +781,211 @@ type TestAttempt struct {
 	User    *User           `json:"user,omitempty"`
 }
 
+// Percentage returns the attempt's score as a percentage of its total points,
+// reporting false until the attempt has been completed and scored
+func (a *TestAttempt) Percentage() (float64, bool) {
+	if a.Status != "completed" || a.CompletedAt == nil || a.Score == nil || a.TotalPoints == nil || *a.TotalPoints <= 0 {
+		return 0, false
+	}
+	return float64(*a.Score) / float64(*a.TotalPoints) * 100, true
+}
+
+// SubmissionGrace is how long after an attempt's deadline its answers are
+// still accepted, covering network delay and a final save made at zero
+const SubmissionGrace = 30 * time.Second
+
+// PracticeIdleTimeout is how long a practice attempt, which has no deadline,
+// may go without an answer saved or a hint revealed before it is abandoned
+const PracticeIdleTimeout = 24 * time.Hour
+
+// TimeUp reports whether the attempt's deadline and grace period have passed
+func (a *TestAttempt) TimeUp(now time.Time) bool {
+	return a.Deadline != nil && now.After(a.Deadline.Add(SubmissionGrace))
+}
+
+// SecondsLeft returns the whole seconds until the attempt's deadline, or 0 once it has passed
+func (a *TestAttempt) SecondsLeft(now time.Time) int {
+	if a.Deadline == nil || !now.Before(*a.Deadline) {
+		return 0
+	}
+	return int(a.Deadline.Sub(now).Seconds())
+}
+
+// SectionDeadline returns when the attempt's time in a section runs out, or
+// nil when the section has no time limit of its own, the student has yet to
+// enter it or the attempt is practice
+func (a *TestAttempt) SectionDeadline(s *Section) *time.Time {
+	started, entered := a.SectionStarts[s.ID]
+	if a.Practice || s.TimeLimitMinutes <= 0 || !entered {
+		return nil
+	}
+	deadline := started.Add(time.Duration(s.TimeLimitMinutes) * time.Minute)
+	return &deadline
+}
+
+// SectionTimeUp reports whether the section's deadline and grace period have passed
+func (a *TestAttempt) SectionTimeUp(s *Section, now time.Time) bool {
+	deadline := a.SectionDeadline(s)
+	return deadline != nil && now.After(deadline.Add(SubmissionGrace))
+}
+
+// SectionOpen reports whether the student may still work on the section: it
+// is not a no-return section they have left and its time has not run out
+func (a *TestAttempt) SectionOpen(s *Section, now time.Time) bool {
+	if slices.Contains(a.SectionsLeft, s.ID) {
+		return false
+	}
+	deadline := a.SectionDeadline(s)
+	return deadline == nil || now.Before(*deadline)
+}
+
+// Arrange returns the questions drawn for the attempt, and each question's
+// options, in the order stored for the attempt. The stored question order is
+// the attempt's selection, so questions it does not list are left out; attempts
+// without one are asked every question. Options the stored order does not list,
+// such as ones added after the attempt started, follow in their usual order.
+func (a *TestAttempt) Arrange(questions []Question) []Question {
+	arranged := arrangeByID(questions, a.QuestionOrder, func(q Question) int { return q.ID })
+	if a.QuestionOrder != nil {
+		selected := make(map[int]bool, len(a.QuestionOrder))
+		for _, id := range a.QuestionOrder {
+			selected[id] = true
+		}
+		arranged = slices.DeleteFunc(arranged, func(q Question) bool { return !selected[q.ID] })
+	}
+	for i := range arranged {
+		q := &arranged[i]
+		q.Options = arrangeByID(q.Options, a.OptionOrder[q.ID], func(o AnswerOption) int { return o.ID })
+	}
+	return arranged
+}
+
+// arrangeByID returns a copy of items with those listed in order first, in
+// that order, followed by the rest in their original order
+func arrangeByID[T any](items []T, order []int, id func(T) int) []T {
+	position := make(map[int]int, len(order))
+	for i, itemID := range order {
+		if _, seen := position[itemID]; !seen {
+			position[itemID] = i
+		}
+	}
+
+	arranged := make([]T, len(items))
+	copy(arranged, items)
+	sort.SliceStable(arranged, func(i, j int) bool {
+		pi, iListed := position[id(arranged[i])]
+		pj, jListed := position[id(arranged[j])]
+		if iListed != jListed {
+			return iListed
+		}
+		return iListed && pi < pj
+	})
+	return arranged
+}
+
 // StudentAnswer represents a student's answer to a question
 type StudentAnswer struct {
-	ID               int       `json:"id"`
-	AttemptID        int       `json:"attempt_id"`
-	QuestionID       int       `json:"question_id"`
-	SelectedOptionID *int      `json:"selected_option_id"`
-	IsCorrect        *bool     `json:"is_correct"`
-	AnsweredAt       time.Time `json:"answered_at"`
+	ID                int            `json:"id"`
+	AttemptID         int            `json:"attempt_id"`
+	QuestionID        int            `json:"question_id"`
+	SelectedOptionID  *int           `json:"selected_option_id"`
+	SelectedOptionIDs []int          `json:"selected_option_ids,omitempty"` // multiple_select questions
+	TextAnswer        *string        `json:"text_answer"`                   // raw text typed by the student
+	MatchedAnswer     *string        `json:"matched_answer"`                // short_answer: accepted answer the text matched
+	MatchPairs        map[int]string `json:"match_pairs,omitempty"`         // matching: option ID -> chosen match text
+	IsCorrect         *bool          `json:"is_correct"`
+	Credit            *float64       `json:"credit"` // fraction of the question's points earned (0-1)
+	AnsweredAt        time.Time      `json:"answered_at"`
 
 	// Related data
 	Question       *Question     `json:"question,omitempty"`
 	SelectedOption *AnswerOption `json:"selected_option,omitempty"`
 }
 
+// Correct reports whether the answer was graded fully correct
+func (a *StudentAnswer) Correct() bool {
+	return a != nil && a.IsCorrect != nil && *a.IsCorrect
+}
+
+// CreditPercent returns the share of the question's points earned, as a whole percentage
+func (a *StudentAnswer) CreditPercent() int {
+	if a == nil || a.Credit == nil {
+		if a != nil && a.IsCorrect != nil && *a.IsCorrect {
+			return 100
+		}
+		return 0
+	}
+	return int(math.Round(*a.Credit * 100))
+}
+
+// Text returns the typed answer, or "" when nothing was typed
+func (a *StudentAnswer) Text() string {
+	if a == nil || a.TextAnswer == nil {
+		return ""
+	}
+	return *a.TextAnswer
+}
+
+// Matched returns the accepted answer the typed text matched, or "" when none did
+func (a *StudentAnswer) Matched() string {
+	if a == nil || a.MatchedAnswer == nil {
+		return ""
+	}
+	return *a.MatchedAnswer
+}
+
+// MatchFor returns the match text the student chose for an option of a matching question
+func (a *StudentAnswer) MatchFor(optionID int) string {
+	if a == nil {
+		return ""
+	}
+	return a.MatchPairs[optionID]
+}
+
+// OrderedOptions returns a question's options in the order the student placed
+// them, or nil when the student has not ordered them
+func (a *StudentAnswer) OrderedOptions(q *Question) []AnswerOption {
+	if a == nil || len(a.SelectedOptionIDs) == 0 {
+		return nil
+	}
+	byID := make(map[int]AnswerOption, len(q.Options))
+	for _, opt := range q.Options {
+		byID[opt.ID] = opt
+	}
+	ordered := make([]AnswerOption, 0, len(a.SelectedOptionIDs))
+	for _, id := range a.SelectedOptionIDs {
+		if opt, ok := byID[id]; ok {
+			ordered = append(ordered, opt)
+		}
+	}
+	return ordered
+}
+
+// Answered reports whether the student gave any answer at all
+func (a *StudentAnswer) Answered() bool {
+	if a == nil {
+		return false
+	}
+	return a.SelectedOptionID != nil || len(a.SelectedOptionIDs) > 0 ||
+		strings.TrimSpace(a.Text()) != "" || len(a.MatchPairs) > 0
+}
+
+// HasSelected reports whether the student picked the given option
+func (a *StudentAnswer) HasSelected(optionID int) bool {
+	if a == nil {
+		return false
+	}
+	if a.SelectedOptionID != nil && *a.SelectedOptionID == optionID {
+		return true
+	}
+	for _, id := range a.SelectedOptionIDs {
+		if id == optionID {
+			return true
+		}
+	}
+	return false
+}
+
 // Achievement represents a badge or achievement
 type Achievement struct {
 	ID            int       `json:"id"`
@@ -150,8 +1020,14 @@ type UserStats struct {
 	UpdatedAt      time.Time `json:"updated_at"`
 }
 
-// TestUpload represents the structure for uploading tests via JSON/CSV
+// UploadSchemaVersion is the version of the TestUpload schema this server
+// reads and exports. An upload without a schema_version is read as this one.
+const UploadSchemaVersion = 1
+
+// TestUpload represents the structure for uploading tests via JSON, or a CSV or
+// XLSX sheet mapped into it (see package spreadsheet)
 type TestUpload struct {
+	SchemaVersion    int              `json:"schema_version,omitempty"` // see UploadSchemaVersion
 	Title            string           `json:"title"`
 	Description      string           `json:"description"`
 	Subject          string           `json:"subject"`
@@ -160,14 +1036,328 @@ type TestUpload struct {
 	Difficulty       string           `json:"difficulty"`
 	TimeLimitMinutes int              `json:"time_limit_minutes"`
 	PassingScore     int              `json:"passing_score"`
+	Scoring          *ScoringPolicy   `json:"scoring,omitempty"` // defaults to DefaultScoringPolicy
+	ShuffleQuestions bool             `json:"shuffle_questions,omitempty"`
+	ShuffleOptions   bool             `json:"shuffle_options,omitempty"`
+	AllowPractice    bool             `json:"allow_practice,omitempty"`
+	Attempts         *AttemptPolicy   `json:"attempts,omitempty"`         // defaults to DefaultAttemptPolicy
+	AvailableFrom    string           `json:"available_from,omitempty"`   // in Timezone, see ParseLocalTime
+	AvailableUntil   string           `json:"available_until,omitempty"`  // in Timezone
+	Timezone         string           `json:"timezone,omitempty"`         // defaults to UTC
+	LateSubmission   string           `json:"late_submission,omitempty"`  // defaults to finish
+	Pools            []PoolUpload     `json:"pools,omitempty"`            // questions name their pool; the rest are always asked
+	Sections         []SectionUpload  `json:"sections,omitempty"`         // taken in order; questions name their section, the rest go in the first
+	GradeBoundaries  GradeBoundaries  `json:"grade_boundaries,omitempty"` // overrides the exam standard's boundaries
+	Notes            *FileUpload      `json:"notes,omitempty"`            // PDF or PowerPoint notes for the test
 	Questions        []QuestionUpload `json:"questions"`
 }
 
+// FileUpload is a file carried in an upload, its data base64 encoded in JSON
+type FileUpload struct {
+	Filename string `json:"filename"`
+	Data     []byte `json:"data"`
+}
+
+// PoolUpload declares a question pool and how many of its questions each attempt draws
+type PoolUpload struct {
+	Name string `json:"name"`
+	Draw int    `json:"draw"`
+}
+
+// SectionUpload declares a section of the test, see Section
+type SectionUpload struct {
+	Title            string `json:"title"`
+	Instructions     string `json:"instructions,omitempty"`
+	TimeLimitMinutes int    `json:"time_limit_minutes,omitempty"`
+	NoReturn         bool   `json:"no_return,omitempty"`
+}
+
+// ResolvedScoring returns the uploaded scoring policy, or the default when none was given
+func (u TestUpload) ResolvedScoring() ScoringPolicy {
+	if u.Scoring == nil {
+		return DefaultScoringPolicy()
+	}
+	return *u.Scoring
+}
+
+// ResolvedAttempts returns the uploaded attempt policy, or the default when none was given
+func (u TestUpload) ResolvedAttempts() AttemptPolicy {
+	if u.Attempts == nil {
+		return DefaultAttemptPolicy()
+	}
+	return *u.Attempts
+}
+
+// Upload returns the test in the upload schema, so that uploading it creates
+// the same test. Image URLs are left as the questions have them, and notes
+// are left for the caller to attach.
+func (t *Test) Upload() TestUpload {
+	scoring, attempts := t.Scoring, t.Attempts
+	upload := TestUpload{
+		SchemaVersion:    UploadSchemaVersion,
+		Title:            t.Title,
+		Description:      t.Description,
+		ExamStandard:     t.ExamStandard,
+		Difficulty:       t.Difficulty,
+		TimeLimitMinutes: t.TimeLimitMinutes,
+		PassingScore:     t.PassingScore,
+		Scoring:          &scoring,
+		ShuffleQuestions: t.ShuffleQuestions,
+		ShuffleOptions:   t.ShuffleOptions,
+		AllowPractice:    t.AllowPractice,
+		Attempts:         &attempts,
+		Timezone:         t.Timezone,
+		LateSubmission:   t.LateSubmission,
+		GradeBoundaries:  t.GradeBoundaries,
+		Questions:        make([]QuestionUpload, 0, len(t.Questions)),
+	}
+	if t.Subject != nil {
+		upload.Subject = t.Subject.Name
+	}
+	if t.Topic != nil {
+		upload.Topic = t.Topic.Name
+	}
+	// Seconds are kept so the window reads back exactly
+	if t.AvailableFrom != nil {
+		upload.AvailableFrom = t.AvailableFrom.In(t.Location()).Format(localTimeLayouts[1])
+	}
+	if t.AvailableUntil != nil {
+		upload.AvailableUntil = t.AvailableUntil.In(t.Location()).Format(localTimeLayouts[1])
+	}
+	for _, p := range t.Pools {
+		upload.Pools = append(upload.Pools, PoolUpload{Name: p.Name, Draw: p.DrawCount})
+	}
+	for _, s := range t.Sections {
+		upload.Sections = append(upload.Sections, SectionUpload{
+			Title: s.Title, Instructions: s.Instructions, TimeLimitMinutes: s.TimeLimitMinutes, NoReturn: s.NoReturn,
+		})
+	}
+	for i := range t.Questions {
+		upload.Questions = append(upload.Questions, t.Questions[i].upload(t))
+	}
+	return upload
+}
+
+// upload returns the question, of test t, in the upload schema
+func (q *Question) upload(t *Test) QuestionUpload {
+	upload := QuestionUpload{
+		QuestionText:    q.QuestionText,
+		QuestionType:    q.QuestionType,
+		ScoringRule:     q.ScoringRule,
+		Points:          q.Points,
+		KeepOptionOrder: q.KeepOptionOrder,
+		Explanation:     q.Explanation,
+		CaseSensitive:   q.CaseSensitive,
+		TypoTolerance:   q.TypoTolerance,
+	}
+	if q.ImageURL != nil {
+		upload.ImageURL = *q.ImageURL
+	}
+	if q.ExplanationImageURL != nil {
+		upload.ExplanationImageURL = *q.ExplanationImageURL
+	}
+	if pool := t.Pool(q.PoolID); pool != nil {
+		upload.Pool = pool.Name
+	}
+	if section := t.Section(q.SectionID); section != nil {
+		upload.Section = section.Title
+	}
+	if q.Numeric != nil {
+		numeric := *q.Numeric
+		upload.Numeric = &numeric
+	}
+
+	// Options are uploaded in the order they are stored, which for ordering
+	// questions is the correct order
+	options := q.CorrectOrder()
+	hasRationale := false
+	for i, o := range options {
+		if q.QuestionType == QuestionTypeMatching {
+			upload.Pairs = append(upload.Pairs, MatchPair{Prompt: o.OptionText, Match: o.MatchText})
+		} else {
+			upload.Options = append(upload.Options, o.OptionText)
+		}
+		if o.IsCorrect {
+			if q.QuestionType == QuestionTypeMultipleSelect {
+				upload.CorrectIndices = append(upload.CorrectIndices, i)
+			} else {
+				upload.CorrectIndex = i
+			}
+		}
+		upload.Rationales = append(upload.Rationales, o.Rationale)
+		hasRationale = hasRationale || o.Rationale != ""
+	}
+	if !hasRationale {
+		upload.Rationales = nil
+	}
+
+	for _, a := range q.AcceptedAnswers {
+		if a.IsRegex {
+			upload.AcceptedPatterns = append(upload.AcceptedPatterns, a.AnswerText)
+		} else {
+			upload.AcceptedAnswers = append(upload.AcceptedAnswers, a.AnswerText)
+		}
+	}
+	for _, h := range q.Hints {
+		upload.Hints = append(upload.Hints, HintUpload{Text: h.HintText, Penalty: h.Penalty})
+	}
+	return upload
+}
+
 // QuestionUpload represents a question for upload
 type QuestionUpload struct {
-	QuestionText string   `json:"question_text"`
-	ImageURL     string   `json:"image_url,omitempty"`
-	Points       int      `json:"points"`
-	Options      []string `json:"options"`       // Array of 4 options
-	CorrectIndex int      `json:"correct_index"` // 0-3, which option is correct
+	QuestionText        string   `json:"question_text"`
+	QuestionType        string   `json:"question_type,omitempty"` // single_choice (default), multiple_select, true_false, numeric, short_answer, ordering, matching
+	ScoringRule         string   `json:"scoring_rule,omitempty"`  // all_or_nothing (default) or partial
+	ImageURL            string   `json:"image_url,omitempty"`
+	Points              int      `json:"points"`
+	Options             []string `json:"options"`                     // 2 to 8 options; may be omitted for true_false
+	CorrectIndex        int      `json:"correct_index"`               // which option is correct (true_false: 0 = True, 1 = False)
+	CorrectIndices      []int    `json:"correct_indices,omitempty"`   // multiple_select: every correct option
+	KeepOptionOrder     bool     `json:"keep_option_order,omitempty"` // never shuffle this question's options
+	Pool                string   `json:"pool,omitempty"`              // name of the pool the question is drawn from
+	Section             string   `json:"section,omitempty"`           // title of the section the question is asked in
+	Explanation         string   `json:"explanation,omitempty"`       // worked solution, shown once the question is answered
+	ExplanationImageURL string   `json:"explanation_image_url,omitempty"`
+	Rationales          []string `json:"rationales,omitempty"` // per option, in the same order as options (or pairs)
+
+	Numeric *NumericAnswer `json:"numeric,omitempty"` // numeric: expected value, tolerance, sig figs and units
+
+	AcceptedAnswers  []string `json:"accepted_answers,omitempty"`  // short_answer: literal answers
+	AcceptedPatterns []string `json:"accepted_patterns,omitempty"` // short_answer: regex patterns matched against the whole answer
+	CaseSensitive    bool     `json:"case_sensitive,omitempty"`    // short_answer: match case exactly
+	TypoTolerance    int      `json:"typo_tolerance,omitempty"`    // short_answer: edits allowed against a literal answer
+
+	Pairs []MatchPair `json:"pairs,omitempty"` // matching: each prompt and the text it pairs with
+
+	Hints []HintUpload `json:"hints,omitempty"` // revealed in order during an attempt
+}
+
+// HintUpload is one hint of an uploaded question, given either as its text or
+// as an object with the text and its own penalty
+type HintUpload struct {
+	Text    string   `json:"text"`
+	Penalty *float64 `json:"penalty,omitempty"`
+}
+
+// UnmarshalJSON accepts a plain string as a hint with the test's penalty
+func (h *HintUpload) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*h = HintUpload{Text: text}
+		return nil
+	}
+	type plain HintUpload
+	return json.Unmarshal(data, (*plain)(h))
+}
+
+// ResolvedHints returns the question's hints in the order they are revealed
+func (q QuestionUpload) ResolvedHints() []Hint {
+	hints := make([]Hint, 0, len(q.Hints))
+	for i, h := range q.Hints {
+		hints = append(hints, Hint{HintText: strings.TrimSpace(h.Text), Penalty: h.Penalty, HintOrder: i + 1})
+	}
+	return hints
+}
+
+// MatchPair is one prompt of an uploaded matching question and its match
+type MatchPair struct {
+	Prompt string `json:"prompt"`
+	Match  string `json:"match"`
+}
+
+// ResolvedType returns the question type, inferring multiple_select from correct_indices,
+// numeric from a numeric answer key, short_answer from accepted answers and matching from pairs
+func (q QuestionUpload) ResolvedType() string {
+	if q.QuestionType != "" {
+		return q.QuestionType
+	}
+	if len(q.CorrectIndices) > 0 {
+		return QuestionTypeMultipleSelect
+	}
+	if q.Numeric != nil {
+		return QuestionTypeNumeric
+	}
+	if len(q.AcceptedAnswers) > 0 || len(q.AcceptedPatterns) > 0 {
+		return QuestionTypeShortAnswer
+	}
+	if len(q.Pairs) > 0 {
+		return QuestionTypeMatching
+	}
+	return QuestionTypeSingleChoice
+}
+
+// ResolvedOptions returns the option texts, supplying True/False for true_false questions
+// and the prompts of matching questions
+func (q QuestionUpload) ResolvedOptions() []string {
+	switch q.ResolvedType() {
+	case QuestionTypeTrueFalse:
+		if len(q.Options) == 0 {
+			return TrueFalseOptions
+		}
+	case QuestionTypeMatching:
+		prompts := make([]string, 0, len(q.Pairs))
+		for _, pair := range q.Pairs {
+			prompts = append(prompts, pair.Prompt)
+		}
+		return prompts
+	}
+	return q.Options
+}
+
+// MatchTextFor returns the match of the option at index i of a matching question
+func (q QuestionUpload) MatchTextFor(i int) string {
+	if q.ResolvedType() != QuestionTypeMatching || i < 0 || i >= len(q.Pairs) {
+		return ""
+	}
+	return q.Pairs[i].Match
+}
+
+// RationaleFor returns the rationale of the option at index i, if one was given
+func (q QuestionUpload) RationaleFor(i int) string {
+	if i < 0 || i >= len(q.Rationales) {
+		return ""
+	}
+	return q.Rationales[i]
+}
+
+// ResolvedScoringRule returns the scoring rule, defaulting to partial credit for
+// ordering and matching questions and all_or_nothing for everything else
+func (q QuestionUpload) ResolvedScoringRule() string {
+	if q.ScoringRule != "" {
+		return q.ScoringRule
+	}
+	switch q.ResolvedType() {
+	case QuestionTypeOrdering, QuestionTypeMatching:
+		return ScoringPartial
+	}
+	return ScoringAllOrNothing
+}
+
+// ResolvedAcceptedAnswers combines literal answers and patterns into accepted answers
+func (q QuestionUpload) ResolvedAcceptedAnswers() []AcceptedAnswer {
+	accepted := make([]AcceptedAnswer, 0, len(q.AcceptedAnswers)+len(q.AcceptedPatterns))
+	for _, text := range q.AcceptedAnswers {
+		accepted = append(accepted, AcceptedAnswer{AnswerText: text})
+	}
+	for _, pattern := range q.AcceptedPatterns {
+		accepted = append(accepted, AcceptedAnswer{AnswerText: pattern, IsRegex: true})
+	}
+	return accepted
+}
+
+// IsCorrectOption reports whether the option at index i is marked correct
+func (q QuestionUpload) IsCorrectOption(i int) bool {
+	switch q.ResolvedType() {
+	case QuestionTypeOrdering, QuestionTypeMatching:
+		return false // graded by position or pairing, not by marked options
+	case QuestionTypeMultipleSelect:
+		for _, idx := range q.CorrectIndices {
+			if idx == i {
+				return true
+			}
+		}
+		return false
+	}
+	return i == q.CorrectIndex
 }
@@ -0,0 +1,279 @@
+package models
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTestAttemptTimeUp(t *testing.T) {
+	start := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	deadline := start.Add(10 * time.Minute)
+	attempt := &TestAttempt{StartedAt: start, Deadline: &deadline}
+
+	if got := attempt.SecondsLeft(start.Add(9 * time.Minute)); got != 60 {
+		t.Fatalf("expected 60 seconds left, got %d", got)
+	}
+	if got := attempt.SecondsLeft(deadline.Add(time.Second)); got != 0 {
+		t.Fatalf("expected no time left after the deadline, got %d", got)
+	}
+
+	if attempt.TimeUp(deadline.Add(SubmissionGrace)) {
+		t.Fatalf("expected answers to be accepted until the grace period ends")
+	}
+	if !attempt.TimeUp(deadline.Add(SubmissionGrace + time.Second)) {
+		t.Fatalf("expected time to be up once the grace period has passed")
+	}
+
+	if (&TestAttempt{}).TimeUp(deadline.Add(time.Hour)) {
+		t.Fatalf("expected an attempt without a deadline never to time out")
+	}
+}
+
+func TestTestAvailabilityWindow(t *testing.T) {
+	opens, err := ParseLocalTime("2025-06-02T09:00", "Europe/London")
+	if err != nil || !opens.Equal(time.Date(2025, 6, 2, 8, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected 9am London summer time to be 8am UTC, got %v, %v", opens, err)
+	}
+	if ts, err := ParseLocalTime(" ", "Europe/London"); ts != nil || err != nil {
+		t.Fatalf("expected a blank time to parse as nil, got %v, %v", ts, err)
+	}
+	if _, err := ParseLocalTime("2 June", "Europe/London"); err == nil {
+		t.Fatalf("expected an unparseable time to be reported")
+	}
+
+	closes := opens.Add(2 * time.Hour)
+	test := &Test{TimeLimitMinutes: 60, AvailableFrom: opens, AvailableUntil: &closes, Timezone: "Europe/London"}
+	if !test.NotYetOpen(opens.Add(-time.Minute)) || test.NotYetOpen(*opens) || test.Closed(closes.Add(-time.Minute)) || !test.Closed(closes) {
+		t.Fatalf("expected the window to run from opening until closing")
+	}
+	if got := test.LocalInput(opens); got != "2025-06-02T09:00" {
+		t.Fatalf("expected the opening time in London time, got %q", got)
+	}
+
+	late := closes.Add(-30 * time.Minute)
+	if got := test.AttemptDeadline(late); !got.Equal(late.Add(time.Hour)) {
+		t.Fatalf("expected a late attempt to run to its time limit, got %v", got)
+	}
+	test.LateSubmission = LateSubmissionCutOff
+	if got := test.AttemptDeadline(late); !got.Equal(closes) {
+		t.Fatalf("expected a late attempt to be cut off when the window closes, got %v", got)
+	}
+	if got := test.AttemptDeadline(*opens); !got.Equal(opens.Add(time.Hour)) {
+		t.Fatalf("expected an early attempt to keep its full time limit, got %v", got)
+	}
+}
+
+func TestGradeBoundaries(t *testing.T) {
+	boundaries := GradeBoundaries{{Grade: "B", MinPercent: 60}, {Grade: "A*", MinPercent: 80}, {Grade: "A", MinPercent: 70}}
+
+	for percent, want := range map[float64]string{100: "A*", 80: "A*", 79.9: "A", 60: "B", 59.5: ""} {
+		if got := boundaries.Grade(percent); got != want {
+			t.Fatalf("expected %v%% to earn %q, got %q", percent, want, got)
+		}
+	}
+	if got := boundaries.GradeFor(7, 10); got == nil || *got != "A" {
+		t.Fatalf("expected 7/10 to earn an A, got %v", got)
+	}
+	if boundaries.GradeFor(1, 10) != nil || boundaries.GradeFor(0, 0) != nil {
+		t.Fatal("expected no grade below every boundary or without a total")
+	}
+	if got := boundaries.Summary(); got != "A* 80%, A 70%, B 60%" {
+		t.Fatalf("expected boundaries listed highest first, got %q", got)
+	}
+	if boundaries[0].Grade != "B" {
+		t.Fatal("expected sorting to leave the set unchanged")
+	}
+}
+
+func TestAttemptPolicyCountedPercentage(t *testing.T) {
+	completed := func(score, total int, at time.Time) TestAttempt {
+		return TestAttempt{Status: "completed", CompletedAt: &at, Score: &score, TotalPoints: &total}
+	}
+	start := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	attempts := []TestAttempt{
+		completed(8, 10, start),
+		completed(4, 10, start.Add(2*time.Hour)),
+		completed(6, 10, start.Add(time.Hour)),
+		{Status: "in_progress", StartedAt: start.Add(3 * time.Hour)},
+	}
+	practice := completed(10, 10, start.Add(4*time.Hour))
+	practice.Practice = true
+	attempts = append(attempts, practice)
+
+	for counts, want := range map[string]float64{CountBestAttempt: 80, CountLatestAttempt: 40, CountAverageAttempt: 60} {
+		got, ok := AttemptPolicy{Counts: counts}.CountedPercentage(attempts)
+		if !ok || got != want {
+			t.Fatalf("%s: expected %.0f%%, got %.1f%% (ok %v)", counts, want, got, ok)
+		}
+	}
+
+	if _, ok := DefaultAttemptPolicy().CountedPercentage(attempts[3:]); ok {
+		t.Fatalf("expected no result without a completed attempt")
+	}
+}
+
+func TestTestSections(t *testing.T) {
+	first, second := 1, 2
+	test := &Test{
+		Sections:  []Section{{ID: first, Title: "A"}, {ID: second, Title: "B", TimeLimitMinutes: 5}},
+		Questions: []Question{{ID: 10, SectionID: &second}, {ID: 20}, {ID: 30, SectionID: &second}, {ID: 40, SectionID: &first}},
+	}
+
+	test.GroupBySection()
+	var order []int
+	for _, q := range test.Questions {
+		order = append(order, q.ID)
+	}
+	if !slices.Equal(order, []int{20, 40, 10, 30}) {
+		t.Fatalf("expected unassigned questions in the first section and order kept within sections, got %v", order)
+	}
+	if got := test.SectionQuestions(second); len(got) != 2 || got[0].ID != 10 {
+		t.Fatalf("expected section B's two questions, got %v", got)
+	}
+
+	start := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	b := &test.Sections[1]
+	attempt := &TestAttempt{SectionStarts: map[int]time.Time{second: start}}
+	if d := attempt.SectionDeadline(b); d == nil || !d.Equal(start.Add(5*time.Minute)) {
+		t.Fatalf("expected the section to run out 5 minutes after it was entered, got %v", d)
+	}
+	if attempt.SectionOpen(b, start.Add(5*time.Minute)) || attempt.SectionTimeUp(b, start.Add(5*time.Minute)) {
+		t.Fatal("expected the section closed at its deadline but still taking answers in the grace period")
+	}
+	if attempt.SectionDeadline(&test.Sections[0]) != nil {
+		t.Fatal("expected no deadline for a section without a time limit")
+	}
+	attempt.Practice = true
+	if attempt.SectionDeadline(b) != nil {
+		t.Fatal("expected practice attempts to be untimed")
+	}
+}
+
+func TestTestContentRoundTrip(t *testing.T) {
+	expected := 2.5
+	pool := 3
+	test := &Test{
+		ID: 1, Title: "Forces", Published: true, UpdatedAt: time.Now(),
+		Scoring:       ScoringPolicy{WrongPenalty: 0.25},
+		Prerequisites: []Prerequisite{{Kind: PrerequisitePassed}},
+		Questions: []Question{
+			{ID: 10, QuestionType: QuestionTypeSingleChoice, PoolID: &pool, Options: []AnswerOption{{ID: 1, OptionText: "a", IsCorrect: true}, {ID: 2, OptionText: "b"}}},
+			{ID: 11, QuestionType: QuestionTypeNumeric, Numeric: &NumericAnswer{Expected: expected, Units: []string{"N"}}},
+		},
+	}
+
+	data, err := json.Marshal(test.Content())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Test
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+
+	if saved.Published || !saved.UpdatedAt.IsZero() || saved.Prerequisites != nil {
+		t.Fatalf("expected publishing state, edit time and prerequisites left out, got %+v", saved)
+	}
+	if saved.Scoring.FloorAtZero || saved.Scoring.WrongPenalty != 0.25 {
+		t.Fatalf("expected the scoring policy kept as set, got %+v", saved.Scoring)
+	}
+	if !saved.Questions[0].Options[0].IsCorrect || saved.Questions[0].Options[1].IsCorrect || *saved.Questions[0].PoolID != pool {
+		t.Fatalf("expected the answer key and pool kept, got %+v", saved.Questions[0])
+	}
+	if n := saved.Questions[1].Numeric; n == nil || n.Expected != expected || n.Units[0] != "N" {
+		t.Fatalf("expected the numeric answer kept, got %+v", n)
+	}
+	if !test.Published || test.Prerequisites == nil {
+		t.Fatal("expected the test itself left unchanged")
+	}
+}
+
+func TestTestUpload(t *testing.T) {
+	pool, section := 3, 4
+	penalty := 0.5
+	image := "/assets/uploads/9/question_1.png"
+	london, _ := time.LoadLocation("Europe/London")
+	opens := time.Date(2025, 6, 1, 9, 0, 30, 0, london)
+	test := &Test{
+		Title: "Forces", Description: "Newton's laws", ExamStandard: "GCSE", Difficulty: "Medium",
+		TimeLimitMinutes: 20, PassingScore: 60,
+		Scoring:  ScoringPolicy{WrongPenalty: 0.25, FloorAtZero: true},
+		Attempts: AttemptPolicy{MaxAttempts: 2, Counts: CountLatestAttempt},
+		Timezone: "Europe/London", AvailableFrom: &opens, LateSubmission: "finish",
+		ShuffleOptions: true,
+		Subject:        &Subject{Name: "Physics"}, Topic: &Topic{Name: "Mechanics"},
+		Pools:           []QuestionPool{{ID: pool, Name: "Units", DrawCount: 1}},
+		Sections:        []Section{{ID: section, Title: "Part A", NoReturn: true}},
+		GradeBoundaries: GradeBoundaries{{Grade: "A", MinPercent: 80}},
+		Questions: []Question{
+			{QuestionText: "Unit of force?", QuestionType: QuestionTypeSingleChoice, ScoringRule: ScoringAllOrNothing, Points: 1,
+				ImageURL: &image, PoolID: &pool, SectionID: &section,
+				Options: []AnswerOption{{OptionText: "Joule", Rationale: "That is energy", OptionOrder: 1}, {OptionText: "Newton", IsCorrect: true, OptionOrder: 2}},
+				Hints:   []Hint{{HintText: "Think of apples", Penalty: &penalty}}},
+			{QuestionText: "Vectors?", QuestionType: QuestionTypeMultipleSelect, ScoringRule: ScoringPartial, Points: 2,
+				Options: []AnswerOption{{OptionText: "Velocity", IsCorrect: true, OptionOrder: 1}, {OptionText: "Speed", OptionOrder: 2}, {OptionText: "Force", IsCorrect: true, OptionOrder: 3}}},
+			{QuestionText: "Smallest first", QuestionType: QuestionTypeOrdering, ScoringRule: ScoringPartial, Points: 1,
+				Options: []AnswerOption{{OptionText: "Cell", OptionOrder: 2}, {OptionText: "Atom", OptionOrder: 1}}},
+			{QuestionText: "Match", QuestionType: QuestionTypeMatching, ScoringRule: ScoringPartial, Points: 2,
+				Options: []AnswerOption{{OptionText: "Force", MatchText: "N", OptionOrder: 1}, {OptionText: "Energy", MatchText: "J", OptionOrder: 2}}},
+			{QuestionText: "Second law?", QuestionType: QuestionTypeShortAnswer, ScoringRule: ScoringAllOrNothing, Points: 1, TypoTolerance: 1,
+				AcceptedAnswers: []AcceptedAnswer{{AnswerText: "F = ma"}, {AnswerText: "f ?= ?ma", IsRegex: true}}},
+			{QuestionText: "2 kg at 3 m/s²?", QuestionType: QuestionTypeNumeric, ScoringRule: ScoringAllOrNothing, Points: 1,
+				Numeric: &NumericAnswer{Expected: 6, Tolerance: 5, ToleranceType: TolerancePercent, Units: []string{"N"}}},
+		},
+	}
+
+	want := TestUpload{
+		SchemaVersion: UploadSchemaVersion,
+		Title:         "Forces", Description: "Newton's laws", Subject: "Physics", Topic: "Mechanics",
+		ExamStandard: "GCSE", Difficulty: "Medium", TimeLimitMinutes: 20, PassingScore: 60,
+		Scoring:  &ScoringPolicy{WrongPenalty: 0.25, FloorAtZero: true},
+		Attempts: &AttemptPolicy{MaxAttempts: 2, Counts: CountLatestAttempt},
+		Timezone: "Europe/London", AvailableFrom: "2025-06-01T09:00:30", LateSubmission: "finish",
+		ShuffleOptions:  true,
+		Pools:           []PoolUpload{{Name: "Units", Draw: 1}},
+		Sections:        []SectionUpload{{Title: "Part A", NoReturn: true}},
+		GradeBoundaries: GradeBoundaries{{Grade: "A", MinPercent: 80}},
+		Questions: []QuestionUpload{
+			{QuestionText: "Unit of force?", QuestionType: QuestionTypeSingleChoice, ScoringRule: ScoringAllOrNothing, Points: 1,
+				ImageURL: image, Pool: "Units", Section: "Part A",
+				Options: []string{"Joule", "Newton"}, CorrectIndex: 1, Rationales: []string{"That is energy", ""},
+				Hints: []HintUpload{{Text: "Think of apples", Penalty: &penalty}}},
+			{QuestionText: "Vectors?", QuestionType: QuestionTypeMultipleSelect, ScoringRule: ScoringPartial, Points: 2,
+				Options: []string{"Velocity", "Speed", "Force"}, CorrectIndices: []int{0, 2}},
+			{QuestionText: "Smallest first", QuestionType: QuestionTypeOrdering, ScoringRule: ScoringPartial, Points: 1,
+				Options: []string{"Atom", "Cell"}},
+			{QuestionText: "Match", QuestionType: QuestionTypeMatching, ScoringRule: ScoringPartial, Points: 2,
+				Pairs: []MatchPair{{Prompt: "Force", Match: "N"}, {Prompt: "Energy", Match: "J"}}},
+			{QuestionText: "Second law?", QuestionType: QuestionTypeShortAnswer, ScoringRule: ScoringAllOrNothing, Points: 1, TypoTolerance: 1,
+				AcceptedAnswers: []string{"F = ma"}, AcceptedPatterns: []string{"f ?= ?ma"}},
+			{QuestionText: "2 kg at 3 m/s²?", QuestionType: QuestionTypeNumeric, ScoringRule: ScoringAllOrNothing, Points: 1,
+				Numeric: &NumericAnswer{Expected: 6, Tolerance: 5, ToleranceType: TolerancePercent, Units: []string{"N"}}},
+		},
+	}
+
+	got, err := json.Marshal(test.Upload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := json.Marshal(want)
+	if string(got) != string(expected) {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+
+	// What the upload says reads back as the test it came from
+	upload := test.Upload()
+	from, err := ParseLocalTime(upload.AvailableFrom, upload.Timezone)
+	if err != nil || !from.Equal(opens) {
+		t.Errorf("expected the window to read back as %v, got %v (%v)", opens, from, err)
+	}
+	for i, q := range upload.Questions {
+		for j, o := range test.Questions[i].CorrectOrder() {
+			if q.IsCorrectOption(j) != o.IsCorrect || q.MatchTextFor(j) != o.MatchText || q.RationaleFor(j) != o.Rationale {
+				t.Errorf("question %d option %d: does not read back as %+v", i+1, j+1, o)
+			}
+		}
+	}
+}
@@ -0,0 +1,506 @@
+package moodle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"my-app/internal/models"
+)
+
+// ReadGIFT reads questions written in GIFT. Each question is a block of
+// lines ending at a blank line; "$CATEGORY:" lines file the questions after
+// them, and lines starting "//" are comments.
+func ReadGIFT(text string) *Bank {
+	bank := &Bank{}
+	category := ""
+	text = strings.TrimPrefix(strings.ReplaceAll(text, "\r\n", "\n"), "\ufeff")
+	for _, block := range giftBlocks(text) {
+		if rest, ok := strings.CutPrefix(block, "$CATEGORY:"); ok {
+			line, question, _ := strings.Cut(rest, "\n")
+			category = strings.TrimSpace(line)
+			if block = strings.TrimSpace(question); block == "" {
+				continue
+			}
+		}
+
+		name, q, warning, problem := readGIFTQuestion(block)
+		who := label(name, q.QuestionText)
+		if problem != "" {
+			bank.Skipped = append(bank.Skipped, Report{Question: who, Problem: problem})
+			continue
+		}
+		if warning != "" {
+			bank.Warnings = append(bank.Warnings, Report{Question: who, Problem: warning})
+		}
+		bank.Questions = append(bank.Questions, Question{Name: name, Category: category, Upload: q})
+	}
+	return bank
+}
+
+// giftBlocks splits GIFT into its questions, dropping comments
+func giftBlocks(text string) []string {
+	var blocks []string
+	var block []string
+	flush := func() {
+		if len(block) > 0 {
+			blocks = append(blocks, strings.Join(block, "\n"))
+			block = nil
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "//"):
+		default:
+			block = append(block, trimmed)
+		}
+	}
+	flush()
+	return blocks
+}
+
+// giftAnswer is one answer of a GIFT question: "=" marks it right and "~"
+// wrong, unless a weight such as "%50%" gives its share of the marks
+type giftAnswer struct {
+	right    bool
+	weight   *float64
+	text     string
+	feedback string
+}
+
+func (a giftAnswer) correct() bool {
+	if a.weight != nil {
+		return *a.weight > 0
+	}
+	return a.right
+}
+
+func (a giftAnswer) fullMarks() bool {
+	return a.weight == nil && a.right || a.weight != nil && *a.weight >= 100
+}
+
+// readGIFTQuestion reads one question. It returns why the question cannot be
+// read instead when it cannot, and what was left out of it when something was.
+func readGIFTQuestion(block string) (name string, q models.QuestionUpload, warning, problem string) {
+	if rest, ok := strings.CutPrefix(block, "::"); ok {
+		if end := indexUnescaped(rest, "::"); end >= 0 {
+			name = giftUnescape(rest[:end])
+			block = strings.TrimSpace(rest[end+2:])
+		}
+	}
+	format := ""
+	if strings.HasPrefix(block, "[") {
+		if end := strings.Index(block, "]"); end > 0 && end < 12 {
+			format, block = block[1:end], strings.TrimSpace(block[end+1:])
+		}
+	}
+
+	open := indexUnescaped(block, "{")
+	if open < 0 {
+		q.QuestionText = giftText(block, format)
+		return name, q, "", "is a description, with no answer to mark"
+	}
+	closing := indexUnescaped(block[open:], "}")
+	if closing < 0 {
+		q.QuestionText = giftText(block[:open], format)
+		return name, q, "", "has an answer block that is never closed"
+	}
+	closing += open
+	q.QuestionText = giftText(block[:open], format)
+	if after := strings.TrimSpace(block[closing+1:]); after != "" {
+		// A missing word question: the answer fills the gap
+		q.QuestionText = giftText(block[:open]+" _____ "+after, format)
+	}
+	if q.QuestionText == "" {
+		q.QuestionText = name
+	}
+	q.Points = 1
+
+	answers, general := block[open+1:closing], ""
+	if i := indexUnescaped(answers, "####"); i >= 0 {
+		answers, general = answers[:i], giftText(answers[i+4:], format)
+	}
+	answers = strings.TrimSpace(answers)
+
+	switch {
+	case answers == "":
+		return name, q, "", "is an essay question, with no answer to mark"
+
+	case strings.HasPrefix(answers, "#"):
+		numeric, feedback, problem := readGIFTNumber(strings.TrimSpace(answers[1:]))
+		if problem != "" {
+			return name, q, "", problem
+		}
+		q.QuestionType = models.QuestionTypeNumeric
+		q.Numeric = numeric
+		feedbackFor(&q, general, []string{giftText(feedback, format)}, func(int) bool { return true })
+		return name, q, "", ""
+	}
+
+	parts := splitUnescaped(answers, "#")
+	switch strings.ToUpper(strings.TrimSpace(parts[0])) {
+	case "T", "TRUE", "F", "FALSE":
+		q.QuestionType = models.QuestionTypeTrueFalse
+		q.CorrectIndex = 0
+		if value := strings.ToUpper(strings.TrimSpace(parts[0])); value[0] == 'F' {
+			q.CorrectIndex = 1
+		}
+		// The first feedback is shown for a wrong answer, the second for a right one
+		feedback := make([]string, 2)
+		if len(parts) > 1 {
+			feedback[1-q.CorrectIndex] = giftText(parts[1], format)
+		}
+		if len(parts) > 2 {
+			feedback[q.CorrectIndex] = giftText(parts[2], format)
+		}
+		feedbackFor(&q, general, feedback, func(i int) bool { return i == q.CorrectIndex })
+		return name, q, "", ""
+	}
+
+	items := readGIFTAnswers(answers, format)
+	if len(items) == 0 {
+		return name, q, "", "has no answers"
+	}
+	anyWrong, anyMatch := false, false
+	for _, item := range items {
+		anyWrong = anyWrong || !item.right
+		anyMatch = anyMatch || indexUnescaped(item.text, "->") >= 0
+	}
+
+	var feedback []string
+	for _, item := range items {
+		feedback = append(feedback, giftText(item.feedback, format))
+	}
+
+	switch {
+	case anyMatch && !anyWrong:
+		q.QuestionType = models.QuestionTypeMatching
+		distractors := 0
+		for _, item := range items {
+			arrow := indexUnescaped(item.text, "->")
+			if arrow < 0 {
+				return name, q, "", "mixes matching pairs with other answers"
+			}
+			prompt, match := giftText(item.text[:arrow], format), giftText(item.text[arrow+2:], format)
+			if prompt == "" {
+				distractors++
+				continue
+			}
+			q.Pairs = append(q.Pairs, models.MatchPair{Prompt: prompt, Match: match})
+		}
+		q.Explanation = general
+		if distractors > 0 {
+			warning = fmt.Sprintf("left out %d extra answers that match no prompt", distractors)
+		}
+		return name, q, warning, ""
+
+	case !anyWrong:
+		q.QuestionType = models.QuestionTypeShortAnswer
+		partial := 0
+		for _, item := range items {
+			if !item.fullMarks() {
+				partial++
+				continue
+			}
+			q.AcceptedAnswers = append(q.AcceptedAnswers, item.text)
+		}
+		if len(q.AcceptedAnswers) == 0 {
+			return name, q, "", "has no answer worth full marks"
+		}
+		if partial > 0 {
+			warning = fmt.Sprintf("left out %d answers worth part marks", partial)
+		}
+		feedbackFor(&q, general, feedback, func(i int) bool { return items[i].fullMarks() })
+		q.Rationales = nil
+		return name, q, warning, ""
+	}
+
+	var correct []int
+	for i, item := range items {
+		q.Options = append(q.Options, item.text)
+		if item.correct() {
+			correct = append(correct, i)
+		}
+	}
+	switch {
+	case len(correct) == 0:
+		return name, q, "", "has no correct answer"
+	case len(correct) == 1 && items[correct[0]].fullMarks():
+		q.QuestionType = models.QuestionTypeSingleChoice
+		q.CorrectIndex = correct[0]
+	default:
+		q.QuestionType = models.QuestionTypeMultipleSelect
+		q.CorrectIndices = correct
+	}
+	feedbackFor(&q, general, feedback, func(i int) bool { return items[i].correct() })
+	return name, q, "", ""
+}
+
+// readGIFTAnswers splits an answer block into its answers, each starting
+// with "=" or "~"
+func readGIFTAnswers(answers, format string) []giftAnswer {
+	var items []giftAnswer
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		raw := answers[start:end]
+		item := giftAnswer{right: raw[0] == '='}
+		raw = strings.TrimSpace(raw[1:])
+		if rest, ok := strings.CutPrefix(raw, "%"); ok {
+			if end := strings.Index(rest, "%"); end >= 0 {
+				if w, err := strconv.ParseFloat(rest[:end], 64); err == nil {
+					item.weight = &w
+					raw = rest[end+1:]
+				}
+			}
+		}
+		if i := indexUnescaped(raw, "#"); i >= 0 {
+			raw, item.feedback = raw[:i], raw[i+1:]
+		}
+		// Matching pairs keep their arrow escaped until they are split
+		if indexUnescaped(raw, "->") >= 0 {
+			item.text = strings.TrimSpace(raw)
+		} else {
+			item.text = giftText(raw, format)
+		}
+		items = append(items, item)
+	}
+	for i := 0; i < len(answers); i++ {
+		switch answers[i] {
+		case '\\':
+			i++
+		case '=', '~':
+			flush(i)
+			start = i
+		}
+	}
+	flush(len(answers))
+	return items
+}
+
+// readGIFTNumber reads a numerical answer: "3.14:0.01" for a value and its
+// tolerance, "3..4" for a range, or several answers starting with "=", of
+// which the first worth full marks is taken
+func readGIFTNumber(spec string) (*models.NumericAnswer, string, string) {
+	feedback := ""
+	if strings.HasPrefix(spec, "=") {
+		var found bool
+		for _, item := range readGIFTAnswers(spec, "") {
+			if item.fullMarks() {
+				spec, feedback, found = item.text, item.feedback, true
+				break
+			}
+		}
+		if !found {
+			return nil, "", "has no numerical answer worth full marks"
+		}
+	} else if i := indexUnescaped(spec, "#"); i >= 0 {
+		spec, feedback = spec[:i], spec[i+1:]
+	}
+	spec = strings.TrimSpace(giftUnescape(spec))
+
+	answer := &models.NumericAnswer{ToleranceType: models.ToleranceAbsolute}
+	if low, high, ok := strings.Cut(spec, ".."); ok {
+		l, err1 := strconv.ParseFloat(strings.TrimSpace(low), 64)
+		h, err2 := strconv.ParseFloat(strings.TrimSpace(high), 64)
+		if err1 != nil || err2 != nil || h < l {
+			return nil, "", fmt.Sprintf("has a numerical range %q that cannot be read", spec)
+		}
+		answer.Expected, answer.Tolerance = (l+h)/2, (h-l)/2
+		return answer, feedback, ""
+	}
+	value, tolerance, _ := strings.Cut(spec, ":")
+	expected, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return nil, "", fmt.Sprintf("has a numerical answer %q that is not a number", spec)
+	}
+	answer.Expected = expected
+	if tolerance != "" {
+		if answer.Tolerance, err = strconv.ParseFloat(strings.TrimSpace(tolerance), 64); err != nil || answer.Tolerance < 0 {
+			return nil, "", fmt.Sprintf("has a tolerance %q that is not a number", tolerance)
+		}
+	}
+	return answer, feedback, ""
+}
+
+// giftText reads text of a question in the format given: HTML has its tags
+// dropped, and other formats are read as plain text
+func giftText(text, format string) string {
+	text = strings.ReplaceAll(text, "\n", " ")
+	if strings.EqualFold(format, "html") {
+		return htmlText(giftUnescape(text))
+	}
+	return plainLines(giftUnescape(text))
+}
+
+// giftUnescape removes GIFT's backslash escapes, "\n" being a line break
+func giftUnescape(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) {
+			i++
+			if text[i] == 'n' {
+				b.WriteByte('\n')
+				continue
+			}
+		}
+		b.WriteByte(text[i])
+	}
+	return b.String()
+}
+
+// giftEscape escapes the characters GIFT gives a meaning to
+func giftEscape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch r {
+		case '~', '=', '#', '{', '}', ':', '\\':
+			b.WriteByte('\\')
+		case '\n':
+			b.WriteString(`\n`)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// indexUnescaped finds sep in s outside backslash escapes, or returns -1
+func indexUnescaped(s, sep string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], sep) {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitUnescaped splits s at each sep outside backslash escapes
+func splitUnescaped(s, sep string) []string {
+	var parts []string
+	for {
+		i := indexUnescaped(s, sep)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+len(sep):]
+	}
+}
+
+// WriteGIFT writes the test's questions in GIFT, filed in a category named
+// after its subject and topic. GIFT carries no points, images or hints, and
+// questions it cannot express are left out with a comment saying why.
+func WriteGIFT(w io.Writer, test *models.Test) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "// %s\n", strings.ReplaceAll(test.Title, "\n", " "))
+	fmt.Fprintf(out, "$CATEGORY: %s\n\n", CategoryFor(test))
+
+	for i := range test.Questions {
+		q := &test.Questions[i]
+		if reason := exportable(q, "GIFT"); reason != "" {
+			fmt.Fprintf(out, "// Question %d is left out: %s\n\n", i+1, reason)
+			continue
+		}
+		fmt.Fprintf(out, "::%s:: %s {", giftEscape(fmt.Sprintf("%s %d", test.Title, i+1)), giftEscape(q.QuestionText))
+
+		switch q.QuestionType {
+		case models.QuestionTypeTrueFalse:
+			value, wrong := "TRUE", 1
+			if len(q.Options) > 1 && q.Options[1].IsCorrect {
+				value, wrong = "FALSE", 0
+			}
+			out.WriteString(value)
+			if rationale := rationaleOf(q, wrong); rationale != "" {
+				out.WriteString("#" + giftEscape(rationale))
+			}
+
+		case models.QuestionTypeNumeric:
+			n := q.Numeric
+			tolerance := n.Tolerance
+			if n.ToleranceType == models.TolerancePercent {
+				tolerance = math.Abs(n.Expected) * n.Tolerance / 100
+			}
+			fmt.Fprintf(out, "#%s:%s", formatNumber(n.Expected), formatNumber(tolerance))
+
+		case models.QuestionTypeShortAnswer:
+			for _, a := range q.AcceptedAnswers {
+				if !a.IsRegex {
+					out.WriteString("\n=" + giftEscape(a.AnswerText))
+				}
+			}
+			out.WriteString("\n")
+
+		case models.QuestionTypeMatching:
+			for _, opt := range q.Options {
+				fmt.Fprintf(out, "\n=%s -> %s", giftEscape(opt.OptionText), giftEscape(opt.MatchText))
+			}
+			out.WriteString("\n")
+
+		case models.QuestionTypeMultipleSelect:
+			right, wrong := 0, 0
+			for _, opt := range q.Options {
+				if opt.IsCorrect {
+					right++
+				} else {
+					wrong++
+				}
+			}
+			for j, opt := range q.Options {
+				weight := 100 / float64(right)
+				if !opt.IsCorrect {
+					weight = -100 / float64(wrong)
+				}
+				fmt.Fprintf(out, "\n~%%%s%%%s", formatWeight(weight), giftEscape(opt.OptionText))
+				if rationale := rationaleOf(q, j); rationale != "" {
+					out.WriteString("#" + giftEscape(rationale))
+				}
+			}
+			out.WriteString("\n")
+
+		default:
+			for j, opt := range q.Options {
+				mark := "~"
+				if opt.IsCorrect {
+					mark = "="
+				}
+				out.WriteString("\n" + mark + giftEscape(opt.OptionText))
+				if rationale := rationaleOf(q, j); rationale != "" {
+					out.WriteString("#" + giftEscape(rationale))
+				}
+			}
+			out.WriteString("\n")
+		}
+
+		if q.Explanation != "" {
+			out.WriteString("####" + giftEscape(q.Explanation))
+		}
+		out.WriteString("}\n\n")
+	}
+	return out.Flush()
+}
+
+// formatNumber writes a number as briefly as it can be read back
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// formatWeight writes a share of the marks as Moodle lists them, to five
+// decimal places at most
+func formatWeight(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 5, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return s
+}
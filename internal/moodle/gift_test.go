@@ -0,0 +1,172 @@
+package moodle
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"my-app/internal/models"
+)
+
+const giftSample = `// Exported from Moodle
+$CATEGORY: $course$/top/Default for Year 10/Physics/Forces
+
+::Unit:: What is the unit of force? {
+	=Newton#Named after Isaac Newton
+	~Joule#That is energy
+	~Watt
+}
+
+::Vectors:: Which are vectors? {~%50%Velocity ~%-100%Speed ~%50%Force ####Vectors have a direction.}
+
+Friction always opposes motion.{TRUE#It does, by definition#Right}
+
+The law F \= ma is Newton's {=second =2nd} law.
+
+::Numbers:: What is 2 \+ 3.5? {#5.5:0.1}
+
+Guess a number from 1 to 5 {#1..5}
+
+Match each quantity to its unit. {=Force -> N =Energy -> J = -> W}
+
+Write about forces. {}
+
+Just a note for the class.
+
+::Broken:: Pick one {~a ~b}
+`
+
+func TestReadGIFT(t *testing.T) {
+	bank := ReadGIFT(giftSample)
+
+	want := []models.QuestionUpload{
+		{QuestionText: "What is the unit of force?", QuestionType: models.QuestionTypeSingleChoice, Points: 1,
+			Options: []string{"Newton", "Joule", "Watt"}, CorrectIndex: 0,
+			Explanation: "Named after Isaac Newton", Rationales: []string{"", "That is energy", ""}},
+		{QuestionText: "Which are vectors?", QuestionType: models.QuestionTypeMultipleSelect, Points: 1,
+			Options: []string{"Velocity", "Speed", "Force"}, CorrectIndices: []int{0, 2}, Explanation: "Vectors have a direction."},
+		{QuestionText: "Friction always opposes motion.", QuestionType: models.QuestionTypeTrueFalse, Points: 1,
+			Explanation: "Right", Rationales: []string{"", "It does, by definition"}},
+		{QuestionText: "The law F = ma is Newton's _____ law.", QuestionType: models.QuestionTypeShortAnswer, Points: 1,
+			AcceptedAnswers: []string{"second", "2nd"}},
+		{QuestionText: "What is 2 + 3.5?", QuestionType: models.QuestionTypeNumeric, Points: 1,
+			Numeric: &models.NumericAnswer{Expected: 5.5, Tolerance: 0.1, ToleranceType: models.ToleranceAbsolute}},
+		{QuestionText: "Guess a number from 1 to 5", QuestionType: models.QuestionTypeNumeric, Points: 1,
+			Numeric: &models.NumericAnswer{Expected: 3, Tolerance: 2, ToleranceType: models.ToleranceAbsolute}},
+		{QuestionText: "Match each quantity to its unit.", QuestionType: models.QuestionTypeMatching, Points: 1,
+			Pairs: []models.MatchPair{{Prompt: "Force", Match: "N"}, {Prompt: "Energy", Match: "J"}}},
+	}
+	if len(bank.Questions) != len(want) {
+		t.Fatalf("expected %d questions, got %d: %+v (skipped %+v)", len(want), len(bank.Questions), bank.Questions, bank.Skipped)
+	}
+	for i, q := range bank.Questions {
+		if !reflect.DeepEqual(q.Upload, want[i]) {
+			t.Errorf("question %d: expected\n%+v\ngot\n%+v", i+1, want[i], q.Upload)
+		}
+		if q.Category != "$course$/top/Default for Year 10/Physics/Forces" {
+			t.Errorf("question %d: unexpected category %q", i+1, q.Category)
+		}
+	}
+	if bank.Questions[0].Name != "Unit" {
+		t.Errorf("expected the question's name read, got %q", bank.Questions[0].Name)
+	}
+
+	wantSkipped := []Report{
+		{Question: "Write about forces.", Problem: "is an essay question, with no answer to mark"},
+		{Question: "Just a note for the class.", Problem: "is a description, with no answer to mark"},
+		{Question: "Broken", Problem: "has no correct answer"},
+	}
+	if !reflect.DeepEqual(bank.Skipped, wantSkipped) {
+		t.Errorf("expected skipped %+v, got %+v", wantSkipped, bank.Skipped)
+	}
+	if len(bank.Warnings) != 1 || bank.Warnings[0].Question != "Match each quantity to its unit." {
+		t.Errorf("expected a warning for the unmatched answer, got %+v", bank.Warnings)
+	}
+}
+
+func TestSplitCategory(t *testing.T) {
+	for category, want := range map[string][2]string{
+		"$course$/top/Default for Year 10/Physics/Forces/Friction": {"Physics", "Friction"},
+		"$course$/top/Chemistry":                                   {"Chemistry", ""},
+		"$system$/top/Maths//Statistics/Averages":                  {"Maths/Statistics", "Averages"},
+		"$course$/top": {"", ""},
+		"":             {"", ""},
+	} {
+		if subject, topic := SplitCategory(category); subject != want[0] || topic != want[1] {
+			t.Errorf("%q: expected %q and %q, got %q and %q", category, want[0], want[1], subject, topic)
+		}
+	}
+}
+
+func TestWriteGIFTRoundTrip(t *testing.T) {
+	test := sampleTest()
+	var buf bytes.Buffer
+	if err := WriteGIFT(&buf, test); err != nil {
+		t.Fatal(err)
+	}
+	bank := ReadGIFT(buf.String())
+
+	if len(bank.Skipped) != 0 {
+		t.Fatalf("expected every written question read back, got skipped %+v\n%s", bank.Skipped, buf.String())
+	}
+	// The ordering question cannot be written in GIFT
+	if len(bank.Questions) != len(test.Questions)-1 {
+		t.Fatalf("expected %d questions, got %d\n%s", len(test.Questions)-1, len(bank.Questions), buf.String())
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("// Question 6 is left out: ordering questions cannot be written in GIFT")) {
+		t.Errorf("expected a comment for the ordering question\n%s", buf.String())
+	}
+	for _, q := range bank.Questions {
+		if subject, topic := SplitCategory(q.Category); subject != "Physics" || topic != "Forces" {
+			t.Errorf("expected the category named after the subject and topic, got %q", q.Category)
+		}
+	}
+
+	first := bank.Questions[0].Upload
+	if first.QuestionText != "What is the unit of force? {Hint: think of apples}" || first.CorrectIndex != 1 ||
+		!reflect.DeepEqual(first.Options, []string{"Joule", "Newton", "Watt"}) || first.Explanation != "It is named after Newton." ||
+		!reflect.DeepEqual(first.Rationales, []string{"Energy, not force", "", ""}) {
+		t.Errorf("unexpected first question %+v", first)
+	}
+	if multiple := bank.Questions[2].Upload; !reflect.DeepEqual(multiple.CorrectIndices, []int{0, 2}) {
+		t.Errorf("expected the correct options of the multiple select question, got %+v", multiple)
+	}
+	if numeric := bank.Questions[3].Upload.Numeric; numeric == nil || numeric.Expected != 6 || numeric.Tolerance != 0.3 {
+		t.Errorf("expected the percentage tolerance written as an absolute one, got %+v", numeric)
+	}
+	if short := bank.Questions[4].Upload; !reflect.DeepEqual(short.AcceptedAnswers, []string{"Newton's second law"}) {
+		t.Errorf("expected only the literal accepted answer, got %+v", short)
+	}
+	if matching := bank.Questions[5].Upload; len(matching.Pairs) != 3 || matching.Pairs[2] != (models.MatchPair{Prompt: "Work", Match: "J"}) {
+		t.Errorf("unexpected matching question %+v", matching)
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+// sampleTest is a test with a question of every type
+func sampleTest() *models.Test {
+	return &models.Test{
+		ID: 7, Title: "Forces", ShuffleOptions: true,
+		Subject: &models.Subject{Name: "Physics"}, Topic: &models.Topic{Name: "Forces"},
+		Questions: []models.Question{
+			{QuestionText: "What is the unit of force? {Hint: think of apples}", QuestionType: models.QuestionTypeSingleChoice, Points: 2,
+				ImageURL: strPtr("/assets/uploads/7/question_1.png"), Explanation: "It is named after Newton.",
+				Options: []models.AnswerOption{
+					{OptionText: "Joule", Rationale: "Energy, not force"}, {OptionText: "Newton", IsCorrect: true}, {OptionText: "Watt"},
+				}},
+			{QuestionText: "Friction always opposes motion.", QuestionType: models.QuestionTypeTrueFalse, Points: 1,
+				Options: []models.AnswerOption{{OptionText: "True"}, {OptionText: "False", IsCorrect: true}}},
+			{QuestionText: "Which are vectors?", QuestionType: models.QuestionTypeMultipleSelect, Points: 2,
+				Options: []models.AnswerOption{{OptionText: "Velocity", IsCorrect: true}, {OptionText: "Speed"}, {OptionText: "Force", IsCorrect: true}}},
+			{QuestionText: "A 2 kg mass accelerates at 3 m/s². What is the force in N?", QuestionType: models.QuestionTypeNumeric, Points: 3,
+				Numeric: &models.NumericAnswer{Expected: 6, Tolerance: 5, ToleranceType: models.TolerancePercent}},
+			{QuestionText: "Name the law F = ma.", QuestionType: models.QuestionTypeShortAnswer, Points: 1,
+				AcceptedAnswers: []models.AcceptedAnswer{{AnswerText: "Newton's second law"}, {AnswerText: "(?i)second law", IsRegex: true}}},
+			{QuestionText: "Order by size.", QuestionType: models.QuestionTypeOrdering, Points: 1,
+				Options: []models.AnswerOption{{OptionText: "Cell", OptionOrder: 2}, {OptionText: "Atom", OptionOrder: 1}, {OptionText: "Planet", OptionOrder: 3}}},
+			{QuestionText: "Match each quantity to its unit.", QuestionType: models.QuestionTypeMatching, Points: 2,
+				Options: []models.AnswerOption{{OptionText: "Force", MatchText: "N"}, {OptionText: "Energy", MatchText: "J"}, {OptionText: "Work", MatchText: "J"}}},
+		},
+	}
+}
@@ -0,0 +1,220 @@
+// Package moodle converts questions to and from Moodle's question bank
+// formats: GIFT, its plain text format, and Moodle XML.
+//
+// A Moodle export is a bank of questions filed in categories rather than a
+// test, so reading one gives the questions with their categories; the caller
+// groups them into tests. Questions of types with no counterpart here, such
+// as essays and calculated questions, are reported rather than read.
+package moodle
+
+import (
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"strings"
+
+	"my-app/internal/models"
+)
+
+// MaxFileSize is the largest export accepted for import
+const MaxFileSize = 20 << 20
+
+// Bank is the questions read from a Moodle export
+type Bank struct {
+	Questions []Question
+	Skipped   []Report // questions that could not be read
+	Warnings  []Report // questions read with something left out
+}
+
+// Question is a question read from an export, with the category it was in
+type Question struct {
+	Name             string
+	Category         string // the Moodle category path, e.g. "$course$/top/Physics/Forces"
+	Upload           models.QuestionUpload
+	Image            *File // an image embedded in the export, to be stored with the question
+	ExplanationImage *File
+}
+
+// File is a file embedded in an export
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Report explains what became of a question
+type Report struct {
+	Question string `json:"question"`
+	Problem  string `json:"problem"`
+}
+
+// Read reads a Moodle export, telling GIFT from Moodle XML by the file's
+// extension: .xml is Moodle XML and .gift or .txt is GIFT
+func Read(filename string, data []byte) (*Bank, error) {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".xml":
+		return ReadXML(data)
+	case ".gift", ".txt":
+		return ReadGIFT(string(data)), nil
+	}
+	return nil, fmt.Errorf("unsupported file type %q: upload a .gift, .txt or .xml file", path.Ext(filename))
+}
+
+// SplitCategory reads the subject and topic a category path names: the first
+// level below Moodle's own contexts and "top" is the subject, and the last
+// level below that is the topic. Either is "" when the path has no such level.
+func SplitCategory(category string) (subject, topic string) {
+	var levels []string
+	for _, level := range strings.Split(strings.ReplaceAll(category, "//", "\x00"), "/") {
+		level = strings.TrimSpace(strings.ReplaceAll(level, "\x00", "/"))
+		switch {
+		case level == "", level == "top":
+		case strings.HasPrefix(level, "$") && strings.HasSuffix(level, "$"):
+		case strings.HasPrefix(level, "Default for "):
+		default:
+			levels = append(levels, level)
+		}
+	}
+	if len(levels) == 0 {
+		return "", ""
+	}
+	if len(levels) == 1 {
+		return levels[0], ""
+	}
+	return levels[0], levels[len(levels)-1]
+}
+
+// CategoryFor returns the category path a test's questions are exported in,
+// named after its subject and topic
+func CategoryFor(test *models.Test) string {
+	category := "$course$/top"
+	for _, level := range []string{subjectName(test), topicName(test)} {
+		if level != "" {
+			category += "/" + strings.ReplaceAll(level, "/", "//")
+		}
+	}
+	return category
+}
+
+func subjectName(test *models.Test) string {
+	if test.Subject == nil {
+		return ""
+	}
+	return test.Subject.Name
+}
+
+func topicName(test *models.Test) string {
+	if test.Topic == nil {
+		return ""
+	}
+	return test.Topic.Name
+}
+
+var (
+	lineBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|h[1-6]|tr|pre|blockquote)>`)
+	tags       = regexp.MustCompile(`<[^>]*>`)
+	imgSrc     = regexp.MustCompile(`(?i)<img[^>]*\ssrc\s*=\s*["']([^"']+)["']`)
+)
+
+// htmlText reads the text of HTML, a paragraph per line of blocks, with its
+// tags and images dropped
+func htmlText(markup string) string {
+	markup = lineBreaks.ReplaceAllString(markup, "\n")
+	return plainLines(html.UnescapeString(tags.ReplaceAllString(markup, "")))
+}
+
+// plainLines collapses the whitespace within lines and keeps paragraphs apart
+// by a blank line
+func plainLines(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n\n")
+}
+
+// firstImage returns the source of the first image in HTML, or ""
+func firstImage(markup string) string {
+	if m := imgSrc.FindStringSubmatch(markup); m != nil {
+		return html.UnescapeString(m[1])
+	}
+	return ""
+}
+
+// label names a question in a report: by its name, or the start of its text
+func label(name, text string) string {
+	if name = strings.TrimSpace(name); name != "" {
+		return name
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > 60 {
+		return string(runes[:57]) + "..."
+	}
+	return text
+}
+
+// wildcardPattern turns a Moodle short answer with * wildcards into a pattern
+// accepting the same answers
+func wildcardPattern(answer string) string {
+	parts := strings.Split(answer, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return strings.Join(parts, ".*")
+}
+
+// feedbackFor builds a question's explanation and rationales from Moodle's
+// feedback: the general feedback explains the question, or failing that the
+// feedback on its correct answers does, and the feedback on each wrong answer
+// is that option's rationale
+func feedbackFor(q *models.QuestionUpload, general string, feedback []string, correct func(i int) bool) {
+	q.Explanation = general
+	var right []string
+	hasRationale := false
+	rationales := make([]string, len(feedback))
+	for i, fb := range feedback {
+		if fb == "" {
+			continue
+		}
+		if correct(i) {
+			right = append(right, fb)
+			continue
+		}
+		rationales[i] = fb
+		hasRationale = true
+	}
+	if q.Explanation == "" {
+		q.Explanation = strings.Join(right, "\n\n")
+	}
+	if hasRationale {
+		q.Rationales = rationales
+	}
+}
+
+// rationaleOf returns the rationale of an option of a stored question
+func rationaleOf(q *models.Question, i int) string {
+	if i < len(q.Options) {
+		return q.Options[i].Rationale
+	}
+	return ""
+}
+
+// exportable reports why a question cannot be written in a format, or ""
+func exportable(q *models.Question, format string) string {
+	switch q.QuestionType {
+	case models.QuestionTypeOrdering:
+		if format == "GIFT" {
+			return "ordering questions cannot be written in GIFT"
+		}
+	case models.QuestionTypeShortAnswer:
+		for _, a := range q.AcceptedAnswers {
+			if !a.IsRegex {
+				return ""
+			}
+		}
+		return "its accepted answers are all patterns, which Moodle cannot check"
+	}
+	return ""
+}
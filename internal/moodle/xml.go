@@ -0,0 +1,520 @@
+package moodle
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"my-app/internal/models"
+)
+
+// xmlQuiz is a Moodle XML file: its questions, with "category" questions
+// filing the questions after them
+type xmlQuiz struct {
+	XMLName   xml.Name      `xml:"quiz"`
+	Questions []xmlQuestion `xml:"question"`
+}
+
+type xmlQuestion struct {
+	XMLName         xml.Name         `xml:"question"`
+	Type            string           `xml:"type,attr"`
+	Category        *xmlText         `xml:"category,omitempty"`
+	Name            *xmlText         `xml:"name,omitempty"`
+	QuestionText    *xmlText         `xml:"questiontext,omitempty"`
+	GeneralFeedback *xmlText         `xml:"generalfeedback,omitempty"`
+	DefaultGrade    string           `xml:"defaultgrade,omitempty"`
+	Single          string           `xml:"single,omitempty"`
+	ShuffleAnswers  string           `xml:"shuffleanswers,omitempty"`
+	AnswerNumbering string           `xml:"answernumbering,omitempty"`
+	UseCase         string           `xml:"usecase,omitempty"`
+	LayoutType      string           `xml:"layouttype,omitempty"`
+	SelectType      string           `xml:"selecttype,omitempty"`
+	GradingType     string           `xml:"gradingtype,omitempty"`
+	Answers         []xmlAnswer      `xml:"answer"`
+	Subquestions    []xmlSubquestion `xml:"subquestion"`
+	Hints           []xmlText        `xml:"hint"`
+}
+
+// xmlText is text in a format, with the files its HTML refers to
+type xmlText struct {
+	Format string    `xml:"format,attr,omitempty"`
+	Text   string    `xml:"text"`
+	Files  []xmlFile `xml:"file"`
+}
+
+type xmlFile struct {
+	Name     string `xml:"name,attr"`
+	Path     string `xml:"path,attr"`
+	Encoding string `xml:"encoding,attr"`
+	Data     string `xml:",chardata"`
+}
+
+type xmlAnswer struct {
+	Fraction  string   `xml:"fraction,attr"`
+	Format    string   `xml:"format,attr,omitempty"`
+	Text      string   `xml:"text"`
+	Feedback  *xmlText `xml:"feedback,omitempty"`
+	Tolerance string   `xml:"tolerance,omitempty"`
+}
+
+type xmlSubquestion struct {
+	Format string  `xml:"format,attr,omitempty"`
+	Text   string  `xml:"text"`
+	Answer xmlText `xml:"answer"`
+}
+
+// pluginFile prefixes the images a Moodle XML file embeds
+const pluginFile = "@@PLUGINFILE@@/"
+
+// xmlQuestionTypes names the Moodle question types with no counterpart here
+var xmlQuestionTypes = map[string]string{
+	"essay":            "an essay",
+	"description":      "a description",
+	"calculated":       "a calculated question",
+	"calculatedsimple": "a simple calculated question",
+	"calculatedmulti":  "a calculated multichoice question",
+	"multianswer":      "an embedded answers (Cloze) question",
+	"ddwtos":           "a drag and drop into text question",
+	"gapselect":        "a select missing words question",
+	"ddimageortext":    "a drag and drop onto image question",
+	"ddmarker":         "a drag and drop markers question",
+	"randomsamatch":    "a random short-answer matching question",
+	"random":           "a random question",
+}
+
+// ReadXML reads questions exported as Moodle XML
+func ReadXML(data []byte) (*Bank, error) {
+	var quiz xmlQuiz
+	if err := xml.Unmarshal(data, &quiz); err != nil {
+		return nil, fmt.Errorf("the file is not Moodle XML: %v", err)
+	}
+
+	bank := &Bank{}
+	category := ""
+	for _, x := range quiz.Questions {
+		if x.Type == "category" {
+			if x.Category != nil {
+				category = strings.TrimSpace(x.Category.Text)
+			}
+			continue
+		}
+
+		q := Question{Category: category}
+		if x.Name != nil {
+			q.Name = strings.TrimSpace(x.Name.Text)
+		}
+		var warnings []string
+		problem := readXMLQuestion(x, &q, &warnings)
+		who := label(q.Name, q.Upload.QuestionText)
+		if problem != "" {
+			bank.Skipped = append(bank.Skipped, Report{Question: who, Problem: problem})
+			continue
+		}
+		for _, warning := range warnings {
+			bank.Warnings = append(bank.Warnings, Report{Question: who, Problem: warning})
+		}
+		bank.Questions = append(bank.Questions, q)
+	}
+	return bank, nil
+}
+
+// readXMLQuestion reads a question into q, returning why it cannot be read
+// instead when it cannot
+func readXMLQuestion(x xmlQuestion, q *Question, warnings *[]string) string {
+	u := &q.Upload
+	u.QuestionText = x.QuestionText.plain()
+	if u.QuestionText == "" {
+		u.QuestionText = q.Name
+	}
+	if kind, ok := xmlQuestionTypes[x.Type]; ok {
+		return "is " + kind + ", which no question type here matches"
+	}
+
+	u.Points = 1
+	if grade, err := strconv.ParseFloat(strings.TrimSpace(x.DefaultGrade), 64); err == nil && grade >= 1 {
+		u.Points = int(math.Round(grade))
+	}
+	u.ImageURL, q.Image = x.QuestionText.image(warnings)
+	u.ExplanationImageURL, q.ExplanationImage = x.GeneralFeedback.image(warnings)
+	for _, hint := range x.Hints {
+		if text := hint.plain(); text != "" {
+			u.Hints = append(u.Hints, models.HintUpload{Text: text})
+		}
+	}
+	general := x.GeneralFeedback.plain()
+	u.KeepOptionOrder = x.ShuffleAnswers == "0" || x.ShuffleAnswers == "false"
+
+	fractions := make([]float64, len(x.Answers))
+	feedback := make([]string, len(x.Answers))
+	for i, a := range x.Answers {
+		fractions[i], _ = strconv.ParseFloat(strings.TrimSpace(a.Fraction), 64)
+		feedback[i] = a.Feedback.plain()
+	}
+
+	switch x.Type {
+	case "multichoice":
+		var correct, full []int
+		for i, a := range x.Answers {
+			u.Options = append(u.Options, a.plain())
+			if fractions[i] > 0 {
+				correct = append(correct, i)
+			}
+			if fractions[i] >= 100 {
+				full = append(full, i)
+			}
+		}
+		if len(correct) == 0 {
+			return "has no correct answer"
+		}
+		if x.Single == "false" || x.Single == "0" {
+			u.QuestionType = models.QuestionTypeMultipleSelect
+			u.CorrectIndices = correct
+			feedbackFor(u, general, feedback, func(i int) bool { return fractions[i] > 0 })
+			return ""
+		}
+		if len(full) != 1 {
+			return "gives part marks for some answers, which a single choice question cannot"
+		}
+		u.QuestionType = models.QuestionTypeSingleChoice
+		u.CorrectIndex = full[0]
+		feedbackFor(u, general, feedback, func(i int) bool { return i == full[0] })
+		return ""
+
+	case "truefalse":
+		u.QuestionType = models.QuestionTypeTrueFalse
+		options := make([]string, 2) // feedback for True and False
+		found := false
+		for i, a := range x.Answers {
+			value := 0
+			if strings.EqualFold(a.plain(), "false") {
+				value = 1
+			}
+			options[value] = feedback[i]
+			if fractions[i] >= 100 {
+				u.CorrectIndex, found = value, true
+			}
+		}
+		if !found {
+			return "has no correct answer"
+		}
+		feedbackFor(u, general, options, func(i int) bool { return i == u.CorrectIndex })
+		return ""
+
+	case "shortanswer":
+		u.QuestionType = models.QuestionTypeShortAnswer
+		u.CaseSensitive = x.UseCase == "1"
+		partial := 0
+		for i, a := range x.Answers {
+			answer := a.plain()
+			switch {
+			case fractions[i] < 100:
+				partial++
+			case strings.Contains(answer, "*"):
+				u.AcceptedPatterns = append(u.AcceptedPatterns, wildcardPattern(answer))
+			default:
+				u.AcceptedAnswers = append(u.AcceptedAnswers, answer)
+			}
+		}
+		if len(u.AcceptedAnswers)+len(u.AcceptedPatterns) == 0 {
+			return "has no answer worth full marks"
+		}
+		if partial > 0 {
+			*warnings = append(*warnings, fmt.Sprintf("left out %d answers worth part marks", partial))
+		}
+		feedbackFor(u, general, feedback, func(i int) bool { return fractions[i] >= 100 })
+		u.Rationales = nil
+		return ""
+
+	case "numerical":
+		for i, a := range x.Answers {
+			if fractions[i] < 100 || strings.TrimSpace(a.Text) == "*" {
+				continue
+			}
+			expected, err := strconv.ParseFloat(strings.TrimSpace(a.plain()), 64)
+			if err != nil {
+				return fmt.Sprintf("has a numerical answer %q that is not a number", a.Text)
+			}
+			tolerance, _ := strconv.ParseFloat(strings.TrimSpace(a.Tolerance), 64)
+			u.QuestionType = models.QuestionTypeNumeric
+			u.Numeric = &models.NumericAnswer{Expected: expected, Tolerance: math.Abs(tolerance), ToleranceType: models.ToleranceAbsolute}
+			u.Explanation = general
+			if u.Explanation == "" {
+				u.Explanation = feedback[i]
+			}
+			return ""
+		}
+		return "has no numerical answer worth full marks"
+
+	case "matching":
+		u.QuestionType = models.QuestionTypeMatching
+		distractors := 0
+		for _, s := range x.Subquestions {
+			prompt := (&xmlText{Format: s.Format, Text: s.Text}).plain()
+			if prompt == "" {
+				distractors++
+				continue
+			}
+			u.Pairs = append(u.Pairs, models.MatchPair{Prompt: prompt, Match: plainLines(s.Answer.Text)})
+		}
+		if len(u.Pairs) == 0 {
+			return "has no pairs to match"
+		}
+		if distractors > 0 {
+			*warnings = append(*warnings, fmt.Sprintf("left out %d extra answers that match no prompt", distractors))
+		}
+		u.Explanation = general
+		return ""
+
+	case "ordering":
+		u.QuestionType = models.QuestionTypeOrdering
+		u.KeepOptionOrder = false
+		for _, a := range x.Answers {
+			u.Options = append(u.Options, a.plain())
+		}
+		u.Explanation = general
+		return ""
+	}
+	return fmt.Sprintf("is a Moodle %q question, which no question type here matches", x.Type)
+}
+
+// plain reads the text, with its HTML tags dropped unless it is plain text
+func (t *xmlText) plain() string {
+	if t == nil {
+		return ""
+	}
+	return textIn(t.Text, t.Format)
+}
+
+func (a xmlAnswer) plain() string {
+	return textIn(a.Text, a.Format)
+}
+
+func textIn(text, format string) string {
+	switch format {
+	case "plain_text", "moodle_auto_format", "markdown":
+		return plainLines(text)
+	}
+	return htmlText(text)
+}
+
+// image finds the text's first image: an image embedded in the file is
+// returned to be stored, and one on the web is linked to
+func (t *xmlText) image(warnings *[]string) (string, *File) {
+	if t == nil {
+		return "", nil
+	}
+	src := firstImage(t.Text)
+	switch {
+	case src == "":
+		return "", nil
+	case strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://"):
+		return src, nil
+	case strings.HasPrefix(src, pluginFile):
+		name, err := url.PathUnescape(strings.TrimPrefix(src, pluginFile))
+		if err != nil {
+			name = strings.TrimPrefix(src, pluginFile)
+		}
+		for _, f := range t.Files {
+			if strings.TrimPrefix(path.Join(f.Path, f.Name), "/") != name || f.Encoding != "base64" {
+				continue
+			}
+			data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(f.Data), ""))
+			if err != nil {
+				break
+			}
+			return "", &File{Name: path.Base(name), Data: data}
+		}
+	}
+	*warnings = append(*warnings, fmt.Sprintf("left out the image %s, which is not in the file", src))
+	return "", nil
+}
+
+// WriteXML writes the test's questions as Moodle XML, filed in a category
+// named after its subject and topic. The images in images, keyed by their
+// URL, are embedded in the file; other images are linked to. Questions Moodle
+// cannot check are left out with a comment saying why.
+func WriteXML(w io.Writer, test *models.Test, images map[string][]byte) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	quiz := xml.StartElement{Name: xml.Name{Local: "quiz"}}
+	if err := enc.EncodeToken(quiz); err != nil {
+		return err
+	}
+	if err := enc.EncodeToken(xml.Comment(" " + test.Title + " ")); err != nil {
+		return err
+	}
+	if err := enc.Encode(xmlQuestion{Type: "category", Category: &xmlText{Text: CategoryFor(test)}}); err != nil {
+		return err
+	}
+
+	for i := range test.Questions {
+		q := &test.Questions[i]
+		if reason := exportable(q, "XML"); reason != "" {
+			if err := enc.EncodeToken(xml.Comment(fmt.Sprintf(" Question %d is left out: %s ", i+1, reason))); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := enc.Encode(xmlQuestionFor(test, q, i+1, images)); err != nil {
+			return err
+		}
+	}
+
+	if err := enc.EncodeToken(quiz.End()); err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// xmlQuestionFor builds the Moodle XML of a question
+func xmlQuestionFor(test *models.Test, q *models.Question, number int, images map[string][]byte) xmlQuestion {
+	x := xmlQuestion{
+		Name:         &xmlText{Text: fmt.Sprintf("%s %d", test.Title, number)},
+		QuestionText: htmlWithImage(q.QuestionText, q.ImageURL, images),
+		DefaultGrade: strconv.Itoa(q.Points),
+	}
+	if q.Explanation != "" || q.ExplanationImageURL != nil {
+		x.GeneralFeedback = htmlWithImage(q.Explanation, q.ExplanationImageURL, images)
+	}
+	for _, hint := range q.Hints {
+		x.Hints = append(x.Hints, *htmlWithImage(hint.HintText, nil, nil))
+	}
+	shuffle := "0"
+	if test.ShuffleOptions && !q.KeepOptionOrder {
+		shuffle = "1"
+	}
+
+	answer := func(text string, fraction float64, feedback string) xmlAnswer {
+		a := xmlAnswer{Fraction: formatWeight(fraction), Format: "plain_text", Text: text}
+		if feedback != "" {
+			a.Feedback = htmlWithImage(feedback, nil, nil)
+		}
+		return a
+	}
+
+	switch q.QuestionType {
+	case models.QuestionTypeTrueFalse:
+		x.Type = "truefalse"
+		for j, value := range []string{"true", "false"} {
+			correct := j < len(q.Options) && q.Options[j].IsCorrect
+			fraction := 0.0
+			if correct {
+				fraction = 100
+			}
+			x.Answers = append(x.Answers, answer(value, fraction, rationaleOf(q, j)))
+		}
+
+	case models.QuestionTypeNumeric:
+		x.Type = "numerical"
+		n := q.Numeric
+		tolerance := n.Tolerance
+		if n.ToleranceType == models.TolerancePercent {
+			tolerance = math.Abs(n.Expected) * n.Tolerance / 100
+		}
+		a := answer(formatNumber(n.Expected), 100, "")
+		a.Tolerance = formatNumber(tolerance)
+		x.Answers = append(x.Answers, a)
+
+	case models.QuestionTypeShortAnswer:
+		x.Type = "shortanswer"
+		x.UseCase = "0"
+		if q.CaseSensitive {
+			x.UseCase = "1"
+		}
+		for _, a := range q.AcceptedAnswers {
+			if !a.IsRegex {
+				x.Answers = append(x.Answers, answer(a.AnswerText, 100, ""))
+			}
+		}
+
+	case models.QuestionTypeMatching:
+		x.Type = "matching"
+		x.ShuffleAnswers = "1"
+		for _, opt := range q.Options {
+			x.Subquestions = append(x.Subquestions, xmlSubquestion{
+				Format: "html", Text: paragraphs(opt.OptionText), Answer: xmlText{Text: opt.MatchText},
+			})
+		}
+
+	case models.QuestionTypeOrdering:
+		x.Type = "ordering"
+		x.LayoutType, x.SelectType, x.GradingType = "VERTICAL", "ALL", "ABSOLUTE_POSITION"
+		for j, opt := range q.CorrectOrder() {
+			x.Answers = append(x.Answers, answer(opt.OptionText, float64(j+1), ""))
+		}
+
+	default:
+		x.Type = "multichoice"
+		x.Single = "true"
+		x.ShuffleAnswers = shuffle
+		x.AnswerNumbering = "abc"
+		right, wrong := 0, 0
+		for _, opt := range q.Options {
+			if opt.IsCorrect {
+				right++
+			} else {
+				wrong++
+			}
+		}
+		multiple := q.QuestionType == models.QuestionTypeMultipleSelect
+		if multiple {
+			x.Single = "false"
+		}
+		for j, opt := range q.Options {
+			fraction := 0.0
+			switch {
+			case opt.IsCorrect && multiple:
+				fraction = 100 / float64(right)
+			case opt.IsCorrect:
+				fraction = 100
+			case multiple:
+				fraction = -100 / float64(wrong)
+			}
+			x.Answers = append(x.Answers, answer(opt.OptionText, fraction, rationaleOf(q, j)))
+		}
+	}
+	return x
+}
+
+// htmlWithImage writes text as HTML paragraphs, followed by the image at the
+// URL given when there is one, embedding it when its data is in images
+func htmlWithImage(text string, imageURL *string, images map[string][]byte) *xmlText {
+	t := &xmlText{Format: "html", Text: paragraphs(text)}
+	if imageURL == nil || *imageURL == "" {
+		return t
+	}
+	src := *imageURL
+	if data, ok := images[src]; ok {
+		name := path.Base(src)
+		t.Files = append(t.Files, xmlFile{Name: name, Path: "/", Encoding: "base64", Data: base64.StdEncoding.EncodeToString(data)})
+		src = pluginFile + url.PathEscape(name)
+	}
+	t.Text += fmt.Sprintf(`<p><img src="%s" alt=""></p>`, html.EscapeString(src))
+	return t
+}
+
+// paragraphs writes text as HTML, a paragraph per line
+func paragraphs(text string) string {
+	var b bytes.Buffer
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			b.WriteString("<p>" + html.EscapeString(line) + "</p>")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,142 @@
+package moodle
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"my-app/internal/models"
+)
+
+const xmlSample = `<?xml version="1.0" encoding="UTF-8"?>
+<quiz>
+  <question type="category"><category><text>$course$/top/Chemistry/Bonding</text></category></question>
+  <question type="multichoice">
+    <name><text>Ionic</text></name>
+    <questiontext format="html">
+      <text><![CDATA[<p>Which compound is <b>ionic</b>?</p><p><img src="@@PLUGINFILE@@/salt%20crystal.png" alt=""></p>]]></text>
+      <file name="salt crystal.png" path="/" encoding="base64">cG5n</file>
+    </questiontext>
+    <generalfeedback format="html"><text></text></generalfeedback>
+    <defaultgrade>2.0000000</defaultgrade>
+    <single>true</single>
+    <shuffleanswers>0</shuffleanswers>
+    <answer fraction="0" format="html"><text>CO&lt;sub&gt;2&lt;/sub&gt;</text><feedback format="html"><text>Carbon dioxide is covalent.</text></feedback></answer>
+    <answer fraction="100" format="html"><text>NaCl</text><feedback format="html"><text>Sodium gives its electron to chlorine.</text></feedback></answer>
+    <hint format="html"><text>Look for a metal.</text></hint>
+  </question>
+  <question type="shortanswer">
+    <name><text>Symbol</text></name>
+    <questiontext format="moodle_auto_format"><text>The symbol for sodium?</text></questiontext>
+    <usecase>1</usecase>
+    <answer fraction="100"><text>Na</text></answer>
+    <answer fraction="100"><text>Na*</text></answer>
+    <answer fraction="50"><text>N</text></answer>
+  </question>
+  <question type="essay">
+    <name><text>Essay</text></name>
+    <questiontext format="html"><text>Discuss bonding.</text></questiontext>
+  </question>
+  <question type="matching">
+    <name><text>Pairs</text></name>
+    <questiontext format="html"><text>Match them.</text></questiontext>
+    <subquestion format="html"><text>Na</text><answer><text>Sodium</text></answer></subquestion>
+    <subquestion format="html"><text>Cl</text><answer><text>Chlorine</text></answer></subquestion>
+    <subquestion format="html"><text></text><answer><text>Argon</text></answer></subquestion>
+  </question>
+</quiz>`
+
+func TestReadXML(t *testing.T) {
+	bank, err := ReadXML([]byte(xmlSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.QuestionUpload{
+		{QuestionText: "Which compound is ionic?", QuestionType: models.QuestionTypeSingleChoice, Points: 2,
+			Options: []string{"CO2", "NaCl"}, CorrectIndex: 1, KeepOptionOrder: true,
+			Explanation: "Sodium gives its electron to chlorine.", Rationales: []string{"Carbon dioxide is covalent.", ""},
+			Hints: []models.HintUpload{{Text: "Look for a metal."}}},
+		{QuestionText: "The symbol for sodium?", QuestionType: models.QuestionTypeShortAnswer, Points: 1, CaseSensitive: true,
+			AcceptedAnswers: []string{"Na"}, AcceptedPatterns: []string{"Na.*"}},
+		{QuestionText: "Match them.", QuestionType: models.QuestionTypeMatching, Points: 1,
+			Pairs: []models.MatchPair{{Prompt: "Na", Match: "Sodium"}, {Prompt: "Cl", Match: "Chlorine"}}},
+	}
+	if len(bank.Questions) != len(want) {
+		t.Fatalf("expected %d questions, got %+v (skipped %+v)", len(want), bank.Questions, bank.Skipped)
+	}
+	for i, q := range bank.Questions {
+		if !reflect.DeepEqual(q.Upload, want[i]) {
+			t.Errorf("question %d: expected\n%+v\ngot\n%+v", i+1, want[i], q.Upload)
+		}
+		if q.Category != "$course$/top/Chemistry/Bonding" {
+			t.Errorf("question %d: unexpected category %q", i+1, q.Category)
+		}
+	}
+	if image := bank.Questions[0].Image; image == nil || image.Name != "salt crystal.png" || string(image.Data) != "png" {
+		t.Errorf("expected the embedded image read, got %+v", image)
+	}
+
+	wantSkipped := []Report{{Question: "Essay", Problem: "is an essay, which no question type here matches"}}
+	if !reflect.DeepEqual(bank.Skipped, wantSkipped) {
+		t.Errorf("expected skipped %+v, got %+v", wantSkipped, bank.Skipped)
+	}
+	wantWarnings := []Report{
+		{Question: "Symbol", Problem: "left out 1 answers worth part marks"},
+		{Question: "Pairs", Problem: "left out 1 extra answers that match no prompt"},
+	}
+	if !reflect.DeepEqual(bank.Warnings, wantWarnings) {
+		t.Errorf("expected warnings %+v, got %+v", wantWarnings, bank.Warnings)
+	}
+
+	if _, err := ReadXML([]byte("question,answer\n")); err == nil {
+		t.Error("expected a file that is not Moodle XML rejected")
+	}
+}
+
+func TestWriteXMLRoundTrip(t *testing.T) {
+	test := sampleTest()
+	var buf bytes.Buffer
+	if err := WriteXML(&buf, test, map[string][]byte{"/assets/uploads/7/question_1.png": []byte("png")}); err != nil {
+		t.Fatal(err)
+	}
+	bank, err := ReadXML(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bank.Skipped) != 0 || len(bank.Warnings) != 0 {
+		t.Fatalf("expected every question read back, got skipped %+v and warnings %+v\n%s", bank.Skipped, bank.Warnings, buf.String())
+	}
+	if len(bank.Questions) != len(test.Questions) {
+		t.Fatalf("expected %d questions, got %d\n%s", len(test.Questions), len(bank.Questions), buf.String())
+	}
+
+	want := []models.QuestionUpload{
+		{QuestionText: "What is the unit of force? {Hint: think of apples}", QuestionType: models.QuestionTypeSingleChoice, Points: 2,
+			Options: []string{"Joule", "Newton", "Watt"}, CorrectIndex: 1, Explanation: "It is named after Newton.",
+			Rationales: []string{"Energy, not force", "", ""}},
+		{QuestionText: "Friction always opposes motion.", QuestionType: models.QuestionTypeTrueFalse, Points: 1, CorrectIndex: 1},
+		{QuestionText: "Which are vectors?", QuestionType: models.QuestionTypeMultipleSelect, Points: 2,
+			Options: []string{"Velocity", "Speed", "Force"}, CorrectIndices: []int{0, 2}},
+		{QuestionText: "A 2 kg mass accelerates at 3 m/s². What is the force in N?", QuestionType: models.QuestionTypeNumeric, Points: 3,
+			Numeric: &models.NumericAnswer{Expected: 6, Tolerance: 0.3, ToleranceType: models.ToleranceAbsolute}},
+		{QuestionText: "Name the law F = ma.", QuestionType: models.QuestionTypeShortAnswer, Points: 1,
+			AcceptedAnswers: []string{"Newton's second law"}},
+		{QuestionText: "Order by size.", QuestionType: models.QuestionTypeOrdering, Points: 1,
+			Options: []string{"Atom", "Cell", "Planet"}},
+		{QuestionText: "Match each quantity to its unit.", QuestionType: models.QuestionTypeMatching, Points: 2,
+			Pairs: []models.MatchPair{{Prompt: "Force", Match: "N"}, {Prompt: "Energy", Match: "J"}, {Prompt: "Work", Match: "J"}}},
+	}
+	for i, q := range bank.Questions {
+		if !reflect.DeepEqual(q.Upload, want[i]) {
+			t.Errorf("question %d: expected\n%+v\ngot\n%+v", i+1, want[i], q.Upload)
+		}
+	}
+	if image := bank.Questions[0].Image; image == nil || image.Name != "question_1.png" || string(image.Data) != "png" {
+		t.Errorf("expected the image embedded and read back, got %+v", image)
+	}
+	if !strings.Contains(buf.String(), "<text>$course$/top/Physics/Forces</text>") {
+		t.Errorf("expected the category named after the subject and topic\n%s", buf.String())
+	}
+}
@@ -0,0 +1,412 @@
+package qti
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"my-app/internal/models"
+)
+
+// Namespaces and names that differ between the versions
+type versionInfo struct {
+	manifestNS string
+	itemNS     string
+	itemType   string
+	testType   string
+	schema     string
+	schemaVer  string
+}
+
+var versions = map[string]versionInfo{
+	Version21: {
+		manifestNS: "http://www.imsglobal.org/xsd/imscp_v1p1",
+		itemNS:     "http://www.imsglobal.org/xsd/imsqti_v2p1",
+		itemType:   "imsqti_item_xmlv2p1",
+		testType:   "imsqti_test_xmlv2p1",
+		schema:     "QTIv2.1 Package",
+		schemaVer:  "1.0.0",
+	},
+	Version30: {
+		manifestNS: "http://www.imsglobal.org/xsd/qti/qtiv3p0/imscp_v1p1",
+		itemNS:     "http://www.imsglobal.org/xsd/imsqtiasi_v3p0",
+		itemType:   "imsqti_item_xmlv3p0",
+		testType:   "imsqti_test_xmlv3p0",
+		schema:     "QTI Package",
+		schemaVer:  "3.0.0",
+	},
+}
+
+// Media is a file carried in a package: an image or the test's notes
+type Media struct {
+	Name string // the file's name, e.g. "diagram.png"
+	Data []byte
+}
+
+// Package is a test with the files its package carries
+type Package struct {
+	Test   *models.Test
+	Images map[string][]byte // image URL to the image, for the images stored with the test
+	Notes  *Media
+}
+
+// Export writes the test as a QTI content package of the version given: a
+// manifest, an assessment test listing an item per question, the images in
+// Images and the notes. Images not in Images, such as ones linked from other
+// sites, are referred to by their URL.
+func Export(w io.Writer, pkg Package, version string) error {
+	info, ok := versions[version]
+	if !ok {
+		return fmt.Errorf("unknown QTI version %q", version)
+	}
+	test := pkg.Test
+	zw := zip.NewWriter(w)
+
+	add := func(name string, data []byte) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	}
+
+	manifestResources := []*node{}
+	packaged := make(map[string]string) // image URL to its path in the package
+	imageHref := func(url string) (string, error) {
+		if url == "" {
+			return "", nil
+		}
+		if href, ok := packaged[url]; ok {
+			return href, nil
+		}
+		data, ok := pkg.Images[url]
+		if !ok {
+			return url, nil
+		}
+		href := fmt.Sprintf("images/%d_%s", len(packaged)+1, path.Base(url))
+		packaged[url] = href
+		return href, add(href, data)
+	}
+
+	// An item per question
+	itemIDs := make([]string, len(test.Questions))
+	itemHrefs := make([]string, len(test.Questions))
+	for i := range test.Questions {
+		q := &test.Questions[i]
+		itemIDs[i] = fmt.Sprintf("item_%d", i+1)
+		itemHrefs[i] = fmt.Sprintf("items/%s.xml", itemIDs[i])
+
+		var image, explanationImage string
+		var err error
+		if q.ImageURL != nil {
+			if image, err = imageHref(*q.ImageURL); err != nil {
+				return err
+			}
+		}
+		if q.ExplanationImageURL != nil {
+			if explanationImage, err = imageHref(*q.ExplanationImageURL); err != nil {
+				return err
+			}
+		}
+
+		item := itemFor(q, itemIDs[i], i+1, test.ShuffleOptions, relativeTo(image), relativeTo(explanationImage))
+		item.attrs["xmlns"] = info.itemNS
+		data, err := writeXML(item, version)
+		if err != nil {
+			return err
+		}
+		if err := add(itemHrefs[i], data); err != nil {
+			return err
+		}
+
+		files := []*node{el("file", map[string]string{"href": itemHrefs[i]})}
+		for _, href := range []string{image, explanationImage} {
+			if href != "" && !isExternal(href) {
+				files = append(files, el("file", map[string]string{"href": href}))
+			}
+		}
+		manifestResources = append(manifestResources, el("resource", map[string]string{
+			"identifier": itemIDs[i], "type": info.itemType, "href": itemHrefs[i],
+		}, files...))
+	}
+
+	// The assessment test, which orders the items into sections
+	testXML := testFor(test, itemIDs, itemHrefs)
+	testXML.attrs["xmlns"] = info.itemNS
+	data, err := writeXML(testXML, version)
+	if err != nil {
+		return err
+	}
+	if err := add("test.xml", data); err != nil {
+		return err
+	}
+	testResource := el("resource", map[string]string{"identifier": "test", "type": info.testType, "href": "test.xml"},
+		el("file", map[string]string{"href": "test.xml"}))
+	for _, id := range itemIDs {
+		testResource.children = append(testResource.children, el("dependency", map[string]string{"identifierref": id}))
+	}
+	manifestResources = append([]*node{testResource}, manifestResources...)
+
+	if pkg.Notes != nil {
+		href := "notes/" + path.Base(pkg.Notes.Name)
+		if err := add(href, pkg.Notes.Data); err != nil {
+			return err
+		}
+		manifestResources = append(manifestResources, el("resource", map[string]string{
+			"identifier": "notes", "type": "webcontent", "href": href,
+		}, el("file", map[string]string{"href": href})))
+	}
+
+	manifest := el("manifest", map[string]string{"xmlns": info.manifestNS, "identifier": fmt.Sprintf("test_%d", test.ID)},
+		el("metadata", nil,
+			el("schema", nil, textNode(info.schema)),
+			el("schemaversion", nil, textNode(info.schemaVer)),
+			el("lom", map[string]string{"xmlns": "http://ltsc.ieee.org/xsd/LOM"},
+				el("general", nil,
+					el("title", nil, el("string", nil, textNode(test.Title))),
+					el("description", nil, el("string", nil, textNode(test.Description))),
+				),
+			),
+		),
+		el("organizations", nil),
+		el("resources", nil, manifestResources...),
+	)
+	if data, err = writeXML(manifest, ""); err != nil {
+		return err
+	}
+	if err := add("imsmanifest.xml", data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// relativeTo gives the path of a packaged file from the items folder
+func relativeTo(href string) string {
+	if href == "" || isExternal(href) {
+		return href
+	}
+	return "../" + href
+}
+
+// isExternal reports whether a reference is a URL rather than a packaged file
+func isExternal(href string) bool {
+	return strings.Contains(href, "://") || strings.HasPrefix(href, "/")
+}
+
+// testFor builds the assessment test: one section per section of the test,
+// or a single one, with each question's item in it
+func testFor(test *models.Test, itemIDs, itemHrefs []string) *node {
+	type section struct {
+		id, title, instructions string
+		minutes                 int
+		refs                    []*node
+	}
+	sections := []*section{{id: "section_1", title: "Questions"}}
+	index := map[int]int{}
+	if len(test.Sections) > 0 {
+		sections = sections[:0]
+		for i, s := range test.Sections {
+			index[s.ID] = i
+			sections = append(sections, &section{
+				id: fmt.Sprintf("section_%d", i+1), title: s.Title, instructions: s.Instructions, minutes: s.TimeLimitMinutes,
+			})
+		}
+	}
+	for i, q := range test.Questions {
+		s := sections[0]
+		if q.SectionID != nil {
+			if at, ok := index[*q.SectionID]; ok {
+				s = sections[at]
+			}
+		}
+		s.refs = append(s.refs, el("assessmentItemRef", map[string]string{"identifier": itemIDs[i], "href": itemHrefs[i]}))
+	}
+
+	part := el("testPart", map[string]string{"identifier": "part_1", "navigationMode": "nonlinear", "submissionMode": "simultaneous"})
+	for _, s := range sections {
+		sec := el("assessmentSection", map[string]string{"identifier": s.id, "title": s.title, "visible": "true"})
+		if s.minutes > 0 {
+			sec.children = append(sec.children, el("timeLimits", map[string]string{"maxTime": strconv.Itoa(s.minutes * 60)}))
+		}
+		if test.ShuffleQuestions {
+			sec.children = append(sec.children, el("ordering", map[string]string{"shuffle": "true"}))
+		}
+		if s.instructions != "" {
+			sec.children = append(sec.children, el("rubricBlock", map[string]string{"view": "candidate"}, paragraphs(s.instructions)...))
+		}
+		sec.children = append(sec.children, s.refs...)
+		part.children = append(part.children, sec)
+	}
+
+	root := el("assessmentTest", map[string]string{"identifier": fmt.Sprintf("test_%d", test.ID), "title": test.Title})
+	if test.TimeLimitMinutes > 0 {
+		root.children = append(root.children, el("timeLimits", map[string]string{"maxTime": strconv.Itoa(test.TimeLimitMinutes * 60)}))
+	}
+	root.children = append(root.children, part)
+	return root
+}
+
+// paragraphs lays out text with blank lines between paragraphs as XHTML
+func paragraphs(text string) []*node {
+	var ps []*node
+	for _, para := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		if para = strings.TrimSpace(para); para != "" {
+			ps = append(ps, htmlEl("p", nil, textNode(para)))
+		}
+	}
+	return ps
+}
+
+// itemFor builds the assessment item of a question. Its response processing
+// sets SCORE to the question's points for a correct answer, so other
+// platforms award the same marks, and shows the explanation as feedback.
+func itemFor(q *models.Question, id string, number int, shuffle bool, image, explanationImage string) *node {
+	points := strconv.Itoa(q.Points)
+	response := el("responseDeclaration", map[string]string{"identifier": "RESPONSE"})
+	body := el("itemBody", nil)
+	if image != "" {
+		body.children = append(body.children, htmlEl("p", nil, htmlEl("img", map[string]string{"src": image, "alt": ""})))
+	}
+	body.children = append(body.children, paragraphs(q.QuestionText)...)
+
+	correct := el("correctResponse", nil)
+	value := func(v string) *node { return el("value", nil, textNode(v)) }
+	choice := func(name, id, text string, attrs map[string]string) *node {
+		if attrs == nil {
+			attrs = map[string]string{}
+		}
+		attrs["identifier"] = id
+		return el(name, attrs, textNode(text))
+	}
+	shuffled := strconv.FormatBool(shuffle && !q.KeepOptionOrder)
+
+	// The condition under which the answer earns the points
+	condition := el("match", nil, el("variable", map[string]string{"identifier": "RESPONSE"}), el("correct", map[string]string{"identifier": "RESPONSE"}))
+
+	switch {
+	case q.IsNumeric() && q.Numeric != nil:
+		response.attrs["cardinality"], response.attrs["baseType"] = "single", "float"
+		correct.children = append(correct.children, value(strconv.FormatFloat(q.Numeric.Expected, 'g', -1, 64)))
+		body.children = append(body.children, htmlEl("p", nil, el("textEntryInteraction", map[string]string{"responseIdentifier": "RESPONSE", "expectedLength": "15"})))
+		mode := "exact"
+		if q.Numeric.Tolerance > 0 {
+			mode = "absolute"
+			if q.Numeric.ToleranceType == models.TolerancePercent {
+				mode = "relative"
+			}
+		}
+		condition = el("equal", map[string]string{"toleranceMode": mode}, condition.children...)
+		if mode != "exact" {
+			tolerance := strconv.FormatFloat(q.Numeric.Tolerance, 'g', -1, 64)
+			condition.attrs["tolerance"] = tolerance + " " + tolerance
+		}
+
+	case q.IsShortAnswer():
+		response.attrs["cardinality"], response.attrs["baseType"] = "single", "string"
+		var tests []*node
+		for _, a := range q.AcceptedAnswers {
+			if a.IsRegex {
+				tests = append(tests, el("patternMatch", map[string]string{"pattern": a.AnswerText}, el("variable", map[string]string{"identifier": "RESPONSE"})))
+				continue
+			}
+			if len(correct.children) == 0 {
+				correct.children = append(correct.children, value(a.AnswerText))
+			}
+			tests = append(tests, el("stringMatch", map[string]string{"caseSensitive": strconv.FormatBool(q.CaseSensitive)},
+				el("variable", map[string]string{"identifier": "RESPONSE"}), el("baseValue", map[string]string{"baseType": "string"}, textNode(a.AnswerText))))
+		}
+		condition = el("or", nil, tests...)
+		if len(tests) == 1 {
+			condition = tests[0]
+		}
+		body.children = append(body.children, htmlEl("p", nil, el("textEntryInteraction", map[string]string{"responseIdentifier": "RESPONSE", "expectedLength": "30"})))
+
+	case q.IsOrdering():
+		response.attrs["cardinality"], response.attrs["baseType"] = "ordered", "identifier"
+		interaction := el("orderInteraction", map[string]string{"responseIdentifier": "RESPONSE", "shuffle": "true"})
+		for i, opt := range q.CorrectOrder() {
+			id := choiceID(i)
+			correct.children = append(correct.children, value(id))
+			interaction.children = append(interaction.children, choice("simpleChoice", id, opt.OptionText, nil))
+		}
+		body.children = append(body.children, interaction)
+
+	case q.IsMatching():
+		response.attrs["cardinality"], response.attrs["baseType"] = "multiple", "directedPair"
+		prompts := el("simpleMatchSet", nil)
+		targets := el("simpleMatchSet", nil)
+		matches := q.MatchChoices()
+		for j, match := range matches {
+			targets.children = append(targets.children, choice("simpleAssociableChoice", fmt.Sprintf("M%d", j+1), match, map[string]string{"matchMax": strconv.Itoa(len(q.Options))}))
+		}
+		for i, opt := range q.Options {
+			id := fmt.Sprintf("P%d", i+1)
+			prompts.children = append(prompts.children, choice("simpleAssociableChoice", id, opt.OptionText, map[string]string{"matchMax": "1"}))
+			for j, match := range matches {
+				if match == opt.MatchText {
+					correct.children = append(correct.children, value(fmt.Sprintf("%s M%d", id, j+1)))
+				}
+			}
+		}
+		body.children = append(body.children, el("matchInteraction", map[string]string{
+			"responseIdentifier": "RESPONSE", "shuffle": shuffled, "maxAssociations": strconv.Itoa(len(q.Options)),
+		}, prompts, targets))
+
+	default: // single choice, true/false and multiple select
+		response.attrs["cardinality"], response.attrs["baseType"] = "single", "identifier"
+		maxChoices := "1"
+		if q.IsMultipleSelect() {
+			response.attrs["cardinality"], maxChoices = "multiple", "0"
+		}
+		interaction := el("choiceInteraction", map[string]string{"responseIdentifier": "RESPONSE", "shuffle": shuffled, "maxChoices": maxChoices})
+		for i, opt := range q.Options {
+			id := choiceID(i)
+			if opt.IsCorrect {
+				correct.children = append(correct.children, value(id))
+			}
+			interaction.children = append(interaction.children, choice("simpleChoice", id, opt.OptionText, nil))
+		}
+		body.children = append(body.children, interaction)
+	}
+	if len(correct.children) > 0 {
+		response.children = append(response.children, correct)
+	}
+
+	score := el("outcomeDeclaration", map[string]string{"identifier": "SCORE", "cardinality": "single", "baseType": "float", "normalMaximum": points},
+		el("defaultValue", nil, value("0")))
+	setScore := func(v string) *node {
+		return el("setOutcomeValue", map[string]string{"identifier": "SCORE"}, el("baseValue", map[string]string{"baseType": "float"}, textNode(v)))
+	}
+	processing := el("responseProcessing", nil, el("responseCondition", nil,
+		el("responseIf", nil, condition, setScore(points)),
+		el("responseElse", nil, setScore("0")),
+	))
+
+	item := el("assessmentItem", map[string]string{
+		"identifier": id, "title": fmt.Sprintf("Question %d", number), "adaptive": "false", "timeDependent": "false",
+	}, response, score)
+
+	if q.Explanation != "" || explanationImage != "" {
+		item.children = append(item.children, el("outcomeDeclaration", map[string]string{"identifier": "FEEDBACK", "cardinality": "single", "baseType": "identifier"}))
+		processing.children = append(processing.children, el("setOutcomeValue", map[string]string{"identifier": "FEEDBACK"},
+			el("baseValue", map[string]string{"baseType": "identifier"}, textNode("EXPLANATION"))))
+
+		feedback := el("modalFeedback", map[string]string{"outcomeIdentifier": "FEEDBACK", "showHide": "show", "identifier": "EXPLANATION"}, paragraphs(q.Explanation)...)
+		if explanationImage != "" {
+			feedback.children = append(feedback.children, htmlEl("p", nil, htmlEl("img", map[string]string{"src": explanationImage, "alt": ""})))
+		}
+		item.children = append(item.children, body, processing, feedback)
+		return item
+	}
+	item.children = append(item.children, body, processing)
+	return item
+}
+
+// choiceID names the option at index i: A, B, C...
+func choiceID(i int) string {
+	return string(rune('A' + i))
+}
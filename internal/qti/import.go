@@ -0,0 +1,655 @@
+package qti
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"my-app/internal/models"
+)
+
+// MaxPackageSize is the largest package accepted for import
+const MaxPackageSize = 50 << 20
+
+// Import is the test a package holds, as an upload to validate and persist
+type Import struct {
+	Upload   models.TestUpload
+	Items    []Item // the item each of Upload.Questions was read from
+	Notes    *Media
+	Skipped  []Report // items that could not be imported
+	Warnings []Report // items imported with something left out
+}
+
+// Item is the package item a question was read from, with the images the
+// package carries for it
+type Item struct {
+	Identifier       string
+	Title            string
+	Image            *Media
+	ExplanationImage *Media
+}
+
+// Report explains what became of an item
+type Report struct {
+	Item    string `json:"item"`
+	Title   string `json:"title,omitempty"`
+	Problem string `json:"problem"`
+}
+
+// Read reads a QTI 2.1 or 3.0 content package. The test is made of the items
+// its assessment test lists, in order and in its sections, or of every item
+// in the manifest when it has none. Details the package does not carry, such
+// as the subject and exam standard, are taken from defaults.
+//
+// An item is skipped, and reported, when it uses an interaction no question
+// type matches or its answer key cannot be read; the rest are still imported.
+func Read(data []byte, defaults models.TestUpload) (*Import, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("the file is not a zip package")
+	}
+	p := &pkgReader{files: make(map[string]*zip.File, len(archive.File))}
+	for _, f := range archive.File {
+		p.files[path.Clean(f.Name)] = f
+	}
+
+	// The manifest is at the top of the package, or of its only folder
+	manifestPath := "imsmanifest.xml"
+	if _, ok := p.files[manifestPath]; !ok {
+		for name := range p.files {
+			if path.Base(name) == "imsmanifest.xml" && strings.Count(name, "/") == 1 {
+				manifestPath = name
+			}
+		}
+	}
+	manifest, err := p.parse(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading the manifest: %w", err)
+	}
+	base := path.Dir(manifestPath)
+
+	imp := &Import{Upload: defaults}
+	imp.Upload.Questions = nil
+	if general := manifest.find("general"); general != nil {
+		if title := langString(general.child("title")); title != "" {
+			imp.Upload.Title = title
+		}
+		if description := langString(general.child("description")); description != "" {
+			imp.Upload.Description = description
+		}
+	}
+
+	type itemRef struct{ href, section string }
+	var refs []itemRef
+	var notesHref string
+	resources := manifest.findAll("resource")
+	for _, res := range resources {
+		kind, href := res.attr("type"), res.attr("href")
+		if strings.HasPrefix(kind, "imsqti_test") && refs == nil {
+			testPath := path.Join(base, href)
+			test, err := p.parse(testPath)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", href, err)
+			}
+			for _, s := range readTest(test, &imp.Upload) {
+				for _, ref := range s.refs {
+					refs = append(refs, itemRef{href: path.Join(path.Dir(testPath), ref), section: s.title})
+				}
+			}
+		}
+		if kind == "webcontent" && notesHref == "" && isNotesFile(href) {
+			notesHref = path.Join(base, href)
+		}
+	}
+	if refs == nil {
+		for _, res := range resources {
+			if strings.HasPrefix(res.attr("type"), "imsqti_item") {
+				refs = append(refs, itemRef{href: path.Join(base, res.attr("href"))})
+			}
+		}
+	}
+	if len(refs) == 0 {
+		return nil, errors.New("the package lists no assessment items")
+	}
+
+	shuffled := false
+	var keepOrder []bool
+	for _, ref := range refs {
+		root, err := p.parse(ref.href)
+		if err != nil {
+			imp.Skipped = append(imp.Skipped, Report{Item: path.Base(ref.href), Problem: "could not be read: " + err.Error()})
+			continue
+		}
+		item := Item{Identifier: root.attr("identifier"), Title: root.attr("title")}
+		if item.Identifier == "" {
+			item.Identifier = path.Base(ref.href)
+		}
+		report := func(problem string) Report {
+			return Report{Item: item.Identifier, Title: item.Title, Problem: problem}
+		}
+
+		q, shuffle, problem := readItem(root)
+		if problem != "" {
+			imp.Skipped = append(imp.Skipped, report(problem))
+			continue
+		}
+		q.Section = ref.section
+
+		// Images carried in the package are stored with the test; others
+		// are linked to
+		for _, img := range []struct {
+			src    string
+			url    *string
+			stored **Media
+		}{
+			{itemImage(root.child("itemBody")), &q.ImageURL, &item.Image},
+			{itemImage(feedbackOf(root)), &q.ExplanationImageURL, &item.ExplanationImage},
+		} {
+			switch {
+			case img.src == "" || strings.HasPrefix(img.src, "data:"):
+			case strings.HasPrefix(img.src, "http://") || strings.HasPrefix(img.src, "https://"):
+				*img.url = img.src
+			default:
+				media, err := p.media(path.Join(path.Dir(ref.href), img.src))
+				if err != nil {
+					imp.Warnings = append(imp.Warnings, report(fmt.Sprintf("imported without its image %s: %v", img.src, err)))
+					continue
+				}
+				*img.stored = media
+			}
+		}
+
+		shuffled = shuffled || shuffle
+		keepOrder = append(keepOrder, !shuffle && q.QuestionType != models.QuestionTypeOrdering &&
+			q.QuestionType != models.QuestionTypeNumeric && q.QuestionType != models.QuestionTypeShortAnswer)
+		imp.Upload.Questions = append(imp.Upload.Questions, q)
+		imp.Items = append(imp.Items, item)
+	}
+
+	// Options are shuffled when any item shuffles them, except in the
+	// items that keep theirs in order
+	imp.Upload.ShuffleOptions = shuffled
+	if shuffled {
+		for i := range imp.Upload.Questions {
+			imp.Upload.Questions[i].KeepOptionOrder = keepOrder[i]
+		}
+	}
+
+	// Sections the skipped items were in may be left empty
+	if len(imp.Upload.Sections) > 0 {
+		used := make(map[string]bool)
+		for _, q := range imp.Upload.Questions {
+			used[q.Section] = true
+		}
+		kept := imp.Upload.Sections[:0]
+		for _, s := range imp.Upload.Sections {
+			if used[s.Title] {
+				kept = append(kept, s)
+			}
+		}
+		imp.Upload.Sections = kept
+	}
+
+	if notesHref == "" {
+		for name := range p.files {
+			if strings.HasPrefix(name, path.Join(base, "notes")+"/") && isNotesFile(name) {
+				notesHref = name
+			}
+		}
+	}
+	if notesHref != "" {
+		if imp.Notes, err = p.media(notesHref); err != nil {
+			return nil, fmt.Errorf("reading the notes: %w", err)
+		}
+	}
+	return imp, nil
+}
+
+// pkgReader reads the files of a package
+type pkgReader struct {
+	files map[string]*zip.File
+}
+
+func (p *pkgReader) open(name string) ([]byte, error) {
+	f, ok := p.files[path.Clean(name)]
+	if !ok {
+		return nil, fmt.Errorf("%s is not in the package", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, MaxPackageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxPackageSize {
+		return nil, fmt.Errorf("%s is too large", name)
+	}
+	return data, nil
+}
+
+func (p *pkgReader) parse(name string) (*node, error) {
+	data, err := p.open(name)
+	if err != nil {
+		return nil, err
+	}
+	return parseXML(bytes.NewReader(data))
+}
+
+func (p *pkgReader) media(name string) (*Media, error) {
+	data, err := p.open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Media{Name: path.Base(name), Data: data}, nil
+}
+
+// testSection is a section of an assessment test and the items it lists
+type testSection struct {
+	title string
+	refs  []string
+}
+
+// readTest reads the title, time limit, question order and sections of an
+// assessment test into the upload, returning its sections in order
+func readTest(test *node, upload *models.TestUpload) []testSection {
+	if title := strings.TrimSpace(test.attr("title")); title != "" {
+		upload.Title = title
+	}
+	if limits := test.child("timeLimits"); limits != nil {
+		if minutes := minutesOf(limits); minutes > 0 {
+			upload.TimeLimitMinutes = minutes
+		}
+	}
+
+	var sections []testSection
+	var uploads []models.SectionUpload
+	instructions := ""
+	for _, s := range test.findAll("assessmentSection") {
+		refs := s.childrenNamed("assessmentItemRef")
+		if len(refs) == 0 {
+			continue
+		}
+		section := testSection{title: strings.TrimSpace(s.attr("title"))}
+		if section.title == "" {
+			section.title = fmt.Sprintf("Section %d", len(sections)+1)
+		}
+		for _, ref := range refs {
+			section.refs = append(section.refs, ref.attr("href"))
+		}
+		if ordering := s.child("ordering"); ordering != nil && ordering.attr("shuffle") == "true" {
+			upload.ShuffleQuestions = true
+		}
+
+		upload := models.SectionUpload{Title: section.title}
+		if rubric := s.child("rubricBlock"); rubric != nil {
+			upload.Instructions = rubric.plainText(nil)
+			if instructions == "" {
+				instructions = upload.Instructions
+			}
+		}
+		if limits := s.child("timeLimits"); limits != nil {
+			upload.TimeLimitMinutes = minutesOf(limits)
+		}
+		sections = append(sections, section)
+		uploads = append(uploads, upload)
+	}
+
+	// One section is the whole test; its instructions describe it
+	if len(sections) == 1 {
+		sections[0].title = ""
+		if upload.Description == "" {
+			upload.Description = instructions
+		}
+		return sections
+	}
+	upload.Sections = uploads
+	return sections
+}
+
+// minutesOf reads a timeLimits maxTime, given in seconds, in whole minutes
+func minutesOf(limits *node) int {
+	seconds, err := strconv.ParseFloat(limits.attr("maxTime"), 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return int(math.Ceil(seconds / 60))
+}
+
+// readItem reads an assessment item as a question. It returns why the item
+// cannot be imported instead when it cannot, and whether its options shuffle.
+func readItem(item *node) (q models.QuestionUpload, shuffle bool, problem string) {
+	if item.name != "assessmentItem" {
+		return q, false, "is not an assessment item"
+	}
+	body := item.child("itemBody")
+	if body == nil {
+		return q, false, "has no item body"
+	}
+
+	interactions := collect(body, isInteraction)
+	switch len(interactions) {
+	case 0:
+		return q, false, "has no interaction to answer"
+	case 1:
+	default:
+		return q, false, fmt.Sprintf("has %d interactions; only items with one can be imported", len(interactions))
+	}
+	interaction := interactions[0]
+
+	q.QuestionText = body.plainText(func(n *node) bool { return isInteraction(n) || n.name == "img" })
+	if prompt := interaction.child("prompt"); prompt != nil {
+		q.QuestionText = strings.TrimSpace(q.QuestionText + "\n\n" + prompt.plainText(nil))
+	}
+	if q.QuestionText == "" {
+		q.QuestionText = strings.TrimSpace(item.attr("title"))
+	}
+	q.Points = itemPoints(item)
+	if feedback := feedbackOf(item); feedback != nil {
+		q.Explanation = feedback.plainText(func(n *node) bool { return n.name == "img" })
+	}
+
+	declaration := responseDeclaration(item, interaction.attr("responseIdentifier"))
+	var correct []string
+	if declaration != nil {
+		if c := declaration.child("correctResponse"); c != nil {
+			for _, v := range c.childrenNamed("value") {
+				correct = append(correct, strings.TrimSpace(v.plainText(nil)))
+			}
+		}
+	}
+	shuffle = interaction.attr("shuffle") == "true"
+
+	switch interaction.name {
+	case "choiceInteraction":
+		ids, texts := choices(interaction, "simpleChoice")
+		q.Options = texts
+		indices, problem := indicesOf(correct, ids)
+		if problem != "" {
+			return q, shuffle, problem
+		}
+		multiple := interaction.attr("maxChoices") != "1" || (declaration != nil && declaration.attr("cardinality") == "multiple")
+		if multiple {
+			q.QuestionType = models.QuestionTypeMultipleSelect
+			q.CorrectIndices = indices
+			return q, shuffle, ""
+		}
+		if len(indices) != 1 {
+			return q, shuffle, "has more than one correct choice but lets students pick only one"
+		}
+		q.QuestionType = models.QuestionTypeSingleChoice
+		q.CorrectIndex = indices[0]
+		if len(texts) == 2 && strings.EqualFold(texts[0], models.TrueFalseOptions[0]) && strings.EqualFold(texts[1], models.TrueFalseOptions[1]) {
+			q.QuestionType = models.QuestionTypeTrueFalse
+			q.Options = nil
+		}
+		return q, shuffle, ""
+
+	case "orderInteraction":
+		ids, texts := choices(interaction, "simpleChoice")
+		indices, problem := indicesOf(correct, ids)
+		if problem != "" {
+			return q, false, problem
+		}
+		if len(indices) != len(ids) {
+			return q, false, "its correct order does not list every choice"
+		}
+		q.QuestionType = models.QuestionTypeOrdering
+		for _, i := range indices {
+			q.Options = append(q.Options, texts[i])
+		}
+		return q, false, ""
+
+	case "matchInteraction":
+		sets := interaction.childrenNamed("simpleMatchSet")
+		if len(sets) != 2 {
+			return q, shuffle, "is a match interaction without two sets to match"
+		}
+		promptIDs, prompts := choices(sets[0], "simpleAssociableChoice")
+		targetIDs, targets := choices(sets[1], "simpleAssociableChoice")
+		matches := make(map[string]string, len(correct))
+		for _, pair := range correct {
+			ends := strings.Fields(pair)
+			if len(ends) != 2 {
+				continue
+			}
+			if i := indexOf(targetIDs, ends[1]); i >= 0 {
+				matches[ends[0]] = targets[i]
+			} else if i := indexOf(targetIDs, ends[0]); i >= 0 {
+				matches[ends[1]] = targets[i]
+			}
+		}
+		q.QuestionType = models.QuestionTypeMatching
+		for i, id := range promptIDs {
+			match, ok := matches[id]
+			if !ok {
+				return q, shuffle, fmt.Sprintf("has no correct match for %q", prompts[i])
+			}
+			q.Pairs = append(q.Pairs, models.MatchPair{Prompt: prompts[i], Match: match})
+		}
+		return q, shuffle, ""
+
+	case "textEntryInteraction":
+		baseType := ""
+		if declaration != nil {
+			baseType = declaration.attr("baseType")
+		}
+		if baseType == "float" || baseType == "integer" {
+			if len(correct) == 0 {
+				return q, false, "has no correct answer"
+			}
+			expected, err := strconv.ParseFloat(correct[0], 64)
+			if err != nil {
+				return q, false, fmt.Sprintf("has a correct answer %q that is not a number", correct[0])
+			}
+			q.QuestionType = models.QuestionTypeNumeric
+			q.Numeric = &models.NumericAnswer{Expected: expected, ToleranceType: models.ToleranceAbsolute}
+			if equal := item.find("equal"); equal != nil {
+				if fields := strings.Fields(equal.attr("tolerance")); len(fields) > 0 {
+					q.Numeric.Tolerance, _ = strconv.ParseFloat(fields[0], 64)
+				}
+				if equal.attr("toleranceMode") == "relative" {
+					q.Numeric.ToleranceType = models.TolerancePercent
+				}
+			}
+			return q, false, ""
+		}
+
+		q.QuestionType = models.QuestionTypeShortAnswer
+		seen := make(map[string]bool)
+		accept := func(answer string) {
+			if answer = strings.TrimSpace(answer); answer != "" && !seen[answer] {
+				seen[answer] = true
+				q.AcceptedAnswers = append(q.AcceptedAnswers, answer)
+			}
+		}
+		for _, answer := range correct {
+			accept(answer)
+		}
+		for _, entry := range item.findAll("mapEntry") {
+			if value, err := strconv.ParseFloat(entry.attr("mappedValue"), 64); err == nil && value > 0 {
+				accept(entry.attr("mapKey"))
+			}
+			q.CaseSensitive = q.CaseSensitive || entry.attr("caseSensitive") == "true"
+		}
+		for _, match := range item.findAll("stringMatch") {
+			if value := match.child("baseValue"); value != nil {
+				accept(value.plainText(nil))
+			}
+			q.CaseSensitive = q.CaseSensitive || match.attr("caseSensitive") == "true"
+		}
+		for _, match := range item.findAll("patternMatch") {
+			if pattern := match.attr("pattern"); pattern != "" {
+				q.AcceptedPatterns = append(q.AcceptedPatterns, pattern)
+			}
+		}
+		if len(q.AcceptedAnswers)+len(q.AcceptedPatterns) == 0 {
+			return q, false, "has no correct answer"
+		}
+		return q, false, ""
+	}
+
+	kind := strings.ReplaceAll(kebabCase(interaction.name), "-", " ")
+	article := "a"
+	if strings.ContainsRune("aeiou", rune(kind[0])) {
+		article = "an"
+	}
+	return q, false, fmt.Sprintf("uses %s %s, which no question type matches", article, kind)
+}
+
+// isInteraction reports whether the element is one a student answers
+func isInteraction(n *node) bool {
+	return strings.HasSuffix(n.name, "Interaction")
+}
+
+// collect returns the elements matching, without looking inside them
+func collect(n *node, match func(*node) bool) []*node {
+	var found []*node
+	for _, c := range n.children {
+		if c.name == "" {
+			continue
+		}
+		if match(c) {
+			found = append(found, c)
+			continue
+		}
+		found = append(found, collect(c, match)...)
+	}
+	return found
+}
+
+// responseDeclaration finds the declaration of the response with the
+// identifier, or the item's only one
+func responseDeclaration(item *node, identifier string) *node {
+	declarations := item.childrenNamed("responseDeclaration")
+	for _, d := range declarations {
+		if d.attr("identifier") == identifier {
+			return d
+		}
+	}
+	if len(declarations) == 1 {
+		return declarations[0]
+	}
+	return nil
+}
+
+// choices reads the identifiers and texts of an interaction's choices
+func choices(n *node, name string) (ids, texts []string) {
+	for _, c := range n.childrenNamed(name) {
+		ids = append(ids, c.attr("identifier"))
+		texts = append(texts, c.plainText(func(n *node) bool { return n.name == "feedbackInline" }))
+	}
+	return ids, texts
+}
+
+// indicesOf finds the position of each correct choice
+func indicesOf(correct, ids []string) ([]int, string) {
+	if len(correct) == 0 {
+		return nil, "has no correct response"
+	}
+	indices := make([]int, 0, len(correct))
+	for _, id := range correct {
+		i := indexOf(ids, id)
+		if i < 0 {
+			return nil, fmt.Sprintf("has a correct response %q that is not one of its choices", id)
+		}
+		indices = append(indices, i)
+	}
+	return indices, ""
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// itemPoints reads what an item is worth: SCORE's normal maximum, else the
+// most a response can set SCORE to, else its mapping's upper bound, else 1
+func itemPoints(item *node) int {
+	points := 0.0
+	for _, d := range item.childrenNamed("outcomeDeclaration") {
+		if d.attr("identifier") == "SCORE" {
+			points, _ = strconv.ParseFloat(d.attr("normalMaximum"), 64)
+		}
+	}
+	if points <= 0 {
+		for _, set := range item.findAll("setOutcomeValue") {
+			if set.attr("identifier") != "SCORE" {
+				continue
+			}
+			if value := set.child("baseValue"); value != nil {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(value.plainText(nil)), 64); err == nil && v > points {
+					points = v
+				}
+			}
+		}
+	}
+	if points <= 0 {
+		if mapping := item.find("mapping"); mapping != nil {
+			points, _ = strconv.ParseFloat(mapping.attr("upperBound"), 64)
+		}
+	}
+	if points < 1 {
+		return 1
+	}
+	return int(math.Round(points))
+}
+
+// feedbackOf returns the feedback an item shows once answered, which holds
+// its worked solution, or nil
+func feedbackOf(item *node) *node {
+	if feedback := item.child("modalFeedback"); feedback != nil {
+		return feedback
+	}
+	return item.find("feedbackBlock")
+}
+
+// itemImage returns the source of the first image in the content, outside
+// any interaction
+func itemImage(content *node) string {
+	if content == nil {
+		return ""
+	}
+	images := collect(content, func(n *node) bool { return n.name == "img" || isInteraction(n) })
+	for _, img := range images {
+		if img.name == "img" {
+			return img.attr("src")
+		}
+	}
+	if content.name == "img" {
+		return content.attr("src")
+	}
+	return ""
+}
+
+// langString reads a LOM langstring, which holds its text in a string element
+func langString(n *node) string {
+	if n == nil {
+		return ""
+	}
+	if s := n.child("string"); s != nil {
+		n = s
+	}
+	return strings.TrimSpace(n.plainText(nil))
+}
+
+// isNotesFile reports whether a file could be a test's notes
+func isNotesFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".pdf", ".ppt", ".pptx":
+		return true
+	}
+	return false
+}
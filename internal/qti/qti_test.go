@@ -0,0 +1,212 @@
+package qti
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"my-app/internal/models"
+)
+
+func intPtr(i int) *int       { return &i }
+func strPtr(s string) *string { return &s }
+func option(text string, correct bool) models.AnswerOption {
+	return models.AnswerOption{OptionText: text, IsCorrect: correct}
+}
+
+// sampleTest is a test with a question of every type, in two sections
+func sampleTest() *models.Test {
+	return &models.Test{
+		ID: 7, Title: "Forces", Description: "Newton's laws", TimeLimitMinutes: 30,
+		ShuffleOptions: true,
+		Sections: []models.Section{
+			{ID: 1, Title: "Warm up", Instructions: "Answer quickly.", TimeLimitMinutes: 5},
+			{ID: 2, Title: "Main", Instructions: "Show your working."},
+		},
+		Questions: []models.Question{
+			{QuestionText: "What is the unit of force?", QuestionType: models.QuestionTypeSingleChoice, Points: 2,
+				SectionID: intPtr(1), ImageURL: strPtr("/assets/uploads/7/question_1.png"), Explanation: "It is named after Newton.",
+				Options: []models.AnswerOption{option("Joule", false), option("Newton", true), option("Watt", false)}},
+			{QuestionText: "Friction always opposes motion.", QuestionType: models.QuestionTypeTrueFalse, Points: 1,
+				SectionID: intPtr(1), KeepOptionOrder: true,
+				Options: []models.AnswerOption{option("True", true), option("False", false)}},
+			{QuestionText: "Which are vectors?", QuestionType: models.QuestionTypeMultipleSelect, Points: 2, SectionID: intPtr(2),
+				Options: []models.AnswerOption{option("Velocity", true), option("Speed", false), option("Force", true)}},
+			{QuestionText: "A 2 kg mass accelerates at 3 m/s². What is the force in N?", QuestionType: models.QuestionTypeNumeric, Points: 3,
+				SectionID: intPtr(2), Numeric: &models.NumericAnswer{Expected: 6, Tolerance: 5, ToleranceType: models.TolerancePercent}},
+			{QuestionText: "Name the law F = ma.", QuestionType: models.QuestionTypeShortAnswer, Points: 1, SectionID: intPtr(2),
+				AcceptedAnswers: []models.AcceptedAnswer{{AnswerText: "Newton's second law"}, {AnswerText: "(?i)second law", IsRegex: true}}},
+			{QuestionText: "Order by size.", QuestionType: models.QuestionTypeOrdering, Points: 1, SectionID: intPtr(2),
+				Options: []models.AnswerOption{{OptionText: "Atom", OptionOrder: 1}, {OptionText: "Cell", OptionOrder: 2}, {OptionText: "Planet", OptionOrder: 3}}},
+			{QuestionText: "Match each quantity to its unit.", QuestionType: models.QuestionTypeMatching, Points: 2, SectionID: intPtr(2),
+				Options: []models.AnswerOption{{OptionText: "Force", MatchText: "N"}, {OptionText: "Energy", MatchText: "J"}, {OptionText: "Work", MatchText: "J"}}},
+		},
+	}
+}
+
+func TestExportReadRoundTrip(t *testing.T) {
+	for _, version := range []string{Version21, Version30} {
+		t.Run(version, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Export(&buf, Package{
+				Test:   sampleTest(),
+				Images: map[string][]byte{"/assets/uploads/7/question_1.png": []byte("png")},
+				Notes:  &Media{Name: "forces.pdf", Data: []byte("%PDF")},
+			}, version)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			imp, err := Read(buf.Bytes(), models.TestUpload{Subject: "Physics", ExamStandard: "GCSE", Difficulty: "Medium", PassingScore: 60})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(imp.Skipped) != 0 || len(imp.Warnings) != 0 {
+				t.Fatalf("expected every item imported, got skipped %v and warnings %v", imp.Skipped, imp.Warnings)
+			}
+			u := imp.Upload
+			if u.Title != "Forces" || u.Description != "Newton's laws" || u.TimeLimitMinutes != 30 || u.Subject != "Physics" || !u.ShuffleOptions {
+				t.Errorf("unexpected test details: %+v", u)
+			}
+			wantSections := []models.SectionUpload{
+				{Title: "Warm up", Instructions: "Answer quickly.", TimeLimitMinutes: 5},
+				{Title: "Main", Instructions: "Show your working."},
+			}
+			if !reflect.DeepEqual(u.Sections, wantSections) {
+				t.Errorf("expected sections %+v, got %+v", wantSections, u.Sections)
+			}
+
+			want := []models.QuestionUpload{
+				{QuestionText: "What is the unit of force?", QuestionType: models.QuestionTypeSingleChoice, Points: 2, Section: "Warm up",
+					Options: []string{"Joule", "Newton", "Watt"}, CorrectIndex: 1, Explanation: "It is named after Newton."},
+				{QuestionText: "Friction always opposes motion.", QuestionType: models.QuestionTypeTrueFalse, Points: 1, Section: "Warm up",
+					KeepOptionOrder: true},
+				{QuestionText: "Which are vectors?", QuestionType: models.QuestionTypeMultipleSelect, Points: 2, Section: "Main",
+					Options: []string{"Velocity", "Speed", "Force"}, CorrectIndices: []int{0, 2}},
+				{QuestionText: "A 2 kg mass accelerates at 3 m/s². What is the force in N?", QuestionType: models.QuestionTypeNumeric, Points: 3,
+					Section: "Main", Numeric: &models.NumericAnswer{Expected: 6, Tolerance: 5, ToleranceType: models.TolerancePercent}},
+				{QuestionText: "Name the law F = ma.", QuestionType: models.QuestionTypeShortAnswer, Points: 1, Section: "Main",
+					AcceptedAnswers: []string{"Newton's second law"}, AcceptedPatterns: []string{"(?i)second law"}},
+				{QuestionText: "Order by size.", QuestionType: models.QuestionTypeOrdering, Points: 1, Section: "Main",
+					Options: []string{"Atom", "Cell", "Planet"}},
+				{QuestionText: "Match each quantity to its unit.", QuestionType: models.QuestionTypeMatching, Points: 2, Section: "Main",
+					Pairs: []models.MatchPair{{Prompt: "Force", Match: "N"}, {Prompt: "Energy", Match: "J"}, {Prompt: "Work", Match: "J"}}},
+			}
+			if len(u.Questions) != len(want) {
+				t.Fatalf("expected %d questions, got %d", len(want), len(u.Questions))
+			}
+			for i := range want {
+				if !reflect.DeepEqual(u.Questions[i], want[i]) {
+					t.Errorf("question %d: expected\n%+v\ngot\n%+v", i+1, want[i], u.Questions[i])
+				}
+			}
+
+			if image := imp.Items[0].Image; image == nil || string(image.Data) != "png" || image.Name != "1_question_1.png" {
+				t.Errorf("expected the first question's image read from the package, got %+v", image)
+			}
+			if imp.Notes == nil || imp.Notes.Name != "forces.pdf" || string(imp.Notes.Data) != "%PDF" {
+				t.Errorf("expected the notes read from the package, got %+v", imp.Notes)
+			}
+		})
+	}
+}
+
+// qtiPackage builds a package of QTI 3.0 items, with no assessment test
+func qtiPackage(t *testing.T, items ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	var resources strings.Builder
+	add := func(name, content string) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	for i, item := range items {
+		href := "items/" + string(rune('a'+i)) + ".xml"
+		add(href, item)
+		resources.WriteString(`<resource identifier="r` + string(rune('a'+i)) + `" type="imsqti_item_xmlv3p0" href="` + href + `"/>`)
+	}
+	add("imsmanifest.xml", `<manifest xmlns="http://www.imsglobal.org/xsd/qti/qtiv3p0/imscp_v1p1"><resources>`+resources.String()+`</resources></manifest>`)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadReportsUnsupportedItems(t *testing.T) {
+	data := qtiPackage(t,
+		`<qti-assessment-item identifier="essay" title="Essay">
+			<qti-response-declaration identifier="RESPONSE" cardinality="single" base-type="string"/>
+			<qti-item-body><qti-extended-text-interaction response-identifier="RESPONSE"><qti-prompt>Discuss.</qti-prompt></qti-extended-text-interaction></qti-item-body>
+		</qti-assessment-item>`,
+		`<qti-assessment-item identifier="capital" title="Capital">
+			<qti-response-declaration identifier="RESPONSE" cardinality="single" base-type="identifier">
+				<qti-correct-response><qti-value>B</qti-value></qti-correct-response>
+			</qti-response-declaration>
+			<qti-outcome-declaration identifier="SCORE" cardinality="single" base-type="float"/>
+			<qti-item-body>
+				<p>Which city is the capital of <b>France</b>?</p>
+				<p><img src="../media/map.png" alt=""/></p>
+				<qti-choice-interaction response-identifier="RESPONSE" max-choices="1" shuffle="true">
+					<qti-simple-choice identifier="A">Lyon</qti-simple-choice>
+					<qti-simple-choice identifier="B">Paris</qti-simple-choice>
+				</qti-choice-interaction>
+			</qti-item-body>
+			<qti-response-processing>
+				<qti-response-condition><qti-response-if>
+					<qti-match><qti-variable identifier="RESPONSE"/><qti-correct identifier="RESPONSE"/></qti-match>
+					<qti-set-outcome-value identifier="SCORE"><qti-base-value base-type="float">3</qti-base-value></qti-set-outcome-value>
+				</qti-response-if></qti-response-condition>
+			</qti-response-processing>
+		</qti-assessment-item>`,
+		`<qti-assessment-item identifier="nokey" title="No key">
+			<qti-response-declaration identifier="RESPONSE" cardinality="single" base-type="identifier"/>
+			<qti-item-body><qti-choice-interaction response-identifier="RESPONSE" max-choices="1">
+				<qti-simple-choice identifier="A">Yes</qti-simple-choice><qti-simple-choice identifier="B">No</qti-simple-choice>
+			</qti-choice-interaction></qti-item-body>
+		</qti-assessment-item>`,
+	)
+
+	imp, err := Read(data, models.TestUpload{Title: "Geography"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSkipped := []Report{
+		{Item: "essay", Title: "Essay", Problem: "uses an extended text interaction, which no question type matches"},
+		{Item: "nokey", Title: "No key", Problem: "has no correct response"},
+	}
+	if !reflect.DeepEqual(imp.Skipped, wantSkipped) {
+		t.Errorf("expected skipped %+v, got %+v", wantSkipped, imp.Skipped)
+	}
+	if len(imp.Warnings) != 1 || imp.Warnings[0].Item != "capital" {
+		t.Errorf("expected a warning for the missing image, got %+v", imp.Warnings)
+	}
+
+	if imp.Upload.Title != "Geography" || len(imp.Upload.Questions) != 1 || len(imp.Items) != 1 {
+		t.Fatalf("expected the one supported item imported, got %+v", imp.Upload)
+	}
+	want := models.QuestionUpload{
+		QuestionText: "Which city is the capital of France?", QuestionType: models.QuestionTypeSingleChoice,
+		Points: 3, Options: []string{"Lyon", "Paris"}, CorrectIndex: 1,
+	}
+	if got := imp.Upload.Questions[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected\n%+v\ngot\n%+v", want, got)
+	}
+	if !imp.Upload.ShuffleOptions {
+		t.Error("expected options shuffled as the item asks")
+	}
+}
+
+func TestReadRejectsNonPackages(t *testing.T) {
+	if _, err := Read([]byte("not a zip"), models.TestUpload{}); err == nil {
+		t.Error("expected a file that is not a zip rejected")
+	}
+	if _, err := Read(qtiPackage(t), models.TestUpload{}); err == nil {
+		t.Error("expected a package without items rejected")
+	}
+}
@@ -0,0 +1,284 @@
+// Package qti converts tests to and from IMS QTI content packages, the zip
+// files other assessment platforms and exam board item banks exchange
+// questions in. Packages of QTI 2.1 and QTI 3.0 are both read and written.
+//
+// Items are read into a generic element tree with QTI 2.1 names, QTI 3.0's
+// "qti-" prefixed kebab-case names being mapped onto them, so one reader
+// handles either version. The writer builds the same tree and names its
+// elements for the version asked for.
+package qti
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Versions of QTI packages
+const (
+	Version21 = "2.1"
+	Version30 = "3.0"
+)
+
+// node is an XML element, or a run of text when it has no name
+type node struct {
+	name     string
+	attrs    map[string]string
+	children []*node
+	text     string
+	html     bool // an XHTML element, named the same in every version
+}
+
+// el builds a QTI element
+func el(name string, attrs map[string]string, children ...*node) *node {
+	return &node{name: name, attrs: attrs, children: children}
+}
+
+// htmlEl builds an XHTML element of an item's content
+func htmlEl(name string, attrs map[string]string, children ...*node) *node {
+	return &node{name: name, attrs: attrs, children: children, html: true}
+}
+
+// textNode builds a run of text
+func textNode(text string) *node {
+	return &node{text: text}
+}
+
+// attr returns the value of an attribute, or "" when it is not set
+func (n *node) attr(name string) string {
+	return n.attrs[name]
+}
+
+// child returns the first child element with the name, or nil
+func (n *node) child(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// childrenNamed returns the child elements with the name
+func (n *node) childrenNamed(name string) []*node {
+	var found []*node
+	for _, c := range n.children {
+		if c.name == name {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+// find returns the first element with the name at any depth, or nil
+func (n *node) find(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+		if found := c.find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findAll returns every element with the name at any depth, in document order
+func (n *node) findAll(name string) []*node {
+	var found []*node
+	for _, c := range n.children {
+		if c.name == name {
+			found = append(found, c)
+		}
+		found = append(found, c.findAll(name)...)
+	}
+	return found
+}
+
+// blockElements end a line when their text is read
+var blockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "pre": true, "tr": true, "blockquote": true,
+}
+
+// plainText reads the text of the element as lines, skipping the elements
+// named in skip
+func (n *node) plainText(skip func(*node) bool) string {
+	var b strings.Builder
+	var walk func(*node)
+	walk = func(n *node) {
+		for _, c := range n.children {
+			switch {
+			case c.name == "":
+				b.WriteString(c.text)
+			case skip != nil && skip(c):
+			default:
+				if blockElements[c.name] {
+					b.WriteString("\n")
+				}
+				walk(c)
+				if blockElements[c.name] {
+					b.WriteString("\n")
+				}
+			}
+		}
+	}
+	walk(n)
+
+	// Collapse the layout whitespace within lines, and keep paragraphs
+	// apart by a blank line
+	var lines []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n\n")
+}
+
+// parseXML reads an XML document into an element tree, mapping QTI 3.0 names
+// onto their QTI 2.1 equivalents
+func parseXML(r io.Reader) (*node, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	root := &node{}
+	stack := []*node{root}
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parent := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{name: qti21Name(t.Name.Local), attrs: make(map[string]string, len(t.Attr))}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+					continue
+				}
+				n.attrs[camelCase(a.Name.Local)] = a.Value
+			}
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			parent.children = append(parent.children, textNode(string(t)))
+		}
+	}
+	for _, c := range root.children {
+		if c.name != "" {
+			return c, nil
+		}
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// qti21Name maps a QTI 3.0 element name such as "qti-choice-interaction" to
+// its QTI 2.1 name, "choiceInteraction"; other names are kept
+func qti21Name(name string) string {
+	if rest, ok := strings.CutPrefix(name, "qti-"); ok {
+		return camelCase(rest)
+	}
+	return name
+}
+
+// camelCase turns a kebab-case name into camelCase
+func camelCase(name string) string {
+	if !strings.Contains(name, "-") {
+		return name
+	}
+	parts := strings.Split(name, "-")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// kebabCase turns a camelCase name into kebab-case
+func kebabCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// writeXML writes the element tree as an XML document, naming its elements
+// and attributes for the version
+func writeXML(root *node, version string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+
+	var write func(*node) error
+	write = func(n *node) error {
+		if n.name == "" {
+			return enc.EncodeToken(xml.CharData(n.text))
+		}
+		name := n.name
+		if version == Version30 && !n.html && !strings.Contains(name, ":") {
+			name = "qti-" + kebabCase(name)
+		}
+		start := xml.StartElement{Name: xml.Name{Local: name}}
+		for _, key := range sortedKeys(n.attrs) {
+			attrName := key
+			if version == Version30 && !strings.Contains(key, ":") {
+				attrName = kebabCase(key)
+			}
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: attrName}, Value: n.attrs[key]})
+		}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, c := range n.children {
+			if err := write(c); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	}
+	if err := write(root); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// sortedKeys orders attributes for writing: xmlns first, as readers expect,
+// then alphabetically
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if (keys[i] == "xmlns") != (keys[j] == "xmlns") {
+			return keys[i] == "xmlns"
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -2,12 +2,14 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"my-app/internal/models"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -33,20 +35,59 @@ type AttemptSearchFilter struct {
 	ScoreMax    *int
 }
 
+// TypedAnswerCount is one distinct text students typed for a question and how often
+type TypedAnswerCount struct {
+	Text          string
+	MatchedAnswer *string
+	IsCorrect     bool
+	Count         int
+}
+
+// HintUse is one hint a student revealed during an attempt at a test
+type HintUse struct {
+	AttemptID  int
+	Username   string
+	StartedAt  time.Time
+	Practice   bool
+	QuestionID int
+	HintOrder  *int // nil once the hint has been deleted
+	Penalty    float64
+}
+
 // NewAttemptRepository creates a new attempt repository
 func NewAttemptRepository(pool *pgxpool.Pool) *AttemptRepository {
 	return &AttemptRepository{pool: pool}
 }
 
+// attemptColumns are the test_attempts columns scanAttempt reads
+const attemptColumns = `id, user_id, test_id, started_at, completed_at, score,
+		       total_points, time_taken_seconds, status,
+		       shuffle_seed, question_order, option_order, deadline_at, practice, grade,
+		       section_id, section_starts, sections_left, revision_id, created_at`
+
+// scanAttempt reads a row selected with attemptColumns
+func scanAttempt(row pgx.Row, attempt *models.TestAttempt) error {
+	return row.Scan(
+		&attempt.ID, &attempt.UserID, &attempt.TestID, &attempt.StartedAt,
+		&attempt.CompletedAt, &attempt.Score, &attempt.TotalPoints,
+		&attempt.TimeTakenSeconds, &attempt.Status,
+		&attempt.ShuffleSeed, &attempt.QuestionOrder, &attempt.OptionOrder, &attempt.Deadline, &attempt.Practice, &attempt.Grade,
+		&attempt.SectionID, &attempt.SectionStarts, &attempt.SectionsLeft, &attempt.RevisionID, &attempt.CreatedAt,
+	)
+}
+
 // Create creates a new test attempt
 func (r *AttemptRepository) Create(ctx context.Context, attempt *models.TestAttempt) error {
 	query := `
-		INSERT INTO test_attempts (user_id, test_id, started_at, status)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO test_attempts (user_id, test_id, started_at, status, shuffle_seed, question_order, option_order, deadline_at, practice,
+		                           section_id, section_starts, revision_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id, created_at`
 
 	return r.pool.QueryRow(ctx, query,
 		attempt.UserID, attempt.TestID, attempt.StartedAt, attempt.Status,
+		attempt.ShuffleSeed, attempt.QuestionOrder, attempt.OptionOrder, attempt.Deadline, attempt.Practice,
+		attempt.SectionID, attempt.SectionStarts, attempt.RevisionID,
 	).Scan(&attempt.ID, &attempt.CreatedAt)
 }
 
@@ -54,55 +95,217 @@ func (r *AttemptRepository) Create(ctx context.Context, attempt *models.TestAtte
 func (r *AttemptRepository) GetByID(ctx context.Context, id int) (*models.TestAttempt, error) {
 	attempt := &models.TestAttempt{}
 	query := `
-		SELECT id, user_id, test_id, started_at, completed_at, score,
-		       total_points, time_taken_seconds, status, created_at
+		SELECT ` + attemptColumns + `
 		FROM test_attempts
 		WHERE id = $1`
 
-	err := r.pool.QueryRow(ctx, query, id).Scan(
-		&attempt.ID, &attempt.UserID, &attempt.TestID, &attempt.StartedAt,
-		&attempt.CompletedAt, &attempt.Score, &attempt.TotalPoints,
-		&attempt.TimeTakenSeconds, &attempt.Status, &attempt.CreatedAt,
-	)
-	if err != nil {
+	if err := scanAttempt(r.pool.QueryRow(ctx, query, id), attempt); err != nil {
 		return nil, err
 	}
 
 	return attempt, nil
 }
 
-// Complete marks an attempt as completed with score
-func (r *AttemptRepository) Complete(ctx context.Context, attemptID, score, totalPoints int) error {
+// GetExpired retrieves the in-progress attempts whose deadline was before cutoff
+func (r *AttemptRepository) GetExpired(ctx context.Context, cutoff time.Time) ([]models.TestAttempt, error) {
+	query := `
+		SELECT ` + attemptColumns + `
+		FROM test_attempts
+		WHERE status = 'in_progress' AND deadline_at < $1
+		ORDER BY deadline_at`
+
+	return r.queryAttempts(ctx, query, cutoff)
+}
+
+// GetIdlePractice retrieves the in-progress practice attempts that were not
+// started, and had no answer saved or hint revealed, since cutoff
+func (r *AttemptRepository) GetIdlePractice(ctx context.Context, cutoff time.Time) ([]models.TestAttempt, error) {
+	query := `
+		SELECT ` + attemptColumns + `
+		FROM test_attempts a
+		WHERE status = 'in_progress' AND practice
+		  AND GREATEST(started_at,
+		               (SELECT MAX(answered_at) FROM student_answers WHERE attempt_id = a.id),
+		               (SELECT MAX(revealed_at) FROM hint_reveals WHERE attempt_id = a.id)) < $1
+		ORDER BY started_at`
+
+	return r.queryAttempts(ctx, query, cutoff)
+}
+
+// GetByUser retrieves every attempt a user has made, oldest first
+func (r *AttemptRepository) GetByUser(ctx context.Context, userID int) ([]models.TestAttempt, error) {
+	query := `
+		SELECT ` + attemptColumns + `
+		FROM test_attempts
+		WHERE user_id = $1
+		ORDER BY started_at, id`
+
+	return r.queryAttempts(ctx, query, userID)
+}
+
+// GetByUserAndTest retrieves a user's attempts at one test, oldest first
+func (r *AttemptRepository) GetByUserAndTest(ctx context.Context, userID, testID int) ([]models.TestAttempt, error) {
+	query := `
+		SELECT ` + attemptColumns + `
+		FROM test_attempts
+		WHERE user_id = $1 AND test_id = $2
+		ORDER BY started_at, id`
+
+	return r.queryAttempts(ctx, query, userID, testID)
+}
+
+// queryAttempts runs a query selecting attemptColumns and scans every row
+func (r *AttemptRepository) queryAttempts(ctx context.Context, query string, args ...any) ([]models.TestAttempt, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []models.TestAttempt
+	for rows.Next() {
+		var attempt models.TestAttempt
+		if err := scanAttempt(rows, &attempt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts, rows.Err()
+}
+
+// Complete marks an in-progress attempt as completed at the given time with
+// its score and grade. It reports false when the attempt was no longer in
+// progress, so an attempt finished twice at once is only counted once.
+func (r *AttemptRepository) Complete(ctx context.Context, attemptID, score, totalPoints int, grade *string, completedAt time.Time) (bool, error) {
 	query := `
 		UPDATE test_attempts
-		SET completed_at = $2, score = $3, total_points = $4,
+		SET completed_at = $2, score = $3, total_points = $4, grade = $5,
 		    time_taken_seconds = EXTRACT(EPOCH FROM ($2 - started_at))::INTEGER,
 		    status = 'completed'
-		WHERE id = $1`
+		WHERE id = $1 AND status = 'in_progress'`
+
+	tag, err := r.pool.Exec(ctx, query, attemptID, completedAt, score, totalPoints, grade)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UpdateSectionState stores which section an in-progress attempt is on, when
+// it entered each section and the no-return sections it has left
+func (r *AttemptRepository) UpdateSectionState(ctx context.Context, attempt *models.TestAttempt) error {
+	query := `
+		UPDATE test_attempts
+		SET section_id = $2, section_starts = $3, sections_left = $4
+		WHERE id = $1 AND status = 'in_progress'`
 
-	_, err := r.pool.Exec(ctx, query, attemptID, time.Now(), score, totalPoints)
+	_, err := r.pool.Exec(ctx, query, attempt.ID, attempt.SectionID, attempt.SectionStarts, attempt.SectionsLeft)
 	return err
 }
 
+// Abandon marks an in-progress attempt as abandoned, reporting false when it
+// was no longer in progress
+func (r *AttemptRepository) Abandon(ctx context.Context, attemptID int) (bool, error) {
+	query := `UPDATE test_attempts SET status = 'abandoned' WHERE id = $1 AND status = 'in_progress'`
+
+	tag, err := r.pool.Exec(ctx, query, attemptID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
 // SaveAnswer saves a student's answer to a question
 func (r *AttemptRepository) SaveAnswer(ctx context.Context, answer *models.StudentAnswer) error {
 	query := `
-		INSERT INTO student_answers (attempt_id, question_id, selected_option_id, is_correct)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO student_answers (attempt_id, question_id, selected_option_id, selected_option_ids,
+		                             text_answer, matched_answer, match_pairs, is_correct, credit)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		ON CONFLICT (attempt_id, question_id)
-		DO UPDATE SET selected_option_id = $3, is_correct = $4, answered_at = CURRENT_TIMESTAMP
+		DO UPDATE SET selected_option_id = $3, selected_option_ids = $4, text_answer = $5,
+		              matched_answer = $6, match_pairs = $7, is_correct = $8, credit = $9,
+		              answered_at = CURRENT_TIMESTAMP
 		RETURNING id, answered_at`
 
 	return r.pool.QueryRow(ctx, query,
-		answer.AttemptID, answer.QuestionID, answer.SelectedOptionID, answer.IsCorrect,
+		answer.AttemptID, answer.QuestionID, answer.SelectedOptionID, answer.SelectedOptionIDs,
+		answer.TextAnswer, answer.MatchedAnswer, answer.MatchPairs, answer.IsCorrect, answer.Credit,
+	).Scan(&answer.ID, &answer.AnsweredAt)
+}
+
+// SaveFirstAnswer saves a student's answer to a question unless one is
+// already stored, reporting false when it was, so an answer that locks its
+// question stays locked however many are sent at once
+func (r *AttemptRepository) SaveFirstAnswer(ctx context.Context, answer *models.StudentAnswer) (bool, error) {
+	query := `
+		INSERT INTO student_answers (attempt_id, question_id, selected_option_id, selected_option_ids,
+		                             text_answer, matched_answer, match_pairs, is_correct, credit)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (attempt_id, question_id) DO NOTHING
+		RETURNING id, answered_at`
+
+	err := r.pool.QueryRow(ctx, query,
+		answer.AttemptID, answer.QuestionID, answer.SelectedOptionID, answer.SelectedOptionIDs,
+		answer.TextAnswer, answer.MatchedAnswer, answer.MatchPairs, answer.IsCorrect, answer.Credit,
 	).Scan(&answer.ID, &answer.AnsweredAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// UpdateAnswerGrade stores a regraded answer without touching what the student entered
+func (r *AttemptRepository) UpdateAnswerGrade(ctx context.Context, answer *models.StudentAnswer) error {
+	query := `
+		UPDATE student_answers
+		SET is_correct = $2, credit = $3, matched_answer = $4
+		WHERE id = $1`
+
+	_, err := r.pool.Exec(ctx, query, answer.ID, answer.IsCorrect, answer.Credit, answer.MatchedAnswer)
+	return err
+}
+
+// UpdateScore replaces the score and grade of an attempt after regrading
+func (r *AttemptRepository) UpdateScore(ctx context.Context, attemptID, score, totalPoints int, grade *string) error {
+	query := `UPDATE test_attempts SET score = $2, total_points = $3, grade = $4 WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, attemptID, score, totalPoints, grade)
+	return err
+}
+
+// GetTypedAnswerCounts groups the texts students typed for a question, most common first
+func (r *AttemptRepository) GetTypedAnswerCounts(ctx context.Context, questionID int) ([]TypedAnswerCount, error) {
+	query := `
+		SELECT text_answer, MAX(matched_answer), BOOL_OR(COALESCE(is_correct, FALSE)), COUNT(*)
+		FROM student_answers
+		WHERE question_id = $1 AND text_answer IS NOT NULL AND text_answer <> ''
+		GROUP BY text_answer
+		ORDER BY COUNT(*) DESC, text_answer`
+
+	rows, err := r.pool.Query(ctx, query, questionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []TypedAnswerCount
+	for rows.Next() {
+		var c TypedAnswerCount
+		if err := rows.Scan(&c.Text, &c.MatchedAnswer, &c.IsCorrect, &c.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
 }
 
 // GetAnswersByAttemptID retrieves all answers for an attempt
 func (r *AttemptRepository) GetAnswersByAttemptID(ctx context.Context, attemptID int) ([]models.StudentAnswer, error) {
 	query := `
 		SELECT sa.id, sa.attempt_id, sa.question_id, sa.selected_option_id,
-		       sa.is_correct, sa.answered_at
+		       sa.selected_option_ids, sa.text_answer, sa.matched_answer, sa.match_pairs,
+		       sa.is_correct, sa.credit, sa.answered_at
 		FROM student_answers sa
 		WHERE sa.attempt_id = $1
 		ORDER BY sa.question_id`
@@ -117,7 +320,8 @@ func (r *AttemptRepository) GetAnswersByAttemptID(ctx context.Context, attemptID
 	for rows.Next() {
 		var a models.StudentAnswer
 		err := rows.Scan(&a.ID, &a.AttemptID, &a.QuestionID,
-			&a.SelectedOptionID, &a.IsCorrect, &a.AnsweredAt)
+			&a.SelectedOptionID, &a.SelectedOptionIDs, &a.TextAnswer, &a.MatchedAnswer,
+			&a.MatchPairs, &a.IsCorrect, &a.Credit, &a.AnsweredAt)
 		if err != nil {
 			return nil, err
 		}
@@ -127,11 +331,86 @@ func (r *AttemptRepository) GetAnswersByAttemptID(ctx context.Context, attemptID
 	return answers, rows.Err()
 }
 
+// RevealHint records a hint revealed during an attempt. It reports false when
+// the attempt had already revealed the hint.
+func (r *AttemptRepository) RevealHint(ctx context.Context, reveal *models.HintReveal) (bool, error) {
+	query := `
+		INSERT INTO hint_reveals (attempt_id, question_id, hint_id, penalty)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (attempt_id, hint_id) DO NOTHING
+		RETURNING id, revealed_at`
+
+	err := r.pool.QueryRow(ctx, query,
+		reveal.AttemptID, reveal.QuestionID, reveal.HintID, reveal.Penalty,
+	).Scan(&reveal.ID, &reveal.RevealedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetHintReveals retrieves the hints revealed during an attempt, in the order
+// they were revealed
+func (r *AttemptRepository) GetHintReveals(ctx context.Context, attemptID int) ([]models.HintReveal, error) {
+	query := `
+		SELECT id, attempt_id, question_id, hint_id, penalty, revealed_at
+		FROM hint_reveals
+		WHERE attempt_id = $1
+		ORDER BY revealed_at, id`
+
+	rows, err := r.pool.Query(ctx, query, attemptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reveals []models.HintReveal
+	for rows.Next() {
+		var h models.HintReveal
+		if err := rows.Scan(&h.ID, &h.AttemptID, &h.QuestionID, &h.HintID, &h.Penalty, &h.RevealedAt); err != nil {
+			return nil, err
+		}
+		reveals = append(reveals, h)
+	}
+
+	return reveals, rows.Err()
+}
+
+// GetHintUsage lists every hint revealed in attempts at a test, grouped by
+// student and attempt
+func (r *AttemptRepository) GetHintUsage(ctx context.Context, testID int) ([]HintUse, error) {
+	query := `
+		SELECT ta.id, u.username, ta.started_at, ta.practice, hr.question_id, qh.hint_order, hr.penalty
+		FROM hint_reveals hr
+		JOIN test_attempts ta ON hr.attempt_id = ta.id
+		JOIN users u ON ta.user_id = u.id
+		LEFT JOIN question_hints qh ON hr.hint_id = qh.id
+		WHERE ta.test_id = $1
+		ORDER BY u.username, ta.started_at, ta.id, hr.question_id, qh.hint_order`
+
+	rows, err := r.pool.Query(ctx, query, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uses []HintUse
+	for rows.Next() {
+		var h HintUse
+		if err := rows.Scan(&h.AttemptID, &h.Username, &h.StartedAt, &h.Practice, &h.QuestionID, &h.HintOrder, &h.Penalty); err != nil {
+			return nil, err
+		}
+		uses = append(uses, h)
+	}
+
+	return uses, rows.Err()
+}
+
 // GetUserAttempts retrieves all test attempts for a user
 func (r *AttemptRepository) GetUserAttempts(ctx context.Context, userID int, limit int) ([]models.TestAttempt, error) {
 	query := `
 		SELECT ta.id, ta.user_id, ta.test_id, ta.started_at, ta.completed_at,
-		       ta.score, ta.total_points, ta.time_taken_seconds, ta.status, ta.created_at,
+		       ta.score, ta.total_points, ta.time_taken_seconds, ta.status, ta.practice, ta.grade, ta.created_at,
 		       t.id, t.title, t.description, t.subject_id, t.topic_id,
 		       t.exam_standard, t.difficulty, t.time_limit_minutes, t.passing_score,
 		       t.created_by, t.created_at, t.updated_at,
@@ -162,7 +441,7 @@ func (r *AttemptRepository) GetUserAttempts(ctx context.Context, userID int, lim
 
 		err := rows.Scan(
 			&a.ID, &a.UserID, &a.TestID, &a.StartedAt, &a.CompletedAt,
-			&a.Score, &a.TotalPoints, &a.TimeTakenSeconds, &a.Status, &a.CreatedAt,
+			&a.Score, &a.TotalPoints, &a.TimeTakenSeconds, &a.Status, &a.Practice, &a.Grade, &a.CreatedAt,
 			&a.Test.ID, &a.Test.Title, &a.Test.Description, &a.Test.SubjectID,
 			&a.Test.TopicID, &a.Test.ExamStandard, &a.Test.Difficulty,
 			&a.Test.TimeLimitMinutes, &a.Test.PassingScore, &a.Test.CreatedBy,
@@ -200,6 +479,7 @@ func (r *AttemptRepository) GetUserAttempts(ctx context.Context, userID int, lim
 
 // GetUserStreakStats calculates the current and best streak for a user based on completed attempts.
 // Streak is counted in whole days; completing at least one test on a day extends the streak.
+// Practice attempts do not count.
 func (r *AttemptRepository) GetUserStreakStats(ctx context.Context, userID int) (StreakStats, error) {
 	stats := StreakStats{}
 
@@ -207,7 +487,7 @@ func (r *AttemptRepository) GetUserStreakStats(ctx context.Context, userID int)
 	query := `
 		SELECT DISTINCT DATE(completed_at) as day
 		FROM test_attempts
-		WHERE user_id = $1 AND status = 'completed' AND completed_at IS NOT NULL
+		WHERE user_id = $1 AND status = 'completed' AND completed_at IS NOT NULL AND NOT practice
 		ORDER BY day DESC`
 
 	rows, err := r.pool.Query(ctx, query, userID)
@@ -256,27 +536,29 @@ func (r *AttemptRepository) GetUserStreakStats(ctx context.Context, userID int)
 	return stats, rows.Err()
 }
 
-// GetUserTestStats retrieves statistics for a user's performance on tests
+// GetUserTestStats retrieves statistics for a user's performance on tests.
+// Practice attempts are left out of the averages and counted on their own.
 func (r *AttemptRepository) GetUserTestStats(ctx context.Context, userID int) (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
 
 	// Get total attempts
-	var totalAttempts int
+	var totalAttempts, practiceAttempts int
 	err := r.pool.QueryRow(ctx,
-		"SELECT COUNT(*) FROM test_attempts WHERE user_id = $1 AND status = 'completed'",
+		"SELECT COUNT(*) FILTER (WHERE NOT practice), COUNT(*) FILTER (WHERE practice) FROM test_attempts WHERE user_id = $1 AND status = 'completed'",
 		userID,
-	).Scan(&totalAttempts)
+	).Scan(&totalAttempts, &practiceAttempts)
 	if err != nil {
 		return nil, err
 	}
 	stats["total_attempts"] = totalAttempts
+	stats["practice_attempts"] = practiceAttempts
 
 	// Get average score
 	var avgScore float64
 	err = r.pool.QueryRow(ctx,
 		`SELECT COALESCE(AVG(CAST(score AS FLOAT) / NULLIF(total_points, 0) * 100), 0)
 		 FROM test_attempts
-		 WHERE user_id = $1 AND status = 'completed' AND total_points > 0`,
+		 WHERE user_id = $1 AND status = 'completed' AND total_points > 0 AND NOT practice`,
 		userID,
 	).Scan(&avgScore)
 	if err != nil {
@@ -291,7 +573,7 @@ func (r *AttemptRepository) GetUserTestStats(ctx context.Context, userID int) (m
 			FROM (
 				SELECT score, total_points
 				FROM test_attempts
-				WHERE user_id = $1 AND status = 'completed' AND total_points > 0
+				WHERE user_id = $1 AND status = 'completed' AND total_points > 0 AND NOT practice
 				ORDER BY completed_at DESC
 				LIMIT 5
 			) r
@@ -301,7 +583,7 @@ func (r *AttemptRepository) GetUserTestStats(ctx context.Context, userID int) (m
 			FROM (
 				SELECT score, total_points
 				FROM test_attempts
-				WHERE user_id = $1 AND status = 'completed' AND total_points > 0
+				WHERE user_id = $1 AND status = 'completed' AND total_points > 0 AND NOT practice
 				ORDER BY completed_at DESC
 				LIMIT 10 OFFSET 5
 			) p
@@ -320,36 +602,16 @@ func (r *AttemptRepository) GetUserTestStats(ctx context.Context, userID int) (m
 	return stats, nil
 }
 
-// GetByTestID retrieves all attempts for a specific test
+// GetByTestID retrieves all attempts for a specific test, with the questions
+// each one was asked
 func (r *AttemptRepository) GetByTestID(ctx context.Context, testID int) ([]models.TestAttempt, error) {
 	query := `
-		SELECT id, user_id, test_id, started_at, completed_at, score,
-		       total_points, time_taken_seconds, status, created_at
+		SELECT ` + attemptColumns + `
 		FROM test_attempts
 		WHERE test_id = $1
 		ORDER BY started_at DESC`
 
-	rows, err := r.pool.Query(ctx, query, testID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var attempts []models.TestAttempt
-	for rows.Next() {
-		var attempt models.TestAttempt
-		err := rows.Scan(
-			&attempt.ID, &attempt.UserID, &attempt.TestID, &attempt.StartedAt,
-			&attempt.CompletedAt, &attempt.Score, &attempt.TotalPoints,
-			&attempt.TimeTakenSeconds, &attempt.Status, &attempt.CreatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		attempts = append(attempts, attempt)
-	}
-
-	return attempts, rows.Err()
+	return r.queryAttempts(ctx, query, testID)
 }
 
 // SearchAttempts returns attempts filtered by the provided criteria and includes user/test metadata.
@@ -360,7 +622,7 @@ func (r *AttemptRepository) SearchAttempts(ctx context.Context, filter AttemptSe
 	)
 
 	builder.WriteString(`SELECT ta.id, ta.user_id, ta.test_id, ta.started_at, ta.completed_at, ta.score,
-	       ta.total_points, ta.time_taken_seconds, ta.status, ta.created_at,
+	       ta.total_points, ta.time_taken_seconds, ta.status, ta.practice, ta.grade, ta.created_at,
 	       u.id, u.username, u.email, u.role,
 	       t.id, t.title, t.exam_standard, t.difficulty
 	FROM test_attempts ta
@@ -419,7 +681,7 @@ func (r *AttemptRepository) SearchAttempts(ctx context.Context, filter AttemptSe
 
 		err := rows.Scan(
 			&attempt.ID, &attempt.UserID, &attempt.TestID, &attempt.StartedAt, &attempt.CompletedAt,
-			&attempt.Score, &attempt.TotalPoints, &attempt.TimeTakenSeconds, &attempt.Status, &attempt.CreatedAt,
+			&attempt.Score, &attempt.TotalPoints, &attempt.TimeTakenSeconds, &attempt.Status, &attempt.Practice, &attempt.Grade, &attempt.CreatedAt,
 			&attempt.User.ID, &attempt.User.Username, &attempt.User.Email, &attempt.User.Role,
 			&attempt.Test.ID, &attempt.Test.Title, &attempt.Test.ExamStandard, &attempt.Test.Difficulty,
 		)
@@ -2,34 +2,107 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 
 	"my-app/internal/models"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// querier runs the repository's statements: the pool, or a transaction when
+// several changes must be made together
+type querier interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 // TestRepository handles test database operations
 type TestRepository struct {
-	pool *pgxpool.Pool
+	db querier
 }
 
 // NewTestRepository creates a new test repository
 func NewTestRepository(pool *pgxpool.Pool) *TestRepository {
-	return &TestRepository{pool: pool}
+	return &TestRepository{db: pool}
+}
+
+// InTx calls fn with a repository whose changes are made in one transaction,
+// committed when fn succeeds and rolled back when it returns an error.
+// Methods that use a transaction of their own run in a savepoint within it.
+func (r *TestRepository) InTx(ctx context.Context, fn func(tx *TestRepository) error) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(&TestRepository{db: tx}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// testColumns are the tests columns, followed by the joined subject and topic,
+// that scanTest reads. Queries select them from "tests t LEFT JOIN subjects s
+// LEFT JOIN topics tp".
+const testColumns = `t.id, t.title, t.description, t.subject_id, t.topic_id,
+		       t.exam_standard, t.difficulty, t.time_limit_minutes,
+		       t.passing_score, t.published, t.notes_filename, t.created_by, t.created_at, t.updated_at,
+		       t.wrong_penalty, t.skipped_credit, t.floor_at_zero, t.shuffle_questions, t.shuffle_options,
+		       t.max_attempts, t.attempt_cooldown_minutes, t.counted_attempt, t.allow_practice, t.hint_penalty,
+		       t.available_from, t.available_until, t.timezone, t.late_submission,
+		       s.id, s.name, s.description,
+		       tp.id, COALESCE(tp.subject_id, 0), COALESCE(tp.name, ''), COALESCE(tp.description, '')`
+
+// scanTest reads a row selected with testColumns
+func scanTest(row pgx.Row, t *models.Test) error {
+	var subjectID, topicID *int
+	var subjectName, subjectDesc *string
+	var topic models.Topic
+
+	err := row.Scan(
+		&t.ID, &t.Title, &t.Description, &t.SubjectID, &t.TopicID,
+		&t.ExamStandard, &t.Difficulty, &t.TimeLimitMinutes,
+		&t.PassingScore, &t.Published, &t.NotesFilename, &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt,
+		&t.Scoring.WrongPenalty, &t.Scoring.SkippedCredit, &t.Scoring.FloorAtZero, &t.ShuffleQuestions, &t.ShuffleOptions,
+		&t.Attempts.MaxAttempts, &t.Attempts.CooldownMinutes, &t.Attempts.Counts, &t.AllowPractice, &t.Scoring.HintPenalty,
+		&t.AvailableFrom, &t.AvailableUntil, &t.Timezone, &t.LateSubmission,
+		&subjectID, &subjectName, &subjectDesc, &topicID, &topic.SubjectID, &topic.Name, &topic.Description,
+	)
+	if err != nil {
+		return err
+	}
+
+	if subjectID != nil {
+		t.Subject = &models.Subject{
+			ID:          *subjectID,
+			Name:        *subjectName,
+			Description: *subjectDesc,
+		}
+	}
+	if topicID != nil {
+		topic.ID = *topicID
+		t.Topic = &topic
+	}
+	return nil
 }
 
 // GetAll retrieves all tests
 func (r *TestRepository) GetAll(ctx context.Context) ([]models.Test, error) {
 	query := `
-		SELECT t.id, t.title, t.description, t.subject_id, t.topic_id,
-		       t.exam_standard, t.difficulty, t.time_limit_minutes,
-		       t.passing_score, t.published, t.notes_filename, t.created_by, t.created_at, t.updated_at,
-		       s.id, s.name, s.description
+		SELECT ` + testColumns + `
 		FROM tests t
 		LEFT JOIN subjects s ON t.subject_id = s.id
+		LEFT JOIN topics tp ON t.topic_id = tp.id
 		ORDER BY t.created_at DESC`
 
-	rows, err := r.pool.Query(ctx, query)
+	rows, err := r.db.Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -38,31 +111,30 @@ func (r *TestRepository) GetAll(ctx context.Context) ([]models.Test, error) {
 	var tests []models.Test
 	for rows.Next() {
 		var t models.Test
-		var subjectID *int
-		var subjectName, subjectDesc *string
-
-		err := rows.Scan(
-			&t.ID, &t.Title, &t.Description, &t.SubjectID, &t.TopicID,
-			&t.ExamStandard, &t.Difficulty, &t.TimeLimitMinutes,
-			&t.PassingScore, &t.Published, &t.NotesFilename, &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt,
-			&subjectID, &subjectName, &subjectDesc,
-		)
-		if err != nil {
+		if err := scanTest(rows, &t); err != nil {
 			return nil, err
 		}
 
-		if subjectID != nil {
-			t.Subject = &models.Subject{
-				ID:          *subjectID,
-				Name:        *subjectName,
-				Description: *subjectDesc,
-			}
-		}
-
 		tests = append(tests, t)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return tests, rows.Err()
+	// Attach every test's prerequisites so the list can show which are locked
+	prerequisites, err := r.queryPrerequisites(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	byTest := make(map[int][]models.Prerequisite)
+	for _, p := range prerequisites {
+		byTest[p.TestID] = append(byTest[p.TestID], p)
+	}
+	for i := range tests {
+		tests[i].Prerequisites = byTest[tests[i].ID]
+	}
+
+	return tests, nil
 }
 
 // Update updates an existing test
@@ -71,49 +143,59 @@ func (r *TestRepository) Update(ctx context.Context, test *models.Test) error {
 		UPDATE tests
 		SET title = $1, description = $2, subject_id = $3, topic_id = $4,
 		    exam_standard = $5, difficulty = $6, time_limit_minutes = $7,
-		    passing_score = $8, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $9
+		    passing_score = $8, wrong_penalty = $9, skipped_credit = $10, floor_at_zero = $11,
+		    shuffle_questions = $12, shuffle_options = $13,
+		    max_attempts = $14, attempt_cooldown_minutes = $15, counted_attempt = $16,
+		    allow_practice = $17, hint_penalty = $18,
+		    available_from = $19, available_until = $20, timezone = $21, late_submission = $22,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $23
 		RETURNING updated_at`
 
-	return r.pool.QueryRow(ctx, query,
+	return r.db.QueryRow(ctx, query,
 		test.Title, test.Description, test.SubjectID, test.TopicID,
 		test.ExamStandard, test.Difficulty, test.TimeLimitMinutes,
-		test.PassingScore, test.ID,
+		test.PassingScore, test.Scoring.WrongPenalty, test.Scoring.SkippedCredit, test.Scoring.FloorAtZero,
+		test.ShuffleQuestions, test.ShuffleOptions,
+		test.Attempts.MaxAttempts, test.Attempts.CooldownMinutes, countedAttemptOrDefault(test.Attempts.Counts),
+		test.AllowPractice, test.Scoring.HintPenalty,
+		test.AvailableFrom, test.AvailableUntil, timezoneOrDefault(test.Timezone), lateSubmissionOrDefault(test.LateSubmission),
+		test.ID,
 	).Scan(&test.UpdatedAt)
 }
 
 // PublishTest publishes a test making it available to students
 func (r *TestRepository) PublishTest(ctx context.Context, testID int) error {
 	query := `UPDATE tests SET published = true, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
-	_, err := r.pool.Exec(ctx, query, testID)
+	_, err := r.db.Exec(ctx, query, testID)
 	return err
 }
 
 // UnpublishTest unpublishes a test
 func (r *TestRepository) UnpublishTest(ctx context.Context, testID int) error {
 	query := `UPDATE tests SET published = false, updated_at = CURRENT_TIMESTAMP WHERE id = $1`
-	_, err := r.pool.Exec(ctx, query, testID)
+	_, err := r.db.Exec(ctx, query, testID)
 	return err
 }
 
 // DeleteTest deletes a test and all its questions
 func (r *TestRepository) DeleteTest(ctx context.Context, testID int) error {
 	query := `DELETE FROM tests WHERE id = $1`
-	_, err := r.pool.Exec(ctx, query, testID)
+	_, err := r.db.Exec(ctx, query, testID)
 	return err
 }
 
 // UpdateTestNotes updates the notes filename for a test
 func (r *TestRepository) UpdateTestNotes(ctx context.Context, testID int, notesFilename *string) error {
 	query := `UPDATE tests SET notes_filename = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
-	_, err := r.pool.Exec(ctx, query, notesFilename, testID)
+	_, err := r.db.Exec(ctx, query, notesFilename, testID)
 	return err
 }
 
 // DeleteQuestion deletes a question
 func (r *TestRepository) DeleteQuestion(ctx context.Context, questionID int) error {
 	query := `DELETE FROM questions WHERE id = $1`
-	_, err := r.pool.Exec(ctx, query, questionID)
+	_, err := r.db.Exec(ctx, query, questionID)
 	return err
 }
 
@@ -121,29 +203,50 @@ func (r *TestRepository) DeleteQuestion(ctx context.Context, questionID int) err
 func (r *TestRepository) UpdateQuestion(ctx context.Context, question *models.Question) error {
 	query := `
 		UPDATE questions
-		SET question_text = $1, image_url = $2, points = $3, question_order = $4
-		WHERE id = $5`
+		SET question_text = $1, image_url = $2, points = $3, question_order = $4,
+		    question_type = $5, scoring_rule = $6,
+		    numeric_expected = $7, numeric_tolerance = $8, numeric_tolerance_type = $9,
+		    numeric_sig_figs = $10, numeric_units = $11,
+		    case_sensitive = $12, typo_tolerance = $13, keep_option_order = $14, pool_id = $15,
+		    explanation = $16, explanation_image_url = $17, section_id = $18
+		WHERE id = $19`
+
+	n := numericColumnsFor(question)
+	_, err := r.db.Exec(ctx, query,
+		question.QuestionText, question.ImageURL, question.Points, question.QuestionOrder,
+		questionTypeOrDefault(question.QuestionType), scoringRuleOrDefault(question.ScoringRule),
+		n.expected, n.tolerance, n.toleranceType, n.sigFigs, n.units,
+		question.CaseSensitive, question.TypoTolerance, question.KeepOptionOrder, question.PoolID,
+		question.Explanation, question.ExplanationImageURL, question.SectionID, question.ID)
+	return err
+}
 
-	_, err := r.pool.Exec(ctx, query,
-		question.QuestionText, question.ImageURL, question.Points, question.QuestionOrder, question.ID)
+// MoveQuestionsAside negates the positions of the test's questions so that
+// UpdateQuestion can renumber them one at a time without two questions
+// sharing a position. Every question must then be given its new position.
+func (r *TestRepository) MoveQuestionsAside(ctx context.Context, testID int) error {
+	query := `UPDATE questions SET question_order = -question_order WHERE test_id = $1`
+	_, err := r.db.Exec(ctx, query, testID)
 	return err
 }
 
-// UpdateAnswerOption updates an answer option
+// UpdateAnswerOption updates an answer option. No two options of a question
+// may share a position, so an option can only move to a free one.
 func (r *TestRepository) UpdateAnswerOption(ctx context.Context, option *models.AnswerOption) error {
 	query := `
 		UPDATE answer_options
-		SET option_text = $1, is_correct = $2
-		WHERE id = $3`
+		SET option_text = $1, is_correct = $2, match_text = $3, rationale = $4, option_order = $5
+		WHERE id = $6`
 
-	_, err := r.pool.Exec(ctx, query, option.OptionText, option.IsCorrect, option.ID)
+	_, err := r.db.Exec(ctx, query,
+		option.OptionText, option.IsCorrect, option.MatchText, option.Rationale, option.OptionOrder, option.ID)
 	return err
 }
 
 // DeleteAnswerOption deletes an answer option
 func (r *TestRepository) DeleteAnswerOption(ctx context.Context, optionID int) error {
 	query := `DELETE FROM answer_options WHERE id = $1`
-	_, err := r.pool.Exec(ctx, query, optionID)
+	_, err := r.db.Exec(ctx, query, optionID)
 	return err
 }
 
@@ -152,34 +255,39 @@ func (r *TestRepository) GetByID(ctx context.Context, id int) (*models.Test, err
 	// Get test details
 	test := &models.Test{}
 	query := `
-		SELECT t.id, t.title, t.description, t.subject_id, t.topic_id,
-		       t.exam_standard, t.difficulty, t.time_limit_minutes,
-		       t.passing_score, t.published, t.notes_filename, t.created_by, t.created_at, t.updated_at,
-		       s.id, s.name, s.description
+		SELECT ` + testColumns + `
 		FROM tests t
 		LEFT JOIN subjects s ON t.subject_id = s.id
+		LEFT JOIN topics tp ON t.topic_id = tp.id
 		WHERE t.id = $1`
 
-	var subjectID *int
-	var subjectName, subjectDesc *string
+	if err := scanTest(r.db.QueryRow(ctx, query, id), test); err != nil {
+		return nil, err
+	}
 
-	err := r.pool.QueryRow(ctx, query, id).Scan(
-		&test.ID, &test.Title, &test.Description, &test.SubjectID, &test.TopicID,
-		&test.ExamStandard, &test.Difficulty, &test.TimeLimitMinutes,
-		&test.PassingScore, &test.Published, &test.NotesFilename, &test.CreatedBy, &test.CreatedAt, &test.UpdatedAt,
-		&subjectID, &subjectName, &subjectDesc,
-	)
+	pools, err := r.getPoolsByTestID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	test.Pools = pools
 
-	if subjectID != nil {
-		test.Subject = &models.Subject{
-			ID:          *subjectID,
-			Name:        *subjectName,
-			Description: *subjectDesc,
-		}
+	sections, err := r.getSectionsByTestID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	test.Sections = sections
+
+	prerequisites, err := r.queryPrerequisites(ctx, "WHERE p.test_id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	test.Prerequisites = prerequisites
+
+	boundaries, err := r.queryGradeBoundaries(ctx, "test_id = $1", id)
+	if err != nil {
+		return nil, err
 	}
+	test.GradeBoundaries = boundaries
 
 	// Get questions and their options
 	questions, err := r.getQuestionsByTestID(ctx, id)
@@ -191,15 +299,158 @@ func (r *TestRepository) GetByID(ctx context.Context, id int) (*models.Test, err
 	return test, nil
 }
 
+// GetForAttempt retrieves the test as the attempt was taken: the revision it
+// was started against, or the current test for attempts from before revisions
+func (r *TestRepository) GetForAttempt(ctx context.Context, attempt *models.TestAttempt) (*models.Test, error) {
+	if attempt.RevisionID == nil {
+		return r.GetByID(ctx, attempt.TestID)
+	}
+	return r.GetRevision(ctx, *attempt.RevisionID)
+}
+
+// GetRevision retrieves the test content saved in a revision
+func (r *TestRepository) GetRevision(ctx context.Context, revisionID int) (*models.Test, error) {
+	var content []byte
+	if err := r.db.QueryRow(ctx, `SELECT content FROM test_revisions WHERE id = $1`, revisionID).Scan(&content); err != nil {
+		return nil, err
+	}
+
+	test := &models.Test{}
+	if err := json.Unmarshal(content, test); err != nil {
+		return nil, fmt.Errorf("decoding revision %d: %w", revisionID, err)
+	}
+	return test, nil
+}
+
+// GetRevisions retrieves a test's revision log, newest first, with who made each revision
+func (r *TestRepository) GetRevisions(ctx context.Context, testID int) ([]models.TestRevision, error) {
+	return r.queryRevisions(ctx, "v.test_id = $1", testID)
+}
+
+// GetAttemptedRevisions retrieves the revisions of a test that attempts were
+// taken against, newest first
+func (r *TestRepository) GetAttemptedRevisions(ctx context.Context, testID int) ([]models.TestRevision, error) {
+	return r.queryRevisions(ctx, "v.test_id = $1 AND EXISTS (SELECT 1 FROM test_attempts a WHERE a.revision_id = v.id)", testID)
+}
+
+// queryRevisions retrieves the test revisions matching the where clause, newest first
+func (r *TestRepository) queryRevisions(ctx context.Context, where string, args ...any) ([]models.TestRevision, error) {
+	query := `
+		SELECT v.id, v.test_id, v.revision, v.content, v.created_by, v.created_at, v.restored_from, COALESCE(u.username, '')
+		FROM test_revisions v
+		LEFT JOIN users u ON v.created_by = u.id
+		WHERE ` + where + `
+		ORDER BY v.test_id, v.revision DESC`
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []models.TestRevision
+	for rows.Next() {
+		var v models.TestRevision
+		var content []byte
+		if err := rows.Scan(&v.ID, &v.TestID, &v.Revision, &content, &v.CreatedBy, &v.CreatedAt, &v.RestoredFrom, &v.CreatedByName); err != nil {
+			return nil, err
+		}
+		v.Content = &models.Test{}
+		if err := json.Unmarshal(content, v.Content); err != nil {
+			return nil, fmt.Errorf("decoding revision %d: %w", v.ID, err)
+		}
+		revisions = append(revisions, v)
+	}
+
+	return revisions, rows.Err()
+}
+
+// SaveRevision records the test's current content as its next revision and
+// returns the revision's ID. When the content is unchanged since the latest
+// revision, that revision's ID is returned instead; revisions are never changed.
+func (r *TestRepository) SaveRevision(ctx context.Context, test *models.Test, createdBy *int) (int, error) {
+	return r.saveRevision(ctx, test, createdBy, nil)
+}
+
+// SaveRestoredRevision records the test's content, just written back from an
+// earlier revision, as its next revision, noting the revision it restored.
+// Like SaveRevision, it returns the latest revision's ID when nothing changed.
+func (r *TestRepository) SaveRestoredRevision(ctx context.Context, test *models.Test, createdBy *int, restoredFrom int) (int, error) {
+	return r.saveRevision(ctx, test, createdBy, &restoredFrom)
+}
+
+func (r *TestRepository) saveRevision(ctx context.Context, test *models.Test, createdBy, restoredFrom *int) (int, error) {
+	content, err := json.Marshal(test.Content())
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the test so attempts starting together agree on one revision
+	if _, err := tx.Exec(ctx, `SELECT id FROM tests WHERE id = $1 FOR UPDATE`, test.ID); err != nil {
+		return 0, err
+	}
+
+	var id, latest int
+	var unchanged bool
+	err = tx.QueryRow(ctx, `
+		SELECT id, revision, content = $2::JSONB
+		FROM test_revisions
+		WHERE test_id = $1
+		ORDER BY revision DESC
+		LIMIT 1`, test.ID, content).Scan(&id, &latest, &unchanged)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+	if unchanged {
+		return id, tx.Commit(ctx)
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO test_revisions (test_id, revision, content, created_by, restored_from)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`, test.ID, latest+1, content, createdBy, restoredFrom).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit(ctx)
+}
+
+// NotesInRevisions reports whether any test revision refers to the stored notes file
+func (r *TestRepository) NotesInRevisions(ctx context.Context, filename string) (bool, error) {
+	var referenced bool
+	err := r.db.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM test_revisions WHERE content->>'notes_filename' = $1)`, filename,
+	).Scan(&referenced)
+	return referenced, err
+}
+
+// PinUnrevisedAttempts ties the test's attempts from before revisions existed
+// to the given revision
+func (r *TestRepository) PinUnrevisedAttempts(ctx context.Context, testID, revisionID int) error {
+	query := `UPDATE test_attempts SET revision_id = $1 WHERE test_id = $2 AND revision_id IS NULL`
+	_, err := r.db.Exec(ctx, query, revisionID, testID)
+	return err
+}
+
 // getQuestionsByTestID retrieves all questions for a test
 func (r *TestRepository) getQuestionsByTestID(ctx context.Context, testID int) ([]models.Question, error) {
 	query := `
-		SELECT id, test_id, question_text, image_url, question_order, points, created_at
+		SELECT id, test_id, question_text, image_url, question_type, scoring_rule,
+		       numeric_expected, numeric_tolerance, numeric_tolerance_type, numeric_sig_figs, numeric_units,
+		       case_sensitive, typo_tolerance, keep_option_order, pool_id, section_id, explanation, explanation_image_url,
+		       question_order, points, created_at
 		FROM questions
 		WHERE test_id = $1
 		ORDER BY question_order`
 
-	rows, err := r.pool.Query(ctx, query, testID)
+	rows, err := r.db.Query(ctx, query, testID)
 	if err != nil {
 		return nil, err
 	}
@@ -208,34 +459,315 @@ func (r *TestRepository) getQuestionsByTestID(ctx context.Context, testID int) (
 	var questions []models.Question
 	for rows.Next() {
 		var q models.Question
+		var n numericColumns
 		err := rows.Scan(&q.ID, &q.TestID, &q.QuestionText, &q.ImageURL,
-			&q.QuestionOrder, &q.Points, &q.CreatedAt)
+			&q.QuestionType, &q.ScoringRule,
+			&n.expected, &n.tolerance, &n.toleranceType, &n.sigFigs, &n.units,
+			&q.CaseSensitive, &q.TypoTolerance, &q.KeepOptionOrder, &q.PoolID, &q.SectionID,
+			&q.Explanation, &q.ExplanationImageURL, &q.QuestionOrder, &q.Points, &q.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
+		if q.IsNumeric() {
+			q.Numeric = n.answer()
+		}
+		questions = append(questions, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// A transaction runs its queries on one connection, which cannot start
+	// another query until these rows are read and closed
+	rows.Close()
 
-		// Get options for this question
+	for i := range questions {
+		q := &questions[i]
 		options, err := r.getOptionsByQuestionID(ctx, q.ID)
 		if err != nil {
 			return nil, err
 		}
 		q.Options = options
 
-		questions = append(questions, q)
+		if q.IsShortAnswer() {
+			accepted, err := r.GetAcceptedAnswers(ctx, q.ID)
+			if err != nil {
+				return nil, err
+			}
+			q.AcceptedAnswers = accepted
+		}
+
+		hints, err := r.getHintsByQuestionID(ctx, q.ID)
+		if err != nil {
+			return nil, err
+		}
+		q.Hints = hints
 	}
 
-	return questions, rows.Err()
+	return questions, nil
+}
+
+// getPoolsByTestID retrieves a test's question pools
+func (r *TestRepository) getPoolsByTestID(ctx context.Context, testID int) ([]models.QuestionPool, error) {
+	query := `
+		SELECT id, test_id, name, draw_count, created_at
+		FROM question_pools
+		WHERE test_id = $1
+		ORDER BY id`
+
+	rows, err := r.db.Query(ctx, query, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pools []models.QuestionPool
+	for rows.Next() {
+		var pool models.QuestionPool
+		if err := rows.Scan(&pool.ID, &pool.TestID, &pool.Name, &pool.DrawCount, &pool.CreatedAt); err != nil {
+			return nil, err
+		}
+		pools = append(pools, pool)
+	}
+
+	return pools, rows.Err()
+}
+
+// CreatePool creates a question pool
+func (r *TestRepository) CreatePool(ctx context.Context, pool *models.QuestionPool) error {
+	query := `
+		INSERT INTO question_pools (test_id, name, draw_count)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	return r.db.QueryRow(ctx, query, pool.TestID, pool.Name, pool.DrawCount).Scan(&pool.ID, &pool.CreatedAt)
+}
+
+// UpdatePool renames a question pool and changes how many questions it draws
+func (r *TestRepository) UpdatePool(ctx context.Context, pool *models.QuestionPool) error {
+	query := `UPDATE question_pools SET name = $1, draw_count = $2 WHERE id = $3`
+	_, err := r.db.Exec(ctx, query, pool.Name, pool.DrawCount, pool.ID)
+	return err
+}
+
+// DeletePool deletes a question pool; its questions are then asked in every attempt
+func (r *TestRepository) DeletePool(ctx context.Context, poolID int) error {
+	query := `DELETE FROM question_pools WHERE id = $1`
+	_, err := r.db.Exec(ctx, query, poolID)
+	return err
+}
+
+// getSectionsByTestID retrieves a test's sections in the order they are taken
+func (r *TestRepository) getSectionsByTestID(ctx context.Context, testID int) ([]models.Section, error) {
+	query := `
+		SELECT id, test_id, title, instructions, time_limit_minutes, no_return, section_order, created_at
+		FROM test_sections
+		WHERE test_id = $1
+		ORDER BY section_order, id`
+
+	rows, err := r.db.Query(ctx, query, testID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sections []models.Section
+	for rows.Next() {
+		var s models.Section
+		if err := rows.Scan(&s.ID, &s.TestID, &s.Title, &s.Instructions, &s.TimeLimitMinutes,
+			&s.NoReturn, &s.SectionOrder, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		sections = append(sections, s)
+	}
+
+	return sections, rows.Err()
+}
+
+// CreateSection creates a test section
+func (r *TestRepository) CreateSection(ctx context.Context, s *models.Section) error {
+	query := `
+		INSERT INTO test_sections (test_id, title, instructions, time_limit_minutes, no_return, section_order)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	return r.db.QueryRow(ctx, query, s.TestID, s.Title, s.Instructions, s.TimeLimitMinutes, s.NoReturn, s.SectionOrder).
+		Scan(&s.ID, &s.CreatedAt)
+}
+
+// UpdateSection updates a test section's title, instructions, time limit and place
+func (r *TestRepository) UpdateSection(ctx context.Context, s *models.Section) error {
+	query := `
+		UPDATE test_sections
+		SET title = $1, instructions = $2, time_limit_minutes = $3, no_return = $4, section_order = $5
+		WHERE id = $6`
+	_, err := r.db.Exec(ctx, query, s.Title, s.Instructions, s.TimeLimitMinutes, s.NoReturn, s.SectionOrder, s.ID)
+	return err
+}
+
+// DeleteSection deletes a test section; its questions move to the first section
+func (r *TestRepository) DeleteSection(ctx context.Context, sectionID int) error {
+	query := `DELETE FROM test_sections WHERE id = $1`
+	_, err := r.db.Exec(ctx, query, sectionID)
+	return err
+}
+
+// queryPrerequisites retrieves test prerequisites matching the where clause,
+// with the title of the required test or the name of the topic
+func (r *TestRepository) queryPrerequisites(ctx context.Context, where string, args ...any) ([]models.Prerequisite, error) {
+	query := `
+		SELECT p.id, p.test_id, p.kind, p.required_test_id, p.min_percent, p.topic_id, p.min_count, p.created_at,
+		       COALESCE(rt.title, ''), COALESCE(tp.name, '')
+		FROM test_prerequisites p
+		LEFT JOIN tests rt ON p.required_test_id = rt.id
+		LEFT JOIN topics tp ON p.topic_id = tp.id
+		` + where + `
+		ORDER BY p.test_id, p.id`
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prerequisites []models.Prerequisite
+	for rows.Next() {
+		var p models.Prerequisite
+		err := rows.Scan(&p.ID, &p.TestID, &p.Kind, &p.RequiredTestID, &p.MinPercent, &p.TopicID, &p.MinCount, &p.CreatedAt,
+			&p.RequiredTitle, &p.TopicName)
+		if err != nil {
+			return nil, err
+		}
+		prerequisites = append(prerequisites, p)
+	}
+
+	return prerequisites, rows.Err()
+}
+
+// CreatePrerequisite adds a prerequisite to a test
+func (r *TestRepository) CreatePrerequisite(ctx context.Context, p *models.Prerequisite) error {
+	query := `
+		INSERT INTO test_prerequisites (test_id, kind, required_test_id, min_percent, topic_id, min_count)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	return r.db.QueryRow(ctx, query, p.TestID, p.Kind, p.RequiredTestID, p.MinPercent, p.TopicID, p.MinCount).
+		Scan(&p.ID, &p.CreatedAt)
+}
+
+// DeletePrerequisite removes a prerequisite from a test
+func (r *TestRepository) DeletePrerequisite(ctx context.Context, prerequisiteID int) error {
+	query := `DELETE FROM test_prerequisites WHERE id = $1`
+	_, err := r.db.Exec(ctx, query, prerequisiteID)
+	return err
+}
+
+// queryGradeBoundaries retrieves the grade boundaries matching the where clause, highest first
+func (r *TestRepository) queryGradeBoundaries(ctx context.Context, where string, args ...any) (models.GradeBoundaries, error) {
+	query := `SELECT grade, min_percent FROM grade_boundaries WHERE ` + where + ` ORDER BY min_percent DESC`
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var boundaries models.GradeBoundaries
+	for rows.Next() {
+		var b models.GradeBoundary
+		if err := rows.Scan(&b.Grade, &b.MinPercent); err != nil {
+			return nil, err
+		}
+		boundaries = append(boundaries, b)
+	}
+
+	return boundaries, rows.Err()
+}
+
+// GetStandardGradeBoundaries retrieves the grade boundaries of every exam standard that has any
+func (r *TestRepository) GetStandardGradeBoundaries(ctx context.Context) (map[string]models.GradeBoundaries, error) {
+	query := `
+		SELECT exam_standard, grade, min_percent
+		FROM grade_boundaries
+		WHERE test_id IS NULL
+		ORDER BY exam_standard, min_percent DESC`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sets := make(map[string]models.GradeBoundaries)
+	for rows.Next() {
+		var standard string
+		var b models.GradeBoundary
+		if err := rows.Scan(&standard, &b.Grade, &b.MinPercent); err != nil {
+			return nil, err
+		}
+		sets[standard] = append(sets[standard], b)
+	}
+
+	return sets, rows.Err()
+}
+
+// GradeBoundariesFor returns the boundaries a test's attempts are graded
+// against: its own when it overrides its exam standard's, else the standard's
+func (r *TestRepository) GradeBoundariesFor(ctx context.Context, test *models.Test) (models.GradeBoundaries, error) {
+	if len(test.GradeBoundaries) > 0 {
+		return test.GradeBoundaries, nil
+	}
+	return r.queryGradeBoundaries(ctx, "exam_standard = $1 AND test_id IS NULL", test.ExamStandard)
+}
+
+// ReplaceStandardGradeBoundaries swaps an exam standard's grade boundaries for a new set
+func (r *TestRepository) ReplaceStandardGradeBoundaries(ctx context.Context, standard string, boundaries models.GradeBoundaries) error {
+	return r.replaceGradeBoundaries(ctx, &standard, nil, boundaries)
+}
+
+// ReplaceTestGradeBoundaries swaps a test's own grade boundaries for a new
+// set; an empty set leaves the test graded against its exam standard's
+func (r *TestRepository) ReplaceTestGradeBoundaries(ctx context.Context, testID int, boundaries models.GradeBoundaries) error {
+	return r.replaceGradeBoundaries(ctx, nil, &testID, boundaries)
+}
+
+// replaceGradeBoundaries swaps the boundaries owned by either the exam
+// standard or the test for a new set
+func (r *TestRepository) replaceGradeBoundaries(ctx context.Context, standard *string, testID *int, boundaries models.GradeBoundaries) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM grade_boundaries
+		WHERE ($1::VARCHAR IS NOT NULL AND exam_standard = $1 AND test_id IS NULL) OR test_id = $2`,
+		standard, testID)
+	if err != nil {
+		return err
+	}
+	for _, b := range boundaries {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO grade_boundaries (exam_standard, test_id, grade, min_percent)
+			VALUES ($1, $2, $3, $4)`,
+			standard, testID, b.Grade, b.MinPercent)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
 }
 
 // getOptionsByQuestionID retrieves all answer options for a question
 func (r *TestRepository) getOptionsByQuestionID(ctx context.Context, questionID int) ([]models.AnswerOption, error) {
 	query := `
-		SELECT id, question_id, option_text, is_correct, option_order, created_at
+		SELECT id, question_id, option_text, is_correct, match_text, rationale, option_order, created_at
 		FROM answer_options
 		WHERE question_id = $1
 		ORDER BY option_order`
 
-	rows, err := r.pool.Query(ctx, query, questionID)
+	rows, err := r.db.Query(ctx, query, questionID)
 	if err != nil {
 		return nil, err
 	}
@@ -245,7 +777,7 @@ func (r *TestRepository) getOptionsByQuestionID(ctx context.Context, questionID
 	for rows.Next() {
 		var opt models.AnswerOption
 		err := rows.Scan(&opt.ID, &opt.QuestionID, &opt.OptionText,
-			&opt.IsCorrect, &opt.OptionOrder, &opt.CreatedAt)
+			&opt.IsCorrect, &opt.MatchText, &opt.Rationale, &opt.OptionOrder, &opt.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -255,51 +787,268 @@ func (r *TestRepository) getOptionsByQuestionID(ctx context.Context, questionID
 	return options, rows.Err()
 }
 
+// getHintsByQuestionID retrieves a question's hints in the order they are revealed
+func (r *TestRepository) getHintsByQuestionID(ctx context.Context, questionID int) ([]models.Hint, error) {
+	query := `
+		SELECT id, question_id, hint_text, penalty, hint_order, created_at
+		FROM question_hints
+		WHERE question_id = $1
+		ORDER BY hint_order`
+
+	rows, err := r.db.Query(ctx, query, questionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hints []models.Hint
+	for rows.Next() {
+		var h models.Hint
+		if err := rows.Scan(&h.ID, &h.QuestionID, &h.HintText, &h.Penalty, &h.HintOrder, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		hints = append(hints, h)
+	}
+
+	return hints, rows.Err()
+}
+
+// CreateHint creates a new hint
+func (r *TestRepository) CreateHint(ctx context.Context, hint *models.Hint) error {
+	query := `
+		INSERT INTO question_hints (question_id, hint_text, penalty, hint_order)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	return r.db.QueryRow(ctx, query,
+		hint.QuestionID, hint.HintText, hint.Penalty, hint.HintOrder,
+	).Scan(&hint.ID, &hint.CreatedAt)
+}
+
+// UpdateHint updates a hint's text and penalty
+func (r *TestRepository) UpdateHint(ctx context.Context, hint *models.Hint) error {
+	query := `UPDATE question_hints SET hint_text = $1, penalty = $2 WHERE id = $3`
+	_, err := r.db.Exec(ctx, query, hint.HintText, hint.Penalty, hint.ID)
+	return err
+}
+
+// DeleteHint deletes a hint. Reveals of it keep the penalty they cost.
+func (r *TestRepository) DeleteHint(ctx context.Context, hintID int) error {
+	query := `DELETE FROM question_hints WHERE id = $1`
+	_, err := r.db.Exec(ctx, query, hintID)
+	return err
+}
+
 // Create creates a new test (used by admin/teacher)
 func (r *TestRepository) Create(ctx context.Context, test *models.Test) error {
 	query := `
 		INSERT INTO tests (title, description, subject_id, topic_id, exam_standard,
-		                   difficulty, time_limit_minutes, passing_score, created_by)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		                   difficulty, time_limit_minutes, passing_score,
+		                   wrong_penalty, skipped_credit, floor_at_zero, shuffle_questions, shuffle_options,
+		                   max_attempts, attempt_cooldown_minutes, counted_attempt, allow_practice, hint_penalty,
+		                   available_from, available_until, timezone, late_submission, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23)
 		RETURNING id, created_at, updated_at`
 
-	return r.pool.QueryRow(ctx, query,
+	return r.db.QueryRow(ctx, query,
 		test.Title, test.Description, test.SubjectID, test.TopicID,
 		test.ExamStandard, test.Difficulty, test.TimeLimitMinutes,
-		test.PassingScore, test.CreatedBy,
+		test.PassingScore, test.Scoring.WrongPenalty, test.Scoring.SkippedCredit, test.Scoring.FloorAtZero,
+		test.ShuffleQuestions, test.ShuffleOptions,
+		test.Attempts.MaxAttempts, test.Attempts.CooldownMinutes, countedAttemptOrDefault(test.Attempts.Counts),
+		test.AllowPractice, test.Scoring.HintPenalty,
+		test.AvailableFrom, test.AvailableUntil, timezoneOrDefault(test.Timezone), lateSubmissionOrDefault(test.LateSubmission),
+		test.CreatedBy,
 	).Scan(&test.ID, &test.CreatedAt, &test.UpdatedAt)
 }
 
 // CreateQuestion creates a new question
 func (r *TestRepository) CreateQuestion(ctx context.Context, question *models.Question) error {
 	query := `
-		INSERT INTO questions (test_id, question_text, image_url, question_order, points)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO questions (test_id, question_text, image_url, question_type, scoring_rule,
+		                       numeric_expected, numeric_tolerance, numeric_tolerance_type, numeric_sig_figs, numeric_units,
+		                       case_sensitive, typo_tolerance, keep_option_order, pool_id, section_id, explanation, explanation_image_url,
+		                       question_order, points)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
 		RETURNING id, created_at`
 
-	return r.pool.QueryRow(ctx, query,
+	question.QuestionType = questionTypeOrDefault(question.QuestionType)
+	question.ScoringRule = scoringRuleOrDefault(question.ScoringRule)
+	n := numericColumnsFor(question)
+
+	return r.db.QueryRow(ctx, query,
 		question.TestID, question.QuestionText, question.ImageURL,
-		question.QuestionOrder, question.Points,
+		question.QuestionType, question.ScoringRule,
+		n.expected, n.tolerance, n.toleranceType, n.sigFigs, n.units,
+		question.CaseSensitive, question.TypoTolerance, question.KeepOptionOrder, question.PoolID, question.SectionID,
+		question.Explanation, question.ExplanationImageURL, question.QuestionOrder, question.Points,
 	).Scan(&question.ID, &question.CreatedAt)
 }
 
+// numericColumns mirrors the numeric_* columns of the questions table
+type numericColumns struct {
+	expected      *float64
+	tolerance     float64
+	toleranceType string
+	sigFigs       *int
+	units         []string
+}
+
+// numericColumnsFor flattens a question's numeric answer key for storage.
+// Questions of other types store the column defaults.
+func numericColumnsFor(question *models.Question) numericColumns {
+	n := numericColumns{toleranceType: models.ToleranceAbsolute}
+	if question.Numeric == nil {
+		return n
+	}
+	expected := question.Numeric.Expected
+	n.expected = &expected
+	n.tolerance = question.Numeric.Tolerance
+	if question.Numeric.ToleranceType != "" {
+		n.toleranceType = question.Numeric.ToleranceType
+	}
+	n.sigFigs = question.Numeric.SigFigs
+	n.units = question.Numeric.Units
+	return n
+}
+
+// answer rebuilds the numeric answer key from its stored columns
+func (n numericColumns) answer() *models.NumericAnswer {
+	a := &models.NumericAnswer{
+		Tolerance:     n.tolerance,
+		ToleranceType: n.toleranceType,
+		SigFigs:       n.sigFigs,
+		Units:         n.units,
+	}
+	if n.expected != nil {
+		a.Expected = *n.expected
+	}
+	return a
+}
+
+// questionTypeOrDefault treats an unset question type as single choice
+func questionTypeOrDefault(questionType string) string {
+	if questionType == "" {
+		return models.QuestionTypeSingleChoice
+	}
+	return questionType
+}
+
+// scoringRuleOrDefault treats an unset scoring rule as all-or-nothing
+func scoringRuleOrDefault(rule string) string {
+	if rule == "" {
+		return models.ScoringAllOrNothing
+	}
+	return rule
+}
+
+// countedAttemptOrDefault falls back to counting the best attempt
+func countedAttemptOrDefault(counts string) string {
+	if counts == "" {
+		return models.CountBestAttempt
+	}
+	return counts
+}
+
+// timezoneOrDefault falls back to setting availability windows in UTC
+func timezoneOrDefault(timezone string) string {
+	if timezone == "" {
+		return "UTC"
+	}
+	return timezone
+}
+
+// lateSubmissionOrDefault falls back to letting attempts run to their time limit
+func lateSubmissionOrDefault(policy string) string {
+	if policy == "" {
+		return models.LateSubmissionFinish
+	}
+	return policy
+}
+
 // CreateAnswerOption creates a new answer option
 func (r *TestRepository) CreateAnswerOption(ctx context.Context, option *models.AnswerOption) error {
 	query := `
-		INSERT INTO answer_options (question_id, option_text, is_correct, option_order)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO answer_options (question_id, option_text, is_correct, match_text, rationale, option_order)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id, created_at`
 
-	return r.pool.QueryRow(ctx, query,
-		option.QuestionID, option.OptionText, option.IsCorrect, option.OptionOrder,
+	return r.db.QueryRow(ctx, query,
+		option.QuestionID, option.OptionText, option.IsCorrect, option.MatchText, option.Rationale, option.OptionOrder,
 	).Scan(&option.ID, &option.CreatedAt)
 }
 
+// GetAcceptedAnswers retrieves the accepted answers of a short-answer question
+func (r *TestRepository) GetAcceptedAnswers(ctx context.Context, questionID int) ([]models.AcceptedAnswer, error) {
+	query := `
+		SELECT id, question_id, answer_text, is_regex, created_at
+		FROM accepted_answers
+		WHERE question_id = $1
+		ORDER BY is_regex, id`
+
+	rows, err := r.db.Query(ctx, query, questionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accepted []models.AcceptedAnswer
+	for rows.Next() {
+		var a models.AcceptedAnswer
+		if err := rows.Scan(&a.ID, &a.QuestionID, &a.AnswerText, &a.IsRegex, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		accepted = append(accepted, a)
+	}
+
+	return accepted, rows.Err()
+}
+
+// CreateAcceptedAnswer adds an accepted answer to a short-answer question.
+// Adding an answer that is already accepted is a no-op.
+func (r *TestRepository) CreateAcceptedAnswer(ctx context.Context, accepted *models.AcceptedAnswer) error {
+	query := `
+		INSERT INTO accepted_answers (question_id, answer_text, is_regex)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (question_id, answer_text, is_regex)
+		DO UPDATE SET answer_text = EXCLUDED.answer_text
+		RETURNING id, created_at`
+
+	return r.db.QueryRow(ctx, query,
+		accepted.QuestionID, accepted.AnswerText, accepted.IsRegex,
+	).Scan(&accepted.ID, &accepted.CreatedAt)
+}
+
+// ReplaceAcceptedAnswers swaps a question's accepted answers for a new list
+func (r *TestRepository) ReplaceAcceptedAnswers(ctx context.Context, questionID int, accepted []models.AcceptedAnswer) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM accepted_answers WHERE question_id = $1`, questionID); err != nil {
+		return err
+	}
+	for _, a := range accepted {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO accepted_answers (question_id, answer_text, is_regex)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (question_id, answer_text, is_regex) DO NOTHING`,
+			questionID, a.AnswerText, a.IsRegex)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
 // GetSubjects retrieves all subjects
 func (r *TestRepository) GetSubjects(ctx context.Context) ([]models.Subject, error) {
 	query := `SELECT id, name, description, created_at FROM subjects ORDER BY name`
 
-	rows, err := r.pool.Query(ctx, query)
+	rows, err := r.db.Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -318,18 +1067,40 @@ func (r *TestRepository) GetSubjects(ctx context.Context) ([]models.Subject, err
 	return subjects, rows.Err()
 }
 
+// GetTopics retrieves all topics
+func (r *TestRepository) GetTopics(ctx context.Context) ([]models.Topic, error) {
+	query := `SELECT id, COALESCE(subject_id, 0), name, COALESCE(description, ''), created_at FROM topics ORDER BY name`
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var topics []models.Topic
+	for rows.Next() {
+		var t models.Topic
+		if err := rows.Scan(&t.ID, &t.SubjectID, &t.Name, &t.Description, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		topics = append(topics, t)
+	}
+
+	return topics, rows.Err()
+}
+
 // GetOrCreateSubject gets or creates a subject by name
 func (r *TestRepository) GetOrCreateSubject(ctx context.Context, name, description string) (int, error) {
 	var id int
 
 	// Try to get existing subject
-	err := r.pool.QueryRow(ctx, "SELECT id FROM subjects WHERE name = $1", name).Scan(&id)
+	err := r.db.QueryRow(ctx, "SELECT id FROM subjects WHERE name = $1", name).Scan(&id)
 	if err == nil {
 		return id, nil
 	}
 
 	// Create new subject
-	err = r.pool.QueryRow(ctx,
+	err = r.db.QueryRow(ctx,
 		"INSERT INTO subjects (name, description) VALUES ($1, $2) RETURNING id",
 		name, description,
 	).Scan(&id)
@@ -342,7 +1113,7 @@ func (r *TestRepository) GetOrCreateTopic(ctx context.Context, subjectID int, na
 	var id int
 
 	// Try to get existing topic
-	err := r.pool.QueryRow(ctx,
+	err := r.db.QueryRow(ctx,
 		"SELECT id FROM topics WHERE subject_id = $1 AND name = $2",
 		subjectID, name,
 	).Scan(&id)
@@ -351,7 +1122,7 @@ func (r *TestRepository) GetOrCreateTopic(ctx context.Context, subjectID int, na
 	}
 
 	// Create new topic
-	err = r.pool.QueryRow(ctx,
+	err = r.db.QueryRow(ctx,
 		"INSERT INTO topics (subject_id, name, description) VALUES ($1, $2, $3) RETURNING id",
 		subjectID, name, description,
 	).Scan(&id)
@@ -362,16 +1133,14 @@ func (r *TestRepository) GetOrCreateTopic(ctx context.Context, subjectID int, na
 // GetByCreator retrieves all tests created by a specific user
 func (r *TestRepository) GetByCreator(ctx context.Context, userID int) ([]models.Test, error) {
 	query := `
-		SELECT t.id, t.title, t.description, t.subject_id, t.topic_id,
-		       t.exam_standard, t.difficulty, t.time_limit_minutes,
-		       t.passing_score, t.published, t.notes_filename, t.created_by, t.created_at, t.updated_at,
-		       s.id, s.name, s.description
+		SELECT ` + testColumns + `
 		FROM tests t
 		LEFT JOIN subjects s ON t.subject_id = s.id
+		LEFT JOIN topics tp ON t.topic_id = tp.id
 		WHERE t.created_by = $1
 		ORDER BY t.created_at DESC`
 
-	rows, err := r.pool.Query(ctx, query, userID)
+	rows, err := r.db.Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -380,27 +1149,10 @@ func (r *TestRepository) GetByCreator(ctx context.Context, userID int) ([]models
 	var tests []models.Test
 	for rows.Next() {
 		var t models.Test
-		var subjectID *int
-		var subjectName, subjectDesc *string
-
-		err := rows.Scan(
-			&t.ID, &t.Title, &t.Description, &t.SubjectID, &t.TopicID,
-			&t.ExamStandard, &t.Difficulty, &t.TimeLimitMinutes,
-			&t.PassingScore, &t.Published, &t.NotesFilename, &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt,
-			&subjectID, &subjectName, &subjectDesc,
-		)
-		if err != nil {
+		if err := scanTest(rows, &t); err != nil {
 			return nil, err
 		}
 
-		if subjectID != nil {
-			t.Subject = &models.Subject{
-				ID:          *subjectID,
-				Name:        *subjectName,
-				Description: *subjectDesc,
-			}
-		}
-
 		tests = append(tests, t)
 	}
 
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"my-app/internal/dbtest"
+	"my-app/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// errRollback ends a test's transaction so nothing it stored is kept
+var errRollback = errors.New("rolled back")
+
+// inTestTx runs fn in a transaction that is rolled back afterwards
+func inTestTx(t *testing.T, pool *pgxpool.Pool, fn func(tx *TestRepository) error) {
+	t.Helper()
+	if err := NewTestRepository(pool).InTx(context.Background(), fn); !errors.Is(err, errRollback) {
+		t.Fatal(err)
+	}
+}
+
+// createTestWithQuestions stores a test with a multiple choice and a short
+// answer question, with their options, accepted answers and hints
+func createTestWithQuestions(ctx context.Context, tx *TestRepository, createdBy int) (*models.Test, error) {
+	subjectID, err := tx.GetOrCreateSubject(ctx, "Physics", "")
+	if err != nil {
+		return nil, err
+	}
+	topicID, err := tx.GetOrCreateTopic(ctx, subjectID, "Mechanics", "")
+	if err != nil {
+		return nil, err
+	}
+	test := &models.Test{Title: "Newton's laws", SubjectID: &subjectID, TopicID: &topicID, PassingScore: 50, CreatedBy: &createdBy}
+	if err := tx.Create(ctx, test); err != nil {
+		return nil, err
+	}
+
+	choice := &models.Question{TestID: test.ID, QuestionText: "First law?", QuestionOrder: 1, Points: 1}
+	if err := tx.CreateQuestion(ctx, choice); err != nil {
+		return nil, err
+	}
+	for i, text := range []string{"Inertia", "Acceleration"} {
+		option := &models.AnswerOption{QuestionID: choice.ID, OptionText: text, IsCorrect: i == 0, OptionOrder: i + 1}
+		if err := tx.CreateAnswerOption(ctx, option); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.CreateHint(ctx, &models.Hint{QuestionID: choice.ID, HintText: "Objects at rest", HintOrder: 1}); err != nil {
+		return nil, err
+	}
+
+	short := &models.Question{TestID: test.ID, QuestionText: "Second law?", QuestionType: models.QuestionTypeShortAnswer, QuestionOrder: 2, Points: 1}
+	if err := tx.CreateQuestion(ctx, short); err != nil {
+		return nil, err
+	}
+	if err := tx.CreateAcceptedAnswer(ctx, &models.AcceptedAnswer{QuestionID: short.ID, AnswerText: "F = ma"}); err != nil {
+		return nil, err
+	}
+	return test, nil
+}
+
+// TestGetByIDInTx loads a test in the transaction that stored it, which runs
+// each query on the transaction's one connection
+func TestGetByIDInTx(t *testing.T) {
+	pool := dbtest.Pool(t)
+	teacherID := dbtest.User(t, pool, "teacher")
+	ctx := context.Background()
+
+	inTestTx(t, pool, func(tx *TestRepository) error {
+		created, err := createTestWithQuestions(ctx, tx, teacherID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test, err := tx.GetByID(ctx, created.ID)
+		if err != nil {
+			t.Fatalf("GetByID in a transaction: %v", err)
+		}
+		if test.Subject == nil || test.Subject.Name != "Physics" {
+			t.Errorf("expected the subject loaded, got %+v", test.Subject)
+		}
+		if test.Topic == nil || test.Topic.Name != "Mechanics" || test.Topic.SubjectID != *created.SubjectID {
+			t.Errorf("expected the topic loaded, got %+v", test.Topic)
+		}
+		if len(test.Questions) != 2 {
+			t.Fatalf("expected 2 questions, got %d", len(test.Questions))
+		}
+		choice, short := test.Questions[0], test.Questions[1]
+		if len(choice.Options) != 2 || !choice.Options[0].IsCorrect {
+			t.Errorf("expected the choice question's options, got %+v", choice.Options)
+		}
+		if len(choice.Hints) != 1 {
+			t.Errorf("expected the choice question's hint, got %+v", choice.Hints)
+		}
+		if len(short.AcceptedAnswers) != 1 || short.AcceptedAnswers[0].AnswerText != "F = ma" {
+			t.Errorf("expected the short answer question's accepted answer, got %+v", short.AcceptedAnswers)
+		}
+		return errRollback
+	})
+}
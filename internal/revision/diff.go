@@ -0,0 +1,266 @@
+// Package revision compares two revisions of a test field by field, so
+// authors can see what an edit changed before restoring an earlier version.
+// Questions, options, pools and sections are matched by ID, so rewording a
+// question shows as a change to it rather than as one question removed and
+// another added.
+package revision
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"my-app/internal/models"
+)
+
+// Kinds of change
+const (
+	Changed = "changed"
+	Added   = "added"
+	Removed = "removed"
+)
+
+// Change is one difference between two revisions of a test
+type Change struct {
+	Kind   string // see the kinds of change
+	Where  string // e.g. "Test", "Question 3" or "Question 3, option B"
+	Field  string // the field that changed; empty when the whole item was added or removed
+	Before string
+	After  string
+}
+
+// field is one named value of an item, formatted for display
+type field struct {
+	name  string
+	value string
+}
+
+// Diff lists what changed from one revision of a test to another: the test's
+// settings first, then its pools, sections and questions in order
+func Diff(from, to *models.Test) []Change {
+	var changes []Change
+	changes = append(changes, compareFields("Test", testFields(from), testFields(to))...)
+
+	changes = append(changes, compareItems(from.Pools, to.Pools,
+		func(p models.QuestionPool) int { return p.ID },
+		func(p models.QuestionPool) string { return "Pool " + strconv.Quote(p.Name) },
+		func(p models.QuestionPool) []field {
+			return []field{{"Name", p.Name}, {"Questions drawn", strconv.Itoa(p.DrawCount)}}
+		})...)
+
+	changes = append(changes, compareItems(from.Sections, to.Sections,
+		func(s models.Section) int { return s.ID },
+		func(s models.Section) string { return "Section " + strconv.Quote(s.Title) },
+		func(s models.Section) []field {
+			return []field{
+				{"Title", s.Title},
+				{"Instructions", s.Instructions},
+				{"Time limit", minutes(s.TimeLimitMinutes)},
+				{"No return", yesNo(s.NoReturn)},
+				{"Position", strconv.Itoa(s.SectionOrder)},
+			}
+		})...)
+
+	fromQuestions := index(from.Questions, func(q models.Question) int { return q.ID })
+	toQuestions := index(to.Questions, func(q models.Question) int { return q.ID })
+	for _, q := range from.Questions {
+		if _, kept := toQuestions[q.ID]; !kept {
+			changes = append(changes, Change{Kind: Removed, Where: questionLabel(q), Before: q.QuestionText})
+		}
+	}
+	for _, q := range to.Questions {
+		before, kept := fromQuestions[q.ID]
+		if !kept {
+			changes = append(changes, Change{Kind: Added, Where: questionLabel(q), After: q.QuestionText})
+			continue
+		}
+		where := questionLabel(q)
+		changes = append(changes, compareFields(where, questionFields(before, from), questionFields(q, to))...)
+		changes = append(changes, compareItems(before.Options, q.Options,
+			func(o models.AnswerOption) int { return o.ID },
+			func(o models.AnswerOption) string { return where + ", option " + optionLetter(o.OptionOrder) },
+			optionFields)...)
+	}
+
+	return changes
+}
+
+// compareFields lists the fields whose values differ between two versions of one item
+func compareFields(where string, before, after []field) []Change {
+	values := make(map[string]string, len(before))
+	for _, f := range before {
+		values[f.name] = f.value
+	}
+
+	var changes []Change
+	for _, f := range after {
+		if old := values[f.name]; old != f.value {
+			changes = append(changes, Change{Kind: Changed, Where: where, Field: f.name, Before: old, After: f.value})
+		}
+	}
+	return changes
+}
+
+// compareItems matches two lists of items by ID, listing those removed, those
+// added and the fields changed on those in both
+func compareItems[T any](before, after []T, id func(T) int, label func(T) string, fields func(T) []field) []Change {
+	beforeByID := index(before, id)
+	afterByID := index(after, id)
+
+	var changes []Change
+	for _, item := range before {
+		if _, kept := afterByID[id(item)]; !kept {
+			changes = append(changes, Change{Kind: Removed, Where: label(item), Before: summary(fields(item))})
+		}
+	}
+	for _, item := range after {
+		old, kept := beforeByID[id(item)]
+		if !kept {
+			changes = append(changes, Change{Kind: Added, Where: label(item), After: summary(fields(item))})
+			continue
+		}
+		changes = append(changes, compareFields(label(item), fields(old), fields(item))...)
+	}
+	return changes
+}
+
+// index maps each item's ID to the item
+func index[T any](items []T, id func(T) int) map[int]T {
+	byID := make(map[int]T, len(items))
+	for _, item := range items {
+		byID[id(item)] = item
+	}
+	return byID
+}
+
+// summary describes an added or removed item by its first field
+func summary(fields []field) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0].value
+}
+
+func testFields(t *models.Test) []field {
+	subject := ""
+	if t.Subject != nil {
+		subject = t.Subject.Name
+	}
+	notes := ""
+	if t.NotesFilename != nil {
+		notes = *t.NotesFilename
+	}
+	return []field{
+		{"Title", t.Title},
+		{"Description", t.Description},
+		{"Subject", subject},
+		{"Exam standard", t.ExamStandard},
+		{"Difficulty", t.Difficulty},
+		{"Time limit", minutes(t.TimeLimitMinutes)},
+		{"Passing score", strconv.Itoa(t.PassingScore) + "%"},
+		{"Wrong-answer penalty", share(t.Scoring.WrongPenalty)},
+		{"Credit for skipped questions", share(t.Scoring.SkippedCredit)},
+		{"Hint penalty", share(t.Scoring.HintPenalty)},
+		{"Score floored at zero", yesNo(t.Scoring.FloorAtZero)},
+		{"Shuffle questions", yesNo(t.ShuffleQuestions)},
+		{"Shuffle options", yesNo(t.ShuffleOptions)},
+		{"Maximum attempts", strconv.Itoa(t.Attempts.MaxAttempts)},
+		{"Cooldown between attempts", minutes(t.Attempts.CooldownMinutes)},
+		{"Counted attempt", t.Attempts.Counts},
+		{"Practice allowed", yesNo(t.AllowPractice)},
+		{"Available from", t.LocalTime(t.AvailableFrom)},
+		{"Available until", t.LocalTime(t.AvailableUntil)},
+		{"Timezone", t.Timezone},
+		{"Late submissions", t.LateSubmission},
+		{"Grade boundaries", t.GradeBoundaries.Summary()},
+		{"Notes", notes},
+	}
+}
+
+func questionFields(q models.Question, t *models.Test) []field {
+	accepted := make([]string, 0, len(q.AcceptedAnswers))
+	for _, a := range q.AcceptedAnswers {
+		accepted = append(accepted, a.Display())
+	}
+	hints := make([]string, 0, len(q.Hints))
+	for _, h := range q.Hints {
+		hint := h.HintText
+		if h.Penalty != nil {
+			hint += " (" + share(*h.Penalty) + ")"
+		}
+		hints = append(hints, hint)
+	}
+	pool := ""
+	if p := t.Pool(q.PoolID); p != nil {
+		pool = p.Name
+	}
+	section := ""
+	if s := t.Section(q.SectionID); s != nil {
+		section = s.Title
+	}
+	return []field{
+		{"Text", q.QuestionText},
+		{"Image", deref(q.ImageURL)},
+		{"Type", q.QuestionType},
+		{"Scoring rule", q.ScoringRule},
+		{"Points", strconv.Itoa(q.Points)},
+		{"Position", strconv.Itoa(q.QuestionOrder)},
+		{"Numeric answer", q.Numeric.Summary()},
+		{"Accepted answers", strings.Join(accepted, " / ")},
+		{"Case sensitive", yesNo(q.CaseSensitive)},
+		{"Typo tolerance", strconv.Itoa(q.TypoTolerance)},
+		{"Keep option order", yesNo(q.KeepOptionOrder)},
+		{"Pool", pool},
+		{"Section", section},
+		{"Explanation", q.Explanation},
+		{"Explanation image", deref(q.ExplanationImageURL)},
+		{"Hints", strings.Join(hints, " / ")},
+	}
+}
+
+func optionFields(o models.AnswerOption) []field {
+	return []field{
+		{"Text", o.OptionText},
+		{"Correct", yesNo(o.IsCorrect)},
+		{"Match", o.MatchText},
+		{"Rationale", o.Rationale},
+		{"Position", strconv.Itoa(o.OptionOrder)},
+	}
+}
+
+func questionLabel(q models.Question) string {
+	return fmt.Sprintf("Question %d", q.QuestionOrder)
+}
+
+// optionLetter labels an option by its 1-based position: A, B, C...
+func optionLetter(order int) string {
+	if order < 1 || order > 26 {
+		return strconv.Itoa(order)
+	}
+	return string(rune('A' + order - 1))
+}
+
+func minutes(n int) string {
+	if n == 1 {
+		return "1 minute"
+	}
+	return strconv.Itoa(n) + " minutes"
+}
+
+func share(f float64) string {
+	return strconv.FormatFloat(f*100, 'f', -1, 64) + "%"
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,61 @@
+package revision
+
+import (
+	"testing"
+
+	"my-app/internal/models"
+)
+
+func TestDiff(t *testing.T) {
+	pool := 7
+	from := &models.Test{
+		Title:        "Algebra",
+		PassingScore: 50,
+		Pools:        []models.QuestionPool{{ID: pool, Name: "Warm-up", DrawCount: 1}},
+		Questions: []models.Question{
+			{ID: 1, QuestionOrder: 1, QuestionText: "2 + 2", Points: 1, Options: []models.AnswerOption{
+				{ID: 10, OptionText: "3", OptionOrder: 1},
+				{ID: 11, OptionText: "4", IsCorrect: true, OptionOrder: 2},
+			}},
+			{ID: 2, QuestionOrder: 2, QuestionText: "3 + 3", Points: 1},
+		},
+	}
+	to := &models.Test{
+		Title:        "Algebra",
+		PassingScore: 60,
+		Pools:        []models.QuestionPool{{ID: pool, Name: "Warm-up", DrawCount: 1}},
+		Questions: []models.Question{
+			{ID: 1, QuestionOrder: 1, QuestionText: "2 + 2 =", Points: 1, PoolID: &pool, Options: []models.AnswerOption{
+				{ID: 11, OptionText: "4", IsCorrect: true, OptionOrder: 1},
+			}},
+			{ID: 3, QuestionOrder: 2, QuestionText: "5 + 5", Points: 1},
+		},
+	}
+
+	want := []Change{
+		{Kind: Changed, Where: "Test", Field: "Passing score", Before: "50%", After: "60%"},
+		{Kind: Removed, Where: "Question 2", Before: "3 + 3"},
+		{Kind: Changed, Where: "Question 1", Field: "Text", Before: "2 + 2", After: "2 + 2 ="},
+		{Kind: Changed, Where: "Question 1", Field: "Pool", Before: "", After: "Warm-up"},
+		{Kind: Removed, Where: "Question 1, option A", Before: "3"},
+		{Kind: Changed, Where: "Question 1, option A", Field: "Position", Before: "2", After: "1"},
+		{Kind: Added, Where: "Question 2", After: "5 + 5"},
+	}
+
+	got := Diff(from, to)
+	if len(got) != len(want) {
+		t.Fatalf("expected %d changes, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("change %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestDiffUnchanged(t *testing.T) {
+	test := &models.Test{Title: "Algebra", Questions: []models.Question{{ID: 1, QuestionText: "2 + 2"}}}
+	if changes := Diff(test, test); len(changes) != 0 {
+		t.Fatalf("expected no changes, got %+v", changes)
+	}
+}
@@ -0,0 +1,78 @@
+// Package richtext renders the light markup teachers write explanations in
+// as HTML. The text is escaped first, so only this markup becomes tags:
+//
+//	**bold**, *italic* and `code`
+//	lines starting "- " make a bulleted list
+//	a blank line starts a new paragraph; other line breaks are kept
+package richtext
+
+import (
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+var (
+	paragraphBreak = regexp.MustCompile(`\n[ \t]*\n`)
+	codeSpan       = regexp.MustCompile("`([^`]+)`")
+	boldSpan       = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	italicSpan     = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+)
+
+// Render turns explanation text into HTML that is safe to show as is
+func Render(src string) template.HTML {
+	src = strings.TrimSpace(strings.ReplaceAll(src, "\r\n", "\n"))
+	if src == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, block := range paragraphBreak.Split(src, -1) {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		if isList(lines) {
+			b.WriteString(`<ul class="list-disc ml-5">`)
+			for _, line := range lines {
+				b.WriteString("<li>" + inline(strings.TrimPrefix(strings.TrimSpace(line), "- ")) + "</li>")
+			}
+			b.WriteString("</ul>")
+			continue
+		}
+
+		rendered := make([]string, len(lines))
+		for i, line := range lines {
+			rendered[i] = inline(strings.TrimSpace(line))
+		}
+		b.WriteString("<p>" + strings.Join(rendered, "<br>") + "</p>")
+	}
+	return template.HTML(b.String())
+}
+
+// isList reports whether every line of a block is a "- " bullet
+func isList(lines []string) bool {
+	for _, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "- ") {
+			return false
+		}
+	}
+	return true
+}
+
+// inline escapes a line and applies the bold, italic and code markup, leaving
+// the text inside code spans as written
+func inline(line string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range codeSpan.FindAllStringSubmatchIndex(line, -1) {
+		b.WriteString(emphasis(line[last:m[0]]))
+		b.WriteString("<code>" + template.HTMLEscapeString(line[m[2]:m[3]]) + "</code>")
+		last = m[1]
+	}
+	b.WriteString(emphasis(line[last:]))
+	return b.String()
+}
+
+func emphasis(text string) string {
+	text = template.HTMLEscapeString(text)
+	text = boldSpan.ReplaceAllString(text, "<strong>$1</strong>")
+	return italicSpan.ReplaceAllString(text, "<em>$1</em>")
+}
@@ -0,0 +1,24 @@
+package richtext
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		name, src string
+		want      string
+	}{
+		{"empty", "  \n ", ""},
+		{"paragraphs and breaks", "First line\nsecond line\n\nNew paragraph", "<p>First line<br>second line</p><p>New paragraph</p>"},
+		{"emphasis", "It is **not** *always* true", "<p>It is <strong>not</strong> <em>always</em> true</p>"},
+		{"code keeps its text", "Use `a*b*c` here", "<p>Use <code>a*b*c</code> here</p>"},
+		{"list", "Remember:\n\n- mass\n- speed", `<p>Remember:</p><ul class="list-disc ml-5"><li>mass</li><li>speed</li></ul>`},
+		{"html is escaped", `<script>alert("x")</script> **<b>**`, "<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; <strong>&lt;b&gt;</strong></p>"},
+		{"lone asterisks stay", "2 * 3 * 4 = 24", "<p>2 * 3 * 4 = 24</p>"},
+	}
+
+	for _, tc := range cases {
+		if got := string(Render(tc.src)); got != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
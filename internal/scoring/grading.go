@@ -0,0 +1,338 @@
+package scoring
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"my-app/internal/models"
+)
+
+// Grade checks a student's answer against the question's answer key and
+// records whether it is fully correct and the fraction of credit it earns.
+func Grade(q *models.Question, answer *models.StudentAnswer) {
+	var credit float64
+	answer.MatchedAnswer = nil
+	switch q.QuestionType {
+	case models.QuestionTypeMultipleSelect:
+		credit = gradeMultipleSelect(q, answer.SelectedOptionIDs)
+	case models.QuestionTypeNumeric:
+		credit = gradeNumeric(q.Numeric, answer.TextAnswer)
+	case models.QuestionTypeOrdering:
+		credit = gradeOrdering(q, answer.SelectedOptionIDs)
+	case models.QuestionTypeMatching:
+		credit = gradeMatching(q, answer.MatchPairs)
+	case models.QuestionTypeShortAnswer:
+		if matched, ok := matchShortAnswer(q, answer.Text()); ok {
+			credit = 1
+			answer.MatchedAnswer = &matched
+		}
+	default:
+		credit = gradeSingleChoice(q, answer.SelectedOptionID)
+	}
+
+	isCorrect := credit >= 1
+	answer.IsCorrect = &isCorrect
+	answer.Credit = &credit
+}
+
+// gradeSingleChoice awards full credit when the selected option is the correct one.
+func gradeSingleChoice(q *models.Question, selected *int) float64 {
+	if selected == nil {
+		return 0
+	}
+	for _, opt := range q.Options {
+		if opt.ID == *selected && opt.IsCorrect {
+			return 1
+		}
+	}
+	return 0
+}
+
+// gradeMultipleSelect scores a set of picks. All-or-nothing requires exactly the
+// correct set; partial credit awards a share per correct pick and takes a share
+// away for every wrong pick, never dropping below zero.
+func gradeMultipleSelect(q *models.Question, selected []int) float64 {
+	correct := make(map[int]bool)
+	totalCorrect := 0
+	for _, opt := range q.Options {
+		correct[opt.ID] = opt.IsCorrect
+		if opt.IsCorrect {
+			totalCorrect++
+		}
+	}
+	if totalCorrect == 0 {
+		return 0
+	}
+
+	hits, misses := 0, 0
+	seen := make(map[int]bool)
+	for _, id := range selected {
+		isCorrect, known := correct[id]
+		if !known || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if isCorrect {
+			hits++
+		} else {
+			misses++
+		}
+	}
+
+	if q.ScoringRule == models.ScoringPartial {
+		credit := float64(hits-misses) / float64(totalCorrect)
+		if credit < 0 {
+			return 0
+		}
+		return credit
+	}
+
+	if hits == totalCorrect && misses == 0 {
+		return 1
+	}
+	return 0
+}
+
+// numericAnswerPattern splits a typed answer into its number and optional unit.
+var numericAnswerPattern = regexp.MustCompile(`^([+-]?(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?)\s*(.*)$`)
+
+// gradeNumeric awards full credit when the typed value is within tolerance of the
+// expected value, carries an accepted unit (when units are configured) and is
+// written to the required number of significant figures.
+func gradeNumeric(key *models.NumericAnswer, text *string) float64 {
+	if key == nil || text == nil {
+		return 0
+	}
+	match := numericAnswerPattern.FindStringSubmatch(strings.TrimSpace(*text))
+	if match == nil {
+		return 0
+	}
+	number, unit := match[1], normalizeUnit(match[2])
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0
+	}
+
+	if len(key.Units) == 0 {
+		if unit != "" {
+			return 0
+		}
+	} else {
+		accepted := false
+		for _, u := range key.Units {
+			if normalizeUnit(u) == unit {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return 0
+		}
+	}
+
+	if key.SigFigs != nil {
+		min, max := significantFigures(number)
+		if *key.SigFigs < min || *key.SigFigs > max {
+			return 0
+		}
+	}
+
+	allowed := key.Tolerance
+	if key.ToleranceType == models.TolerancePercent {
+		allowed = math.Abs(key.Expected) * key.Tolerance / 100
+	}
+	// Allow for floating point noise so "0.3" matches 0.1+0.2 with zero tolerance
+	epsilon := 1e-9 * math.Max(1, math.Abs(key.Expected))
+	if math.Abs(value-key.Expected) > allowed+epsilon {
+		return 0
+	}
+	return 1
+}
+
+// normalizeUnit trims a unit and collapses internal whitespace. Case is kept
+// because it matters for units (mA vs MA).
+func normalizeUnit(unit string) string {
+	return strings.Join(strings.Fields(unit), " ")
+}
+
+// significantFigures counts the significant figures in a number as typed.
+// Trailing zeros in a whole number without a decimal point ("1200") are
+// ambiguous, so it returns the smallest and largest possible counts.
+func significantFigures(number string) (min, max int) {
+	mantissa := strings.TrimLeft(number, "+-")
+	if i := strings.IndexAny(mantissa, "eE"); i >= 0 {
+		mantissa = mantissa[:i]
+	}
+	hasPoint := strings.Contains(mantissa, ".")
+	digits := strings.TrimLeft(strings.Replace(mantissa, ".", "", 1), "0")
+	if digits == "" {
+		// Zero itself: "0" has one significant figure, "0.00" has as many as its decimals
+		if hasPoint {
+			decimals := len(mantissa) - strings.Index(mantissa, ".") - 1
+			if decimals > 0 {
+				return decimals, decimals
+			}
+		}
+		return 1, 1
+	}
+	if hasPoint {
+		return len(digits), len(digits)
+	}
+	trimmed := strings.TrimRight(digits, "0")
+	return len(trimmed), len(digits)
+}
+
+// gradeOrdering scores the order the student placed the options in. Partial
+// credit awards a share for every option in its correct position; all-or-nothing
+// requires the whole sequence.
+func gradeOrdering(q *models.Question, order []int) float64 {
+	if len(q.Options) == 0 {
+		return 0
+	}
+
+	// Positions follow option_order rather than trusting the slice order
+	position := make(map[int]int, len(q.Options))
+	for _, opt := range q.Options {
+		rank := 0
+		for _, other := range q.Options {
+			if other.OptionOrder < opt.OptionOrder {
+				rank++
+			}
+		}
+		position[opt.ID] = rank
+	}
+
+	placed := 0
+	seen := make(map[int]bool)
+	for i, id := range order {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if pos, ok := position[id]; ok && pos == i {
+			placed++
+		}
+	}
+
+	return shareOrAll(q.ScoringRule, placed, len(q.Options))
+}
+
+// gradeMatching scores the match chosen for each option. Options are compared
+// by match text, so two options sharing a match are interchangeable.
+func gradeMatching(q *models.Question, pairs map[int]string) float64 {
+	if len(q.Options) == 0 {
+		return 0
+	}
+
+	matched := 0
+	for _, opt := range q.Options {
+		if chosen, ok := pairs[opt.ID]; ok && chosen == opt.MatchText {
+			matched++
+		}
+	}
+
+	return shareOrAll(q.ScoringRule, matched, len(q.Options))
+}
+
+// shareOrAll turns a count of correct parts into credit: the share of parts
+// under partial scoring, otherwise full credit only when every part is right
+func shareOrAll(rule string, right, total int) float64 {
+	if rule == models.ScoringPartial {
+		return float64(right) / float64(total)
+	}
+	if right == total {
+		return 1
+	}
+	return 0
+}
+
+// matchShortAnswer compares typed text with a short-answer question's accepted
+// answers and returns the accepted answer it matched. Surrounding and repeated
+// whitespace is ignored, as is case unless the question is case sensitive.
+// Exact matches win over regex patterns, which win over near-misses within the
+// question's typo tolerance.
+func matchShortAnswer(q *models.Question, text string) (string, bool) {
+	typed := normalizeShortAnswer(text, q.CaseSensitive)
+	if typed == "" {
+		return "", false
+	}
+
+	for _, a := range q.AcceptedAnswers {
+		if !a.IsRegex && normalizeShortAnswer(a.AnswerText, q.CaseSensitive) == typed {
+			return a.Display(), true
+		}
+	}
+
+	for _, a := range q.AcceptedAnswers {
+		if !a.IsRegex {
+			continue
+		}
+		pattern := `^(?:` + a.AnswerText + `)$`
+		if !q.CaseSensitive {
+			pattern = `(?i)` + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(strings.Join(strings.Fields(text), " ")) {
+			return a.Display(), true
+		}
+	}
+
+	if q.TypoTolerance <= 0 {
+		return "", false
+	}
+	best, bestDistance := "", q.TypoTolerance+1
+	for _, a := range q.AcceptedAnswers {
+		if a.IsRegex {
+			continue
+		}
+		accepted := normalizeShortAnswer(a.AnswerText, q.CaseSensitive)
+		// A typo allowance must not swallow the whole word ("ox" vs "ax" with tolerance 2)
+		if len([]rune(accepted)) <= q.TypoTolerance {
+			continue
+		}
+		if d := editDistance(typed, accepted); d < bestDistance {
+			best, bestDistance = a.Display(), d
+		}
+	}
+	if bestDistance <= q.TypoTolerance {
+		return best, true
+	}
+	return "", false
+}
+
+// normalizeShortAnswer trims and collapses whitespace, folding case unless caseSensitive
+func normalizeShortAnswer(text string, caseSensitive bool) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if !caseSensitive {
+		text = strings.ToLower(text)
+	}
+	return text
+}
+
+// editDistance is the Levenshtein distance between two strings, counted in runes
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,294 @@
+package scoring
+
+import (
+	"testing"
+
+	"my-app/internal/models"
+)
+
+func multipleSelectQuestion(rule string) *models.Question {
+	return &models.Question{
+		QuestionType: models.QuestionTypeMultipleSelect,
+		ScoringRule:  rule,
+		Points:       2,
+		Options: []models.AnswerOption{
+			{ID: 1, IsCorrect: true},
+			{ID: 2, IsCorrect: false},
+			{ID: 3, IsCorrect: true},
+			{ID: 4, IsCorrect: false},
+		},
+	}
+}
+
+func TestGrade_MultipleSelectAllOrNothing(t *testing.T) {
+	cases := []struct {
+		name     string
+		selected []int
+		want     float64
+	}{
+		{"exact set", []int{1, 3}, 1},
+		{"missing one", []int{1}, 0},
+		{"extra wrong pick", []int{1, 2, 3}, 0},
+		{"nothing picked", nil, 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			answer := &models.StudentAnswer{SelectedOptionIDs: tc.selected}
+			Grade(multipleSelectQuestion(models.ScoringAllOrNothing), answer)
+
+			if *answer.Credit != tc.want {
+				t.Fatalf("expected credit %v, got %v", tc.want, *answer.Credit)
+			}
+			if *answer.IsCorrect != (tc.want == 1) {
+				t.Fatalf("expected is_correct %v, got %v", tc.want == 1, *answer.IsCorrect)
+			}
+		})
+	}
+}
+
+func TestGrade_MultipleSelectPartial(t *testing.T) {
+	cases := []struct {
+		name     string
+		selected []int
+		want     float64
+	}{
+		{"exact set", []int{1, 3}, 1},
+		{"half right", []int{1}, 0.5},
+		{"wrong pick cancels right pick", []int{1, 2}, 0},
+		{"more wrong than right floors at zero", []int{1, 2, 4}, 0},
+		{"duplicates and unknown ids ignored", []int{1, 1, 99}, 0.5},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			answer := &models.StudentAnswer{SelectedOptionIDs: tc.selected}
+			Grade(multipleSelectQuestion(models.ScoringPartial), answer)
+
+			if *answer.Credit != tc.want {
+				t.Fatalf("expected credit %v, got %v", tc.want, *answer.Credit)
+			}
+		})
+	}
+}
+
+func TestGrade_SingleChoice(t *testing.T) {
+	q := &models.Question{
+		Options: []models.AnswerOption{{ID: 10, IsCorrect: false}, {ID: 11, IsCorrect: true}},
+	}
+
+	right, wrong := 11, 10
+	answer := &models.StudentAnswer{SelectedOptionID: &right}
+	Grade(q, answer)
+	if !*answer.IsCorrect || *answer.Credit != 1 {
+		t.Fatalf("expected correct option to earn full credit")
+	}
+
+	answer = &models.StudentAnswer{SelectedOptionID: &wrong}
+	Grade(q, answer)
+	if *answer.IsCorrect || *answer.Credit != 0 {
+		t.Fatalf("expected wrong option to earn no credit")
+	}
+}
+
+func TestGrade_Numeric(t *testing.T) {
+	threeSigFigs := 3
+	cases := []struct {
+		name   string
+		key    models.NumericAnswer
+		answer string
+		want   float64
+	}{
+		{"exact", models.NumericAnswer{Expected: 42}, "42", 1},
+		{"wrong value", models.NumericAnswer{Expected: 42}, "43", 0},
+		{"not a number", models.NumericAnswer{Expected: 42}, "forty-two", 0},
+		{"within absolute tolerance", models.NumericAnswer{Expected: 9.81, Tolerance: 0.05}, "9.78", 1},
+		{"outside absolute tolerance", models.NumericAnswer{Expected: 9.81, Tolerance: 0.05}, "9.7", 0},
+		{"within percent tolerance", models.NumericAnswer{Expected: 200, Tolerance: 5, ToleranceType: models.TolerancePercent}, "209", 1},
+		{"outside percent tolerance", models.NumericAnswer{Expected: 200, Tolerance: 5, ToleranceType: models.TolerancePercent}, "211", 0},
+		{"scientific notation", models.NumericAnswer{Expected: 6.02e23, Tolerance: 1, ToleranceType: models.TolerancePercent}, "6.0e23", 1},
+		{"accepted unit", models.NumericAnswer{Expected: 9.81, Units: []string{"m/s^2", "N/kg"}}, "9.81 N/kg", 1},
+		{"unit without space", models.NumericAnswer{Expected: 9.81, Units: []string{"m/s^2"}}, "9.81m/s^2", 1},
+		{"missing unit", models.NumericAnswer{Expected: 9.81, Units: []string{"m/s^2"}}, "9.81", 0},
+		{"wrong unit", models.NumericAnswer{Expected: 9.81, Units: []string{"m/s^2"}}, "9.81 kg", 0},
+		{"unit given when none expected", models.NumericAnswer{Expected: 5}, "5 cm", 0},
+		{"right sig figs", models.NumericAnswer{Expected: 9.81, SigFigs: &threeSigFigs}, "9.81", 1},
+		{"trailing zero counts after point", models.NumericAnswer{Expected: 2.5, SigFigs: &threeSigFigs}, "2.50", 1},
+		{"too few sig figs", models.NumericAnswer{Expected: 2.5, Tolerance: 0.1, SigFigs: &threeSigFigs}, "2.5", 0},
+		{"ambiguous trailing zeros", models.NumericAnswer{Expected: 1200, SigFigs: &threeSigFigs}, "1200", 1},
+		{"leading zeros do not count", models.NumericAnswer{Expected: 0.00123, SigFigs: &threeSigFigs}, "0.00123", 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			key := tc.key
+			text := tc.answer
+			answer := &models.StudentAnswer{TextAnswer: &text}
+			Grade(&models.Question{QuestionType: models.QuestionTypeNumeric, Numeric: &key}, answer)
+
+			if *answer.Credit != tc.want {
+				t.Fatalf("expected credit %v for %q, got %v", tc.want, tc.answer, *answer.Credit)
+			}
+		})
+	}
+}
+
+func TestGrade_NumericUnanswered(t *testing.T) {
+	answer := &models.StudentAnswer{}
+	Grade(&models.Question{QuestionType: models.QuestionTypeNumeric, Numeric: &models.NumericAnswer{Expected: 1}}, answer)
+	if *answer.IsCorrect || *answer.Credit != 0 {
+		t.Fatalf("expected an unanswered numeric question to earn no credit")
+	}
+}
+
+func shortAnswerQuestion(caseSensitive bool, typoTolerance int, accepted ...models.AcceptedAnswer) *models.Question {
+	return &models.Question{
+		QuestionType:    models.QuestionTypeShortAnswer,
+		CaseSensitive:   caseSensitive,
+		TypoTolerance:   typoTolerance,
+		Points:          1,
+		AcceptedAnswers: accepted,
+	}
+}
+
+func TestGrade_ShortAnswer(t *testing.T) {
+	paris := models.AcceptedAnswer{AnswerText: "Paris"}
+	cases := []struct {
+		name    string
+		q       *models.Question
+		answer  string
+		matched string
+	}{
+		{"exact", shortAnswerQuestion(false, 0, paris), "Paris", "Paris"},
+		{"case folded", shortAnswerQuestion(false, 0, paris), "PARIS", "Paris"},
+		{"trimmed", shortAnswerQuestion(false, 0, paris), "  paris \n", "Paris"},
+		{"case sensitive rejects wrong case", shortAnswerQuestion(true, 0, paris), "paris", ""},
+		{"wrong answer", shortAnswerQuestion(false, 0, paris), "London", ""},
+		{"blank", shortAnswerQuestion(false, 0, paris), "   ", ""},
+		{"inner whitespace collapsed", shortAnswerQuestion(false, 0, models.AcceptedAnswer{AnswerText: "Henry VIII"}), "henry   viii", "Henry VIII"},
+		{"typo within tolerance", shortAnswerQuestion(false, 1, paris), "Pariss", "Paris"},
+		{"typo beyond tolerance", shortAnswerQuestion(false, 1, paris), "Parsi", ""},
+		{"tolerance ignored for short words", shortAnswerQuestion(false, 2, models.AcceptedAnswer{AnswerText: "ox"}), "ax", ""},
+		{"regex", shortAnswerQuestion(false, 0, models.AcceptedAnswer{AnswerText: `(king )?henry (viii|8)`, IsRegex: true}), "King Henry 8", "/(king )?henry (viii|8)/"},
+		{"regex is anchored", shortAnswerQuestion(false, 0, models.AcceptedAnswer{AnswerText: `henry`, IsRegex: true}), "not henry", ""},
+		{"invalid regex skipped", shortAnswerQuestion(false, 0, models.AcceptedAnswer{AnswerText: `(`, IsRegex: true}, paris), "paris", "Paris"},
+		{"exact beats typo match", shortAnswerQuestion(false, 1, models.AcceptedAnswer{AnswerText: "Rome"}, models.AcceptedAnswer{AnswerText: "Roma"}), "roma", "Roma"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			text := tc.answer
+			answer := &models.StudentAnswer{TextAnswer: &text}
+			Grade(tc.q, answer)
+
+			if answer.Matched() != tc.matched {
+				t.Fatalf("expected %q to match %q, got %q", tc.answer, tc.matched, answer.Matched())
+			}
+			if *answer.IsCorrect != (tc.matched != "") {
+				t.Fatalf("expected is_correct %v, got %v", tc.matched != "", *answer.IsCorrect)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"kitten", "sitting", 3},
+		{"paris", "pariss", 1},
+		{"café", "cafe", 1},
+	}
+	for _, tc := range cases {
+		if got := editDistance(tc.a, tc.b); got != tc.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func orderingQuestion(rule string) *models.Question {
+	return &models.Question{
+		QuestionType: models.QuestionTypeOrdering,
+		ScoringRule:  rule,
+		Points:       4,
+		Options: []models.AnswerOption{
+			{ID: 21, OptionText: "Battle of Hastings", OptionOrder: 1},
+			{ID: 22, OptionText: "Magna Carta", OptionOrder: 2},
+			{ID: 23, OptionText: "Black Death", OptionOrder: 3},
+			{ID: 24, OptionText: "Wars of the Roses", OptionOrder: 4},
+		},
+	}
+}
+
+func TestGrade_Ordering(t *testing.T) {
+	cases := []struct {
+		name  string
+		rule  string
+		order []int
+		want  float64
+	}{
+		{"partial: correct order", models.ScoringPartial, []int{21, 22, 23, 24}, 1},
+		{"partial: last two swapped", models.ScoringPartial, []int{21, 22, 24, 23}, 0.5},
+		{"partial: reversed", models.ScoringPartial, []int{24, 23, 22, 21}, 0},
+		{"partial: repeated option only counts once", models.ScoringPartial, []int{21, 21, 23, 24}, 0.75},
+		{"partial: unanswered", models.ScoringPartial, nil, 0},
+		{"all or nothing: correct order", models.ScoringAllOrNothing, []int{21, 22, 23, 24}, 1},
+		{"all or nothing: one swap", models.ScoringAllOrNothing, []int{21, 22, 24, 23}, 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			answer := &models.StudentAnswer{SelectedOptionIDs: tc.order}
+			Grade(orderingQuestion(tc.rule), answer)
+
+			if *answer.Credit != tc.want {
+				t.Fatalf("expected credit %v, got %v", tc.want, *answer.Credit)
+			}
+		})
+	}
+}
+
+func TestGrade_Matching(t *testing.T) {
+	q := &models.Question{
+		QuestionType: models.QuestionTypeMatching,
+		ScoringRule:  models.ScoringPartial,
+		Points:       3,
+		Options: []models.AnswerOption{
+			{ID: 31, OptionText: "Heart", MatchText: "Pumps blood"},
+			{ID: 32, OptionText: "Lungs", MatchText: "Exchange gases"},
+			{ID: 33, OptionText: "Kidneys", MatchText: "Filter blood"},
+			{ID: 34, OptionText: "Liver", MatchText: "Filter blood"},
+		},
+	}
+
+	cases := []struct {
+		name  string
+		pairs map[int]string
+		want  float64
+	}{
+		{"all matched", map[int]string{31: "Pumps blood", 32: "Exchange gases", 33: "Filter blood", 34: "Filter blood"}, 1},
+		{"half matched", map[int]string{31: "Pumps blood", 32: "Filter blood", 33: "Filter blood", 34: "Exchange gases"}, 0.5},
+		{"some unanswered", map[int]string{31: "Pumps blood"}, 0.25},
+		{"unknown options ignored", map[int]string{99: "Pumps blood"}, 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			answer := &models.StudentAnswer{MatchPairs: tc.pairs}
+			Grade(q, answer)
+
+			if *answer.Credit != tc.want {
+				t.Fatalf("expected credit %v, got %v", tc.want, *answer.Credit)
+			}
+		})
+	}
+
+	q.ScoringRule = models.ScoringAllOrNothing
+	answer := &models.StudentAnswer{MatchPairs: map[int]string{31: "Pumps blood", 32: "Exchange gases", 33: "Filter blood"}}
+	Grade(q, answer)
+	if *answer.Credit != 0 {
+		t.Fatalf("expected all-or-nothing matching with a missing pair to earn no credit")
+	}
+}
@@ -0,0 +1,153 @@
+// Package scoring grades student answers and adds them up into a test score
+// under the test's scoring policy.
+package scoring
+
+import (
+	"math"
+
+	"my-app/internal/models"
+)
+
+// Result is a test score together with how it was worked out
+type Result struct {
+	Score       int // points awarded, rounded to a whole number
+	TotalPoints int // points available
+
+	Correct int // questions earning all of their points
+	Partial int // questions earning some of their points
+	Wrong   int // questions answered but earning nothing
+	Skipped int // questions left unanswered
+
+	Earned        float64 // points from correct and partially correct answers
+	Penalty       float64 // points deducted for wrong answers
+	SkippedPoints float64 // points awarded for skipped questions
+	HintsUsed     int     // hints revealed during the attempt
+	HintPenalty   float64 // points the revealed hints took off the earned points
+	Floored       bool    // the raw score was below zero and was raised to zero
+}
+
+// Raw returns the score before rounding and before the zero floor is applied
+func (r Result) Raw() float64 {
+	return r.Earned - r.Penalty - r.HintPenalty + r.SkippedPoints
+}
+
+// Score grades every answer against the test's questions and totals them
+// under the test's scoring policy, less the cost of the hints revealed
+func Score(test *models.Test, answers []models.StudentAnswer, hints []models.HintReveal) Result {
+	questions := make(map[int]*models.Question, len(test.Questions))
+	for i := range test.Questions {
+		questions[test.Questions[i].ID] = &test.Questions[i]
+	}
+	for i := range answers {
+		if q, ok := questions[answers[i].QuestionID]; ok {
+			Grade(q, &answers[i])
+		}
+	}
+	return Tally(test, answers, hints)
+}
+
+// Tally totals answers that have already been graded under the test's scoring
+// policy. A question with no answer, or an empty one, counts as skipped; an
+// answer earning no credit counts as wrong and carries the wrong-answer
+// penalty. Partially correct answers are never penalised.
+//
+// Each revealed hint lowers the points a question is worth to the student by
+// its penalty share, so a hint costs nothing on a question earning no credit
+// and a question's hints never cost more than it earned.
+func Tally(test *models.Test, answers []models.StudentAnswer, hints []models.HintReveal) Result {
+	byQuestion := make(map[int]*models.StudentAnswer, len(answers))
+	for i := range answers {
+		byQuestion[answers[i].QuestionID] = &answers[i]
+	}
+	hintShare := make(map[int]float64) // questionID -> share of its points the hints cost
+	for _, h := range hints {
+		hintShare[h.QuestionID] += h.Penalty
+	}
+
+	policy := test.Scoring
+	result := Result{HintsUsed: len(hints)}
+	for i := range test.Questions {
+		q := &test.Questions[i]
+		points := float64(q.Points)
+		result.TotalPoints += q.Points
+
+		answer := byQuestion[q.ID]
+		credit := creditOf(answer)
+		if share, ok := hintShare[q.ID]; ok && answer.Answered() && credit > 0 {
+			result.HintPenalty += min(share, 1) * credit * points
+		}
+		switch {
+		case !answer.Answered():
+			result.Skipped++
+			result.SkippedPoints += policy.SkippedCredit * points
+		case credit >= 1:
+			result.Correct++
+			result.Earned += points
+		case credit > 0:
+			result.Partial++
+			result.Earned += credit * points
+		default:
+			result.Wrong++
+			result.Penalty += policy.WrongPenalty * points
+		}
+	}
+
+	raw := result.Raw()
+	if policy.FloorAtZero && raw < 0 {
+		raw = 0
+		result.Floored = true
+	}
+	result.Score = int(math.Round(raw))
+	return result
+}
+
+// SectionResult is one section's share of a test score
+type SectionResult struct {
+	Section models.Section
+	Result
+}
+
+// Sections subtotals graded answers section by section, returning nil for a
+// test without sections. Each subtotal tallies the section's questions and
+// the hints revealed on them under the test's policy, but without the zero
+// floor, so the subtotals add up to the score before it is floored, give or
+// take rounding.
+func Sections(test *models.Test, answers []models.StudentAnswer, hints []models.HintReveal) []SectionResult {
+	if len(test.Sections) == 0 {
+		return nil
+	}
+
+	part := *test
+	part.Scoring.FloorAtZero = false
+	results := make([]SectionResult, 0, len(test.Sections))
+	for _, section := range test.Sections {
+		part.Questions = test.SectionQuestions(section.ID)
+		asked := make(map[int]bool, len(part.Questions))
+		for _, q := range part.Questions {
+			asked[q.ID] = true
+		}
+		var partHints []models.HintReveal
+		for _, h := range hints {
+			if asked[h.QuestionID] {
+				partHints = append(partHints, h)
+			}
+		}
+		results = append(results, SectionResult{Section: section, Result: Tally(&part, answers, partHints)})
+	}
+	return results
+}
+
+// creditOf returns the fraction of credit a graded answer earned, falling back
+// to is_correct for answers saved before credit was recorded
+func creditOf(answer *models.StudentAnswer) float64 {
+	if answer == nil {
+		return 0
+	}
+	if answer.Credit != nil {
+		return *answer.Credit
+	}
+	if answer.Correct() {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,191 @@
+package scoring
+
+import (
+	"math"
+	"testing"
+
+	"my-app/internal/models"
+)
+
+func TestScore(t *testing.T) {
+	test := &models.Test{
+		Scoring: models.DefaultScoringPolicy(),
+		Questions: []models.Question{
+			*multipleSelectQuestion(models.ScoringPartial),
+			*shortAnswerQuestion(false, 0, models.AcceptedAnswer{AnswerText: "Paris"}),
+		},
+	}
+	test.Questions[0].ID = 1
+	test.Questions[1].ID = 2
+
+	typed := "paris"
+	answers := []models.StudentAnswer{
+		{QuestionID: 1, SelectedOptionIDs: []int{1}},
+		{QuestionID: 2, TextAnswer: &typed},
+	}
+
+	result := Score(test, answers, nil)
+	if result.Score != 2 || result.TotalPoints != 3 {
+		t.Fatalf("expected 2/3, got %d/%d", result.Score, result.TotalPoints)
+	}
+	if result.Correct != 1 || result.Partial != 1 {
+		t.Fatalf("expected 1 correct and 1 partial, got %+v", result)
+	}
+	if answers[1].Credit == nil || *answers[1].Credit != 1 {
+		t.Fatalf("expected answers to be graded in place")
+	}
+}
+
+// fourQuestionTest has four single-choice questions worth 2 points each,
+// where option 1 of each question is correct
+func fourQuestionTest(policy models.ScoringPolicy) *models.Test {
+	test := &models.Test{Scoring: policy}
+	for id := 1; id <= 4; id++ {
+		test.Questions = append(test.Questions, models.Question{
+			ID:     id,
+			Points: 2,
+			Options: []models.AnswerOption{
+				{ID: id*10 + 1, IsCorrect: true},
+				{ID: id*10 + 2},
+			},
+		})
+	}
+	return test
+}
+
+func pick(questionID, optionID int) models.StudentAnswer {
+	return models.StudentAnswer{QuestionID: questionID, SelectedOptionID: &optionID}
+}
+
+func TestScore_Policies(t *testing.T) {
+	oneRightTwoWrongOneSkipped := []models.StudentAnswer{pick(1, 11), pick(2, 22), pick(3, 32)}
+	allWrong := []models.StudentAnswer{pick(1, 12), pick(2, 22), pick(3, 32), pick(4, 42)}
+
+	cases := []struct {
+		name    string
+		policy  models.ScoringPolicy
+		answers []models.StudentAnswer
+		score   int
+		raw     float64
+		floored bool
+	}{
+		{"default policy", models.DefaultScoringPolicy(), oneRightTwoWrongOneSkipped, 2, 2, false},
+		{"quarter mark penalty", models.ScoringPolicy{WrongPenalty: 0.25, FloorAtZero: true}, oneRightTwoWrongOneSkipped, 1, 1, false},
+		{"credit for skipping", models.ScoringPolicy{WrongPenalty: 0.25, SkippedCredit: 0.5, FloorAtZero: true}, oneRightTwoWrongOneSkipped, 2, 2, false},
+		{"floored at zero", models.ScoringPolicy{WrongPenalty: 0.5, FloorAtZero: true}, allWrong, 0, -4, true},
+		{"negative allowed", models.ScoringPolicy{WrongPenalty: 0.5}, allWrong, -4, -4, false},
+		{"nothing answered", models.ScoringPolicy{WrongPenalty: 1, SkippedCredit: 0.25, FloorAtZero: true}, nil, 2, 2, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			answers := append([]models.StudentAnswer(nil), tc.answers...)
+			result := Score(fourQuestionTest(tc.policy), answers, nil)
+
+			if result.Score != tc.score || result.TotalPoints != 8 {
+				t.Fatalf("expected %d/8, got %d/%d (%+v)", tc.score, result.Score, result.TotalPoints, result)
+			}
+			if math.Abs(result.Raw()-tc.raw) > 1e-9 {
+				t.Fatalf("expected raw score %v, got %v", tc.raw, result.Raw())
+			}
+			if result.Floored != tc.floored {
+				t.Fatalf("expected floored=%v, got %v", tc.floored, result.Floored)
+			}
+			if got := result.Correct + result.Partial + result.Wrong + result.Skipped; got != 4 {
+				t.Fatalf("expected every question counted once, got %d", got)
+			}
+		})
+	}
+}
+
+func TestTally_PartialCreditIsNotPenalised(t *testing.T) {
+	test := &models.Test{
+		Scoring:   models.ScoringPolicy{WrongPenalty: 1, FloorAtZero: true},
+		Questions: []models.Question{{ID: 1, Points: 4}, {ID: 2, Points: 4}},
+	}
+	half, none := 0.5, 0.0
+	answers := []models.StudentAnswer{
+		{QuestionID: 1, SelectedOptionIDs: []int{1}, Credit: &half},
+		{QuestionID: 2, SelectedOptionIDs: []int{2}, Credit: &none},
+	}
+
+	result := Tally(test, answers, nil)
+	if result.Partial != 1 || result.Wrong != 1 {
+		t.Fatalf("expected 1 partial and 1 wrong, got %+v", result)
+	}
+	if result.Earned != 2 || result.Penalty != 4 {
+		t.Fatalf("expected +2 earned and -4 penalty, got %+v", result)
+	}
+	if result.Score != 0 || !result.Floored {
+		t.Fatalf("expected score floored to 0, got %+v", result)
+	}
+}
+
+func TestTally_BlankAnswerCountsAsSkipped(t *testing.T) {
+	test := &models.Test{
+		Scoring:   models.ScoringPolicy{WrongPenalty: 1, SkippedCredit: 0.5, FloorAtZero: true},
+		Questions: []models.Question{{ID: 1, QuestionType: models.QuestionTypeShortAnswer, Points: 2}},
+	}
+	blank, none := "  ", 0.0
+	answers := []models.StudentAnswer{{QuestionID: 1, TextAnswer: &blank, Credit: &none}}
+
+	result := Tally(test, answers, nil)
+	if result.Skipped != 1 || result.Wrong != 0 || result.Score != 1 {
+		t.Fatalf("expected a blank answer to be skipped and earn 1 point, got %+v", result)
+	}
+}
+
+func TestTally_HintPenalty(t *testing.T) {
+	test := fourQuestionTest(models.ScoringPolicy{WrongPenalty: 0.5})
+	answers := []models.StudentAnswer{pick(1, 11), pick(2, 21), pick(3, 32)}
+	for i := range answers {
+		Grade(&test.Questions[answers[i].QuestionID-1], &answers[i])
+	}
+	hints := []models.HintReveal{
+		{QuestionID: 1, Penalty: 0.25}, // 2 points less a quarter
+		{QuestionID: 2, Penalty: 0.75}, // two hints costing more than the
+		{QuestionID: 2, Penalty: 0.75}, // question earned take it to nothing
+		{QuestionID: 3, Penalty: 0.5},  // a wrong answer has nothing to lose
+	}
+
+	result := Tally(test, answers, hints)
+	if result.HintsUsed != 4 || result.HintPenalty != 2.5 {
+		t.Fatalf("expected 4 hints costing 2.5 points, got %d costing %v", result.HintsUsed, result.HintPenalty)
+	}
+	if result.Raw() != 4-1-2.5 || result.Score != 1 {
+		t.Fatalf("expected a raw score of 0.5 rounding to 1, got %v and %d", result.Raw(), result.Score)
+	}
+}
+
+func TestSections(t *testing.T) {
+	test := fourQuestionTest(models.ScoringPolicy{WrongPenalty: 1, FloorAtZero: true})
+	if Sections(test, nil, nil) != nil {
+		t.Fatal("expected no subtotals for a test without sections")
+	}
+
+	// Questions 1 and 2 are unassigned, so they fall in the first section
+	second := 8
+	test.Sections = []models.Section{{ID: 7, Title: "A"}, {ID: second, Title: "B"}}
+	test.Questions[2].SectionID = &second
+	test.Questions[3].SectionID = &second
+	answers := []models.StudentAnswer{pick(1, 11), pick(2, 21), pick(3, 32), pick(4, 42)}
+	for i := range answers {
+		Grade(&test.Questions[answers[i].QuestionID-1], &answers[i])
+	}
+	hints := []models.HintReveal{{QuestionID: 1, Penalty: 0.5}}
+
+	sections := Sections(test, answers, hints)
+	if len(sections) != 2 || sections[0].Section.Title != "A" || sections[1].Section.Title != "B" {
+		t.Fatalf("expected a subtotal per section in order, got %+v", sections)
+	}
+	if a := sections[0]; a.Correct != 2 || a.HintsUsed != 1 || a.Score != 3 || a.TotalPoints != 4 {
+		t.Fatalf("expected section A to score 3/4 with its hint, got %+v", a.Result)
+	}
+	// The floor applies to the test's score, not to each section
+	if b := sections[1]; b.Wrong != 2 || b.Score != -4 || b.Floored {
+		t.Fatalf("expected section B to score -4 unfloored, got %+v", b.Result)
+	}
+	if total := Tally(test, answers, hints); total.Score != 0 || !total.Floored {
+		t.Fatalf("expected the whole test floored at 0, got %+v", total)
+	}
+}
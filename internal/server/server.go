@@ -1,9 +1,11 @@
 package server
 
 import (
+	"context"
 	"html/template"
 	"log"
 	"net/http"
+	"time"
 
 	"my-app/internal/auth"
 	"my-app/internal/database"
@@ -19,8 +21,12 @@ type Server struct {
 	db           *database.Service
 	router       *chi.Mux
 	sessionStore *auth.SessionStore
+	testHandler  *handlers.TestHandler
 }
 
+// sweepInterval is how often expired test attempts and idle practice attempts are closed
+const sweepInterval = time.Minute
+
 // NewServer creates and configures a new HTTP server.
 func NewServer(db *database.Service) *Server {
 	s := &Server{
@@ -45,6 +51,7 @@ func NewServer(db *database.Service) *Server {
 	authHandler := handlers.NewAuthHandler(userRepo, s.sessionStore)
 	dashboardHandler := handlers.NewDashboardHandler(userRepo, testRepo, attemptRepo)
 	testHandler := handlers.NewTestHandler(testRepo, attemptRepo, userRepo)
+	s.testHandler = testHandler
 	adminHandler := handlers.NewAdminHandler(testRepo, userRepo)
 	teacherHandler := handlers.NewTeacherHandler(testRepo, userRepo, attemptRepo)
 
@@ -66,12 +73,15 @@ func NewServer(db *database.Service) *Server {
 		r.Get("/dashboard", dashboardHandler.ShowDashboard)
 		r.Get("/logout", authHandler.Logout)
 		r.Get("/history", testHandler.History)
+		r.Get("/history/export", testHandler.ExportHistory)
 
 		// Tests - student routes
 		r.Get("/tests", testHandler.ListTests)
 		r.Get("/test/start", testHandler.StartTest)
 		r.Get("/test/take", testHandler.TakeTest)
 		r.Post("/test/answer", testHandler.SubmitAnswer)
+		r.Post("/test/hint", testHandler.RevealHint)
+		r.Post("/test/section", testHandler.MoveSection)
 		r.Post("/test/submit", testHandler.SubmitTest)
 		r.Get("/test/results", testHandler.ViewResults)
 		r.Get("/test/review", testHandler.ReviewTest)
@@ -83,16 +93,32 @@ func NewServer(db *database.Service) *Server {
 			r.Get("/admin/wizard", adminHandler.ShowWizard)
 			r.Post("/admin/wizard", adminHandler.CreateWizardTest)
 			r.Post("/admin/upload", adminHandler.UploadTest)
+			r.Post("/admin/upload/sheet", adminHandler.UploadSheet)
 
 			// Teacher-specific routes
 			r.Get("/teacher/dashboard", teacherHandler.ShowDashboard)
 			r.Get("/teacher/upload", teacherHandler.ShowUpload)
 			r.Post("/teacher/upload", teacherHandler.UploadTest)
+			r.Post("/teacher/upload/sheet", teacherHandler.UploadSheet)
+			r.Get("/teacher/upload/template.csv", teacherHandler.DownloadSheetTemplate)
+			r.Post("/teacher/upload/qti", teacherHandler.ImportQTI)
+			r.Post("/teacher/upload/moodle/preview", teacherHandler.PreviewMoodle)
+			r.Post("/teacher/upload/moodle", teacherHandler.ImportMoodle)
+			r.Post("/teacher/upload/bundle", teacherHandler.ImportBundle)
+			r.Get("/teacher/upload/bundle/{job}", teacherHandler.ShowBundleImport)
 			r.Get("/teacher/test/create", teacherHandler.ShowCreateTest)
 			r.Post("/teacher/test/create", teacherHandler.CreateTest)
 			r.Get("/teacher/test/{id}/edit", teacherHandler.EditTest)
 			r.Post("/teacher/test/{id}/update", teacherHandler.UpdateTest)
 			r.Get("/teacher/test/{id}/preview", teacherHandler.PreviewTest)
+			r.Get("/teacher/test/{id}/responses", teacherHandler.ShowResponses)
+			r.Post("/teacher/test/{id}/accept-answer", teacherHandler.AcceptAnswer)
+			r.Post("/teacher/test/{id}/regrade", teacherHandler.RegradeTest)
+			r.Get("/teacher/test/{id}/export/json", teacherHandler.ExportJSON)
+			r.Get("/teacher/test/{id}/export/qti", teacherHandler.ExportQTI)
+			r.Get("/teacher/test/{id}/export/moodle", teacherHandler.ExportMoodle)
+			r.Get("/teacher/test/{id}/revisions", teacherHandler.ShowRevisions)
+			r.Post("/teacher/test/{id}/revisions/{revision}/restore", teacherHandler.RestoreRevision)
 			r.Post("/teacher/test/{id}/publish", teacherHandler.PublishTest)
 			r.Post("/teacher/test/{id}/unpublish", teacherHandler.UnpublishTest)
 			r.Post("/teacher/test/{id}/delete", teacherHandler.DeleteTest)
@@ -104,6 +130,7 @@ func NewServer(db *database.Service) *Server {
 				r.Get("/admin/manage", adminHandler.ShowManagement)
 				r.Post("/admin/manage/subjects", adminHandler.CreateSubject)
 				r.Delete("/admin/manage/subjects/{id}", adminHandler.DeleteSubject)
+				r.Post("/admin/manage/grades", adminHandler.UpdateGradeBoundaries)
 				r.Get("/admin/test/{id}/edit", adminHandler.EditTest)
 				r.Get("/admin/test/{id}/preview", teacherHandler.PreviewTest)
 				r.Post("/admin/test/{id}/delete", adminHandler.DeleteTest)
@@ -128,6 +155,13 @@ func NewServer(db *database.Service) *Server {
 	return s
 }
 
+// RunBackgroundJobs runs the server's background work, closing test attempts
+// whose time has run out and practice attempts left idle, until ctx is
+// cancelled.
+func (s *Server) RunBackgroundJobs(ctx context.Context) {
+	s.testHandler.RunSweeper(ctx, sweepInterval)
+}
+
 // Router returns the configured Chi router.
 func (s *Server) Router() *chi.Mux {
 	return s.router
@@ -0,0 +1,249 @@
+// Package spreadsheet imports tests written in a spreadsheet, one row per
+// question, from CSV files and XLSX workbooks. It maps the rows into a
+// models.TestUpload and records which sheet cell each value came from, so
+// problems found with the upload can point at the row and column to fix.
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MaxFileSize is the largest spreadsheet accepted for upload
+const MaxFileSize = 5 << 20
+
+// maxRows bounds the rows read from a sheet, which gives row numbers rather
+// than storing blank rows and so could otherwise claim a million of them
+const maxRows = 10000
+
+// Read reads the rows of a CSV file, or of the first worksheet of an XLSX
+// workbook, going by the file's extension
+func Read(filename string, r io.Reader) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return ReadCSV(r)
+	case ".xlsx":
+		data, err := io.ReadAll(io.LimitReader(r, MaxFileSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > MaxFileSize {
+			return nil, fmt.Errorf("the workbook is larger than %d MB", MaxFileSize>>20)
+		}
+		return ReadXLSX(data)
+	}
+	return nil, fmt.Errorf("%s is not a .csv or .xlsx file", filename)
+}
+
+// ReadCSV reads every row of a CSV file. Rows may have different numbers of
+// cells, and a byte order mark left by a spreadsheet program is dropped.
+func ReadCSV(r io.Reader) ([][]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV: %w", err)
+	}
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff")
+	}
+	return rows, nil
+}
+
+// The parts of an XLSX workbook ReadXLSX needs
+type (
+	xlsxWorkbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	xlsxRelationships struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	xlsxSharedStrings struct {
+		Items []xlsxText `xml:"si"`
+	}
+	xlsxText struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	}
+	xlsxWorksheet struct {
+		Rows []struct {
+			Number int `xml:"r,attr"`
+			Cells  []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+)
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+// ReadXLSX reads every row of the first worksheet of an XLSX workbook, as
+// the text each cell shows. Numbers are kept as Excel stores them, booleans
+// read TRUE or FALSE, and the empty rows and cells Excel leaves out are
+// filled in, so row i of the result is row i+1 of the sheet.
+func ReadXLSX(data []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("the file is not an XLSX workbook")
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared xlsxSharedStrings
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeXML(f, &shared); err != nil {
+			return nil, fmt.Errorf("reading shared strings: %w", err)
+		}
+	}
+
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("the workbook has no %s", sheetPath)
+	}
+	var sheet xlsxWorksheet
+	if err := decodeXML(f, &sheet); err != nil {
+		return nil, fmt.Errorf("reading the worksheet: %w", err)
+	}
+
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		number := row.Number
+		if number <= len(rows) {
+			number = len(rows) + 1
+		}
+		if number > maxRows {
+			return nil, fmt.Errorf("the worksheet has more than %d rows", maxRows)
+		}
+		for len(rows) < number {
+			rows = append(rows, nil)
+		}
+
+		var cells []string
+		for _, c := range row.Cells {
+			col := len(cells)
+			if c.Ref != "" {
+				if parsed, ok := columnOfRef(c.Ref); ok && parsed >= col {
+					col = parsed
+				}
+			}
+			for len(cells) < col {
+				cells = append(cells, "")
+			}
+
+			value := c.Value
+			switch c.Type {
+			case "s":
+				i, err := strconv.Atoi(c.Value)
+				if err != nil || i < 0 || i >= len(shared.Items) {
+					return nil, fmt.Errorf("cell %s refers to a missing shared string", c.Ref)
+				}
+				value = shared.Items[i].String()
+			case "inlineStr":
+				value = c.Inline.String()
+			case "b":
+				value = map[string]string{"1": "TRUE", "0": "FALSE"}[c.Value]
+			}
+			cells = append(cells, value)
+		}
+		rows[number-1] = cells
+	}
+	return rows, nil
+}
+
+// firstSheetPath finds the part holding the workbook's first worksheet
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	workbookFile, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", errors.New("the file is not an XLSX workbook")
+	}
+	var workbook xlsxWorkbook
+	if err := decodeXML(workbookFile, &workbook); err != nil {
+		return "", fmt.Errorf("reading the workbook: %w", err)
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", errors.New("the workbook has no worksheets")
+	}
+
+	var rels xlsxRelationships
+	if f, ok := files["xl/_rels/workbook.xml.rels"]; ok {
+		if err := decodeXML(f, &rels); err != nil {
+			return "", fmt.Errorf("reading the workbook: %w", err)
+		}
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].ID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return "xl/worksheets/sheet1.xml", nil
+}
+
+func decodeXML(f *zip.File, v any) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(io.LimitReader(rc, 8*MaxFileSize)).Decode(v)
+}
+
+// columnOfRef returns the 0-based column of a cell reference such as "C12"
+func columnOfRef(ref string) (int, bool) {
+	col := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z' && col <= 16384; i++ {
+		col = col*26 + int(ref[i]-'A'+1)
+	}
+	if i == 0 || col > 16384 {
+		return 0, false
+	}
+	return col - 1, true
+}
+
+// ColumnName returns the letters naming a 0-based column, e.g. "C" for 2
+func ColumnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
@@ -0,0 +1,86 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadCSV(t *testing.T) {
+	rows, err := Read("questions.CSV", strings.NewReader("\ufefftitle,Algebra\n\nQuestion,Option A\n\"What is 2 + 2, roughly?\",4\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"title", "Algebra"}, {"Question", "Option A"}, {"What is 2 + 2, roughly?", "4"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("expected %q, got %q", want, rows)
+	}
+}
+
+// workbook builds an XLSX file holding the given worksheet XML
+func workbook(t *testing.T, sheet string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+			<sheets><sheet name="Questions" sheetId="1" r:id="rId3"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId1" Target="styles.xml"/><Relationship Id="rId3" Target="worksheets/questions.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+			<si><t>Question</t></si><si><r><t>What is </t></r><r><t>2 + 2?</t></r></si></sst>`,
+		"xl/worksheets/questions.xml": sheet,
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadXLSX(t *testing.T) {
+	data := workbook(t, `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+		<row r="2"><c r="A2" t="s"><v>0</v></c><c r="C2" t="inlineStr"><is><t>Points</t></is></c></row>
+		<row r="3"><c r="A3" t="s"><v>1</v></c><c r="B3"><v>4</v></c><c r="C3"><v>1.5</v></c><c r="D3" t="b"><v>1</v></c></row>
+	</sheetData></worksheet>`)
+
+	rows, err := ReadXLSX(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{nil, {"Question", "", "Points"}, {"What is 2 + 2?", "4", "1.5", "TRUE"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("expected %q, got %q", want, rows)
+	}
+}
+
+func TestReadRejects(t *testing.T) {
+	if _, err := Read("questions.ods", strings.NewReader("")); err == nil {
+		t.Error("expected an unsupported file type rejected")
+	}
+	if _, err := Read("questions.xlsx", strings.NewReader("not a zip")); err == nil {
+		t.Error("expected a file that is not a workbook rejected")
+	}
+	data := workbook(t, `<worksheet><sheetData><row r="1"><c t="s"><v>7</v></c></row></sheetData></worksheet>`)
+	if _, err := ReadXLSX(data); err == nil {
+		t.Error("expected a missing shared string rejected")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for col, want := range map[int]string{0: "A", 3: "D", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := ColumnName(col); got != want {
+			t.Errorf("column %d: expected %s, got %s", col, want, got)
+		}
+		if got, ok := columnOfRef(want + "12"); !ok || got != col {
+			t.Errorf("%s12: expected column %d, got %d", want, col, got)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package spreadsheet
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"my-app/internal/models"
+)
+
+// Columns of the question table; each row below its header is one question
+const (
+	ColumnQuestion = "question"
+	ColumnOptionA  = "option_a"
+	ColumnOptionB  = "option_b"
+	ColumnOptionC  = "option_c"
+	ColumnOptionD  = "option_d"
+	ColumnCorrect  = "correct"
+	ColumnPoints   = "points"
+	ColumnImage    = "image"
+)
+
+// optionColumns are the option columns in letter order
+var optionColumns = []string{ColumnOptionA, ColumnOptionB, ColumnOptionC, ColumnOptionD}
+
+// columnAliases are other headings teachers give the question table's columns
+var columnAliases = map[string]string{
+	"question_text":  ColumnQuestion,
+	"a":              ColumnOptionA,
+	"b":              ColumnOptionB,
+	"c":              ColumnOptionC,
+	"d":              ColumnOptionD,
+	"correct_answer": ColumnCorrect,
+	"answer":         ColumnCorrect,
+	"image_url":      ColumnImage,
+}
+
+// metadataFields are the test details a header block above the question
+// table can set, one per row: the field's name, then its value
+var metadataFields = []string{
+	"title", "description", "subject", "topic", "exam_standard", "difficulty",
+	"time_limit_minutes", "passing_score",
+}
+
+// Cell is a cell of the sheet: a 1-based row and a 0-based column
+type Cell struct {
+	Row    int
+	Column int
+}
+
+// Layout records where an imported test's values were in the sheet
+type Layout struct {
+	Metadata map[string]Cell // test field to the cell holding its value
+	Headers  map[string]int  // question table column to its position
+	Headings []string        // the question table's header row as written
+	Rows     []int           // the sheet row of each question
+}
+
+// Locate describes where the value behind a validation error key sits in the
+// sheet: a test field such as "title", or a question's field such as
+// "question_3_points". It returns false for keys the sheet did not supply.
+func (l *Layout) Locate(key string) (string, bool) {
+	if cell, ok := l.Metadata[key]; ok {
+		return fmt.Sprintf("Row %d, column %s (%s)", cell.Row, ColumnName(cell.Column), key), true
+	}
+
+	m := questionKey.FindStringSubmatch(key)
+	if m == nil {
+		return "", false
+	}
+	n, _ := strconv.Atoi(m[1])
+	if n < 1 || n > len(l.Rows) {
+		return "", false
+	}
+	row := l.Rows[n-1]
+
+	column := ""
+	switch field := m[2]; {
+	case field == "question_text":
+		column = ColumnQuestion
+	case field == "points":
+		column = ColumnPoints
+	case field == "image_url":
+		column = ColumnImage
+	case strings.HasPrefix(field, "correct"):
+		column = ColumnCorrect
+	case strings.HasPrefix(field, "option"), field == "rationales":
+		column = ColumnOptionA
+	}
+	if col, ok := l.Headers[column]; ok {
+		return fmt.Sprintf("Row %d, column %s (%s)", row, ColumnName(col), l.Headings[col]), true
+	}
+	return fmt.Sprintf("Row %d", row), true
+}
+
+// questionKey matches the keys validation gives a question's errors
+var questionKey = regexp.MustCompile(`^question_(\d+)_(.+)$`)
+
+// ParseTest maps the rows of a sheet into a test upload. A header block of
+// test details may come first, then a header row naming the question table's
+// columns: Question, Option A to Option D, Correct, and the optional Points
+// and Image. Details the header block leaves blank are taken from defaults,
+// which carries the details given alongside the upload.
+//
+// Problems reading the sheet are returned keyed by the cell they concern;
+// the upload still needs validating, and Layout.Locate places the problems
+// validation finds. Without a usable header row there is no question table
+// to read and the Layout is nil.
+func ParseTest(rows [][]string, defaults models.TestUpload) (models.TestUpload, *Layout, map[string]string) {
+	upload := defaults
+	upload.Questions = nil
+	layout := &Layout{Metadata: make(map[string]Cell), Headers: make(map[string]int)}
+	problems := make(map[string]string)
+	problem := func(cell Cell, heading, format string, args ...any) {
+		problems[fmt.Sprintf("Row %d, column %s (%s)", cell.Row, ColumnName(cell.Column), heading)] = fmt.Sprintf(format, args...)
+	}
+
+	// The header block, up to the question table's header row
+	header := -1
+	for i, row := range rows {
+		if isHeaderRow(row) {
+			header = i
+			break
+		}
+		name := normalizeHeading(cellAt(row, 0))
+		if name == "" {
+			continue
+		}
+		valueCell := Cell{Row: i + 1, Column: 1}
+		if !isMetadataField(name) {
+			problem(Cell{Row: i + 1}, cellAt(row, 0), "Unknown test detail; expected one of %s, or a Question header row", strings.Join(metadataFields, ", "))
+			continue
+		}
+		value := strings.TrimSpace(cellAt(row, 1))
+		if value == "" {
+			continue
+		}
+		layout.Metadata[name] = valueCell
+		if err := setMetadata(&upload, name, value); err != nil {
+			problem(valueCell, name, "%s", err.Error())
+		}
+	}
+	if header < 0 {
+		problems["sheet"] = "No header row naming the question columns was found; it needs at least Question, Option A, Option B and Correct"
+		return upload, nil, problems
+	}
+
+	// The question table's columns
+	layout.Headings = make([]string, len(rows[header]))
+	for col, heading := range rows[header] {
+		layout.Headings[col] = strings.TrimSpace(heading)
+		name := columnName(heading)
+		if name == "" {
+			continue
+		}
+		if !isQuestionColumn(name) {
+			problem(Cell{Row: header + 1, Column: col}, layout.Headings[col], "Unknown column; expected Question, Option A to Option D, Correct, Points or Image")
+			continue
+		}
+		if _, dup := layout.Headers[name]; dup {
+			problem(Cell{Row: header + 1, Column: col}, layout.Headings[col], "Column is given more than once")
+			continue
+		}
+		layout.Headers[name] = col
+	}
+	for _, required := range []string{ColumnQuestion, ColumnOptionA, ColumnOptionB, ColumnCorrect} {
+		if _, ok := layout.Headers[required]; !ok {
+			problems[fmt.Sprintf("Row %d", header+1)] = "The header row needs Question, Option A, Option B and Correct columns"
+			return upload, nil, problems
+		}
+	}
+
+	// One question per row below it
+	for i := header + 1; i < len(rows); i++ {
+		row := rows[i]
+		if isBlankRow(row) {
+			continue
+		}
+		field := func(column string) (string, Cell) {
+			col, ok := layout.Headers[column]
+			if !ok {
+				return "", Cell{Row: i + 1}
+			}
+			return strings.TrimSpace(cellAt(row, col)), Cell{Row: i + 1, Column: col}
+		}
+		heading := func(cell Cell) string { return layout.Headings[cell.Column] }
+
+		q := models.QuestionUpload{Points: 1}
+		q.QuestionText, _ = field(ColumnQuestion)
+		q.ImageURL, _ = field(ColumnImage)
+
+		// Options run from A, without gaps
+		var gap *Cell
+		gapped := false
+		for _, column := range optionColumns {
+			text, cell := field(column)
+			if text == "" {
+				if gap == nil {
+					gap = &cell
+				}
+				continue
+			}
+			if gap != nil {
+				problem(*gap, heading(*gap), "Options must be filled in from Option A without gaps")
+				gapped = true
+				break
+			}
+			q.Options = append(q.Options, text)
+		}
+
+		if value, cell := field(ColumnPoints); value != "" {
+			points, err := strconv.ParseFloat(value, 64)
+			if err != nil || points != float64(int(points)) {
+				problem(cell, heading(cell), "Points must be a whole number, not %q", value)
+			} else {
+				q.Points = int(points)
+			}
+		}
+
+		// Letters past a gap would point at the wrong options
+		value, cell := field(ColumnCorrect)
+		letters, err := correctLetters(value, len(q.Options))
+		if err != nil && !gapped {
+			problem(cell, heading(cell), "%s", err.Error())
+		}
+		switch len(letters) {
+		case 0:
+		case 1:
+			q.CorrectIndex = letters[0]
+		default:
+			q.QuestionType = models.QuestionTypeMultipleSelect
+			q.CorrectIndices = letters
+		}
+
+		upload.Questions = append(upload.Questions, q)
+		layout.Rows = append(layout.Rows, i+1)
+	}
+	return upload, layout, problems
+}
+
+// correctLetters reads the correct option letters, e.g. "B", or "A, C" when
+// more than one option is correct, as option indices
+func correctLetters(value string, options int) ([]int, error) {
+	if value == "" {
+		return nil, fmt.Errorf("Give the letter of the correct option")
+	}
+	var indices []int
+	for _, part := range strings.FieldsFunc(strings.ToUpper(value), func(r rune) bool {
+		return r == ',' || r == ';' || r == ' '
+	}) {
+		if len(part) != 1 || part[0] < 'A' || int(part[0]-'A') >= options {
+			return nil, fmt.Errorf("%q is not the letter of a filled-in option (A to %s)", part, ColumnName(max(options-1, 0)))
+		}
+		indices = append(indices, int(part[0]-'A'))
+	}
+	return indices, nil
+}
+
+// setMetadata sets a test detail from the header block
+func setMetadata(upload *models.TestUpload, name, value string) error {
+	number := func() (int, error) {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("%s must be a whole number, not %q", name, value)
+		}
+		return n, nil
+	}
+
+	var err error
+	switch name {
+	case "title":
+		upload.Title = value
+	case "description":
+		upload.Description = value
+	case "subject":
+		upload.Subject = value
+	case "topic":
+		upload.Topic = value
+	case "exam_standard":
+		upload.ExamStandard = value
+	case "difficulty":
+		upload.Difficulty = value
+	case "time_limit_minutes":
+		upload.TimeLimitMinutes, err = number()
+	case "passing_score":
+		upload.PassingScore, err = number()
+	}
+	return err
+}
+
+// Template is a sheet to start from: a header block, the question table's
+// header row and two example questions
+func Template() [][]string {
+	return [][]string{
+		{"title", "Mathematics - Algebra Basics"},
+		{"description", "Test covering basic algebra concepts"},
+		{"subject", "Mathematics"},
+		{"topic", "Algebra"},
+		{"exam_standard", "GCSE"},
+		{"difficulty", "Easy"},
+		{"time_limit_minutes", "30"},
+		{"passing_score", "60"},
+		{},
+		{"Question", "Option A", "Option B", "Option C", "Option D", "Correct", "Points", "Image"},
+		{"What is 2 + 2?", "3", "4", "5", "6", "B", "1", ""},
+		{"Which of these are prime?", "2", "4", "7", "9", "A, C", "2", ""},
+	}
+}
+
+func isHeaderRow(row []string) bool {
+	for _, heading := range row {
+		if columnName(heading) == ColumnQuestion {
+			return true
+		}
+	}
+	return false
+}
+
+func isMetadataField(name string) bool {
+	for _, field := range metadataFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isQuestionColumn(name string) bool {
+	switch name {
+	case ColumnQuestion, ColumnOptionA, ColumnOptionB, ColumnOptionC, ColumnOptionD, ColumnCorrect, ColumnPoints, ColumnImage:
+		return true
+	}
+	return false
+}
+
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// columnName reads a question table heading, e.g. "Option A" or "Correct answer"
+func columnName(heading string) string {
+	name := normalizeHeading(heading)
+	if alias, ok := columnAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// normalizeHeading lowercases a heading and joins its words with underscores
+func normalizeHeading(heading string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(heading), func(r rune) bool {
+		return r == ' ' || r == '_' || r == '-'
+	}), "_")
+}
+
+func cellAt(row []string, col int) string {
+	if col < len(row) {
+		return row[col]
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package spreadsheet
+
+import (
+	"reflect"
+	"testing"
+
+	"my-app/internal/models"
+)
+
+func TestParseTest(t *testing.T) {
+	rows := [][]string{
+		{"Title", "Fractions"},
+		{"time limit minutes", "25"},
+		{"subject", ""},
+		{},
+		{"Question", "Option A", "Option B", "Option C", "Option D", "Correct answer", "Points", "Image"},
+		{"Half of 10?", "2", "5", "", "", "b", "", ""},
+		{"", "", "", "", "", "", "", ""},
+		{"Which are even?", "2", "3", "4", "5", "A, C", "2", "/static/uploads/even.png"},
+	}
+
+	upload, layout, problems := ParseTest(rows, models.TestUpload{Title: "Ignored", Subject: "Maths", PassingScore: 60})
+	if len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+
+	// The header block wins over the defaults, which fill in what it leaves blank
+	if upload.Title != "Fractions" || upload.TimeLimitMinutes != 25 || upload.Subject != "Maths" || upload.PassingScore != 60 {
+		t.Errorf("unexpected test details: %+v", upload)
+	}
+
+	want := []models.QuestionUpload{
+		{QuestionText: "Half of 10?", Options: []string{"2", "5"}, CorrectIndex: 1, Points: 1},
+		{QuestionText: "Which are even?", Options: []string{"2", "3", "4", "5"}, QuestionType: models.QuestionTypeMultipleSelect,
+			CorrectIndices: []int{0, 2}, Points: 2, ImageURL: "/static/uploads/even.png"},
+	}
+	if !reflect.DeepEqual(upload.Questions, want) {
+		t.Fatalf("expected questions %+v, got %+v", want, upload.Questions)
+	}
+	if !reflect.DeepEqual(layout.Rows, []int{6, 8}) {
+		t.Errorf("expected the questions on rows 6 and 8, got %v", layout.Rows)
+	}
+
+	for key, want := range map[string]string{
+		"title":                    "Row 1, column B (title)",
+		"question_2_points":        "Row 8, column G (Points)",
+		"question_1_options":       "Row 6, column B (Option A)",
+		"question_2_correct_index": "Row 8, column F (Correct answer)",
+		"question_1_explanation":   "Row 6",
+	} {
+		if got, ok := layout.Locate(key); !ok || got != want {
+			t.Errorf("%s: expected %q, got %q", key, want, got)
+		}
+	}
+	for _, key := range []string{"subject", "question_3_points", "questions"} {
+		if got, ok := layout.Locate(key); ok {
+			t.Errorf("%s: expected no place in the sheet, got %q", key, got)
+		}
+	}
+}
+
+func TestParseTestProblems(t *testing.T) {
+	rows := [][]string{
+		{"title", "Fractions"},
+		{"passing_score", "sixty"},
+		{"colour", "blue"},
+		{"Question", "A", "B", "C", "Correct", "Points", "Notes"},
+		{"Half of 10?", "2", "", "5", "B", "1.5"},
+		{"Double 3?", "6", "9", "", "C", "1"},
+	}
+
+	_, layout, problems := ParseTest(rows, models.TestUpload{})
+	if layout == nil {
+		t.Fatal("expected the question table read despite the problems")
+	}
+	want := map[string]string{
+		"Row 2, column B (passing_score)": `passing_score must be a whole number, not "sixty"`,
+		"Row 3, column A (colour)":        "Unknown test detail; expected one of title, description, subject, topic, exam_standard, difficulty, time_limit_minutes, passing_score, or a Question header row",
+		"Row 4, column G (Notes)":         "Unknown column; expected Question, Option A to Option D, Correct, Points or Image",
+		"Row 5, column C (B)":             "Options must be filled in from Option A without gaps",
+		"Row 5, column F (Points)":        `Points must be a whole number, not "1.5"`,
+		"Row 6, column E (Correct)":       `"C" is not the letter of a filled-in option (A to B)`,
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Fatalf("expected problems %v, got %v", want, problems)
+	}
+}
+
+func TestParseTestWithoutHeaderRow(t *testing.T) {
+	for _, rows := range [][][]string{
+		{{"title", "Fractions"}},
+		{{"Question", "Option A", "Correct"}, {"Half of 10?", "5", "A"}},
+	} {
+		if _, layout, problems := ParseTest(rows, models.TestUpload{}); layout != nil || len(problems) != 1 {
+			t.Errorf("%q: expected the sheet rejected, got %v", rows, problems)
+		}
+	}
+}
+
+func TestTemplateParses(t *testing.T) {
+	upload, _, problems := ParseTest(Template(), models.TestUpload{})
+	if len(problems) != 0 || len(upload.Questions) != 2 || upload.Title == "" {
+		t.Fatalf("expected the template to read cleanly, got %v", problems)
+	}
+}
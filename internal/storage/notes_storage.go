@@ -66,6 +66,11 @@ func DeleteNotesFile(filename string) error {
 	return nil
 }
 
+// IsNotesFilename reports whether a file of that name may be stored as notes
+func IsNotesFilename(filename string) bool {
+	return isValidNotesFileType(strings.ToLower(filepath.Ext(filename)))
+}
+
 // isValidNotesFileType checks if the file extension is PDF or PowerPoint
 func isValidNotesFileType(ext string) bool {
 	validExtensions := map[string]bool{
@@ -2,6 +2,10 @@ package validation
 
 import (
 	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
 
 	"my-app/internal/models"
 )
@@ -58,6 +62,44 @@ func (v *TestValidator) ValidateTest(test *models.Test) bool {
 		v.addError("passing_score", "Passing score must be between 0 and 100")
 	}
 
+	if test.Scoring.WrongPenalty < 0 || test.Scoring.WrongPenalty > 1 {
+		v.addError("wrong_penalty", "Wrong answer penalty must be between 0 and 1 of a question's points")
+	}
+
+	if test.Scoring.SkippedCredit < 0 || test.Scoring.SkippedCredit > 1 {
+		v.addError("skipped_credit", "Skipped question credit must be between 0 and 1 of a question's points")
+	}
+
+	if test.Scoring.HintPenalty < 0 || test.Scoring.HintPenalty > 1 {
+		v.addError("hint_penalty", "Hint penalty must be between 0 and 1 of a question's points")
+	}
+
+	if test.Attempts.MaxAttempts < 0 {
+		v.addError("max_attempts", "Maximum attempts cannot be negative")
+	}
+
+	if test.Attempts.CooldownMinutes < 0 {
+		v.addError("cooldown_minutes", "Cooldown between attempts cannot be negative")
+	}
+
+	if test.Attempts.Counts != "" && !isValidCountedAttempt(test.Attempts.Counts) {
+		v.addError("counted_attempt", "Invalid counted attempt. Must be best, latest or average")
+	}
+
+	if test.Timezone != "" {
+		if _, err := time.LoadLocation(test.Timezone); err != nil || test.Timezone == "Local" {
+			v.addError("timezone", fmt.Sprintf("Unknown timezone %q. Use a name like Europe/London", test.Timezone))
+		}
+	}
+
+	if test.AvailableFrom != nil && test.AvailableUntil != nil && !test.AvailableUntil.After(*test.AvailableFrom) {
+		v.addError("available_until", "The test must close after it opens")
+	}
+
+	if test.LateSubmission != "" && !isValidLateSubmission(test.LateSubmission) {
+		v.addError("late_submission", "Invalid late submission policy. Must be finish or cut_off")
+	}
+
 	return len(v.errors) == 0
 }
 
@@ -76,25 +118,82 @@ func (v *TestValidator) ValidateQuestion(question *models.Question) bool {
 		v.addError("points", "Points must be greater than 0")
 	}
 
-	if len(question.Options) != 4 {
-		v.addError("options", "A question must have exactly 4 answer options")
+	if len(question.Explanation) > 5000 {
+		v.addError("explanation", "Explanation must not exceed 5000 characters")
+	}
+
+	if question.ExplanationImageURL != nil && len(*question.ExplanationImageURL) > 500 {
+		v.addError("explanation_image_url", "Explanation image URL must not exceed 500 characters")
+	}
+
+	for i, hint := range question.Hints {
+		switch {
+		case strings.TrimSpace(hint.HintText) == "":
+			v.addError("hints", fmt.Sprintf("Hint %d text is required", i+1))
+		case len(hint.HintText) > 1000:
+			v.addError("hints", fmt.Sprintf("Hint %d must not exceed 1000 characters", i+1))
+		}
+		if hint.Penalty != nil && (*hint.Penalty < 0 || *hint.Penalty > 1) {
+			v.addError("hints", fmt.Sprintf("Hint %d penalty must be between 0 and 1 of the question's points", i+1))
+		}
+	}
+
+	questionType := question.QuestionType
+	if questionType == "" {
+		questionType = models.QuestionTypeSingleChoice
+	}
+	if !isValidQuestionType(questionType) {
+		v.addError("question_type", "Invalid question type. Must be single_choice, multiple_select, true_false, numeric, short_answer, ordering, or matching")
+	}
+
+	if question.ScoringRule != "" && !isValidScoringRule(question.ScoringRule) {
+		v.addError("scoring_rule", "Invalid scoring rule. Must be all_or_nothing or partial")
+	}
+
+	if questionType == models.QuestionTypeNumeric {
+		v.validateNumericAnswer(question)
+	} else if questionType == models.QuestionTypeShortAnswer {
+		v.validateAcceptedAnswers(question)
+	} else if questionType == models.QuestionTypeTrueFalse && len(question.Options) != 2 {
+		v.addError("options", "A true/false question must have exactly 2 answer options")
+	} else if len(question.Options) < models.MinOptions || len(question.Options) > models.MaxOptions {
+		v.addError("options", fmt.Sprintf("A question must have between %d and %d answer options", models.MinOptions, models.MaxOptions))
 	} else {
-		// Validate options and ensure one is marked as correct
-		hasCorrect := false
+		// Validate options and count how many are marked as correct
+		correctCount := 0
+		seen := make(map[string]bool)
 		for i, opt := range question.Options {
 			if opt.OptionText == "" {
 				v.addError("options", fmt.Sprintf("Option %d text is required", i+1))
 			}
 			if opt.IsCorrect {
-				if hasCorrect {
-					v.addError("options", "Only one option can be marked as correct")
-					break
+				correctCount++
+			}
+			if len(opt.Rationale) > 1000 {
+				v.addError("options", fmt.Sprintf("Option %d rationale must not exceed 1000 characters", i+1))
+			}
+			if questionType == models.QuestionTypeMatching && strings.TrimSpace(opt.MatchText) == "" {
+				v.addError("options", fmt.Sprintf("Option %d needs a match", i+1))
+			}
+			if questionType == models.QuestionTypeOrdering || questionType == models.QuestionTypeMatching {
+				if seen[opt.OptionText] {
+					v.addError("options", fmt.Sprintf("Option %d repeats %q; every item must be different", i+1, opt.OptionText))
 				}
-				hasCorrect = true
+				seen[opt.OptionText] = true
 			}
 		}
-		if !hasCorrect {
+
+		switch {
+		case questionType == models.QuestionTypeOrdering || questionType == models.QuestionTypeMatching:
+			// Graded by position or pairing, so no option is marked correct
+		case questionType == models.QuestionTypeMultipleSelect && correctCount == 0:
+			v.addError("options", "At least one option must be marked as correct")
+		case questionType == models.QuestionTypeMultipleSelect:
+			// Any number of correct options is allowed
+		case correctCount == 0:
 			v.addError("options", "One option must be marked as correct")
+		case correctCount > 1:
+			v.addError("options", "Only one option can be marked as correct")
 		}
 	}
 
@@ -108,6 +207,232 @@ func (v *TestValidator) ValidateQuestion(question *models.Question) bool {
 	return isValid
 }
 
+// validateNumericAnswer checks the answer key of a numeric question
+func (v *TestValidator) validateNumericAnswer(question *models.Question) {
+	if len(question.Options) > 0 {
+		v.addError("options", "A numeric question must not have answer options")
+	}
+
+	n := question.Numeric
+	if n == nil {
+		v.addError("numeric", "A numeric question must have an expected answer")
+		return
+	}
+	if math.IsNaN(n.Expected) || math.IsInf(n.Expected, 0) {
+		v.addError("numeric_expected", "Expected answer must be a finite number")
+	}
+	if n.Tolerance < 0 {
+		v.addError("numeric_tolerance", "Tolerance must not be negative")
+	}
+	if n.ToleranceType != "" && n.ToleranceType != models.ToleranceAbsolute && n.ToleranceType != models.TolerancePercent {
+		v.addError("numeric_tolerance_type", "Invalid tolerance type. Must be absolute or percent")
+	}
+	if n.SigFigs != nil && (*n.SigFigs < 1 || *n.SigFigs > models.MaxSigFigs) {
+		v.addError("numeric_sig_figs", fmt.Sprintf("Significant figures must be between 1 and %d", models.MaxSigFigs))
+	}
+	for _, unit := range n.Units {
+		if strings.TrimSpace(unit) == "" {
+			v.addError("numeric_units", "Units must not be blank")
+			break
+		}
+	}
+}
+
+// validateAcceptedAnswers checks the answer key of a short-answer question
+func (v *TestValidator) validateAcceptedAnswers(question *models.Question) {
+	if len(question.Options) > 0 {
+		v.addError("options", "A short-answer question must not have answer options")
+	}
+	if len(question.AcceptedAnswers) == 0 {
+		v.addError("accepted_answers", "A short-answer question must have at least one accepted answer")
+	}
+	for i, a := range question.AcceptedAnswers {
+		if strings.TrimSpace(a.AnswerText) == "" {
+			v.addError("accepted_answers", fmt.Sprintf("Accepted answer %d must not be blank", i+1))
+			continue
+		}
+		if a.IsRegex {
+			if _, err := regexp.Compile(a.AnswerText); err != nil {
+				v.addError("accepted_patterns", fmt.Sprintf("Pattern %q is not a valid regular expression", a.AnswerText))
+			}
+		}
+	}
+	if question.TypoTolerance < 0 || question.TypoTolerance > models.MaxTypoTolerance {
+		v.addError("typo_tolerance", fmt.Sprintf("Typo tolerance must be between 0 and %d", models.MaxTypoTolerance))
+	}
+}
+
+// ValidatePools validates a test's question pools against the questions in
+// them. Errors are keyed by the pool's position, e.g. pool_1_draw.
+func (v *TestValidator) ValidatePools(test *models.Test) bool {
+	v.errors = []ValidationError{} // Reset errors
+
+	seen := make(map[string]bool)
+	for i, pool := range test.Pools {
+		field := fmt.Sprintf("pool_%d", i+1)
+		name := strings.TrimSpace(pool.Name)
+		switch {
+		case name == "":
+			v.addError(field+"_name", "Pool name is required")
+		case len(name) > 100:
+			v.addError(field+"_name", "Pool name must not exceed 100 characters")
+		case seen[name]:
+			v.addError(field+"_name", fmt.Sprintf("Pool name %q is used more than once", name))
+		}
+		seen[name] = true
+
+		size := test.PoolSize(pool.ID)
+		switch {
+		case pool.DrawCount < 1:
+			v.addError(field+"_draw", "Each attempt must draw at least 1 question from a pool")
+		case pool.DrawCount > size:
+			v.addError(field+"_draw", fmt.Sprintf("Pool %q draws %d questions but only has %d", name, pool.DrawCount, size))
+		}
+	}
+
+	return len(v.errors) == 0
+}
+
+// ValidateSections validates a test's sections. Titles name a section in
+// uploads, so each must be used once, and no section may be given longer
+// than the whole test. Errors are keyed by the section's position, e.g.
+// section_1_time.
+func (v *TestValidator) ValidateSections(test *models.Test) bool {
+	v.errors = []ValidationError{} // Reset errors
+
+	seen := make(map[string]bool)
+	for i, s := range test.Sections {
+		field := fmt.Sprintf("section_%d", i+1)
+		title := strings.TrimSpace(s.Title)
+		switch {
+		case title == "":
+			v.addError(field+"_title", "Section title is required")
+		case len(title) > 255:
+			v.addError(field+"_title", "Section title must not exceed 255 characters")
+		case seen[title]:
+			v.addError(field+"_title", fmt.Sprintf("Section title %q is used more than once", title))
+		}
+		seen[title] = true
+
+		switch {
+		case s.TimeLimitMinutes < 0:
+			v.addError(field+"_time", "Section time limit cannot be negative")
+		case test.TimeLimitMinutes > 0 && s.TimeLimitMinutes > test.TimeLimitMinutes:
+			v.addError(field+"_time", fmt.Sprintf("Section %q is given %d minutes but the whole test only has %d",
+				title, s.TimeLimitMinutes, test.TimeLimitMinutes))
+		}
+	}
+
+	return len(v.errors) == 0
+}
+
+// ValidatePrerequisites validates a test's prerequisites against the other
+// tests in the catalogue. A test may not require itself, even through a chain
+// of other tests, as no student could then unlock it. Errors are keyed by the
+// prerequisite's position, e.g. prerequisite_1.
+func (v *TestValidator) ValidatePrerequisites(test *models.Test, catalogue []models.Test) bool {
+	v.errors = []ValidationError{} // Reset errors
+
+	requires := make(map[int][]int) // testID -> tests it requires
+	exists := make(map[int]bool, len(catalogue))
+	for _, t := range catalogue {
+		exists[t.ID] = true
+		if t.ID == test.ID {
+			continue
+		}
+		for _, p := range t.Prerequisites {
+			if p.RequiredTestID != nil {
+				requires[t.ID] = append(requires[t.ID], *p.RequiredTestID)
+			}
+		}
+	}
+	for _, p := range test.Prerequisites {
+		if p.RequiredTestID != nil {
+			requires[test.ID] = append(requires[test.ID], *p.RequiredTestID)
+		}
+	}
+
+	for i, p := range test.Prerequisites {
+		field := fmt.Sprintf("prerequisite_%d", i+1)
+		switch p.Kind {
+		case models.PrerequisitePassed, models.PrerequisiteMinScore:
+			switch {
+			case p.RequiredTestID == nil || !exists[*p.RequiredTestID]:
+				v.addError(field, "Choose the test this prerequisite requires")
+			case *p.RequiredTestID == test.ID:
+				v.addError(field, "A test cannot be its own prerequisite")
+			case leadsTo(requires, *p.RequiredTestID, test.ID):
+				v.addError(field, "That test already requires this one, so neither could be unlocked")
+			}
+			if p.Kind == models.PrerequisiteMinScore && (p.MinPercent < 1 || p.MinPercent > 100) {
+				v.addError(field+"_percent", "The score to reach must be between 1 and 100%")
+			}
+		case models.PrerequisiteTopicCount:
+			if p.TopicID == nil {
+				v.addError(field, "Choose the topic this prerequisite requires")
+			}
+			if p.MinCount < 1 {
+				v.addError(field+"_count", "At least 1 test in the topic must be required")
+			}
+		default:
+			v.addError(field, "Invalid prerequisite. Must be passed, min_score or topic_count")
+		}
+	}
+
+	return len(v.errors) == 0
+}
+
+// leadsTo reports whether following requirements from one test reaches another
+func leadsTo(requires map[int][]int, from, to int) bool {
+	seen := make(map[int]bool)
+	stack := []int{from}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == to {
+			return true
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		stack = append(stack, requires[id]...)
+	}
+	return false
+}
+
+// ValidateGradeBoundaries validates a set of grade boundaries. Each grade
+// must be named once and reached at its own percentage. Errors are keyed by
+// the boundary's position, e.g. grade_boundary_1.
+func (v *TestValidator) ValidateGradeBoundaries(boundaries models.GradeBoundaries) bool {
+	v.errors = []ValidationError{} // Reset errors
+
+	grades := make(map[string]bool)
+	percents := make(map[float64]bool)
+	for i, b := range boundaries {
+		field := fmt.Sprintf("grade_boundary_%d", i+1)
+		switch {
+		case strings.TrimSpace(b.Grade) == "":
+			v.addError(field, "Grade is required")
+		case len(b.Grade) > models.MaxGradeLength:
+			v.addError(field, fmt.Sprintf("Grade must be at most %d characters", models.MaxGradeLength))
+		case grades[b.Grade]:
+			v.addError(field, fmt.Sprintf("Grade %s is listed more than once", b.Grade))
+		}
+		grades[b.Grade] = true
+
+		switch {
+		case math.IsNaN(b.MinPercent) || b.MinPercent < 0 || b.MinPercent > 100:
+			v.addError(field+"_percent", "Boundary must be between 0 and 100%")
+		case percents[b.MinPercent]:
+			v.addError(field+"_percent", "Two grades cannot share a boundary")
+		}
+		percents[b.MinPercent] = true
+	}
+
+	return len(v.errors) == 0
+}
+
 // ValidateAnswerOption validates answer option data
 func (v *TestValidator) ValidateAnswerOption(option *models.AnswerOption) bool {
 	v.errors = []ValidationError{} // Reset errors
@@ -118,8 +443,8 @@ func (v *TestValidator) ValidateAnswerOption(option *models.AnswerOption) bool {
 		v.addError("option_text", "Option text must not exceed 1000 characters")
 	}
 
-	if option.OptionOrder < 1 || option.OptionOrder > 4 {
-		v.addError("option_order", "Option order must be between 1 and 4")
+	if option.OptionOrder < 1 || option.OptionOrder > models.MaxOptions {
+		v.addError("option_order", fmt.Sprintf("Option order must be between 1 and %d", models.MaxOptions))
 	}
 
 	return len(v.errors) == 0
@@ -167,3 +492,39 @@ func isValidDifficulty(difficulty string) bool {
 	}
 	return false
 }
+
+func isValidQuestionType(questionType string) bool {
+	for _, t := range models.ValidQuestionTypes {
+		if t == questionType {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidScoringRule(rule string) bool {
+	for _, r := range models.ValidScoringRules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidCountedAttempt(counts string) bool {
+	for _, c := range models.ValidCountedAttempts {
+		if c == counts {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidLateSubmission(policy string) bool {
+	for _, p := range models.ValidLateSubmissions {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+package validation
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"my-app/internal/models"
+)
+
+func questionWithOptions(questionType string, texts ...string) *models.Question {
+	q := &models.Question{QuestionText: "Q", QuestionType: questionType, Points: 1}
+	for i, text := range texts {
+		q.Options = append(q.Options, models.AnswerOption{OptionText: text, IsCorrect: i == 0, OptionOrder: i + 1})
+	}
+	return q
+}
+
+func TestValidateQuestion_OptionCounts(t *testing.T) {
+	cases := []struct {
+		name  string
+		texts []string
+		valid bool
+	}{
+		{"one option", []string{"a"}, false},
+		{"two options", []string{"a", "b"}, true},
+		{"five options", []string{"a", "b", "c", "d", "e"}, true},
+		{"eight options", []string{"a", "b", "c", "d", "e", "f", "g", "h"}, true},
+		{"nine options", []string{"a", "b", "c", "d", "e", "f", "g", "h", "i"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := NewTestValidator()
+			if got := v.ValidateQuestion(questionWithOptions(models.QuestionTypeSingleChoice, tc.texts...)); got != tc.valid {
+				t.Fatalf("expected valid=%v, got %v (%v)", tc.valid, got, v.GetErrorMessages())
+			}
+		})
+	}
+}
+
+func TestValidateQuestion_TrueFalseNeedsExactlyTwoOptions(t *testing.T) {
+	v := NewTestValidator()
+	if !v.ValidateQuestion(questionWithOptions(models.QuestionTypeTrueFalse, "True", "False")) {
+		t.Fatalf("expected true/false question to be valid: %v", v.GetErrorMessages())
+	}
+
+	v = NewTestValidator()
+	if v.ValidateQuestion(questionWithOptions(models.QuestionTypeTrueFalse, "True", "False", "Maybe")) {
+		t.Fatalf("expected true/false question with three options to be rejected")
+	}
+}
+
+func TestValidateAnswerOption_OrderRange(t *testing.T) {
+	v := NewTestValidator()
+	if !v.ValidateAnswerOption(&models.AnswerOption{OptionText: "a", OptionOrder: models.MaxOptions}) {
+		t.Fatalf("expected option order %d to be valid", models.MaxOptions)
+	}
+	if v.ValidateAnswerOption(&models.AnswerOption{OptionText: "a", OptionOrder: models.MaxOptions + 1}) {
+		t.Fatalf("expected option order %d to be rejected", models.MaxOptions+1)
+	}
+}
+
+func TestValidateQuestion_Numeric(t *testing.T) {
+	zero := 0
+	cases := []struct {
+		name    string
+		numeric *models.NumericAnswer
+		options []string
+		valid   bool
+	}{
+		{"expected value only", &models.NumericAnswer{Expected: 3.5}, nil, true},
+		{"percent tolerance with units", &models.NumericAnswer{Expected: 9.81, Tolerance: 2, ToleranceType: models.TolerancePercent, Units: []string{"m/s^2"}}, nil, true},
+		{"missing answer key", nil, nil, false},
+		{"negative tolerance", &models.NumericAnswer{Expected: 1, Tolerance: -1}, nil, false},
+		{"unknown tolerance type", &models.NumericAnswer{Expected: 1, ToleranceType: "relative"}, nil, false},
+		{"zero sig figs", &models.NumericAnswer{Expected: 1, SigFigs: &zero}, nil, false},
+		{"blank unit", &models.NumericAnswer{Expected: 1, Units: []string{" "}}, nil, false},
+		{"options not allowed", &models.NumericAnswer{Expected: 1}, []string{"a", "b"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := questionWithOptions(models.QuestionTypeNumeric, tc.options...)
+			q.Numeric = tc.numeric
+			v := NewTestValidator()
+			if got := v.ValidateQuestion(q); got != tc.valid {
+				t.Fatalf("expected valid=%v, got %v (%v)", tc.valid, got, v.GetErrorMessages())
+			}
+		})
+	}
+}
+
+func TestValidateQuestion_ShortAnswer(t *testing.T) {
+	cases := []struct {
+		name          string
+		accepted      []models.AcceptedAnswer
+		typoTolerance int
+		valid         bool
+	}{
+		{"literal answer", []models.AcceptedAnswer{{AnswerText: "Paris"}}, 0, true},
+		{"regex with typo tolerance", []models.AcceptedAnswer{{AnswerText: "Paris"}, {AnswerText: "(king )?henry", IsRegex: true}}, 2, true},
+		{"no accepted answers", nil, 0, false},
+		{"blank accepted answer", []models.AcceptedAnswer{{AnswerText: "  "}}, 0, false},
+		{"invalid regex", []models.AcceptedAnswer{{AnswerText: "(", IsRegex: true}}, 0, false},
+		{"typo tolerance too high", []models.AcceptedAnswer{{AnswerText: "Paris"}}, models.MaxTypoTolerance + 1, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q := questionWithOptions(models.QuestionTypeShortAnswer)
+			q.AcceptedAnswers = tc.accepted
+			q.TypoTolerance = tc.typoTolerance
+			v := NewTestValidator()
+			if got := v.ValidateQuestion(q); got != tc.valid {
+				t.Fatalf("expected valid=%v, got %v (%v)", tc.valid, got, v.GetErrorMessages())
+			}
+		})
+	}
+}
+
+func TestValidateQuestion_OrderingAndMatching(t *testing.T) {
+	ordering := questionWithOptions(models.QuestionTypeOrdering, "first", "second", "third")
+	for i := range ordering.Options {
+		ordering.Options[i].IsCorrect = false
+	}
+	v := NewTestValidator()
+	if !v.ValidateQuestion(ordering) {
+		t.Fatalf("expected ordering question to be valid: %v", v.GetErrorMessages())
+	}
+
+	repeated := questionWithOptions(models.QuestionTypeOrdering, "first", "first")
+	v = NewTestValidator()
+	if v.ValidateQuestion(repeated) {
+		t.Fatalf("expected ordering question with repeated items to be rejected")
+	}
+
+	matching := questionWithOptions(models.QuestionTypeMatching, "Heart", "Lungs")
+	matching.Options[0].MatchText = "Pumps blood"
+	matching.Options[1].MatchText = "Exchange gases"
+	v = NewTestValidator()
+	if !v.ValidateQuestion(matching) {
+		t.Fatalf("expected matching question to be valid: %v", v.GetErrorMessages())
+	}
+
+	matching.Options[1].MatchText = ""
+	v = NewTestValidator()
+	if v.ValidateQuestion(matching) {
+		t.Fatalf("expected matching question with a missing match to be rejected")
+	}
+}
+
+func TestValidateQuestion_ExplanationAndRationale(t *testing.T) {
+	q := questionWithOptions(models.QuestionTypeSingleChoice, "4", "5")
+	q.Explanation = "**2 + 2** is 4"
+	q.Options[1].Rationale = "Counted one of the numbers twice"
+	v := NewTestValidator()
+	if !v.ValidateQuestion(q) {
+		t.Fatalf("expected question with an explanation and rationale to be valid: %v", v.GetErrorMessages())
+	}
+
+	q.Explanation = strings.Repeat("x", 5001)
+	v = NewTestValidator()
+	if v.ValidateQuestion(q) || v.GetErrorMessages()["explanation"] == "" {
+		t.Fatalf("expected an overlong explanation to be rejected, got %v", v.GetErrorMessages())
+	}
+
+	q.Explanation = ""
+	q.Options[1].Rationale = strings.Repeat("x", 1001)
+	v = NewTestValidator()
+	if v.ValidateQuestion(q) {
+		t.Fatalf("expected an overlong rationale to be rejected")
+	}
+}
+
+func TestValidatePrerequisites(t *testing.T) {
+	basics, quadratics, topic := 1, 2, 7
+	catalogue := []models.Test{
+		{ID: basics, Title: "Algebra Basics"},
+		{ID: quadratics, Title: "Quadratics", Prerequisites: []models.Prerequisite{{Kind: models.PrerequisitePassed, RequiredTestID: &basics}}},
+		{ID: 3, Title: "Polynomials"},
+	}
+
+	test := &models.Test{ID: 3, Prerequisites: []models.Prerequisite{
+		{Kind: models.PrerequisiteMinScore, RequiredTestID: &quadratics, MinPercent: 70},
+		{Kind: models.PrerequisiteTopicCount, TopicID: &topic, MinCount: 2},
+	}}
+	v := NewTestValidator()
+	if !v.ValidatePrerequisites(test, catalogue) {
+		t.Fatalf("expected a chain of prerequisites to be valid: %v", v.GetErrorMessages())
+	}
+
+	// Basics requiring Quadratics would lock both for good
+	test = &models.Test{ID: basics, Prerequisites: []models.Prerequisite{{Kind: models.PrerequisitePassed, RequiredTestID: &quadratics}}}
+	v = NewTestValidator()
+	if v.ValidatePrerequisites(test, catalogue) || !strings.Contains(v.GetErrorMessages()["prerequisite_1"], "already requires") {
+		t.Fatalf("expected a cycle to be rejected, got %v", v.GetErrorMessages())
+	}
+
+	self := 3
+	test = &models.Test{ID: 3, Prerequisites: []models.Prerequisite{
+		{Kind: models.PrerequisitePassed, RequiredTestID: &self},
+		{Kind: models.PrerequisiteMinScore, RequiredTestID: &basics, MinPercent: 0},
+		{Kind: models.PrerequisiteTopicCount, MinCount: 0},
+		{Kind: "attended"},
+	}}
+	v = NewTestValidator()
+	v.ValidatePrerequisites(test, catalogue)
+	errs := v.GetErrorMessages()
+	for _, field := range []string{"prerequisite_1", "prerequisite_2_percent", "prerequisite_3", "prerequisite_3_count", "prerequisite_4"} {
+		if errs[field] == "" {
+			t.Fatalf("expected %s to be reported, got %v", field, errs)
+		}
+	}
+}
+
+func TestValidateGradeBoundaries(t *testing.T) {
+	v := NewTestValidator()
+	if !v.ValidateGradeBoundaries(models.GradeBoundaries{{Grade: "9", MinPercent: 80}, {Grade: "U", MinPercent: 0}}) {
+		t.Fatalf("expected boundaries to be valid: %v", v.GetErrorMessages())
+	}
+	if !v.ValidateGradeBoundaries(nil) {
+		t.Fatal("expected an empty set to be valid")
+	}
+
+	v.ValidateGradeBoundaries(models.GradeBoundaries{
+		{Grade: "A", MinPercent: 70},
+		{Grade: "A", MinPercent: 60},
+		{Grade: " ", MinPercent: 70},
+		{Grade: "Distinction*", MinPercent: 101},
+		{Grade: "C", MinPercent: math.NaN()},
+	})
+	errs := v.GetErrorMessages()
+	for _, field := range []string{"grade_boundary_2", "grade_boundary_3", "grade_boundary_3_percent", "grade_boundary_4", "grade_boundary_4_percent", "grade_boundary_5_percent"} {
+		if errs[field] == "" {
+			t.Fatalf("expected %s to be reported, got %v", field, errs)
+		}
+	}
+}
@@ -43,3 +43,36 @@ func TestAdminUsersTemplateRenders(t *testing.T) {
 		t.Fatalf("rendered template missing expected content")
 	}
 }
+
+// Ensures the teacher dashboard renders its per-test stats and totals.
+func TestTeacherDashboardTemplateRenders(t *testing.T) {
+	basePath := filepath.Join("..", "..", "views")
+	layout := filepath.Join(basePath, "layout.html")
+	dashboard := filepath.Join(basePath, "teacher_dashboard.html")
+
+	tmpl, err := template.New("").Funcs(template.FuncMap{
+		"add": func(a, b int) int { return a + b },
+	}).ParseFiles(layout, dashboard)
+	if err != nil {
+		t.Fatalf("failed to parse templates: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"Session": nil,
+		"Tests": []models.Test{
+			{ID: 1, Title: "Algebra Basics", Difficulty: "Easy", CreatedAt: time.Now()},
+		},
+		"TestStats": map[int]map[string]interface{}{
+			1: {"total_attempts": 3, "completed_attempts": 2, "average_score": "72.5"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "layout.html", data); err != nil {
+		t.Fatalf("failed to execute template: %v", err)
+	}
+
+	if !bytes.Contains(buf.Bytes(), []byte("72.5%")) {
+		t.Fatalf("rendered template missing the average score")
+	}
+}